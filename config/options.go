@@ -3,12 +3,31 @@ package config
 import (
 	"github.com/nearmap/cvmanager/events"
 	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
 )
 
 // Options contains additional (optional) configuration for the controller
 type Options struct {
 	Stats    stats.Stats
 	Recorder events.Recorder
+
+	// Namespaces restricts operation to the given namespaces. All namespaces
+	// are used if empty.
+	Namespaces []string
+
+	// CVLabelSelector restricts operation to ContainerVersion resources matching
+	// the label selector. All resources are used if empty.
+	CVLabelSelector string
+
+	// InformerStop enables informer backed lookups of workloads when set.
+	// The informers are stopped when the channel is closed.
+	InformerStop <-chan struct{}
+
+	// SyncerArgs are additional arguments of the syncers started by the controller.
+	SyncerArgs []string
+
+	// Tracer records rollouts as traces when set.
+	Tracer *tracing.Tracer
 }
 
 // WithStats applies the stats instance as configuration.
@@ -25,6 +44,41 @@ func WithRecorder(recorder events.Recorder) func(*Options) {
 	}
 }
 
+// WithNamespaces applies the given namespaces as configuration.
+func WithNamespaces(namespaces []string) func(*Options) {
+	return func(opts *Options) {
+		opts.Namespaces = namespaces
+	}
+}
+
+// WithCVLabelSelector applies the given ContainerVersion label selector as configuration.
+func WithCVLabelSelector(selector string) func(*Options) {
+	return func(opts *Options) {
+		opts.CVLabelSelector = selector
+	}
+}
+
+// WithInformers enables informer backed lookups that run until the given channel is closed.
+func WithInformers(stopCh <-chan struct{}) func(*Options) {
+	return func(opts *Options) {
+		opts.InformerStop = stopCh
+	}
+}
+
+// WithSyncerArgs applies the given additional syncer arguments as configuration.
+func WithSyncerArgs(args ...string) func(*Options) {
+	return func(opts *Options) {
+		opts.SyncerArgs = append(opts.SyncerArgs, args...)
+	}
+}
+
+// WithTracer applies the given tracer as configuration.
+func WithTracer(tracer *tracing.Tracer) func(*Options) {
+	return func(opts *Options) {
+		opts.Tracer = tracer
+	}
+}
+
 // NewOptions returns an Options intance with defaults.
 func NewOptions() *Options {
 	return &Options{
@@ -38,5 +92,10 @@ func WithOptions(options *Options) func(*Options) {
 	return func(opts *Options) {
 		opts.Stats = options.Stats
 		opts.Recorder = options.Recorder
+		opts.Namespaces = options.Namespaces
+		opts.CVLabelSelector = options.CVLabelSelector
+		opts.InformerStop = options.InformerStop
+		opts.SyncerArgs = options.SyncerArgs
+		opts.Tracer = options.Tracer
 	}
 }
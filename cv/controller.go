@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	gosync "sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -13,8 +14,8 @@ import (
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
 	scheme "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/scheme"
-	informers "github.com/nearmap/cvmanager/gok8s/client/informers/externalversions"
 	customlister "github.com/nearmap/cvmanager/gok8s/client/listers/custom/v1"
+	"github.com/nearmap/cvmanager/sync"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 	appsv1 "k8s.io/api/apps/v1"
@@ -24,7 +25,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
-	k8sinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	k8sscheme "k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -46,19 +46,27 @@ type CVController struct {
 
 	cvImgRepo string
 
+	// syncerArgs are additional arguments of the syncer deployments.
+	syncerArgs []string
+
 	k8sCS    kubernetes.Interface
 	customCS clientset.Interface
 
-	deployLister v1lister.DeploymentLister
-	deploySynced cache.InformerSynced
-
-	cvcLister customlister.ContainerVersionLister
-	cvcSynced cache.InformerSynced
+	// listers are keyed by the namespace of the informer that provides them,
+	// with an empty namespace covering all namespaces.
+	deployListers map[string]v1lister.DeploymentLister
+	cvcListers    map[string]customlister.ContainerVersionLister
+	synced        []cache.InformerSynced
 
 	queue workqueue.RateLimitingInterface
 
 	recorder record.EventRecorder
 
+	// driftAlerts holds the version that each deployment was last alerted to have drifted
+	// to, keyed by cv and deployment.
+	driftMu     gosync.Mutex
+	driftAlerts map[string]string
+
 	opts *conf.Options
 }
 
@@ -73,8 +81,7 @@ type configKey struct {
 // and thus performing the roll-out if required (using the roll-out strategy specified in deployment.
 func NewCVController(configMapKey, cvImgRepo string,
 	k8sCS kubernetes.Interface, customCS clientset.Interface,
-	k8sIF k8sinformers.SharedInformerFactory, customIF informers.SharedInformerFactory,
-	options ...func(*conf.Options)) (*CVController, error) {
+	infs []*Informers, options ...func(*conf.Options)) (*CVController, error) {
 
 	opts := conf.NewOptions()
 	for _, opt := range options {
@@ -86,9 +93,6 @@ func NewCVController(configMapKey, cvImgRepo string,
 		return nil, errors.Wrap(err, "Invalid configmap key")
 	}
 
-	deploymentInformer := k8sIF.Apps().V1().Deployments()
-	cvcInformer := customIF.Custom().V1().ContainerVersions()
-
 	scheme.AddToScheme(k8sscheme.Scheme)
 
 	eventBroadcaster := record.NewBroadcaster()
@@ -102,53 +106,59 @@ func NewCVController(configMapKey, cvImgRepo string,
 			ns:   namespace,
 		},
 
-		cvImgRepo: cvImgRepo,
+		cvImgRepo:  cvImgRepo,
+		syncerArgs: opts.SyncerArgs,
 
 		k8sCS:    k8sCS,
 		customCS: customCS,
 
-		deployLister: deploymentInformer.Lister(),
-		deploySynced: deploymentInformer.Informer().HasSynced,
+		deployListers: make(map[string]v1lister.DeploymentLister),
+		cvcListers:    make(map[string]customlister.ContainerVersionLister),
 
-		cvcLister: cvcInformer.Lister(),
-		cvcSynced: cvcInformer.Informer().HasSynced,
-
-		queue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ContainerVersions"),
-		recorder: recorder,
-		opts:     opts,
+		queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ContainerVersions"),
+		recorder:    recorder,
+		driftAlerts: make(map[string]string),
+		opts:        opts,
 	}
 
 	glog.V(1).Info("Setting up event handlers in container version controller")
 
-	cvcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: cvc.enqueue,
-		UpdateFunc: func(old, new interface{}) {
-			if !reflect.DeepEqual(old, new) {
-				cvc.enqueue(new)
-			}
-		},
-		DeleteFunc: cvc.dequeueCV,
-	})
-
-	// TODO : We need deploymentInformer to monitor DR sycn deployments specs if they were modified
-	// outside the controller scope. This need some more work as following snippet causes infinite cycle.
-	// Probably checking if state of DR deployment is different than whats specified by CV CRD
-	// but we can worry about it later
-
-	// deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-	// 	AddFunc: cvc.handleCVOwnedObj,
-	// 	UpdateFunc: func(old, new interface{}) {
-	// 		newDepl := new.(*appsv1.Deployment)
-	// 		oldDepl := old.(*appsv1.Deployment)
-	// 		if newDepl.ResourceVersion == oldDepl.ResourceVersion {
-	// 			// Periodic resync will send update events for all known Deployments.
-	// 			// Two different versions of the same Deployment will always have different RVs.
-	// 			return
-	// 		}
-	// 		cvc.handleCVOwnedObj(new)
-	// 	},
-	// 	DeleteFunc: cvc.handleCVOwnedObj,
-	// })
+	for _, inf := range infs {
+		deploymentInformer := inf.K8s.Apps().V1().Deployments()
+		cvcInformer := inf.Custom.Custom().V1().ContainerVersions()
+
+		cvc.deployListers[inf.Namespace] = deploymentInformer.Lister()
+		cvc.cvcListers[inf.Namespace] = cvcInformer.Lister()
+		cvc.synced = append(cvc.synced, deploymentInformer.Informer().HasSynced, cvcInformer.Informer().HasSynced)
+
+		cvcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: cvc.enqueue,
+			UpdateFunc: func(old, new interface{}) {
+				// Annotation-only changes, such as the checkpoints saved by syncers at
+				// every step of a rollout, do not need to be synced.
+				if cvChanged(old.(*cv1.ContainerVersion), new.(*cv1.ContainerVersion)) {
+					cvc.enqueue(new)
+				}
+			},
+			DeleteFunc: cvc.dequeueCV,
+		})
+
+		// Deployment events detect out-of-band changes to both CR sync deployments and
+		// managed workloads. Changes are only written back when the observed state differs
+		// from the desired state, so the resulting events do not cause a reconcile loop.
+		deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: cvc.handleDeployment,
+			UpdateFunc: func(old, new interface{}) {
+				if !specChanged(old.(*appsv1.Deployment), new.(*appsv1.Deployment)) {
+					// Periodic resyncs and status updates during rollouts do not change
+					// the spec, so they cannot cause drift.
+					return
+				}
+				cvc.handleDeployment(new)
+			},
+			DeleteFunc: cvc.handleCVOwnedObj,
+		})
+	}
 
 	return cvc, nil
 }
@@ -160,7 +170,7 @@ func (c *CVController) Run(threadiness int, stopCh <-chan struct{}) error {
 
 	glog.V(1).Info("Starting Container version controller")
 
-	if !cache.WaitForCacheSync(stopCh, c.deploySynced, c.cvcSynced) {
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
 		return errors.New("Fail to wait for (secondary) cache sync")
 	}
 
@@ -213,7 +223,6 @@ func (c *CVController) processNextWorkItem() bool {
 
 		c.queue.Forget(obj)
 		glog.V(1).Infof("Successfully synced '%s'", key)
-		c.opts.Stats.IncCount(fmt.Sprintf("cvc.%s.sync.success", key))
 		return nil
 	}(obj)
 
@@ -237,7 +246,12 @@ func (c *CVController) syncHandler(key string) error {
 		return nil
 	}
 
-	cv, err := c.cvcLister.ContainerVersions(namespace).Get(name)
+	if !c.inScope(namespace) {
+		glog.V(2).Infof("Ignoring cv %s outside of the controller namespaces", key)
+		return nil
+	}
+
+	cv, err := c.cvcLister(namespace).Get(name)
 	if err != nil {
 		if k8serr.IsNotFound(err) {
 			runtime.HandleError(fmt.Errorf("cv '%s' in work queue no longer exists", key))
@@ -247,23 +261,56 @@ func (c *CVController) syncHandler(key string) error {
 
 	version, err := c.fetchVersion()
 	if err != nil {
-		c.opts.Stats.IncCount(fmt.Sprintf("cvc.%s.sync.failure", name), fmt.Sprintf("env:%s", namespace))
+		c.opts.Stats.IncCount("cv_sync_failures_total", "cv:"+name, "namespace:"+namespace)
 		c.recorder.Event(cv, corev1.EventTypeWarning, "FailedCreateCRSync", "Cant find config for CRSync version")
 		return errors.Wrap(err, "Failed to find container version")
 	}
-	if err = c.syncDeployNames(namespace, key, version, cv); err != nil {
-		c.opts.Stats.IncCount(fmt.Sprintf("cvc.%s.sync.failure", name), fmt.Sprintf("env:%s", namespace))
+	changed, err := c.syncDeployNames(namespace, key, version, cv)
+	if err != nil {
+		c.opts.Stats.IncCount("cv_sync_failures_total", "cv:"+name, "namespace:"+namespace)
 		return errors.Wrap(err, "Failed to sync deployment")
 	}
+	if err = c.checkDrift(cv); err != nil {
+		c.opts.Stats.IncCount("cv_sync_failures_total", "cv:"+name, "namespace:"+namespace)
+		return errors.Wrap(err, "Failed to check workload drift")
+	}
 
 	if glog.V(2) {
 		glog.V(2).Infof("In sync handler of CVC for key=%s, namespace=%v, cv=%v, name=%v", key, namespace, cv, name)
 	}
 
-	c.recorder.Event(cv, corev1.EventTypeNormal, "Synced", "Sync of CV resource was successful")
+	c.opts.Stats.IncCount("cv_syncs_total", "cv:"+name, "namespace:"+namespace)
+	if changed {
+		c.recorder.Event(cv, corev1.EventTypeNormal, "Synced", "Sync of CV resource was successful")
+	}
 	return nil
 }
 
+// inScope returns true if the given namespace is watched by this controller.
+func (c *CVController) inScope(namespace string) bool {
+	if _, ok := c.cvcListers[metav1.NamespaceAll]; ok {
+		return true
+	}
+	_, ok := c.cvcListers[namespace]
+	return ok
+}
+
+// cvcLister returns the ContainerVersion lister for the given namespace, which must be in scope.
+func (c *CVController) cvcLister(namespace string) customlister.ContainerVersionNamespaceLister {
+	if lister, ok := c.cvcListers[namespace]; ok {
+		return lister.ContainerVersions(namespace)
+	}
+	return c.cvcListers[metav1.NamespaceAll].ContainerVersions(namespace)
+}
+
+// deployLister returns the Deployment lister for the given namespace, which must be in scope.
+func (c *CVController) deployLister(namespace string) v1lister.DeploymentNamespaceLister {
+	if lister, ok := c.deployListers[namespace]; ok {
+		return lister.Deployments(namespace)
+	}
+	return c.deployListers[metav1.NamespaceAll].Deployments(namespace)
+}
+
 // enqueue takes a CV resource and converts it into a namespace/name
 // string which is then put onto the work queue. This method should *not* be
 // passed resources of any type other than CV.
@@ -275,6 +322,12 @@ func (c *CVController) enqueue(obj interface{}) {
 		return
 	}
 
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || !c.inScope(namespace) {
+		glog.V(4).Infof("Ignoring cv outside of the controller namespaces: name=%s", key)
+		return
+	}
+
 	glog.V(4).Infof("Queued cv for processing: name=%s", key)
 
 	c.queue.AddRateLimited(key)
@@ -341,7 +394,11 @@ func (c *CVController) handleCVOwnedObj(obj interface{}) {
 			return
 		}
 
-		cv, err := c.cvcLister.ContainerVersions(object.GetNamespace()).Get(ownerRef.Name)
+		if !c.inScope(object.GetNamespace()) {
+			return
+		}
+
+		cv, err := c.cvcLister(object.GetNamespace()).Get(ownerRef.Name)
 		if err != nil {
 			glog.V(2).Infof("ignoring orphaned object '%s' of CV'%s'", object.GetSelfLink(), ownerRef.Name)
 			return
@@ -353,27 +410,83 @@ func (c *CVController) handleCVOwnedObj(obj interface{}) {
 
 // syncDeployNames sync the deployment referenced by CV resource - creates if absent and updates if required
 // The synce deployments are automatically updated when controller is updated so the syncers do not need CV
-// resource or auto update mechanism
-func (c *CVController) syncDeployNames(namespace, key, version string, cv *cv1.ContainerVersion) error {
-	_, err := c.deployLister.Deployments(namespace).Get(syncDeployName(cv.Name))
+// resource or auto update mechanism. Returns true if the deployment was created or updated.
+func (c *CVController) syncDeployNames(namespace, key, version string, cv *cv1.ContainerVersion) (bool, error) {
+	existing, err := c.deployLister(namespace).Get(syncDeployName(cv.Name))
 	if err != nil {
 		if k8serr.IsNotFound(err) {
 			_, err = c.k8sCS.AppsV1().Deployments(namespace).Create(c.newCRSyncDeployment(cv, version))
 			if err != nil {
 				c.recorder.Event(cv, corev1.EventTypeWarning, "FailedCreateCRSync", "Failed to create DR Sync deployment")
-				return errors.Wrapf(err, "Failed to create DR Sync deployment %s", key)
+				return false, errors.Wrapf(err, "Failed to create DR Sync deployment %s", key)
 			}
-			return nil
+			return true, nil
 		}
-		return errors.Wrapf(err, "Failed to find DR Sync deployment %s", key)
+		return false, errors.Wrapf(err, "Failed to find DR Sync deployment %s", key)
+	}
+
+	desired := c.newCRSyncDeployment(cv, version)
+	if !crSyncDrifted(existing, desired) {
+		glog.V(4).Infof("DR Sync deployment %s is up to date", key)
+		return false, nil
 	}
 
-	_, err = c.k8sCS.AppsV1().Deployments(namespace).Update(c.newCRSyncDeployment(cv, version))
+	glog.V(2).Infof("Updating DR Sync deployment %s", key)
+	_, err = c.k8sCS.AppsV1().Deployments(namespace).Update(desired)
 	if err != nil {
 		c.recorder.Event(cv, corev1.EventTypeWarning, "FailedUpdateCRSync", "Failed to update DR Sync deployment")
-		return errors.Wrapf(err, "Failed to update DR Sync deployment %s", key)
+		return false, errors.Wrapf(err, "Failed to update DR Sync deployment %s", key)
 	}
-	return nil
+	return true, nil
+}
+
+// cvChanged returns true if the labels, spec or status of the cv changed between the
+// given versions.
+func cvChanged(old, new *cv1.ContainerVersion) bool {
+	return !reflect.DeepEqual(old.Labels, new.Labels) || !reflect.DeepEqual(old.Spec, new.Spec) ||
+		!reflect.DeepEqual(old.Status, new.Status)
+}
+
+// specChanged returns true if the spec of the deployment changed between the given
+// versions, as opposed to its status or metadata.
+func specChanged(old, new *appsv1.Deployment) bool {
+	if old.ResourceVersion == new.ResourceVersion {
+		return false
+	}
+	return old.Generation != new.Generation || !reflect.DeepEqual(old.Spec.Template, new.Spec.Template)
+}
+
+// crSyncDrifted returns true if the existing CR sync deployment differs from the desired
+// deployment in any of the fields set by the controller. Fields that are defaulted by the
+// API server are ignored.
+func crSyncDrifted(existing, desired *appsv1.Deployment) bool {
+	if existing.Spec.Replicas == nil || *existing.Spec.Replicas != *desired.Spec.Replicas {
+		return true
+	}
+	if !reflect.DeepEqual(existing.Spec.Template.Labels, desired.Spec.Template.Labels) {
+		return true
+	}
+
+	ec := existing.Spec.Template.Spec.Containers
+	dc := desired.Spec.Template.Spec.Containers
+	if len(ec) != len(dc) {
+		return true
+	}
+	for i := range dc {
+		if ec[i].Name != dc[i].Name || ec[i].Image != dc[i].Image || !reflect.DeepEqual(ec[i].Args, dc[i].Args) {
+			return true
+		}
+		if (ec[i].LivenessProbe == nil) != (dc[i].LivenessProbe == nil) {
+			return true
+		}
+		if dc[i].LivenessProbe != nil {
+			ep, dp := ec[i].LivenessProbe, dc[i].LivenessProbe
+			if ep.PeriodSeconds != dp.PeriodSeconds || ep.Exec == nil || !reflect.DeepEqual(ep.Exec.Command, dp.Exec.Command) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // newCRSyncDeployment creates a new Deployment for a ContainerVersion resource. It also sets
@@ -388,10 +501,7 @@ func (c *CVController) newCRSyncDeployment(cv *cv1.ContainerVersion, version str
 		livenessSeconds = 5 * 60
 	}
 
-	labels := map[string]string{
-		"app":        "cr-syncer",
-		"controller": cv.Name,
-	}
+	labels := syncDeployLabels(cv.Name)
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      dName,
@@ -421,15 +531,22 @@ func (c *CVController) newCRSyncDeployment(cv *cv1.ContainerVersion, version str
 						{
 							Name:  fmt.Sprintf("%s-container", dName),
 							Image: fmt.Sprintf("%s:%s", c.cvImgRepo, version),
-							Args: []string{
+							Args: append([]string{
 								"cr",
 								"sync",
 								fmt.Sprintf("--namespace=%s", cv.Namespace),
 								fmt.Sprintf("--cv=%s", cv.Name),
 								fmt.Sprintf("--version=%s", specVersion(cv)),
+								fmt.Sprintf("--port=%d", sync.DefaultPort),
 								fmt.Sprintf("--logtostderr=true"),
 								fmt.Sprintf("--v=%d", glogVerbosity),
 								fmt.Sprintf("--vmodule=%s", glogVmodule),
+							}, c.syncerArgs...),
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "http",
+									ContainerPort: int32(sync.DefaultPort),
+								},
 							},
 							Env: []corev1.EnvVar{
 								{
@@ -495,6 +612,14 @@ func syncDeployName(cvName string) string {
 	return fmt.Sprintf("crsync-%s", cvName)
 }
 
+// syncDeployLabels returns the labels of the syncer deployment of the named cv and its pods.
+func syncDeployLabels(cvName string) map[string]string {
+	return map[string]string{
+		"app":        "cr-syncer",
+		"controller": cvName,
+	}
+}
+
 // fetchVersion gets container version from config map as specified in configMapKey
 func (c *CVController) fetchVersion() (string, error) {
 	cm, err := c.k8sCS.CoreV1().ConfigMaps(c.config.ns).Get(c.config.name, metav1.GetOptions{})
@@ -0,0 +1,234 @@
+package cv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/deploy"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/sync"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/util/retry"
+)
+
+// handleDeployment enqueues the ContainerVersion resources that own or select the given
+// deployment so that they are checked for drift.
+func (c *CVController) handleDeployment(obj interface{}) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("error decoding deployment, invalid type"))
+		return
+	}
+
+	if metav1.GetControllerOf(deployment) != nil {
+		c.handleCVOwnedObj(deployment)
+		return
+	}
+
+	if !c.inScope(deployment.Namespace) {
+		return
+	}
+
+	cvs, err := c.cvcLister(deployment.Namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Failed to list cvs for deployment %s/%s: %v", deployment.Namespace, deployment.Name, err)
+		return
+	}
+	for _, cv := range cvs {
+		if len(cv.Spec.Selector) == 0 {
+			continue
+		}
+		if labels.Set(cv.Spec.Selector).AsSelector().Matches(labels.Set(deployment.Labels)) {
+			glog.V(4).Infof("Deployment %s/%s is managed by cv %s", deployment.Namespace, deployment.Name, cv.Name)
+			c.enqueue(cv)
+		}
+	}
+}
+
+// checkDrift compares the deployments managed by the given cv against its current version
+// and handles any that have been changed out-of-band according to the cv's drift policy.
+// Drift is only checked once a rollout has completed successfully.
+func (c *CVController) checkDrift(cv *cv1.ContainerVersion) error {
+	if cv.Status.CurrStatus != k8s.StatusSuccess || cv.Status.CurrVersion == "" {
+		return nil
+	}
+	if cv.Spec.Strategy != nil && cv.Spec.Strategy.Kind == deploy.KindServieBlueGreen {
+		// blue-green rollouts intentionally run workloads at different versions
+		return nil
+	}
+	if len(cv.Spec.Selector) == 0 || !managesKind(cv, k8s.TypeDeployment) {
+		return nil
+	}
+
+	deployments, err := c.deployLister(cv.Namespace).List(labels.Set(cv.Spec.Selector).AsSelector())
+	if err != nil {
+		return errors.Wrapf(err, "failed to list deployments for cv %s", cv.Name)
+	}
+
+	var latest *cv1.ContainerVersion
+	for _, deployment := range deployments {
+		if metav1.GetControllerOf(deployment) != nil {
+			continue
+		}
+
+		version, ok := containerVersion(cv, deployment.Spec.Template.Spec)
+		if !ok || version == cv.Status.CurrVersion {
+			c.clearDriftAlert(cv, deployment.Name)
+			continue
+		}
+
+		// The lister may lag behind a rollout that has just started, in which case the
+		// deployment is at the version being rolled out rather than drifted.
+		if latest == nil {
+			if latest, err = c.customCS.CustomV1().ContainerVersions(cv.Namespace).Get(cv.Name, metav1.GetOptions{}); err != nil {
+				return errors.Wrapf(err, "failed to get cv %s", cv.Name)
+			}
+			if !settled(latest, cv.Status.CurrVersion) {
+				glog.V(2).Infof("Not checking drift of cv %s/%s while a rollout is in progress", cv.Namespace, cv.Name)
+				return nil
+			}
+		}
+
+		glog.V(1).Infof("Detected drift of deployment %s/%s: version=%s, cv=%s, currVersion=%s, policy=%s",
+			deployment.Namespace, deployment.Name, version, cv.Name, cv.Status.CurrVersion, cv.Spec.DriftPolicy)
+		c.opts.Stats.IncCount("workload_drift_total", "cv:"+cv.Name, "namespace:"+cv.Namespace)
+
+		switch cv.Spec.DriftPolicy {
+		case cv1.DriftPolicyAlert:
+			if !c.alertDrift(cv, deployment.Name, version) {
+				continue
+			}
+			c.recorder.Eventf(cv, corev1.EventTypeWarning, "WorkloadDrift",
+				"Deployment %s is at version %s but expected %s", deployment.Name, version, cv.Status.CurrVersion)
+
+		case cv1.DriftPolicyAdopt:
+			if err := c.adoptVersion(cv, version); err != nil {
+				return errors.WithStack(err)
+			}
+			c.recorder.Eventf(cv, corev1.EventTypeNormal, "WorkloadDriftAdopted",
+				"Adopted version %s of deployment %s", version, deployment.Name)
+			return nil
+
+		default:
+			if err := c.revertDeployment(cv, deployment.DeepCopy()); err != nil {
+				c.recorder.Eventf(cv, corev1.EventTypeWarning, "WorkloadDriftRevertFailed",
+					"Failed to revert deployment %s to version %s", deployment.Name, cv.Status.CurrVersion)
+				return errors.WithStack(err)
+			}
+			c.recorder.Eventf(cv, corev1.EventTypeNormal, "WorkloadDriftReverted",
+				"Reverted deployment %s from version %s to %s", deployment.Name, version, cv.Status.CurrVersion)
+		}
+	}
+
+	return nil
+}
+
+// settled returns true if the given cv, as read from the API, completed a rollout of the
+// given version and has no rollout in progress.
+func settled(cv *cv1.ContainerVersion, version string) bool {
+	return cv.Status.CurrStatus == k8s.StatusSuccess && cv.Status.CurrVersion == version &&
+		cv.Annotations[sync.CheckpointAnnotation] == ""
+}
+
+// alertDrift records that the given deployment of the cv drifted to the given version, and
+// returns true if the drift to this version has not been alerted yet.
+func (c *CVController) alertDrift(cv *cv1.ContainerVersion, deployment, version string) bool {
+	key := cv.Namespace + "/" + cv.Name + "/" + deployment
+
+	c.driftMu.Lock()
+	defer c.driftMu.Unlock()
+	if c.driftAlerts[key] == version {
+		return false
+	}
+	c.driftAlerts[key] = version
+	return true
+}
+
+// clearDriftAlert forgets any drift alerted for the given deployment of the cv, so that it
+// is alerted again if the deployment drifts once more.
+func (c *CVController) clearDriftAlert(cv *cv1.ContainerVersion, deployment string) {
+	c.driftMu.Lock()
+	defer c.driftMu.Unlock()
+	delete(c.driftAlerts, cv.Namespace+"/"+cv.Name+"/"+deployment)
+}
+
+// revertDeployment patches the cv's containers of the given deployment back to the cv's current version.
+func (c *CVController) revertDeployment(cv *cv1.ContainerVersion, deployment *appsv1.Deployment) error {
+	wl := k8s.NewDeployment(c.k8sCS, deployment.Namespace, deployment)
+
+	containers, err := k8s.Containers(cv, wl.PodSpec())
+	if err != nil {
+		return errors.Wrapf(err, "failed to revert deployment %s", deployment.Name)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := wl.PatchPodSpec(k8s.VersionImages(containers, cv.Status.CurrVersion)); err != nil {
+			return errors.Wrapf(err, "failed to revert deployment %s", deployment.Name)
+		}
+		return nil
+	})
+}
+
+// adoptVersion updates the status of the cv so that the given out-of-band version becomes its current version.
+func (c *CVController) adoptVersion(cv *cv1.ContainerVersion, version string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		client := c.customCS.CustomV1().ContainerVersions(cv.Namespace)
+		latest, err := client.Get(cv.Name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get cv %s", cv.Name)
+		}
+
+		if latest.Status.AdoptedFrom == "" {
+			latest.Status.AdoptedFrom = latest.Status.CurrVersion
+		}
+		latest.Status.CurrVersion = version
+		latest.Status.SuccessVersion = version
+		latest.Status.CurrStatusTime = metav1.NewTime(time.Now().UTC())
+
+		_, err = client.Update(latest)
+		return err
+	})
+}
+
+// managesKind returns true if the cv manages workloads of the given kind.
+func managesKind(cv *cv1.ContainerVersion, kind string) bool {
+	if len(cv.Spec.WorkloadKinds) == 0 {
+		return true
+	}
+	for _, k := range cv.Spec.WorkloadKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// containerVersion returns the version of the cv's containers in the given pod spec. If the
+// containers are at different versions, a version other than the cv's current version is returned.
+// Returns false if a container is not present or does not use its repository.
+func containerVersion(cv *cv1.ContainerVersion, podSpec corev1.PodSpec) (string, bool) {
+	containers, err := k8s.Containers(cv, podSpec)
+	if err != nil {
+		return "", false
+	}
+
+	var version string
+	for _, container := range containers {
+		parts := strings.SplitN(container.Image, ":", 2)
+		if len(parts) != 2 || parts[0] != container.ImageRepo {
+			return "", false
+		}
+		if version == "" || version == cv.Status.CurrVersion {
+			version = parts[1]
+		}
+	}
+	return version, true
+}
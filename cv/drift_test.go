@@ -0,0 +1,265 @@
+package cv
+
+import (
+	"testing"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/sync"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCRSyncDrifted(t *testing.T) {
+	c := &CVController{cvImgRepo: "nearmap/cvmanager"}
+	cv := &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cv", Namespace: "test-ns"},
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "nearmap/test",
+			Tag:       "dev",
+		},
+	}
+
+	desired := c.newCRSyncDeployment(cv, "v1")
+
+	// simulate fields defaulted by the API server
+	defaulted := desired.DeepCopy()
+	defaulted.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	defaulted.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	defaulted.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.FieldRef.APIVersion = "v1"
+	defaulted.Spec.Template.Spec.Containers[0].LivenessProbe.SuccessThreshold = 1
+
+	image := desired.DeepCopy()
+	image.Spec.Template.Spec.Containers[0].Image = "nearmap/cvmanager:v0"
+
+	replicas := desired.DeepCopy()
+	nr := int32(2)
+	replicas.Spec.Replicas = &nr
+
+	args := desired.DeepCopy()
+	args.Spec.Template.Spec.Containers[0].Args = args.Spec.Template.Spec.Containers[0].Args[1:]
+
+	var tests = []struct {
+		message  string
+		existing *appsv1.Deployment
+		expected bool
+	}{
+		{"identical", desired.DeepCopy(), false},
+		{"server defaults", defaulted, false},
+		{"image changed", image, true},
+		{"replicas changed", replicas, true},
+		{"args changed", args, true},
+	}
+
+	for _, test := range tests {
+		if result := crSyncDrifted(test.existing, desired); result != test.expected {
+			t.Errorf("%s: expected drifted=%v, got %v", test.message, test.expected, result)
+		}
+	}
+}
+
+func TestSpecChanged(t *testing.T) {
+	old := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", ResourceVersion: "1", Generation: 1},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nearmap/app:abc"}}},
+			},
+		},
+	}
+
+	resync := old.DeepCopy()
+
+	status := old.DeepCopy()
+	status.ResourceVersion = "2"
+	status.Status.UpdatedReplicas = 2
+
+	generation := old.DeepCopy()
+	generation.ResourceVersion = "2"
+	generation.Generation = 2
+
+	image := old.DeepCopy()
+	image.ResourceVersion = "2"
+	image.Spec.Template.Spec.Containers[0].Image = "nearmap/app:def"
+
+	var tests = []struct {
+		message  string
+		new      *appsv1.Deployment
+		expected bool
+	}{
+		{"resync", resync, false},
+		{"status update", status, false},
+		{"new generation", generation, true},
+		{"pod template changed", image, true},
+	}
+
+	for _, test := range tests {
+		if result := specChanged(old, test.new); result != test.expected {
+			t.Errorf("%s: expected changed=%v, got %v", test.message, test.expected, result)
+		}
+	}
+}
+
+func TestCVChanged(t *testing.T) {
+	old := &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cv", ResourceVersion: "1", Labels: map[string]string{"team": "a"}},
+		Spec:       cv1.ContainerVersionSpec{ImageRepo: "nearmap/app", Tag: "dev"},
+		Status:     cv1.ContainerVersionStatus{CurrVersion: "abc"},
+	}
+
+	checkpoint := old.DeepCopy()
+	checkpoint.ResourceVersion = "2"
+	checkpoint.Annotations = map[string]string{sync.CheckpointAnnotation: `{"id":"def"}`}
+
+	labels := old.DeepCopy()
+	labels.Labels["team"] = "b"
+
+	spec := old.DeepCopy()
+	spec.Spec.Tag = "prod"
+
+	status := old.DeepCopy()
+	status.Status.CurrVersion = "def"
+
+	var tests = []struct {
+		message  string
+		new      *cv1.ContainerVersion
+		expected bool
+	}{
+		{"annotations changed", checkpoint, false},
+		{"labels changed", labels, true},
+		{"spec changed", spec, true},
+		{"status changed", status, true},
+	}
+
+	for _, test := range tests {
+		if result := cvChanged(old, test.new); result != test.expected {
+			t.Errorf("%s: expected changed=%v, got %v", test.message, test.expected, result)
+		}
+	}
+}
+
+func TestContainerVersion(t *testing.T) {
+	cv := &cv1.ContainerVersion{
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "nearmap/test",
+			Container: cv1.ContainerSpec{Name: "app"},
+		},
+	}
+
+	var tests = []struct {
+		message    string
+		containers []corev1.Container
+		version    string
+		ok         bool
+	}{
+		{"matching container", []corev1.Container{{Name: "app", Image: "nearmap/test:abc"}}, "abc", true},
+		{"other repository", []corev1.Container{{Name: "app", Image: "nearmap/other:abc"}}, "", false},
+		{"no tag", []corev1.Container{{Name: "app", Image: "nearmap/test"}}, "", false},
+		{"no container", []corev1.Container{{Name: "sidecar", Image: "nearmap/test:abc"}}, "", false},
+	}
+
+	for _, test := range tests {
+		version, ok := containerVersion(cv, corev1.PodSpec{Containers: test.containers})
+		if version != test.version || ok != test.ok {
+			t.Errorf("%s: expected (%s, %v), got (%s, %v)", test.message, test.version, test.ok, version, ok)
+		}
+	}
+}
+
+func TestContainerVersionContainers(t *testing.T) {
+	cv := &cv1.ContainerVersion{
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "nearmap/test",
+			Container: cv1.ContainerSpec{Name: "app"},
+			Containers: []cv1.ContainerRef{
+				{Name: "sidecar", ImageRepo: "nearmap/sidecar"},
+				{Name: "migrate"},
+			},
+		},
+		Status: cv1.ContainerVersionStatus{CurrVersion: "abc"},
+	}
+	init := []corev1.Container{{Name: "migrate", Image: "nearmap/test:abc"}}
+
+	var tests = []struct {
+		message        string
+		containers     []corev1.Container
+		initContainers []corev1.Container
+		version        string
+		ok             bool
+	}{
+		{"current version", []corev1.Container{
+			{Name: "app", Image: "nearmap/test:abc"}, {Name: "sidecar", Image: "nearmap/sidecar:abc"},
+		}, init, "abc", true},
+		{"drifted sidecar", []corev1.Container{
+			{Name: "app", Image: "nearmap/test:abc"}, {Name: "sidecar", Image: "nearmap/sidecar:def"},
+		}, init, "def", true},
+		{"drifted init container", []corev1.Container{
+			{Name: "app", Image: "nearmap/test:abc"}, {Name: "sidecar", Image: "nearmap/sidecar:abc"},
+		}, []corev1.Container{{Name: "migrate", Image: "nearmap/test:def"}}, "def", true},
+		{"sidecar from app repository", []corev1.Container{
+			{Name: "app", Image: "nearmap/test:abc"}, {Name: "sidecar", Image: "nearmap/test:abc"},
+		}, init, "", false},
+		{"no init container", []corev1.Container{
+			{Name: "app", Image: "nearmap/test:abc"}, {Name: "sidecar", Image: "nearmap/sidecar:abc"},
+		}, nil, "", false},
+	}
+
+	for _, test := range tests {
+		podSpec := corev1.PodSpec{Containers: test.containers, InitContainers: test.initContainers}
+		version, ok := containerVersion(cv, podSpec)
+		if version != test.version || ok != test.ok {
+			t.Errorf("%s: expected (%s, %v), got (%s, %v)", test.message, test.version, test.ok, version, ok)
+		}
+	}
+}
+
+func TestSettled(t *testing.T) {
+	succeeded := cv1.ContainerVersionStatus{CurrStatus: k8s.StatusSuccess, CurrVersion: "abc"}
+
+	var tests = []struct {
+		message     string
+		status      cv1.ContainerVersionStatus
+		annotations map[string]string
+		expected    bool
+	}{
+		{"succeeded", succeeded, nil, true},
+		{"cleared checkpoint", succeeded, map[string]string{sync.CheckpointAnnotation: ""}, true},
+		{"checkpoint", succeeded, map[string]string{sync.CheckpointAnnotation: `{"id":"def"}`}, false},
+		{"new version", cv1.ContainerVersionStatus{CurrStatus: k8s.StatusSuccess, CurrVersion: "def"}, nil, false},
+		{"progressing", cv1.ContainerVersionStatus{CurrStatus: k8s.StatusProgressing, CurrVersion: "abc"}, nil, false},
+	}
+
+	for _, test := range tests {
+		cv := &cv1.ContainerVersion{
+			ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations},
+			Status:     test.status,
+		}
+		if result := settled(cv, "abc"); result != test.expected {
+			t.Errorf("%s: expected settled=%v, got %v", test.message, test.expected, result)
+		}
+	}
+}
+
+func TestAlertDrift(t *testing.T) {
+	c := &CVController{driftAlerts: make(map[string]string)}
+	cv := &cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "test-cv", Namespace: "test-ns"}}
+
+	if !c.alertDrift(cv, "app", "def") {
+		t.Errorf("Expected first drift to be alerted")
+	}
+	if c.alertDrift(cv, "app", "def") {
+		t.Errorf("Expected repeated drift not to be alerted")
+	}
+	if !c.alertDrift(cv, "app", "ghi") {
+		t.Errorf("Expected drift to another version to be alerted")
+	}
+	if !c.alertDrift(cv, "worker", "ghi") {
+		t.Errorf("Expected drift of another deployment to be alerted")
+	}
+
+	c.clearDriftAlert(cv, "app")
+	if !c.alertDrift(cv, "app", "ghi") {
+		t.Errorf("Expected drift after clearing to be alerted")
+	}
+}
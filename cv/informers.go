@@ -0,0 +1,59 @@
+package cv
+
+import (
+	"time"
+
+	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
+	informers "github.com/nearmap/cvmanager/gok8s/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Informers holds the shared informer factories used by the controller for a
+// single namespace. An empty namespace covers all namespaces.
+type Informers struct {
+	Namespace string
+
+	K8s    k8sinformers.SharedInformerFactory
+	Custom informers.SharedInformerFactory
+
+	// Promotions watches Promotion resources, which are not restricted by the
+	// ContainerVersion label selector.
+	Promotions informers.SharedInformerFactory
+}
+
+// NewInformers returns informer factories for each of the given namespaces, or a single
+// cluster wide set of factories if no namespaces are given. ContainerVersion informers
+// only watch resources that match the given label selector.
+func NewInformers(k8sCS kubernetes.Interface, customCS clientset.Interface, resync time.Duration,
+	namespaces []string, cvLabelSelector string) []*Informers {
+
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	cvTweak := func(opts *metav1.ListOptions) {
+		opts.LabelSelector = cvLabelSelector
+	}
+
+	var result []*Informers
+	for _, ns := range namespaces {
+		result = append(result, &Informers{
+			Namespace:  ns,
+			K8s:        k8sinformers.NewFilteredSharedInformerFactory(k8sCS, resync, ns, nil),
+			Custom:     informers.NewFilteredSharedInformerFactory(customCS, resync, ns, cvTweak),
+			Promotions: informers.NewFilteredSharedInformerFactory(customCS, resync, ns, nil),
+		})
+	}
+	return result
+}
+
+// StartInformers starts all of the given informer factories.
+func StartInformers(infs []*Informers, stopCh <-chan struct{}) {
+	for _, inf := range infs {
+		inf.K8s.Start(stopCh)
+		inf.Custom.Start(stopCh)
+		inf.Promotions.Start(stopCh)
+	}
+}
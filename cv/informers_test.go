@@ -0,0 +1,69 @@
+package cv
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	customfake "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNewInformers(t *testing.T) {
+	customCS := customfake.NewSimpleClientset(
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a", Labels: map[string]string{"team": "a"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team-a", Labels: map[string]string{"team": "b"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-b", Labels: map[string]string{"team": "a"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-c", Labels: map[string]string{"team": "a"}}},
+	)
+
+	var tests = []struct {
+		message    string
+		namespaces []string
+		selector   string
+		expected   []string
+	}{
+		{"all namespaces", nil, "", []string{"/team-a/app,team-a/other,team-b/app,team-c/app"}},
+		{"label selector", nil, "team=a", []string{"/team-a/app,team-b/app,team-c/app"}},
+		{"namespaces", []string{"team-a", "team-b"}, "", []string{"team-a/team-a/app,team-a/other", "team-b/team-b/app"}},
+		{"namespaces and label selector", []string{"team-a", "team-b"}, "team=a", []string{"team-a/team-a/app", "team-b/team-b/app"}},
+	}
+
+	for _, test := range tests {
+		stopCh := make(chan struct{})
+		infs := NewInformers(fake.NewSimpleClientset(), customCS, 0, test.namespaces, test.selector)
+
+		var synced []cache.InformerSynced
+		for _, inf := range infs {
+			synced = append(synced, inf.Custom.Custom().V1().ContainerVersions().Informer().HasSynced)
+		}
+		StartInformers(infs, stopCh)
+		if !cache.WaitForCacheSync(stopCh, synced...) {
+			t.Fatalf("%s: failed to sync informers", test.message)
+		}
+
+		// each informer lists the cvs that it watches, prefixed by its namespace
+		var watched []string
+		for _, inf := range infs {
+			cvs, err := inf.Custom.Custom().V1().ContainerVersions().Lister().List(labels.Everything())
+			if err != nil {
+				t.Fatalf("%s: failed to list cvs: %v", test.message, err)
+			}
+			var names []string
+			for _, cv := range cvs {
+				names = append(names, cv.Namespace+"/"+cv.Name)
+			}
+			sort.Strings(names)
+			watched = append(watched, inf.Namespace+"/"+strings.Join(names, ","))
+		}
+		close(stopCh)
+
+		if strings.Join(watched, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%s: expected informers to watch %v, got %v", test.message, test.expected, watched)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package cv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/sync"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SyncerOperations returns the operations of the syncer of the named cv, obtained from
+// the syncer pod via the Kubernetes API server proxy.
+func SyncerOperations(cs kubernetes.Interface, namespace, cvName string) ([]state.Operation, error) {
+	pods, err := cs.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: labels.Set(syncDeployLabels(cvName)).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list syncer pods of cv %s", cvName)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		data, err := cs.CoreV1().RESTClient().Get().
+			Namespace(namespace).
+			Resource("pods").
+			Name(fmt.Sprintf("%s:%d", pod.Name, sync.DefaultPort)).
+			SubResource("proxy").
+			Suffix(sync.OperationsPath).
+			DoRaw()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get operations from syncer pod %s", pod.Name)
+		}
+
+		var ops []state.Operation
+		if err := json.Unmarshal(data, &ops); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode operations from syncer pod %s", pod.Name)
+		}
+		return ops, nil
+	}
+
+	return nil, k8serr.NewNotFound(corev1.Resource("pods"), syncDeployName(cvName))
+}
+
+// WriteOperations writes a human readable summary of the given operations.
+func WriteOperations(w io.Writer, ops []state.Operation, now time.Time) {
+	for _, op := range ops {
+		if op.Started.IsZero() {
+			next := "now"
+			if len(op.States) > 0 && op.States[0].NextRun.After(now) {
+				next = fmt.Sprintf("in %s", op.States[0].NextRun.Sub(now).Round(time.Second))
+			}
+			fmt.Fprintf(w, "Next sync %s\n", next)
+			continue
+		}
+
+		fmt.Fprintf(w, "Operation %s (running for %s)\n", op.ID, now.Sub(op.Started).Round(time.Second))
+		if op.Message != "" {
+			fmt.Fprintf(w, "  %s\n", op.Message)
+		}
+		for _, st := range op.States {
+			var details []string
+			if st.Executing {
+				details = append(details, "executing")
+			} else if st.NextRun.After(now) {
+				details = append(details, fmt.Sprintf("next run in %s", st.NextRun.Sub(now).Round(time.Second)))
+			}
+			if st.Retries > 0 {
+				details = append(details, fmt.Sprintf("%d retries", st.Retries))
+			}
+			fmt.Fprintf(w, "  - %s", st.State)
+			if len(details) > 0 {
+				fmt.Fprintf(w, " (%s)", strings.Join(details, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// NewOperationsHandler is web handler to return the operations of the syncer of a cv as json.
+// ContainerVersions outside the namespaces and label selector of the provider are not found.
+func NewOperationsHandler(k8sProvider *k8s.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := pat.Param(r, "name")
+		ns := r.URL.Query().Get("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+		if !k8sProvider.WatchesNamespace(ns) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		provider := k8sProvider.InNamespace(ns)
+		ops, err := func() ([]state.Operation, error) {
+			cv, err := provider.CV(name)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			ok, err := provider.InScope(cv)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if !ok {
+				return nil, k8serr.NewNotFound(cv1.Resource("containerversion"), name)
+			}
+			return SyncerOperations(provider.Client(), ns, name)
+		}()
+		if err != nil {
+			glog.Errorf("Failed to get operations of cv %s/%s: %v", ns, name, err)
+			if k8serr.IsNotFound(errors.Cause(err)) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		data, err := json.Marshal(ops)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
@@ -0,0 +1,89 @@
+package cv
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/config"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	customfake "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/state"
+	goji "goji.io"
+	"goji.io/pat"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWriteOperations(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	ops := []state.Operation{
+		{
+			ID:      "abc",
+			Started: now.Add(-2 * time.Minute),
+			Message: "waiting for pods on secondary (3/5 ready)",
+			States: []state.OperationState{
+				{State: "secondary.bluegreen.ensureHasPods", Retries: 1, NextRun: now.Add(15 * time.Second)},
+			},
+		},
+		{
+			ID: "def",
+			States: []state.OperationState{
+				{State: "sync.(*Syncer).initialState.func1", NextRun: now.Add(5 * time.Minute)},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	WriteOperations(&buf, ops, now)
+
+	expected := `Operation abc (running for 2m0s)
+  waiting for pods on secondary (3/5 ready)
+  - secondary.bluegreen.ensureHasPods (next run in 15s, 1 retries)
+Next sync in 5m0s
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestOperationsHandlerScope(t *testing.T) {
+	cvcs := customfake.NewSimpleClientset(
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a", Labels: map[string]string{"team": "a"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team-a", Labels: map[string]string{"team": "b"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-b", Labels: map[string]string{"team": "a"}}},
+	)
+
+	var tests = []struct {
+		message string
+		path    string
+		proxied bool
+	}{
+		{"in scope", "/v1/cv/app/operations?namespace=team-a", true},
+		{"other namespace", "/v1/cv/app/operations?namespace=team-b", false},
+		{"other labels", "/v1/cv/other/operations?namespace=team-a", false},
+		{"missing", "/v1/cv/missing/operations?namespace=team-a", false},
+	}
+
+	for _, test := range tests {
+		cs := fake.NewSimpleClientset()
+		k8sProvider := k8s.NewProvider(cs, cvcs, "",
+			config.WithNamespaces([]string{"team-a"}), config.WithCVLabelSelector("team=a"))
+		mux := goji.NewMux()
+		mux.Handle(pat.Get("/v1/cv/:name/operations"), NewOperationsHandler(k8sProvider))
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+
+		// the fake clientset has no syncer pods, so the operations of cvs in scope are not found either
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", test.message, http.StatusNotFound, w.Code)
+		}
+		if proxied := len(cs.Actions()) > 0; proxied != test.proxied {
+			t.Errorf("%s: expected syncer pods to be looked up only for cvs in scope, got %v", test.message, proxied)
+		}
+	}
+}
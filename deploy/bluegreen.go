@@ -2,6 +2,7 @@ package deploy
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/golang/glog"
@@ -9,6 +10,7 @@ import (
 	k8s "github.com/nearmap/cvmanager/gok8s/workload"
 	"github.com/nearmap/cvmanager/registry"
 	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/nearmap/cvmanager/verify"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
@@ -88,7 +90,7 @@ func (bgd *BlueGreenDeployer) Do(ctx context.Context) (state.States, error) {
 		return state.Error(errors.Wrapf(err, "failed to find service for cv spec %s", bgd.cv.Name))
 	}
 
-	primary, secondary, err := bgd.getBlueGreenTargets(service)
+	primary, secondary, err := bgd.getBlueGreenTargets(ctx, service)
 	if err != nil {
 		return state.Error(errors.WithStack(err))
 	}
@@ -102,14 +104,40 @@ func (bgd *BlueGreenDeployer) Do(ctx context.Context) (state.States, error) {
 	// if we're the primary live workload and our version mismatches then we want to initiate deployment
 	// on the non-live workload.
 
-	return state.Single(
-		bgd.updateVersion(secondary,
-			bgd.updateVerificationServiceSelector(secondary,
-				bgd.ensureHasPods(secondary,
-					verify.NewVerifiers(bgd.cs, bgd.registryProvider, bgd.namespace, bgd.version, bgd.cv.Spec.Strategy.Verify,
-						bgd.scaleUpSecondary(primary, secondary,
-							bgd.updateServiceSelector(bgd.blueGreen.ServiceName, secondary,
-								bgd.scaleDown(primary, bgd.next))))))))
+	// record the targets so that a resumed rollout continues with the same targets
+	// even once the live service has been cut over.
+	if state.Data(ctx, bgd.dataKey("primary")) != primary.Name() {
+		state.SetData(ctx, bgd.dataKey("primary"), primary.Name())
+		state.SetData(ctx, bgd.dataKey("secondary"), secondary.Name())
+	}
+
+	scaleDown := bgd.step("scaleDown", bgd.scaleDown(primary, bgd.next), bgd.next)
+	updateServiceSelector := bgd.step("updateServiceSelector",
+		bgd.updateServiceSelector(bgd.blueGreen.ServiceName, secondary, scaleDown), scaleDown)
+	scaleUpSecondary := bgd.step("scaleUpSecondary",
+		bgd.scaleUpSecondary(primary, secondary, updateServiceSelector), updateServiceSelector)
+	verifiers := bgd.step("verify",
+		verify.NewVerifiers(bgd.cs, bgd.registryProvider, bgd.namespace, bgd.cv.Spec.ImageRepo, bgd.version, bgd.cv.Spec.Strategy.Verify, scaleUpSecondary),
+		scaleUpSecondary)
+	ensureHasPods := bgd.step("ensureHasPods", bgd.ensureHasPods(secondary, verifiers), verifiers)
+	updateVerificationServiceSelector := bgd.step("updateVerificationServiceSelector",
+		bgd.updateVerificationServiceSelector(secondary, ensureHasPods), ensureHasPods)
+	updateVersion := bgd.step("updateVersion", bgd.updateVersion(secondary, updateVerificationServiceSelector),
+		updateVerificationServiceSelector)
+
+	return state.Single(updateVersion)
+}
+
+// step returns a state for the named step of the blue-green rollout of the current target.
+func (bgd *BlueGreenDeployer) step(name string, st, next state.State) state.State {
+	return state.NewStepState(fmt.Sprintf("%s.bluegreen.%s", bgd.target.Name(), name),
+		phaseState(bgd.target.Name(), KindServieBlueGreen, name, st), next)
+}
+
+// dataKey returns the checkpoint data key for the given name. Keys are shared by both
+// workloads of the blue-green rollout.
+func (bgd *BlueGreenDeployer) dataKey(name string) string {
+	return fmt.Sprintf("bluegreen.%s", name)
 }
 
 // getService returns the service with the given name.
@@ -124,7 +152,8 @@ func (bgd *BlueGreenDeployer) getService(serviceName string) (*corev1.Service, e
 
 // getBlueGreenTargets returns the primary and secondary rollout targets based on whether
 // the live service (as specified) is currently selecting them.
-func (bgd *BlueGreenDeployer) getBlueGreenTargets(service *corev1.Service) (primary, secondary TemplateRolloutTarget, err error) {
+// If the rollout is being resumed, the targets recorded by the previous run are returned.
+func (bgd *BlueGreenDeployer) getBlueGreenTargets(ctx context.Context, service *corev1.Service) (primary, secondary TemplateRolloutTarget, err error) {
 	// get all the workloads managed by this cv spec
 	workloads, err := bgd.target.Select(bgd.cv.Spec.Selector)
 	if err != nil {
@@ -134,6 +163,24 @@ func (bgd *BlueGreenDeployer) getBlueGreenTargets(service *corev1.Service) (prim
 		return nil, nil, errors.Errorf("blue-green strategy requires exactly 2 workloads to be managed by a cv spec, found %d", len(workloads))
 	}
 
+	primaryName := state.Data(ctx, bgd.dataKey("primary"))
+	secondaryName := state.Data(ctx, bgd.dataKey("secondary"))
+	if primaryName != "" && secondaryName != "" {
+		for _, wl := range workloads {
+			switch wl.Name() {
+			case primaryName:
+				primary = wl
+			case secondaryName:
+				secondary = wl
+			}
+		}
+		if primary != nil && secondary != nil {
+			glog.V(2).Infof("Resuming blue-green deployment with primary=%s, secondary=%s", primaryName, secondaryName)
+			return primary, secondary, nil
+		}
+		primary, secondary = nil, nil
+	}
+
 	selector := labels.Set(service.Spec.Selector).AsSelector()
 	for _, wl := range workloads {
 		ptLabels := labels.Set(wl.PodTemplateSpec().Labels)
@@ -158,20 +205,21 @@ func (bgd *BlueGreenDeployer) updateVersion(target TemplateRolloutTarget, next s
 	return func(ctx context.Context) (state.States, error) {
 		glog.V(1).Infof("Updating version of %s to %s", target.Name(), bgd.version)
 
-		podSpec := target.PodSpec()
+		containers, err := k8s.Containers(bgd.cv, target.PodSpec())
+		if err != nil {
+			return state.Error(errors.Wrapf(err, "failed to find containers in pod spec for target %s", target.Name()))
+		}
 
+		_, span := tracing.Start(ctx, "k8s.PatchPodSpec", "workload", target.Name(), "version", bgd.version)
 		retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			for _, c := range podSpec.Containers {
-				if c.Name == bgd.cv.Spec.Container.Name {
-					if updateErr := target.PatchPodSpec(bgd.cv, c, bgd.version); updateErr != nil {
-						glog.V(2).Infof("Failed to update container version (will retry): version=%v, target=%v, error=%v",
-							bgd.version, target.Name(), updateErr)
-						return updateErr
-					}
-				}
+			if updateErr := target.PatchPodSpec(k8s.VersionImages(containers, bgd.version)); updateErr != nil {
+				glog.V(2).Infof("Failed to update container version (will retry): version=%v, target=%v, error=%v",
+					bgd.version, target.Name(), updateErr)
+				return updateErr
 			}
 			return nil
 		})
+		span.Finish(retryErr)
 		if retryErr != nil {
 			return state.Error(errors.Wrapf(retryErr, "failed to patch pod spec for target %s", target.Name()))
 		}
@@ -221,7 +269,10 @@ func (bgd *BlueGreenDeployer) updateServiceSelector(serviceName string, target T
 		glog.V(2).Infof("Updating service %s with selectors %v", serviceName, service.Spec.Selector)
 
 		// TODO: is update appropriate?
-		if _, err := bgd.cs.CoreV1().Services(bgd.namespace).Update(service); err != nil {
+		_, span := tracing.Start(ctx, "k8s.UpdateService", "service", service.Name)
+		_, err = bgd.cs.CoreV1().Services(bgd.namespace).Update(service)
+		span.Finish(err)
+		if err != nil {
 			return state.Error(errors.Wrapf(err, "failed to update test service %s while processing blue-green deployment for %s",
 				service.Name, bgd.cv.Name))
 		}
@@ -242,7 +293,9 @@ func (bgd *BlueGreenDeployer) ensureHasPods(target TemplateRolloutTarget, next s
 		if numReplicas == 0 {
 			glog.V(1).Infof("Increasing replicas of %s to 1", target.Name())
 
+			_, span := tracing.Start(ctx, "k8s.PatchNumReplicas", "workload", target.Name(), "replicas", "1")
 			err := target.PatchNumReplicas(1)
+			span.Finish(err)
 			if err != nil {
 				return state.Error(errors.Wrapf(err, "failed to patch number of replicas for target %s", target.Name()))
 			}
@@ -264,13 +317,15 @@ func (bgd *BlueGreenDeployer) waitForAllPods(target TemplateRolloutTarget, next
 		}
 		if len(pods) == 0 {
 			glog.V(2).Infof("no pods found for target %s", target.Name())
+			state.Report(ctx, "waiting for pods on %s", target.Name())
 			return state.After(15*time.Second, bgd.waitForAllPods(target, next))
 		}
 
+		ready := 0
 		for _, pod := range pods {
 			if pod.Status.Phase != corev1.PodRunning {
 				glog.V(2).Infof("Still waiting for rollout: pod %s phase is %v", pod.Name, pod.Status.Phase)
-				return state.After(15*time.Second, bgd.waitForAllPods(target, next))
+				continue
 			}
 
 			ok, err := k8s.CheckPodSpecContainerVersions(bgd.cv, bgd.version, pod.Spec)
@@ -280,8 +335,13 @@ func (bgd *BlueGreenDeployer) waitForAllPods(target TemplateRolloutTarget, next
 			}
 			if !ok {
 				glog.V(2).Infof("Still waiting for rollout: pod %s is wrong version", pod.Name)
-				return state.After(15*time.Second, bgd.waitForAllPods(target, next))
+				continue
 			}
+			ready++
+		}
+		if ready < len(pods) {
+			state.Report(ctx, "waiting for pods on %s (%d/%d ready)", target.Name(), ready, len(pods))
+			return state.After(15*time.Second, bgd.waitForAllPods(target, next))
 		}
 
 		glog.V(2).Infof("All pods are ready")
@@ -302,7 +362,11 @@ func (bgd *BlueGreenDeployer) scaleUpSecondary(current, secondary TemplateRollou
 			return state.Single(next)
 		}
 
-		if err := secondary.PatchNumReplicas(currentNum); err != nil {
+		_, span := tracing.Start(ctx, "k8s.PatchNumReplicas", "workload", secondary.Name(),
+			"replicas", fmt.Sprint(currentNum))
+		err := secondary.PatchNumReplicas(currentNum)
+		span.Finish(err)
+		if err != nil {
 			return state.Error(errors.Wrapf(err, "failed to patch number of replicas for secondary spec %s", secondary.Name()))
 		}
 
@@ -314,12 +378,17 @@ func (bgd *BlueGreenDeployer) scaleUpSecondary(current, secondary TemplateRollou
 func (bgd *BlueGreenDeployer) scaleDown(target TemplateRolloutTarget, next state.State) state.StateFunc {
 	return func(ctx context.Context) (state.States, error) {
 		if !bgd.cv.Spec.Strategy.BlueGreen.ScaleDown {
+			endPhase(ctx, bgd.target.Name(), KindServieBlueGreen)
 			return state.Single(next)
 		}
 
-		if err := target.PatchNumReplicas(0); err != nil {
+		_, span := tracing.Start(ctx, "k8s.PatchNumReplicas", "workload", target.Name(), "replicas", "0")
+		err := target.PatchNumReplicas(0)
+		span.Finish(err)
+		if err != nil {
 			return state.Error(errors.WithStack(err))
 		}
+		endPhase(ctx, bgd.target.Name(), KindServieBlueGreen)
 		return state.Single(next)
 	}
 }
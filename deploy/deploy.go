@@ -17,6 +17,43 @@ type RolloutTarget = k8s.Workload
 // resources.
 type TemplateRolloutTarget = k8s.TemplateWorkload
 
+// ErrorRolledBack is a permanent error indicating that a rollout failed and the
+// target was rolled back to its previous version.
+type ErrorRolledBack struct {
+	// PreviousVersion is the version the target was rolled back to.
+	PreviousVersion string
+
+	err error
+}
+
+// NewRolledBack returns an ErrorRolledBack for a target that was rolled back to the given
+// version after failing for the given reason.
+func NewRolledBack(previousVersion, reason string) *ErrorRolledBack {
+	return &ErrorRolledBack{
+		PreviousVersion: previousVersion,
+		err:             state.NewFailed("%s and was rolled back to version %s", reason, previousVersion),
+	}
+}
+
+// Error implements the error interface.
+func (erb *ErrorRolledBack) Error() string {
+	return erb.err.Error()
+}
+
+// Cause implements the errors.Cause interface.
+func (erb *ErrorRolledBack) Cause() error {
+	return erb.err
+}
+
+// RolledBack returns the ErrorRolledBack in the cause chain of the given error, if any.
+func RolledBack(err error) (*ErrorRolledBack, bool) {
+	erb, ok := state.FindCause(err, func(err error) bool {
+		_, ok := err.(*ErrorRolledBack)
+		return ok
+	}).(*ErrorRolledBack)
+	return erb, ok
+}
+
 // Deployer is an interface for rollout strategies.
 type Deployer interface {
 	// Deploy initiates a rollout for a target spec based on the underlying strategy implementation.
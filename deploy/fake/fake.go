@@ -10,6 +10,7 @@ import (
 	"github.com/nearmap/cvmanager/deploy"
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // RolloutTarget defines a fake RolloutTarget implementation for use in testing.
@@ -60,6 +61,11 @@ func (rt *RolloutTarget) Namespace() string {
 	return rt.FakeNamespace
 }
 
+// Object implements the RolloutTarget interface.
+func (rt *RolloutTarget) Object() runtime.Object {
+	return &corev1.ObjectReference{Kind: rt.FakeType, Namespace: rt.FakeNamespace, Name: rt.FakeName}
+}
+
 // Type implements the RolloutTarget interface.
 func (rt *RolloutTarget) Type() string {
 	return rt.FakeType
@@ -77,9 +83,7 @@ func (rt *RolloutTarget) AsResource(cv *cv1.ContainerVersion) *k8s.Resource {
 // ReceivedPatchPodSpec represents the received parameters of an invocation of the
 // PatchPodSpec method.
 type ReceivedPatchPodSpec struct {
-	CV        *cv1.ContainerVersion
-	Container corev1.Container
-	Version   string
+	Images []k8s.ContainerImage
 }
 
 // InvocationPatchPodSpec represents an invocation of the PatchPodSpec method.
@@ -97,14 +101,12 @@ func NewInvocationPatchPodSpec() *InvocationPatchPodSpec {
 }
 
 // PatchPodSpec implements the RolloutTarget interface.
-func (rt *RolloutTarget) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
+func (rt *RolloutTarget) PatchPodSpec(images []k8s.ContainerImage) error {
 	var pps InvocationPatchPodSpec
 	rt.invocationFor(&pps)
 
 	if pps.Received != nil {
-		pps.Received.CV = cv
-		pps.Received.Container = container
-		pps.Received.Version = version
+		pps.Received.Images = images
 	}
 
 	return pps.Error
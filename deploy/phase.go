@@ -0,0 +1,50 @@
+package deploy
+
+import (
+	"context"
+	"time"
+
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/stats"
+)
+
+// startPhase records the start of the named phase of a rollout of the given target
+// in the checkpoint of the operation group, and generates timing stats for the phase
+// that preceded it. Starting the phase that is already in progress has no effect,
+// so states that poll may call it on every attempt.
+func startPhase(ctx context.Context, target, strategy, phase string) {
+	key := "phase." + target
+	prev := state.Data(ctx, key)
+	if prev == phase {
+		return
+	}
+
+	now := state.Now(ctx)
+	if prev != "" {
+		if started, err := time.Parse(time.RFC3339Nano, state.Data(ctx, key+".started")); err == nil {
+			if st := stats.FromContext(ctx); st != nil {
+				st.Timing("rollout_phase_duration", now.Sub(started),
+					"strategy:"+strategy, "phase:"+prev)
+			}
+		}
+	}
+
+	state.SetDataMap(ctx, map[string]string{
+		key:              phase,
+		key + ".started": now.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// endPhase completes the current phase of a rollout of the given target.
+func endPhase(ctx context.Context, target, strategy string) {
+	startPhase(ctx, target, strategy, "")
+}
+
+// phaseState returns a state that starts the named rollout phase before executing
+// the given state.
+func phaseState(target, strategy, phase string, st state.State) state.StateFunc {
+	return func(ctx context.Context) (state.States, error) {
+		startPhase(ctx, target, strategy, phase)
+		return st.Do(ctx)
+	}
+}
@@ -2,17 +2,23 @@ package deploy
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
 	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/pkg/errors"
-	"k8s.io/api/core/v1"
 	"k8s.io/client-go/util/retry"
 )
 
+const (
+	// KindSimple defines a deployment type that patches the target's pod spec and relies
+	// on the default Kubernetes deployment strategy for the workload.
+	KindSimple = "Simple"
+)
+
 // SimpleDeployer implements a rollout strategy by patching the target's pod spec with a new version.
 type SimpleDeployer struct {
 	cv      *cv1.ContainerVersion
@@ -40,43 +46,46 @@ func NewSimpleDeployer(cv *cv1.ContainerVersion, version string, target RolloutT
 func (sd *SimpleDeployer) Do(ctx context.Context) (state.States, error) {
 	glog.V(2).Infof("Performing simple deployment: target=%s, version=%s", sd.target.Name(), sd.version)
 
-	var container *v1.Container
-	podSpec := sd.target.PodSpec()
-
-	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		for _, c := range podSpec.Containers {
-			if c.Name == sd.cv.Spec.Container.Name {
-				if updateErr := sd.target.PatchPodSpec(sd.cv, c, sd.version); updateErr != nil {
-					glog.V(2).Infof("Failed to update container version: version=%v, target=%v, error=%v",
-						sd.version, sd.target.Name(), updateErr)
-					return updateErr
-				}
-				container = &c
-			}
+	startPhase(ctx, sd.target.Name(), KindSimple, "patch")
+
+	containers, err := k8s.Containers(sd.cv, sd.target.PodSpec())
+	if err != nil {
+		err = errors.Wrapf(err, "failed to find containers in PodSpec for target %s", sd.target.Name())
+		glog.V(2).Infof("Failed to rollout: target=%s, version=%s, error=%v", sd.target.Name(), sd.version, err)
+		return state.Error(err)
+	}
+
+	_, span := tracing.Start(ctx, "k8s.PatchPodSpec", "workload", sd.target.Name(), "version", sd.version)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if updateErr := sd.target.PatchPodSpec(k8s.VersionImages(containers, sd.version)); updateErr != nil {
+			glog.V(2).Infof("Failed to update container version: version=%v, target=%v, error=%v",
+				sd.version, sd.target.Name(), updateErr)
+			return updateErr
 		}
 		return nil
 	})
-	if err == nil && container == nil {
-		err = errors.Errorf("container with name %s not found in PodSpec for target %s",
-			sd.cv.Spec.Container, sd.target.Name())
-	}
+	span.Finish(err)
 	if err != nil {
 		glog.V(2).Infof("Failed to rollout: target=%s, version=%s, error=%v", sd.target.Name(), sd.version, err)
 		return state.Error(err)
 	}
 
 	if sd.cv.Spec.Rollback.Enabled {
-		return state.Single(sd.checkRollbackState(container, sd.next))
+		return state.Single(sd.checkRollbackState(containers, sd.next))
 	}
 
 	glog.V(2).Infof("Not checking rollback state")
+	endPhase(ctx, sd.target.Name(), KindSimple)
 	return state.Single(sd.next)
 }
 
-func (sd *SimpleDeployer) checkRollbackState(container *v1.Container, next state.State) state.StateFunc {
+func (sd *SimpleDeployer) checkRollbackState(containers []k8s.Container, next state.State) state.StateFunc {
 	return func(ctx context.Context) (state.States, error) {
+		startPhase(ctx, sd.target.Name(), KindSimple, "healthCheck")
+
 		if sd.target.RollbackAfter() == nil {
 			glog.V(2).Infof("Target %s does not define a progress deadline.", sd.target.Name())
+			endPhase(ctx, sd.target.Name(), KindSimple)
 			return state.Single(next)
 		}
 
@@ -86,29 +95,36 @@ func (sd *SimpleDeployer) checkRollbackState(container *v1.Container, next state
 		}
 		if healthy == nil {
 			glog.V(4).Infof("Waiting for healthy state of target %s", sd.target.Name())
-			return state.After(time.Second*15, sd.checkRollbackState(container, next))
+			state.Report(ctx, "waiting for %s to become healthy", sd.target.Name())
+			return state.After(time.Second*15, sd.checkRollbackState(containers, next))
 		}
 
 		if *healthy == true {
 			glog.V(2).Info("Target is healthy")
+			endPhase(ctx, sd.target.Name(), KindSimple)
 			return state.Single(next)
 		}
 
+		startPhase(ctx, sd.target.Name(), KindSimple, "rollback")
+
 		// rollback
-		prevVersion := strings.SplitAfterN(container.Image, ":", 2)[1]
+		prevVersion := containers[0].Version()
 		glog.V(1).Infof("Rolling back target %s", sd.target.Name())
+		_, span := tracing.Start(ctx, "k8s.PatchPodSpec", "workload", sd.target.Name(), "version", prevVersion)
 		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-			if rbErr := sd.target.PatchPodSpec(sd.cv, *container, prevVersion); rbErr != nil {
+			if rbErr := sd.target.PatchPodSpec(k8s.CurrentImages(containers)); rbErr != nil {
 				glog.V(2).Infof("Failed to rollback container version (will retry):	from version=%s, to version=%s, target=%s, error=%v",
 					sd.version, prevVersion, sd.target.Name(), rbErr)
 				return rbErr
 			}
 			return nil
 		})
+		span.Finish(err)
 		if err != nil {
 			return state.Error(err)
 		}
 
-		return state.Error(state.NewFailed("deployment failed healthy state check and was rolled back"))
+		endPhase(ctx, sd.target.Name(), KindSimple)
+		return state.Error(NewRolledBack(prevVersion, "deployment failed healthy state check"))
 	}
 }
@@ -4,10 +4,14 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/nearmap/cvmanager/deploy"
 	"github.com/nearmap/cvmanager/deploy/fake"
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apimacherrors "k8s.io/apimachinery/pkg/api/errors"
@@ -21,12 +25,14 @@ const (
 func TestSimpleDeploy(t *testing.T) {
 	cv := &cv1.ContainerVersion{
 		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "test-image",
 			Container: cv1.ContainerSpec{
 				Name: containerName,
 			},
 		},
 	}
 	version := "version-string"
+	expected := []k8s.ContainerImage{{Name: containerName, Image: "test-image:version-string"}}
 	target := fake.NewRolloutTarget()
 
 	target.FakePodSpec.Containers = []corev1.Container{}
@@ -47,14 +53,8 @@ func TestSimpleDeploy(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected no error when PodSpec contains a container with the correct container name. Got %v", err)
 	}
-	if !reflect.DeepEqual(pps.Received.CV, cv) {
-		t.Errorf("Expected received CV instance to equal the provided instance. Got %+v.", pps.Received.CV)
-	}
-	if !reflect.DeepEqual(pps.Received.Container, target.FakePodSpec.Containers[0]) {
-		t.Errorf("Expected received container to equal the provided matching container. Got %+v.", pps.Received.Container)
-	}
-	if pps.Received.Version != version {
-		t.Errorf("Expected received version to equal the provided version. Got %+v.", pps.Received.Version)
+	if !reflect.DeepEqual(pps.Received.Images, expected) {
+		t.Errorf("Expected received images to set the version of the matching container. Got %+v.", pps.Received.Images)
 	}
 
 	target.FakePodSpec.Containers = []corev1.Container{
@@ -74,14 +74,8 @@ func TestSimpleDeploy(t *testing.T) {
 	if err != nil {
 		t.Errorf("Expected no error when PodSpec contains a container with the correct container name. Got %v", err)
 	}
-	if !reflect.DeepEqual(pps.Received.CV, cv) {
-		t.Errorf("Expected received CV instance to equal the provided instance. Got %+v.", pps.Received.CV)
-	}
-	if !reflect.DeepEqual(pps.Received.Container, target.FakePodSpec.Containers[1]) {
-		t.Errorf("Expected received container to equal the provided matching container. Got %+v.", pps.Received.Container)
-	}
-	if pps.Received.Version != version {
-		t.Errorf("Expected received version to equal the provided version. Got %+v.", pps.Received.Version)
+	if !reflect.DeepEqual(pps.Received.Images, expected) {
+		t.Errorf("Expected received images to set the version of the matching container. Got %+v.", pps.Received.Images)
 	}
 
 	pps = fake.NewInvocationPatchPodSpec()
@@ -101,3 +95,122 @@ func TestSimpleDeploy(t *testing.T) {
 		t.Errorf("Expected no error when PatchPodSpec returns an error that IS conflict")
 	}
 }
+
+func TestSimpleDeployContainers(t *testing.T) {
+	cv := &cv1.ContainerVersion{
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "test-image",
+			Container: cv1.ContainerSpec{
+				Name: containerName,
+			},
+			Containers: []cv1.ContainerRef{
+				{Name: "sidecar", ImageRepo: "sidecar-image"},
+				{Name: "migrate"},
+			},
+		},
+	}
+	target := fake.NewRolloutTarget()
+	target.FakePodSpec.InitContainers = []corev1.Container{
+		{Name: "migrate", Image: "test-image:prev-version"},
+	}
+	target.FakePodSpec.Containers = []corev1.Container{
+		{Name: containerName, Image: "test-image:prev-version"},
+		{Name: "sidecar", Image: "sidecar-image:prev-version"},
+		{Name: "other", Image: "other-image:other-version"},
+	}
+
+	pps := fake.NewInvocationPatchPodSpec()
+	target.Invocations <- pps
+	if _, err := deploy.NewSimpleDeployer(cv, "version-string", target, nil).Do(context.Background()); err != nil {
+		t.Fatalf("Expected no error when PodSpec contains all containers. Got %v", err)
+	}
+	expected := []k8s.ContainerImage{
+		{Name: containerName, Image: "test-image:version-string"},
+		{Name: "sidecar", Image: "sidecar-image:version-string"},
+		{Name: "migrate", Image: "test-image:version-string", Init: true},
+	}
+	if !reflect.DeepEqual(pps.Received.Images, expected) {
+		t.Errorf("Expected all containers to be patched in a single patch. Got %+v.", pps.Received.Images)
+	}
+	if len(target.Invocations) != 0 {
+		t.Errorf("Expected a single patch, got %d more invocations", len(target.Invocations))
+	}
+
+	target.FakePodSpec.InitContainers = nil
+	if _, err := deploy.NewSimpleDeployer(cv, "version-string", target, nil).Do(context.Background()); err == nil {
+		t.Errorf("Expected error when PodSpec does not contain the init container")
+	}
+}
+
+func TestSimpleDeployRollback(t *testing.T) {
+	cv := &cv1.ContainerVersion{
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "test-image",
+			Container: cv1.ContainerSpec{
+				Name: containerName,
+			},
+			Rollback: cv1.RollbackSpec{
+				Enabled: true,
+			},
+		},
+	}
+	rollbackAfter := 5 * time.Minute
+	target := fake.NewRolloutTarget()
+	target.FakeRollbackAfter = &rollbackAfter
+	target.FakePodSpec.Containers = []corev1.Container{
+		corev1.Container{
+			Name:  containerName,
+			Image: "test-image:prev-version",
+		},
+	}
+
+	var failure error
+	onFailure := state.OnFailureFunc(func(ctx context.Context, err error) {
+		failure = err
+	})
+
+	h := statetest.New(state.WithFailure(deploy.NewSimpleDeployer(cv, "version-string", target, nil), onFailure))
+	start := h.Clock.Now()
+
+	target.Invocations <- fake.NewInvocationPatchPodSpec()
+	h.Machine.Schedule()
+	for i := 0; i < 3; i++ {
+		h.Step()
+	}
+
+	expected := []string{
+		"state.WithFailure.func1",
+		"*deploy.SimpleDeployer",
+		"deploy.(*SimpleDeployer).checkRollbackState.func1",
+	}
+	if !reflect.DeepEqual(h.States(), expected) {
+		t.Fatalf("Expected states %v while waiting for progress health, got %v", expected, h.States())
+	}
+
+	unhealthy := false
+	target.FakeProgressHealth = &unhealthy
+	pps := fake.NewInvocationPatchPodSpec()
+	target.Invocations <- pps
+
+	if err := h.RunOperation(10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records := h.Records()
+	last := records[len(records)-1]
+	if last.Time.Sub(start) != 15*time.Second {
+		t.Errorf("Expected progress health to be checked again after 15s, got %v", last.Time.Sub(start))
+	}
+	if !state.IsPermanent(last.Err) {
+		t.Errorf("Expected a permanent failure after rolling back, got %v", last.Err)
+	}
+	if erb, ok := deploy.RolledBack(last.Err); !ok || erb.PreviousVersion != "prev-version" {
+		t.Errorf("Expected a rolled back error for the previous version, got %v", last.Err)
+	}
+	if !reflect.DeepEqual(pps.Received.Images, []k8s.ContainerImage{{Name: containerName, Image: "test-image:prev-version"}}) {
+		t.Errorf("Expected rollback to the previous version. Got %+v.", pps.Received.Images)
+	}
+	if failure == nil {
+		t.Errorf("Expected failure func to be invoked")
+	}
+}
@@ -8,18 +8,16 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// newPodEventRecorder creates an event record that attaches event of a pod
-// identified by name specified
+// newPodEventRecorder creates an event recorder that attaches events to the pod
+// identified by the given name. If the pod cannot be found, events are logged.
 func newPodEventRecorder(cs kubernetes.Interface, ns string, podName string) Recorder {
-	var recorder Recorder
+	b := NewBroadcaster(cs)
 	pod, err := cs.CoreV1().Pods(ns).Get(podName, metav1.GetOptions{})
 	if err != nil {
-		glog.Errorf("failed to get pod with name %s for event recorder: %v", podName, err)
-		recorder = &FakeRecorder{}
-	} else {
-		recorder = NewRecorder(cs, ns, pod)
+		glog.Errorf("failed to get pod with name %s for event recorder, events will only be logged: %v", podName, err)
+		return b.Recorder()
 	}
-	return recorder
+	return b.Recorder(pod)
 }
 
 // PodEventRecorder creates an event record that attaches event of a pod
@@ -0,0 +1,34 @@
+package events
+
+// Reasons of the events recorded for rollouts. Events of a rollout are attached to the
+// ContainerVersion and to the workload being rolled out.
+const (
+	ReasonRolloutStarted        = "RolloutStarted"
+	ReasonRolloutSucceeded      = "RolloutSucceeded"
+	ReasonRolloutFailed         = "RolloutFailed"
+	ReasonVerificationFailed    = "VerificationFailed"
+	ReasonRolledBack            = "RolledBack"
+	ReasonRolloutAborted        = "RolloutAborted"
+	ReasonRolloutPaused         = "RolloutPaused"
+	ReasonRolloutResumed        = "RolloutResumed"
+	ReasonGitOpsWriteBack       = "GitOpsWriteBack"
+	ReasonGitOpsWriteBackFailed = "GitOpsWriteBackFailed"
+)
+
+// Reasons of the events recorded for promotions of versions across environments. Events
+// are attached to the Promotion, and successful promotions also to its source ContainerVersion.
+const (
+	ReasonPromoted        = "Promoted"
+	ReasonPromotionFailed = "PromotionFailed"
+)
+
+// Reasons of the events recorded for failures of the sync process that do not fail a rollout.
+const (
+	ReasonSyncFailed                   = "CRSyncFailed"
+	ReasonUpdateRolloutStatusFailed    = "FailedUpdateRolloutStatus"
+	ReasonCreateVersionConfigMapFailed = "FailedCreateVersionConfigMap"
+	ReasonUpdateVersionConfigMapFailed = "FailedUpdateVersionConfigMap"
+	ReasonSaveHistoryFailed            = "SaveHistoryFailed"
+	ReasonNotificationFailed           = "NotificationFailed"
+	ReasonDeploymentStatusFailed       = "DeploymentStatusFailed"
+)
@@ -1,14 +1,20 @@
 package events
 
 import (
+	"fmt"
+
 	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/scheme"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/client-go/kubernetes"
 	k8sscheme "k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
 const (
@@ -16,6 +22,17 @@ const (
 	Warning = corev1.EventTypeWarning
 )
 
+const (
+	defaultQPS   = 1
+	defaultBurst = 25
+
+	// the spam filter of the event correlator of client-go, which silently drops events
+	// of an object once a burst of 25 have been sent, and then allows one every 5 minutes
+	spamCacheSize = 4096
+	spamBurst     = 25
+	spamQPS       = 1. / 300.
+)
+
 // Recorder records Kubernetes events for the current pod.
 type Recorder interface {
 	// Event constructs an event from the given information and puts it in the queue for sending.
@@ -28,40 +45,150 @@ type Recorder interface {
 	PastEventf(timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{})
 }
 
-// SimpleRecorder implements the Recorder interface.
-type SimpleRecorder struct {
-	cs       kubernetes.Interface
-	recorder record.EventRecorder
-	object   runtime.Object
+// Broadcaster sends events of Kubernetes objects to the API server. Events are rate
+// limited, and events that exceed the rate limit are logged instead of being sent.
+// Events of an object that would be dropped by the spam filter of client-go are also
+// logged instead of being sent.
+type Broadcaster struct {
+	recorder   record.EventRecorder
+	source     corev1.EventSource
+	limiter    flowcontrol.RateLimiter
+	spamFilter *record.EventSourceObjectSpamFilter
 }
 
-// NewRecorder returns an event recorder that encapsulates the current namespace and runtime object.
-func NewRecorder(cs kubernetes.Interface, namespace string, object runtime.Object) *SimpleRecorder {
+// WithRateLimit sets the rate, in events per second, and burst of events sent by a broadcaster.
+func WithRateLimit(qps float32, burst int) func(*Broadcaster) {
+	return func(b *Broadcaster) {
+		b.limiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+	}
+}
+
+// NewBroadcaster returns a broadcaster that sends events with the given clientset.
+// All events are also logged.
+func NewBroadcaster(cs kubernetes.Interface, options ...func(*Broadcaster)) *Broadcaster {
+	// events may be attached to ContainerVersions
+	scheme.AddToScheme(k8sscheme.Scheme)
+
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(glog.Infof)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events("")})
 
-	recorder := eventBroadcaster.NewRecorder(k8sscheme.Scheme, corev1.EventSource{Component: "container-version-controller"})
+	source := corev1.EventSource{Component: "container-version-controller"}
+	b := &Broadcaster{
+		recorder:   eventBroadcaster.NewRecorder(k8sscheme.Scheme, source),
+		source:     source,
+		limiter:    flowcontrol.NewTokenBucketRateLimiter(defaultQPS, defaultBurst),
+		spamFilter: record.NewEventSourceObjectSpamFilter(spamCacheSize, spamBurst, spamQPS, clock.RealClock{}),
+	}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
 
-	return &SimpleRecorder{
-		cs:       cs,
-		recorder: recorder,
-		object:   object,
+// Recorder returns a recorder that attaches events to the given objects.
+func (b *Broadcaster) Recorder(objects ...runtime.Object) *ObjectRecorder {
+	return &ObjectRecorder{
+		broadcaster: b,
+		objects:     objects,
 	}
 }
 
-// Event implements EventRecorder.
-func (sr *SimpleRecorder) Event(eventtype, reason, message string) {
-	sr.recorder.Event(sr.object, eventtype, reason, message)
+// event sends an event for each of the given objects, or logs it if there are no objects
+// or the rate limit has been exceeded.
+func (b *Broadcaster) event(objects []runtime.Object, timestamp *metav1.Time, eventType, reason, message string) {
+	if len(objects) == 0 {
+		glog.Warningf("Event has no object: type=%s, reason=%s, message=%s", eventType, reason, message)
+		return
+	}
+	for _, obj := range objects {
+		if !b.limiter.TryAccept() {
+			glog.Warningf("Event rate limit exceeded, not sending event for %s: type=%s, reason=%s, message=%s",
+				objectName(obj), eventType, reason, message)
+			continue
+		}
+		if b.spam(obj) {
+			glog.Warningf("Event spam filter exceeded, not sending event for %s: type=%s, reason=%s, message=%s",
+				objectName(obj), eventType, reason, message)
+			continue
+		}
+		if timestamp != nil {
+			b.recorder.PastEventf(obj, *timestamp, eventType, reason, "%s", message)
+		} else {
+			b.recorder.Event(obj, eventType, reason, message)
+		}
+	}
+}
 
+// spam returns true if the spam filter of client-go would drop a further event of the
+// given object. The filter is applied here with the same settings, so that the events it
+// drops are logged; the events that are sent are then accepted by client-go's filter.
+func (b *Broadcaster) spam(obj runtime.Object) bool {
+	if b.spamFilter == nil {
+		return false
+	}
+	ref, err := reference.GetReference(k8sscheme.Scheme, obj)
+	if err != nil {
+		return false
+	}
+	return b.spamFilter.Filter(&corev1.Event{Source: b.source, InvolvedObject: *ref})
 }
 
-// Event implements EventRecorder.
-func (sr *SimpleRecorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
-	sr.recorder.Eventf(sr.object, eventtype, reason, messageFmt, args...)
+// objectName returns the namespaced name of the given object for logging.
+func objectName(obj runtime.Object) string {
+	if ref, ok := obj.(*corev1.ObjectReference); ok {
+		return ref.Namespace + "/" + ref.Name
+	}
+	if m, ok := obj.(metav1.Object); ok {
+		return m.GetNamespace() + "/" + m.GetName()
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+// ObjectRecorder implements the Recorder interface, attaching events to a set of objects.
+type ObjectRecorder struct {
+	broadcaster *Broadcaster
+	objects     []runtime.Object
+}
+
+// NewRecorder returns an event recorder that attaches events to the given object.
+func NewRecorder(cs kubernetes.Interface, namespace string, object runtime.Object) *ObjectRecorder {
+	return NewBroadcaster(cs).Recorder(object)
+}
+
+// For returns a recorder that attaches events to the given objects in addition to the
+// objects of this recorder.
+func (or *ObjectRecorder) For(objects ...runtime.Object) *ObjectRecorder {
+	all := make([]runtime.Object, 0, len(or.objects)+len(objects))
+	all = append(all, or.objects...)
+	for _, obj := range objects {
+		if obj != nil {
+			all = append(all, obj)
+		}
+	}
+	return or.broadcaster.Recorder(all...)
+}
+
+// Event implements the Recorder interface.
+func (or *ObjectRecorder) Event(eventType, reason, message string) {
+	or.broadcaster.event(or.objects, nil, eventType, reason, message)
+}
+
+// Eventf implements the Recorder interface.
+func (or *ObjectRecorder) Eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	or.broadcaster.event(or.objects, nil, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// PastEventf implements the Recorder interface.
+func (or *ObjectRecorder) PastEventf(timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	or.broadcaster.event(or.objects, &timestamp, eventType, reason, fmt.Sprintf(messageFmt, args...))
 }
 
-// Event implements EventRecorder.
-func (sr *SimpleRecorder) PastEventf(timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
-	sr.recorder.PastEventf(sr.object, timestamp, eventtype, reason, messageFmt, args...)
+// ForObjects returns a recorder that also attaches events to the given objects if the
+// given recorder is an ObjectRecorder, or the given recorder otherwise.
+func ForObjects(recorder Recorder, objects ...runtime.Object) Recorder {
+	if or, ok := recorder.(*ObjectRecorder); ok {
+		return or.For(objects...)
+	}
+	return recorder
 }
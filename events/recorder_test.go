@@ -0,0 +1,84 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// objectRecorder records the objects of events in addition to the events.
+type objectRecorder struct {
+	*record.FakeRecorder
+	objects []runtime.Object
+}
+
+func (or *objectRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	or.objects = append(or.objects, object)
+	or.FakeRecorder.Event(object, eventType, reason, message)
+}
+
+func newTestBroadcaster(limiter flowcontrol.RateLimiter) (*Broadcaster, *objectRecorder) {
+	rec := &objectRecorder{FakeRecorder: record.NewFakeRecorder(10)}
+	return &Broadcaster{recorder: rec, limiter: limiter}, rec
+}
+
+func TestObjectRecorder(t *testing.T) {
+	b, rec := newTestBroadcaster(flowcontrol.NewFakeAlwaysRateLimiter())
+
+	cv := &corev1.ObjectReference{Kind: "ContainerVersion", Name: "app-cv"}
+	workload := &corev1.ObjectReference{Kind: "Deployment", Name: "app"}
+
+	ForObjects(b.Recorder(cv), workload).Eventf(Normal, ReasonRolloutStarted, "Rolling out %s", "app")
+	if len(rec.objects) != 2 || rec.objects[0] != cv || rec.objects[1] != workload {
+		t.Fatalf("Expected event for cv and workload, got %v", rec.objects)
+	}
+	for i := 0; i < 2; i++ {
+		if e := <-rec.Events; e != "Normal RolloutStarted Rolling out app" {
+			t.Errorf("Unexpected event %s", e)
+		}
+	}
+
+	b.Recorder().Event(Warning, ReasonRolloutFailed, "no objects")
+	if len(rec.objects) != 2 {
+		t.Errorf("Expected event without objects not to be sent, got %v", rec.objects)
+	}
+}
+
+func TestObjectRecorderRateLimit(t *testing.T) {
+	b, rec := newTestBroadcaster(flowcontrol.NewFakeNeverRateLimiter())
+
+	b.Recorder(&corev1.ObjectReference{Name: "app-cv"}).Event(Warning, ReasonRolledBack, "rolled back")
+	if len(rec.objects) != 0 {
+		t.Errorf("Expected rate limited event not to be sent, got %v", rec.objects)
+	}
+}
+
+func TestObjectRecorderSpamFilter(t *testing.T) {
+	b, rec := newTestBroadcaster(flowcontrol.NewFakeAlwaysRateLimiter())
+	b.spamFilter = record.NewEventSourceObjectSpamFilter(10, 2, spamQPS, clock.NewFakeClock(time.Now()))
+
+	cv := &corev1.ObjectReference{Kind: "ContainerVersion", Namespace: "default", Name: "app-cv"}
+	for i := 0; i < 3; i++ {
+		b.Recorder(cv).Event(Normal, ReasonRolloutStarted, "rolling out")
+	}
+	if len(rec.objects) != 2 {
+		t.Errorf("Expected events over the spam filter burst not to be sent, got %v", rec.objects)
+	}
+
+	b.Recorder(&corev1.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "app"}).Event(Normal, ReasonRolloutStarted, "rolling out")
+	if len(rec.objects) != 3 {
+		t.Errorf("Expected event of another object to be sent, got %v", rec.objects)
+	}
+}
+
+func TestForObjects(t *testing.T) {
+	rec := NewFakeRecorder(1)
+	if r := ForObjects(rec, &corev1.ObjectReference{Name: "app"}); r != rec {
+		t.Errorf("Expected recorder without objects to be returned unchanged")
+	}
+}
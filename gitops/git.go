@@ -0,0 +1,90 @@
+package gitops
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// repository is a clone of a repository.
+type repository struct {
+	git string
+	dir string
+
+	// env are the environment variables of git commands, which authenticate with the
+	// remote repository.
+	env []string
+}
+
+// clone clones the branch of the repository into the given directory, which is also
+// used for any credentials.
+func (w *Writer) clone(ctx context.Context, dir string) (*repository, error) {
+	repo := &repository{
+		git: w.git,
+		dir: filepath.Join(dir, "repo"),
+		env: []string{"GIT_TERMINAL_PROMPT=0"},
+	}
+
+	if isSSH(w.spec.Repository) {
+		knownHosts := filepath.Join(dir, "known_hosts")
+		if err := ioutil.WriteFile(knownHosts, w.knownHosts, 0600); err != nil {
+			return nil, errors.Wrap(err, "failed to write known hosts")
+		}
+		command := "ssh -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + knownHosts
+		if len(w.credentials) > 0 {
+			key := filepath.Join(dir, "id")
+			if err := ioutil.WriteFile(key, w.credentials, 0600); err != nil {
+				return nil, errors.Wrap(err, "failed to write ssh key")
+			}
+			command += " -i " + key + " -o IdentitiesOnly=yes"
+		}
+		repo.env = append(repo.env, "GIT_SSH_COMMAND="+command)
+	} else if len(w.credentials) > 0 {
+		// the token is passed in the environment rather than the arguments of git,
+		// which are visible to other processes
+		auth := base64.StdEncoding.EncodeToString([]byte("oauth2:" + strings.TrimSpace(string(w.credentials))))
+		repo.env = append(repo.env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth)
+	}
+
+	if _, err := repo.run(ctx, "clone", "--quiet", "--depth", "1", "--single-branch",
+		"--branch", w.branch(), w.spec.Repository, repo.dir); err != nil {
+		return nil, errors.Wrapf(err, "failed to clone branch %s of %s", w.branch(), w.spec.Repository)
+	}
+	return repo, nil
+}
+
+// run runs the git command with the given arguments in the repository and returns its output.
+func (r *repository) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, r.git, args...)
+	cmd.Env = append(os.Environ(), r.env...)
+	if _, err := os.Stat(r.dir); err == nil {
+		cmd.Dir = r.dir
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isSSH returns true if the given repository URL is accessed over SSH, either with an
+// ssh URL or the scp-like syntax user@host:path.
+func isSSH(url string) bool {
+	if strings.HasPrefix(url, "ssh://") {
+		return true
+	}
+	if strings.Contains(url, "://") {
+		return false
+	}
+	colon := strings.Index(url, ":")
+	slash := strings.Index(url, "/")
+	return colon > 0 && (slash < 0 || colon < slash)
+}
@@ -0,0 +1,254 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/tracing"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultBranch = "master"
+
+	defaultMessage = `Deploy {{.Image}}:{{.Version}} to {{.Namespace}}
+
+Written back by cvmanager for ContainerVersion {{.Name}}{{if .PreviousVersion}}, replacing version {{.PreviousVersion}}{{end}}.
+`
+
+	authorName  = "cvmanager"
+	authorEmail = "cvmanager@localhost"
+)
+
+// MergeRequester opens merge requests of branches of a repository.
+type MergeRequester interface {
+	// OpenMergeRequest opens a merge request of the source branch into the target branch,
+	// unless one is already open, and returns its URL.
+	OpenMergeRequest(ctx context.Context, source, target, title, description string) (string, error)
+}
+
+// Change describes a deployed version that is written back to a repository. Its fields
+// may be used in the commit message template.
+type Change struct {
+	// Name and Namespace of the ContainerVersion.
+	Name      string
+	Namespace string
+
+	// Image is the repository of the image, without a tag.
+	Image string
+
+	Version         string
+	PreviousVersion string
+}
+
+// Writer writes deployed versions back to a file of a Git repository, using the git
+// command line tool.
+type Writer struct {
+	spec        *cv1.GitOpsSpec
+	credentials []byte
+	knownHosts  []byte
+	requester   MergeRequester
+
+	git string
+}
+
+// WithCredentials sets the SSH private key or HTTPS token used to access the repository.
+func WithCredentials(credentials []byte) func(*Writer) {
+	return func(w *Writer) {
+		w.credentials = credentials
+	}
+}
+
+// WithKnownHosts sets the known_hosts entries used to verify the host key of a repository
+// accessed over SSH.
+func WithKnownHosts(knownHosts []byte) func(*Writer) {
+	return func(w *Writer) {
+		w.knownHosts = knownHosts
+	}
+}
+
+// WithMergeRequester sets the requester of merge requests, which is required if the spec
+// writes versions with merge requests.
+func WithMergeRequester(requester MergeRequester) func(*Writer) {
+	return func(w *Writer) {
+		w.requester = requester
+	}
+}
+
+// WithGit sets the path of the git command.
+func WithGit(path string) func(*Writer) {
+	return func(w *Writer) {
+		w.git = path
+	}
+}
+
+// NewWriter returns a writer to the repository of the given spec.
+func NewWriter(spec *cv1.GitOpsSpec, options ...func(*Writer)) (*Writer, error) {
+	w := &Writer{
+		spec: spec,
+		git:  "git",
+	}
+	for _, opt := range options {
+		opt(w)
+	}
+
+	if spec.Repository == "" {
+		return nil, errors.New("no repository defined for gitops")
+	}
+	if spec.File == "" || filepath.IsAbs(spec.File) || strings.HasPrefix(filepath.Clean(spec.File), "..") {
+		return nil, errors.Errorf("invalid gitops file %q, which must be relative to the root of the repository", spec.File)
+	}
+	if spec.MergeRequest && w.requester == nil {
+		return nil, errors.New("gitops merge requests require an scm")
+	}
+	if isSSH(spec.Repository) && len(w.knownHosts) == 0 {
+		return nil, errors.Errorf("gitops repository %s is accessed over ssh and requires known hosts", spec.Repository)
+	}
+	return w, nil
+}
+
+// ForSpec returns a writer to the repository of the given spec, reading any credentials
+// and known hosts from the secrets of the spec in the given namespace. The requester may
+// be nil if the spec does not write versions with merge requests.
+func ForSpec(cs kubernetes.Interface, namespace string, spec *cv1.GitOpsSpec, requester MergeRequester) (*Writer, error) {
+	options := []func(*Writer){WithMergeRequester(requester)}
+	if ref := spec.CredentialsFrom; ref != nil {
+		credentials, err := secretKey(cs, namespace, ref)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		options = append(options, WithCredentials(credentials))
+	}
+	if ref := spec.KnownHostsFrom; ref != nil {
+		knownHosts, err := secretKey(cs, namespace, ref)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		options = append(options, WithKnownHosts(knownHosts))
+	}
+	return NewWriter(spec, options...)
+}
+
+// secretKey returns the value of the given secret key in the given namespace.
+func secretKey(cs kubernetes.Interface, namespace string, ref *cv1.SecretKeyRef) ([]byte, error) {
+	secret, err := cs.CoreV1().Secrets(namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s", ref.Name)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, errors.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return value, nil
+}
+
+func (w *Writer) branch() string {
+	if w.spec.Branch == "" {
+		return defaultBranch
+	}
+	return w.spec.Branch
+}
+
+// Write writes the version of the given change to the file of the repository. The change
+// is committed and pushed to the branch, or to a new branch of a merge request. Write
+// returns the commit or the URL of the merge request, or an empty string if the file
+// already has the version.
+func (w *Writer) Write(ctx context.Context, change *Change) (result string, err error) {
+	ctx, span := tracing.Start(ctx, "gitops.write", "version", change.Version)
+	defer func() { span.Finish(err) }()
+
+	message, err := w.message(change)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "cvmanager-gitops")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create directory for repository")
+	}
+	defer os.RemoveAll(tmp)
+
+	repo, err := w.clone(ctx, tmp)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	path := filepath.Join(repo.dir, w.spec.File)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to find %s in repository", w.spec.File)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", w.spec.File)
+	}
+	updated, err := Update(w.spec.Format, content, w.spec.Path, change.Image, change.Version)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to update %s", w.spec.File)
+	}
+	if bytes.Equal(content, updated) {
+		glog.V(2).Infof("Version %s is already written to %s of %s", change.Version, w.spec.File, w.spec.Repository)
+		return "", nil
+	}
+	if err := ioutil.WriteFile(path, updated, info.Mode()); err != nil {
+		return "", errors.Wrapf(err, "failed to write %s", w.spec.File)
+	}
+
+	if _, err := repo.run(ctx, "add", "--", w.spec.File); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if _, err := repo.run(ctx, "-c", "user.name="+authorName, "-c", "user.email="+authorEmail,
+		"commit", "-m", message); err != nil {
+		return "", errors.WithStack(err)
+	}
+	commit, err := repo.run(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if !w.spec.MergeRequest {
+		if _, err := repo.run(ctx, "push", "origin", "HEAD:refs/heads/"+w.branch()); err != nil {
+			return "", errors.WithStack(err)
+		}
+		glog.V(1).Infof("Wrote version %s to %s of %s in commit %s", change.Version, w.spec.File, w.spec.Repository, commit)
+		return commit, nil
+	}
+
+	source := "cvmanager/" + change.Name + "-" + change.Version
+	if _, err := repo.run(ctx, "push", "--force", "origin", "HEAD:refs/heads/"+source); err != nil {
+		return "", errors.WithStack(err)
+	}
+	title := strings.SplitN(message, "\n", 2)[0]
+	url, err := w.requester.OpenMergeRequest(ctx, source, w.branch(), title, message)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open merge request of %s", source)
+	}
+	glog.V(1).Infof("Opened merge request %s of version %s to %s of %s", url, change.Version, w.spec.File, w.spec.Repository)
+	return url, nil
+}
+
+// message returns the commit message of the given change.
+func (w *Writer) message(change *Change) (string, error) {
+	text := w.spec.Message
+	if text == "" {
+		text = defaultMessage
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse gitops message template")
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, change); err != nil {
+		return "", errors.Wrap(err, "failed to execute gitops message template")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,241 @@
+package gitops
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+)
+
+const kustomization = `resources:
+- deployment.yaml
+images:
+- name: nearmap/app
+  newTag: abc
+`
+
+// git runs git with the given arguments in the given directory.
+func git(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@localhost"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newBareRepo returns the path of a local bare repository whose master branch has a
+// kustomization in the deploy directory.
+func newBareRepo(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitops-test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+
+	bare := filepath.Join(dir, "manifests.git")
+	git(t, dir, "init", "--quiet", "--bare", bare)
+	git(t, bare, "symbolic-ref", "HEAD", "refs/heads/master")
+
+	work := filepath.Join(dir, "work")
+	git(t, dir, "init", "--quiet", work)
+	if err := os.MkdirAll(filepath.Join(work, "deploy"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(work, "deploy", "kustomization.yaml"), []byte(kustomization), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+	git(t, work, "add", ".")
+	git(t, work, "commit", "--quiet", "-m", "Initial commit")
+	git(t, work, "push", "--quiet", bare, "HEAD:refs/heads/master")
+
+	return bare, func() { os.RemoveAll(dir) }
+}
+
+func testChange() *Change {
+	return &Change{
+		Name:            "app-cv",
+		Namespace:       "default",
+		Image:           "nearmap/app",
+		Version:         "def",
+		PreviousVersion: "abc",
+	}
+}
+
+func TestWritePush(t *testing.T) {
+	bare, cleanup := newBareRepo(t)
+	defer cleanup()
+
+	w, err := NewWriter(&cv1.GitOpsSpec{
+		Repository: bare,
+		File:       "deploy/kustomization.yaml",
+		Format:     FormatKustomize,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	commit, err := w.Write(context.Background(), testChange())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if head := git(t, bare, "rev-parse", "master"); commit == "" || head != commit {
+		t.Errorf("Expected master to be at commit %s, got %s", commit, head)
+	}
+	if file := git(t, bare, "show", "master:deploy/kustomization.yaml"); !strings.Contains(file, "newTag: def") {
+		t.Errorf("Expected version to be written, got:\n%s", file)
+	}
+	message := git(t, bare, "log", "-1", "--format=%B", "master")
+	if !strings.HasPrefix(message, "Deploy nearmap/app:def to default") || !strings.Contains(message, "replacing version abc") {
+		t.Errorf("Unexpected commit message:\n%s", message)
+	}
+
+	// writing the same version again is a no-op
+	if commit, err := w.Write(context.Background(), testChange()); err != nil || commit != "" {
+		t.Errorf("Expected no commit for written version, got %s: %v", commit, err)
+	}
+	if count := git(t, bare, "rev-list", "--count", "master"); count != "2" {
+		t.Errorf("Expected 2 commits, got %s", count)
+	}
+}
+
+// mergeRequester records the merge requests it is asked to open.
+type mergeRequester struct {
+	requests []string
+}
+
+func (mr *mergeRequester) OpenMergeRequest(ctx context.Context, source, target, title, description string) (string, error) {
+	mr.requests = append(mr.requests, source+" -> "+target+": "+title)
+	return "https://scm.example.com/mr/1", nil
+}
+
+func TestWriteMergeRequest(t *testing.T) {
+	bare, cleanup := newBareRepo(t)
+	defer cleanup()
+
+	spec := &cv1.GitOpsSpec{
+		Repository:   bare,
+		File:         "deploy/kustomization.yaml",
+		Format:       FormatKustomize,
+		Message:      "Update {{.Name}} to {{.Version}}",
+		MergeRequest: true,
+	}
+	if _, err := NewWriter(spec); err == nil {
+		t.Fatalf("Expected error for merge requests without a requester")
+	}
+
+	mr := &mergeRequester{}
+	w, err := NewWriter(spec, WithMergeRequester(mr))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	url, err := w.Write(context.Background(), testChange())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if url != "https://scm.example.com/mr/1" {
+		t.Errorf("Expected merge request URL, got %s", url)
+	}
+	if len(mr.requests) != 1 || mr.requests[0] != "cvmanager/app-cv-def -> master: Update app-cv to def" {
+		t.Errorf("Unexpected merge requests %v", mr.requests)
+	}
+
+	if file := git(t, bare, "show", "cvmanager/app-cv-def:deploy/kustomization.yaml"); !strings.Contains(file, "newTag: def") {
+		t.Errorf("Expected version to be written to merge request branch, got:\n%s", file)
+	}
+	if file := git(t, bare, "show", "master:deploy/kustomization.yaml"); file != strings.TrimSpace(kustomization) {
+		t.Errorf("Expected master to be unchanged, got:\n%s", file)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	bare, cleanup := newBareRepo(t)
+	defer cleanup()
+
+	if _, err := NewWriter(&cv1.GitOpsSpec{Repository: bare, File: "../secrets.yaml", Format: FormatYAML}); err == nil {
+		t.Errorf("Expected error for file outside of repository")
+	}
+
+	w, _ := NewWriter(&cv1.GitOpsSpec{Repository: bare, Branch: "missing", File: "deploy/kustomization.yaml", Format: FormatKustomize})
+	if _, err := w.Write(context.Background(), testChange()); err == nil || !strings.Contains(err.Error(), "failed to clone") {
+		t.Errorf("Expected clone error for missing branch, got %v", err)
+	}
+
+	w, _ = NewWriter(&cv1.GitOpsSpec{Repository: bare, File: "deploy/values.yaml", Format: FormatHelm})
+	if _, err := w.Write(context.Background(), testChange()); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestWriteCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitops-test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a stand-in for git that records its arguments and environment
+	fakeGit := filepath.Join(dir, "git")
+	script := "#!/bin/sh\necho \"$@\" > " + dir + "/args\nenv > " + dir + "/env\nexit 1\n"
+	if err := ioutil.WriteFile(fakeGit, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write git script: %v", err)
+	}
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	spec := &cv1.GitOpsSpec{Repository: "https://github.com/nearmap/manifests.git", File: "values.yaml", Format: FormatHelm}
+	w, err := NewWriter(spec, WithGit(fakeGit), WithCredentials([]byte("t0ken")))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	w.Write(context.Background(), testChange())
+	if args := read("args"); strings.Contains(args, "Authorization") {
+		t.Errorf("Expected token not to be passed in arguments, got %s", args)
+	}
+	// base64 of oauth2:t0ken
+	if env := read("env"); !strings.Contains(env, "GIT_CONFIG_VALUE_0=Authorization: Basic b2F1dGgyOnQwa2Vu") {
+		t.Errorf("Expected token to be passed in the environment, got %s", env)
+	}
+
+	spec = &cv1.GitOpsSpec{Repository: "git@github.com:nearmap/manifests.git", File: "values.yaml", Format: FormatHelm}
+	if _, err := NewWriter(spec, WithGit(fakeGit), WithCredentials([]byte("key"))); err == nil {
+		t.Errorf("Expected error for ssh repository without known hosts")
+	}
+	w, err = NewWriter(spec, WithGit(fakeGit), WithCredentials([]byte("key")), WithKnownHosts([]byte("github.com ssh-ed25519 AAAA")))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	w.Write(context.Background(), testChange())
+	if env := read("env"); !strings.Contains(env, "StrictHostKeyChecking=yes") {
+		t.Errorf("Expected strict host key checking, got %s", env)
+	}
+}
+
+func TestIsSSH(t *testing.T) {
+	tests := map[string]bool{
+		"git@github.com:nearmap/manifests.git":       true,
+		"ssh://git@github.com/nearmap/manifests.git": true,
+		"https://github.com/nearmap/manifests.git":   false,
+		"/var/lib/manifests.git":                     false,
+		"../manifests":                               false,
+	}
+	for url, expected := range tests {
+		if isSSH(url) != expected {
+			t.Errorf("Expected isSSH(%s) to be %t", url, expected)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package gitops
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats of the files that versions are written to.
+const (
+	// FormatKustomize is a kustomization, whose images define the tag of the image.
+	FormatKustomize = "Kustomize"
+	// FormatHelm is a Helm values file that defines the tag of the image.
+	FormatHelm = "Helm"
+	// FormatYAML is a YAML file, such as a Kubernetes manifest, that defines the image.
+	FormatYAML = "YAML"
+)
+
+const defaultHelmPath = "image.tag"
+
+// Update returns the given content of a file of the given format with the tag of the
+// image set to the given version. The path selects the version in the file as described
+// by the GitOpsSpec. The image is the repository of the image, without a tag.
+func Update(format string, content []byte, path, image, version string) ([]byte, error) {
+	doc := newDocument(content)
+
+	var err error
+	switch format {
+	case FormatKustomize:
+		if path == "" {
+			path = image
+		}
+		err = updateKustomization(doc, path, version)
+	case FormatHelm:
+		if path == "" {
+			path = defaultHelmPath
+		}
+		err = updateValue(doc, path, func(string) string { return version })
+	case FormatYAML:
+		if path == "" {
+			return nil, errors.New("no path of the image defined for YAML file")
+		}
+		err = updateValue(doc, path, func(ref string) string { return withTag(ref, version) })
+	default:
+		return nil, errors.Errorf("unknown gitops format %s", format)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return doc.Bytes()
+}
+
+// updateKustomization sets the newTag of the given image in the images of a kustomization.
+func updateKustomization(doc *document, image, version string) error {
+	for _, root := range doc.roots() {
+		line, _ := doc.key(root, "images")
+		if line < 0 {
+			continue
+		}
+		for _, item := range doc.items(doc.value(root, line)) {
+			nameLine, nameCol := doc.key(item, "name")
+			if nameLine < 0 {
+				continue
+			}
+			if name, _, _, err := doc.scalar(nameLine, nameCol); err != nil || name != image {
+				continue
+			}
+
+			if tagLine, tagCol := doc.key(item, "newTag"); tagLine >= 0 {
+				return doc.set(tagLine, tagCol, version)
+			}
+			doc.insert(item, "newTag", version)
+			return nil
+		}
+	}
+	return errors.Errorf("no image %s in the images of the kustomization", image)
+}
+
+// updateValue replaces the scalar at the given dotted path with the result of the given
+// function of its current value.
+func updateValue(doc *document, path string, value func(string) string) error {
+	line, col := doc.find(strings.Split(path, "."))
+	if line < 0 {
+		return errors.Errorf("no value at path %s", path)
+	}
+	current, _, _, err := doc.scalar(line, col)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get value at path %s", path)
+	}
+	return doc.set(line, col, value(current))
+}
+
+// withTag returns the given image reference with its tag, and any digest, replaced by
+// the given tag.
+func withTag(ref, tag string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref + ":" + tag
+}
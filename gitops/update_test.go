@@ -0,0 +1,129 @@
+package gitops
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpdateKustomize(t *testing.T) {
+	content := `resources:
+  - deployment.yaml
+# images deployed by cvmanager
+images:
+- name: nearmap/other
+  newTag: "1.0"
+- name: nearmap/app
+  newTag: abc # current version
+`
+	updated, err := Update(FormatKustomize, []byte(content), "", "nearmap/app", "def")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := strings.Replace(content, "newTag: abc #", "newTag: def #", 1)
+	if string(updated) != expected {
+		t.Errorf("Unexpected kustomization:\n%s", updated)
+	}
+
+	content = `images:
+  - name: nearmap/app
+    newName: registry.example.com/app
+`
+	updated, err = Update(FormatKustomize, []byte(content), "nearmap/app", "", "1234567")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = content + "    newTag: \"1234567\"\n"
+	if string(updated) != expected {
+		t.Errorf("Expected numeric tag to be quoted and added, got:\n%s", updated)
+	}
+
+	if _, err := Update(FormatKustomize, []byte(content), "", "nearmap/missing", "abc"); err == nil {
+		t.Errorf("Expected error for missing image")
+	}
+}
+
+func TestUpdateHelm(t *testing.T) {
+	content := `replicaCount: 2
+image:
+  repository: nearmap/app
+  # the tag is written by cvmanager
+  tag: 'abc'
+  pullPolicy: IfNotPresent
+sidecar:
+  image:
+    tag: abc
+`
+	updated, err := Update(FormatHelm, []byte(content), "", "nearmap/app", "def")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := strings.Replace(content, "tag: 'abc'", "tag: 'def'", 1)
+	if string(updated) != expected {
+		t.Errorf("Unexpected values:\n%s", updated)
+	}
+
+	updated, err = Update(FormatHelm, []byte(content), "sidecar.image.tag", "nearmap/app", "def")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(string(updated), "    tag: def\n") {
+		t.Errorf("Unexpected values:\n%s", updated)
+	}
+
+	if _, err := Update(FormatHelm, []byte(content), "image.missing", "nearmap/app", "def"); err == nil {
+		t.Errorf("Expected error for missing path")
+	}
+}
+
+func TestUpdateYAML(t *testing.T) {
+	content := `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          image: nearmap/sidecar:1.0
+        - name: app
+          image: "registry.example.com:5000/nearmap/app:abc@sha256:0123"
+          ports:
+            - containerPort: 80
+`
+	updated, err := Update(FormatYAML, []byte(content), "spec.template.spec.containers.1.image", "nearmap/app", "def")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := strings.Replace(content, "nearmap/app:abc@sha256:0123", "nearmap/app:def", 1)
+	if string(updated) != expected {
+		t.Errorf("Unexpected manifest:\n%s", updated)
+	}
+
+	if _, err := Update(FormatYAML, []byte(content), "", "nearmap/app", "def"); err == nil {
+		t.Errorf("Expected error for missing path")
+	}
+	if _, err := Update(FormatYAML, []byte(content), "spec.template.spec.containers.2.image", "nearmap/app", "def"); err == nil {
+		t.Errorf("Expected error for missing container")
+	}
+}
+
+func TestWithTag(t *testing.T) {
+	tests := map[string]string{
+		"nearmap/app":                      "nearmap/app:v2",
+		"nearmap/app:v1":                   "nearmap/app:v2",
+		"localhost:5000/nearmap/app":       "localhost:5000/nearmap/app:v2",
+		"localhost:5000/nearmap/app:v1":    "localhost:5000/nearmap/app:v2",
+		"nearmap/app:v1@sha256:0123456789": "nearmap/app:v2",
+	}
+	for ref, expected := range tests {
+		if actual := withTag(ref, "v2"); actual != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, ref, actual)
+		}
+	}
+}
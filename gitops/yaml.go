@@ -0,0 +1,258 @@
+package gitops
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// document is a YAML file that is edited line by line, so that the comments and
+// formatting of the lines that are not changed are preserved.
+type document struct {
+	lines []string
+}
+
+func newDocument(content []byte) *document {
+	return &document{lines: strings.Split(string(content), "\n")}
+}
+
+// Bytes returns the content of the document, which must be valid YAML.
+func (d *document) Bytes() ([]byte, error) {
+	content := []byte(strings.Join(d.lines, "\n"))
+	for _, b := range d.roots() {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(strings.Join(d.lines[b.start:b.end], "\n")), &v); err != nil {
+			return nil, errors.Wrap(err, "updated file is not valid YAML")
+		}
+	}
+	return content, nil
+}
+
+// block is the range of lines [start, end) of a block mapping or sequence. The content
+// of the first line starts at the given offset, which is after the dash of a sequence item.
+type block struct {
+	start, end int
+	offset     int
+}
+
+// roots returns the root blocks of each YAML document in the file.
+func (d *document) roots() []block {
+	var blocks []block
+	start := 0
+	for i, line := range d.lines {
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") {
+			blocks = append(blocks, block{start: start, end: i})
+			start = i + 1
+		}
+	}
+	return append(blocks, block{start: start, end: len(d.lines)})
+}
+
+// column returns the column of the content of line i of the block, or -1 if the line
+// has no content.
+func (d *document) column(b block, i int) int {
+	line := d.lines[i]
+	col := len(line) - len(strings.TrimLeft(line, " "))
+	if i == b.start && b.offset > col {
+		col = b.offset
+	}
+	if col >= len(line) || line[col] == '#' {
+		return -1
+	}
+	return col
+}
+
+// indent returns the column of the entries of the block, or -1 if it is empty.
+func (d *document) indent(b block) int {
+	for i := b.start; i < b.end; i++ {
+		if col := d.column(b, i); col >= 0 {
+			return col
+		}
+	}
+	return -1
+}
+
+// key returns the line of the given key of the mapping block and the column of its value,
+// or -1 if the block has no such key.
+func (d *document) key(b block, key string) (int, int) {
+	indent := d.indent(b)
+	if indent < 0 {
+		return -1, -1
+	}
+	for i := b.start; i < b.end; i++ {
+		if d.column(b, i) != indent {
+			continue
+		}
+		text := d.lines[i][indent:]
+		for _, k := range []string{key, `"` + key + `"`, "'" + key + "'"} {
+			if strings.HasPrefix(text, k+":") && (len(text) == len(k)+1 || text[len(k)+1] == ' ') {
+				return i, indent + len(k) + 1
+			}
+		}
+	}
+	return -1, -1
+}
+
+// value returns the block of the value of the key on the given line of the block.
+func (d *document) value(b block, line int) block {
+	indent := d.column(b, line)
+	end := line + 1
+	for ; end < b.end; end++ {
+		col := d.column(b, end)
+		if col < 0 {
+			continue
+		}
+		if col < indent || (col == indent && !isItem(d.lines[end][col:])) {
+			break
+		}
+	}
+	return block{start: line + 1, end: end}
+}
+
+// items returns the blocks of the items of the sequence block.
+func (d *document) items(b block) []block {
+	indent := d.indent(b)
+	if indent < 0 {
+		return nil
+	}
+	var items []block
+	for i := b.start; i < b.end; i++ {
+		if d.column(b, i) != indent || !isItem(d.lines[i][indent:]) {
+			continue
+		}
+		if len(items) > 0 {
+			items[len(items)-1].end = i
+		}
+		text := d.lines[i][indent+1:]
+		offset := indent + 1 + len(text) - len(strings.TrimLeft(text, " "))
+		items = append(items, block{start: i, end: b.end, offset: offset})
+	}
+	return items
+}
+
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// find returns the line and value column of the scalar at the given path of keys and
+// sequence indices, or -1 if there is none.
+func (d *document) find(path []string) (int, int) {
+	for _, root := range d.roots() {
+		if line, col := d.findIn(root, path); line >= 0 {
+			return line, col
+		}
+	}
+	return -1, -1
+}
+
+func (d *document) findIn(b block, path []string) (int, int) {
+	if index, err := strconv.Atoi(path[0]); err == nil {
+		items := d.items(b)
+		if index < 0 || index >= len(items) {
+			return -1, -1
+		}
+		item := items[index]
+		if len(path) == 1 {
+			return item.start, item.offset
+		}
+		return d.findIn(item, path[1:])
+	}
+
+	line, col := d.key(b, path[0])
+	if line < 0 || len(path) == 1 {
+		return line, col
+	}
+	return d.findIn(d.value(b, line), path[1:])
+}
+
+// scalar returns the scalar value at the given column of the line, and the columns of
+// its token, including any quotes.
+func (d *document) scalar(line, col int) (string, int, int, error) {
+	text := d.lines[line]
+	start := col
+	for start < len(text) && text[start] == ' ' {
+		start++
+	}
+	if start == len(text) || text[start] == '#' {
+		return "", start, start, errors.Errorf("line %d has no scalar value", line+1)
+	}
+
+	switch text[start] {
+	case '"', '\'':
+		quote := text[start]
+		for end := start + 1; end < len(text); end++ {
+			if quote == '"' && text[end] == '\\' {
+				end++
+				continue
+			}
+			if text[end] != quote {
+				continue
+			}
+			if quote == '\'' && end+1 < len(text) && text[end+1] == '\'' {
+				end++
+				continue
+			}
+			var value string
+			if err := yaml.Unmarshal([]byte(text[start:end+1]), &value); err != nil {
+				return "", start, end + 1, errors.Wrapf(err, "failed to parse value on line %d", line+1)
+			}
+			return value, start, end + 1, nil
+		}
+		return "", start, start, errors.Errorf("line %d has an unterminated string", line+1)
+	case '|', '>', '[', '{', '&', '*', '!':
+		return "", start, start, errors.Errorf("line %d does not have a plain scalar value", line+1)
+	}
+
+	end := len(text)
+	if i := strings.Index(text[start:], " #"); i >= 0 {
+		end = start + i
+	}
+	end = start + len(strings.TrimRight(text[start:end], " "))
+	return text[start:end], start, end, nil
+}
+
+// set replaces the scalar value at the given column of the line, keeping its quotes.
+func (d *document) set(line, col int, value string) error {
+	_, start, end, err := d.scalar(line, col)
+	if err != nil {
+		return err
+	}
+	text := d.lines[line]
+	d.lines[line] = text[:start] + token(value, text[start]) + text[end:]
+	return nil
+}
+
+// insert inserts the given key and value as the last entry of the mapping block.
+func (d *document) insert(b block, key, value string) {
+	indent := d.indent(b)
+	last := b.start
+	for i := b.start; i < b.end; i++ {
+		if d.column(b, i) >= 0 {
+			last = i
+		}
+	}
+	line := strings.Repeat(" ", indent) + key + ": " + token(value, 0)
+
+	lines := append([]string{}, d.lines[:last+1]...)
+	lines = append(lines, line)
+	d.lines = append(lines, d.lines[last+1:]...)
+}
+
+// token returns the YAML token of the given string value, quoted with the given quote
+// if it is one, or with double quotes if the value would otherwise not be a string.
+func token(value string, quote byte) string {
+	switch quote {
+	case '\'':
+		return "'" + strings.Replace(value, "'", "''", -1) + "'"
+	case '"':
+		return strconv.Quote(value)
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil || v != value {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -33,6 +33,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&ContainerVersion{},
 		&ContainerVersionList{},
+		&RolloutRecord{},
+		&RolloutRecordList{},
+		&Promotion{},
+		&PromotionList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -6,6 +6,17 @@ import (
 
 const CVAPP = "cvapp"
 
+// Drift policies determine how out-of-band changes to the version of a managed
+// workload are handled.
+const (
+	// DriftPolicyRevert reverts the workload to the current version. This is the default.
+	DriftPolicyRevert = "revert"
+	// DriftPolicyAlert raises an event but leaves the workload unchanged.
+	DriftPolicyAlert = "alert"
+	// DriftPolicyAdopt accepts the workload's version as the current version.
+	DriftPolicyAdopt = "adopt"
+)
+
 // +genclient
 // +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -32,12 +43,37 @@ type ContainerVersionSpec struct {
 	Selector  map[string]string `json:"selector,omitempty" protobuf:"bytes,2,rep,name=selector"`
 	Container ContainerSpec     `json:"container"`
 
+	// Containers lists further containers, or init containers, of the workloads that run
+	// the version of the ContainerVersion. All containers are patched in a single patch.
+	Containers []ContainerRef `json:"containers,omitempty"`
+
+	// WorkloadKinds restricts the kinds of workload (e.g. Deployment, CronJob) that are
+	// managed by this resource. All kinds are managed if empty.
+	WorkloadKinds []string `json:"workloadKinds,omitempty"`
+
 	Strategy *StrategySpec `json:"strategy"`
 
 	History  HistorySpec  `json:"history"`
 	Rollback RollbackSpec `json:"rollback"`
 
 	Config *ConfigSpec `json:"config"`
+
+	// DriftPolicy is one of revert, alert or adopt. Defaults to revert. Only Deployments
+	// are checked for drift.
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+
+	// Retry overrides the default policy for retrying failed rollout operations.
+	Retry *RetrySpec `json:"retry,omitempty"`
+
+	// Notifications lists the channels that are notified of rollout events.
+	Notifications []NotificationSpec `json:"notifications,omitempty"`
+
+	// SCM reports rollouts as deployments of the commit of the version to a source
+	// code management service.
+	SCM *SCMSpec `json:"scm,omitempty"`
+
+	// GitOps writes deployed versions back to a manifests repository.
+	GitOps *GitOpsSpec `json:"gitops,omitempty"`
 }
 
 // ContainerSpec defines a name of container and option container level verification step
@@ -46,6 +82,14 @@ type ContainerSpec struct {
 	Verify []VerifySpec `json:"verify"`
 }
 
+// ContainerRef names a container or init container of the workloads of a ContainerVersion.
+type ContainerRef struct {
+	Name string `json:"name"`
+
+	// ImageRepo overrides the image repository of the ContainerVersion for the container.
+	ImageRepo string `json:"imageRepo,omitempty"`
+}
+
 // StrategySpec defines a rollout strategy and optional verification steps.
 type StrategySpec struct {
 	Kind      string         `json:"kind"`
@@ -66,6 +110,49 @@ type VerifySpec struct {
 	Kind  string `json:"kind"`
 	Image string `json:"image"`
 	Tag   string `json:"tag"`
+
+	// KeysFrom selects the public keys that verify the signatures of the image being
+	// rolled out, for the Signature kind.
+	KeysFrom *KeysSource `json:"keysFrom,omitempty"`
+
+	// Severity is the lowest severity of the vulnerabilities that fail the rollout, for the
+	// Scan kind. One of LOW, MEDIUM, HIGH or CRITICAL, defaulting to HIGH.
+	Severity string `json:"severity,omitempty"`
+
+	// BlockUnknown fails the rollout for vulnerabilities of unknown severity as if they had
+	// the given severity, for the Scan kind. They are otherwise ignored.
+	BlockUnknown bool `json:"blockUnknown,omitempty"`
+
+	// ReportFrom selects a Trivy or Grype JSON report of the image being rolled out, for
+	// the Scan kind. The findings of ECR image scanning are used if it is not set.
+	ReportFrom *ReportSource `json:"reportFrom,omitempty"`
+
+	// Allowlist lists the vulnerabilities that do not fail the rollout, for the Scan kind.
+	Allowlist []AllowedVulnerability `json:"allowlist,omitempty"`
+}
+
+// KeysSource selects PEM encoded public keys from a key of a secret or a config map in
+// the namespace of the ContainerVersion. The key may hold several public keys.
+type KeysSource struct {
+	Secret    *SecretKeyRef    `json:"secret,omitempty"`
+	ConfigMap *ConfigMapKeyRef `json:"configMap,omitempty"`
+}
+
+// ReportSource selects a vulnerability report from either a key of a config map in the
+// namespace of the ContainerVersion, defaulting to the version being rolled out, or an OCI
+// artifact in the image repository tagged with the digest of the image, sha256-<hex>.scan.
+type ReportSource struct {
+	ConfigMap *ConfigMapKeyRef `json:"configMap,omitempty"`
+	Artifact  bool             `json:"artifact,omitempty"`
+}
+
+// AllowedVulnerability is a vulnerability, such as a CVE ID, that is accepted until it expires.
+type AllowedVulnerability struct {
+	ID string `json:"id"`
+
+	// Expires is the date (YYYY-MM-DD) or RFC 3339 time after which the vulnerability
+	// fails the rollout again. The vulnerability is always allowed if it is not set.
+	Expires string `json:"expires,omitempty"`
 }
 
 // HistorySpec contains configuration for saving rollout history.
@@ -79,6 +166,104 @@ type RollbackSpec struct {
 	Enabled bool `json:"enabled"`
 }
 
+// RetrySpec contains configuration for retrying failed rollout operations.
+// Unset values use the defaults of the state machine.
+type RetrySpec struct {
+	MaxAttempts         int `json:"maxAttempts,omitempty"`
+	InitialDelaySeconds int `json:"initialDelaySeconds,omitempty"`
+	MaxDelaySeconds     int `json:"maxDelaySeconds,omitempty"`
+	MaxElapsedSeconds   int `json:"maxElapsedSeconds,omitempty"`
+}
+
+// NotificationSpec defines a channel that is notified of rollout events.
+type NotificationSpec struct {
+	// Kind is one of Slack, Teams or Webhook.
+	Kind string `json:"kind"`
+
+	// URL is the URL that notifications are posted to. URLFrom takes precedence
+	// when set, for URLs that contain credentials such as Slack webhook URLs.
+	URL     string        `json:"url,omitempty"`
+	URLFrom *SecretKeyRef `json:"urlFrom,omitempty"`
+
+	// SigningSecret is the key with which Webhook notifications are signed.
+	SigningSecret *SecretKeyRef `json:"signingSecret,omitempty"`
+
+	// Events restricts notifications to the given rollout events. All events
+	// are notified if empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// SCMSpec defines the repository whose deployments report the rollouts of versions.
+// Versions must be commit SHAs of the repository.
+type SCMSpec struct {
+	// Kind is one of GitHub or GitLab.
+	Kind string `json:"kind"`
+
+	// Repository is the owner/name of a GitHub repository or the path of a GitLab project.
+	Repository string `json:"repository"`
+
+	// BaseURL is the URL of the API, for GitHub Enterprise or self-hosted GitLab.
+	// Defaults to the public API of the kind.
+	BaseURL string `json:"baseURL,omitempty"`
+
+	// TokenFrom selects the secret key holding the API token.
+	TokenFrom SecretKeyRef `json:"tokenFrom"`
+
+	// EnvironmentFrom is one of tag or namespace, selecting whether the name of the
+	// deployment environment is the tag or the namespace of the ContainerVersion.
+	// Defaults to tag.
+	EnvironmentFrom string `json:"environmentFrom,omitempty"`
+}
+
+// GitOpsSpec defines the file of a Git repository to which deployed versions are written back.
+type GitOpsSpec struct {
+	// Repository is the URL of the repository, cloned over SSH or HTTPS, or a local path.
+	Repository string `json:"repository"`
+
+	// Branch is the branch that versions are written to, or the target branch of
+	// merge requests. Defaults to master.
+	Branch string `json:"branch,omitempty"`
+
+	// File is the path of the file that defines the version, relative to the root
+	// of the repository.
+	File string `json:"file"`
+
+	// Format is one of Kustomize, Helm or YAML.
+	Format string `json:"format"`
+
+	// Path selects the version in the file. It is the name of the image in the images
+	// of a kustomization (defaults to the imageRepo), the dotted path of the tag in
+	// Helm values (defaults to image.tag) or the dotted path of the image in a YAML file.
+	Path string `json:"path,omitempty"`
+
+	// Message is a Go template of the commit message.
+	Message string `json:"message,omitempty"`
+
+	// CredentialsFrom selects the secret key holding the SSH private key or HTTPS token
+	// used to access the repository.
+	CredentialsFrom *SecretKeyRef `json:"credentialsFrom,omitempty"`
+
+	// KnownHostsFrom selects the secret key holding the known_hosts entries of the host
+	// of the repository, which are required for repositories accessed over SSH.
+	KnownHostsFrom *SecretKeyRef `json:"knownHostsFrom,omitempty"`
+
+	// MergeRequest opens a merge request with the scm of the ContainerVersion instead
+	// of pushing to the branch.
+	MergeRequest bool `json:"mergeRequest,omitempty"`
+}
+
+// SecretKeyRef selects a key of a secret in the namespace of the ContainerVersion.
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// ConfigMapKeyRef selects a key of a config map in the namespace of the ContainerVersion.
+type ConfigMapKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
 // ConfigSpec is spec for Config resources
 type ConfigSpec struct {
 	Name string `json:"name"`
@@ -97,6 +282,10 @@ type ContainerVersionStatus struct {
 
 	// SuccessVersion is the last version that was successfully deployed.
 	SuccessVersion string `json:"successVersion"`
+
+	// AdoptedFrom is the version that was replaced when an out-of-band version was
+	// adopted as the current version. It is cleared by the next rollout.
+	AdoptedFrom string `json:"adoptedFrom,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -108,3 +297,126 @@ type ContainerVersionList struct {
 
 	Items []ContainerVersion `json:"items"`
 }
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RolloutRecord is a record of a rollout performed by cvmanager, stored
+// when the CRD history backend is used.
+type RolloutRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec RolloutRecordSpec `json:"spec"`
+}
+
+// RolloutRecordSpec contains the details of a rollout.
+type RolloutRecordSpec struct {
+	// History is the name of the history that the record belongs to.
+	History string `json:"history"`
+
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	Digest          string `json:"digest,omitempty"`
+	Status          string `json:"status"`
+	Strategy        string `json:"strategy,omitempty"`
+
+	Time            metav1.Time `json:"time"`
+	DurationSeconds float64     `json:"durationSeconds,omitempty"`
+
+	Verifiers []RolloutVerifierResult `json:"verifiers,omitempty"`
+
+	Actor   string `json:"actor,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// RolloutVerifierResult contains the result of a verification performed during a rollout.
+type RolloutVerifierResult struct {
+	Kind    string `json:"kind"`
+	Image   string `json:"image,omitempty"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// RolloutRecordList is a list of RolloutRecord resources
+type RolloutRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []RolloutRecord `json:"items"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Promotion promotes versions that were successfully deployed by a source
+// ContainerVersion by tagging them with a target tag, which is typically
+// watched by the ContainerVersion of another environment.
+type Promotion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PromotionSpec   `json:"spec"`
+	Status PromotionStatus `json:"status"`
+}
+
+// PromotionSpec is spec for Promotion resources
+type PromotionSpec struct {
+	// Source is the name of the ContainerVersion whose versions are promoted, in
+	// the namespace of the Promotion unless SourceNamespace is set.
+	Source          string `json:"source"`
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+
+	// TargetTag is the tag that is added to promoted versions.
+	TargetTag string `json:"targetTag"`
+
+	Conditions PromotionConditions `json:"conditions,omitempty"`
+}
+
+// PromotionConditions are the conditions that a successful version of the source
+// must meet before it is promoted.
+type PromotionConditions struct {
+	// SucceededForSeconds is the minimum time that the version must have been
+	// successfully deployed by the source.
+	SucceededForSeconds int `json:"succeededForSeconds,omitempty"`
+
+	// NoRollback requires that the history of the source has no rollback of the
+	// version, or since the version was deployed.
+	NoRollback bool `json:"noRollback,omitempty"`
+}
+
+// PromotionStatus is status for Promotion resources
+type PromotionStatus struct {
+	// Version is the last promoted version and Time the time it was promoted.
+	Version string      `json:"version,omitempty"`
+	Time    metav1.Time `json:"time,omitempty"`
+
+	// Message describes why the current version of the source has not been promoted.
+	Message string `json:"message,omitempty"`
+
+	// Records are the most recent promotions, most recent first.
+	Records []PromotionRecord `json:"records,omitempty"`
+}
+
+// PromotionRecord is a record of a promoted version.
+type PromotionRecord struct {
+	Version string      `json:"version"`
+	Time    metav1.Time `json:"time"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PromotionList is a list of Promotion resources
+type PromotionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []Promotion `json:"items"`
+}
@@ -28,6 +28,8 @@ import (
 type CustomV1Interface interface {
 	RESTClient() rest.Interface
 	ContainerVersionsGetter
+	PromotionsGetter
+	RolloutRecordsGetter
 }
 
 // CustomV1Client is used to interact with features provided by the custom.k8s.io group.
@@ -39,6 +41,14 @@ func (c *CustomV1Client) ContainerVersions(namespace string) ContainerVersionInt
 	return newContainerVersions(c, namespace)
 }
 
+func (c *CustomV1Client) Promotions(namespace string) PromotionInterface {
+	return newPromotions(c, namespace)
+}
+
+func (c *CustomV1Client) RolloutRecords(namespace string) RolloutRecordInterface {
+	return newRolloutRecords(c, namespace)
+}
+
 // NewForConfig creates a new CustomV1Client for the given config.
 func NewForConfig(c *rest.Config) (*CustomV1Client, error) {
 	config := *c
@@ -32,6 +32,14 @@ func (c *FakeCustomV1) ContainerVersions(namespace string) v1.ContainerVersionIn
 	return &FakeContainerVersions{c, namespace}
 }
 
+func (c *FakeCustomV1) Promotions(namespace string) v1.PromotionInterface {
+	return &FakePromotions{c, namespace}
+}
+
+func (c *FakeCustomV1) RolloutRecords(namespace string) v1.RolloutRecordInterface {
+	return &FakeRolloutRecords{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeCustomV1) RESTClient() rest.Interface {
@@ -19,3 +19,7 @@ limitations under the License.
 package v1
 
 type ContainerVersionExpansion interface{}
+
+type PromotionExpansion interface{}
+
+type RolloutRecordExpansion interface{}
@@ -26,6 +26,10 @@ import (
 type Interface interface {
 	// ContainerVersions returns a ContainerVersionInformer.
 	ContainerVersions() ContainerVersionInformer
+	// Promotions returns a PromotionInformer.
+	Promotions() PromotionInformer
+	// RolloutRecords returns a RolloutRecordInformer.
+	RolloutRecords() RolloutRecordInformer
 }
 
 type version struct {
@@ -43,3 +47,13 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) ContainerVersions() ContainerVersionInformer {
 	return &containerVersionInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// Promotions returns a PromotionInformer.
+func (v *version) Promotions() PromotionInformer {
+	return &promotionInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// RolloutRecords returns a RolloutRecordInformer.
+func (v *version) RolloutRecords() RolloutRecordInformer {
+	return &rolloutRecordInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -55,6 +55,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=custom.k8s.io, Version=v1
 	case v1.SchemeGroupVersion.WithResource("containerversions"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Custom().V1().ContainerVersions().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("promotions"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Custom().V1().Promotions().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("rolloutrecords"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Custom().V1().RolloutRecords().Informer()}, nil
 
 	}
 
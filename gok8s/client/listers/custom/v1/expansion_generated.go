@@ -25,3 +25,19 @@ type ContainerVersionListerExpansion interface{}
 // ContainerVersionNamespaceListerExpansion allows custom methods to be added to
 // ContainerVersionNamespaceLister.
 type ContainerVersionNamespaceListerExpansion interface{}
+
+// PromotionListerExpansion allows custom methods to be added to
+// PromotionLister.
+type PromotionListerExpansion interface{}
+
+// PromotionNamespaceListerExpansion allows custom methods to be added to
+// PromotionNamespaceLister.
+type PromotionNamespaceListerExpansion interface{}
+
+// RolloutRecordListerExpansion allows custom methods to be added to
+// RolloutRecordLister.
+type RolloutRecordListerExpansion interface{}
+
+// RolloutRecordNamespaceListerExpansion allows custom methods to be added to
+// RolloutRecordNamespaceLister.
+type RolloutRecordNamespaceListerExpansion interface{}
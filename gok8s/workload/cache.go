@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const informerResync = 5 * time.Minute
+
+// informerCache provides informer backed listing of workloads. Informer factories are
+// created lazily per namespace and individual informers are only started for the kinds
+// of workload that are actually listed.
+type informerCache struct {
+	cs     kubernetes.Interface
+	stopCh <-chan struct{}
+
+	mu        sync.Mutex
+	factories map[string]k8sinformers.SharedInformerFactory
+	synced    map[string]bool
+}
+
+func newInformerCache(cs kubernetes.Interface, stopCh <-chan struct{}) *informerCache {
+	return &informerCache{
+		cs:        cs,
+		stopCh:    stopCh,
+		factories: make(map[string]k8sinformers.SharedInformerFactory),
+		synced:    make(map[string]bool),
+	}
+}
+
+// factory returns the informer factory for the given namespace, creating it if required.
+func (ic *informerCache) factory(namespace string) k8sinformers.SharedInformerFactory {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	f, ok := ic.factories[namespace]
+	if !ok {
+		glog.V(2).Infof("Creating workload informer factory for namespace=%q", namespace)
+		f = k8sinformers.NewFilteredSharedInformerFactory(ic.cs, informerResync, namespace, nil)
+		ic.factories[namespace] = f
+	}
+	return f
+}
+
+// ensure starts the given informer of the namespace's factory if required and waits
+// for its cache to sync.
+func (ic *informerCache) ensure(namespace, kind string, informer cache.SharedIndexInformer) error {
+	key := namespace + "/" + kind
+
+	ic.mu.Lock()
+	if ic.synced[key] {
+		ic.mu.Unlock()
+		return nil
+	}
+	f := ic.factories[namespace]
+	ic.mu.Unlock()
+
+	glog.V(2).Infof("Starting %s informer for namespace=%q", kind, namespace)
+	f.Start(ic.stopCh)
+	if !cache.WaitForCacheSync(ic.stopCh, informer.HasSynced) {
+		return errors.Errorf("failed to sync %s informer cache for namespace %q", kind, namespace)
+	}
+
+	ic.mu.Lock()
+	ic.synced[key] = true
+	ic.mu.Unlock()
+	return nil
+}
+
+// informer returns the shared informer of the namespace's factory for the given kind
+// of workload.
+func (ic *informerCache) informer(namespace, kind string) (cache.SharedIndexInformer, error) {
+	f := ic.factory(namespace)
+	switch kind {
+	case TypeDeployment:
+		return f.Apps().V1().Deployments().Informer(), nil
+	case TypeCronJob:
+		return f.Batch().V1beta1().CronJobs().Informer(), nil
+	case TypeDaemonSet:
+		return f.Apps().V1().DaemonSets().Informer(), nil
+	case TypeJob:
+		return f.Batch().V1().Jobs().Informer(), nil
+	case TypePod:
+		return f.Core().V1().Pods().Informer(), nil
+	case TypeReplicaSet:
+		return f.Apps().V1().ReplicaSets().Informer(), nil
+	case TypeStatefulSet:
+		return f.Apps().V1().StatefulSets().Informer(), nil
+	}
+	return nil, errors.Errorf("unsupported workload kind %s", kind)
+}
+
+// list returns copies of the cached workloads of the given kind in the namespace that
+// match the selector.
+func (ic *informerCache) list(namespace, kind string, selector labels.Selector) ([]runtime.Object, error) {
+	inf, err := ic.informer(namespace, kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := ic.ensure(namespace, kind, inf); err != nil {
+		return nil, err
+	}
+
+	var result []runtime.Object
+	err = cache.ListAllByNamespace(inf.GetIndexer(), namespace, selector, func(obj interface{}) {
+		result = append(result, obj.(runtime.Object).DeepCopyObject())
+	})
+	return result, err
+}
+
+// hasController returns true if the given object is managed by a controller such as
+// a Deployment or Job, in which case the controller is managed as the workload instead.
+func hasController(obj metav1.Object) bool {
+	return metav1.GetControllerOf(obj) != nil
+}
@@ -23,7 +23,7 @@ func (k *Provider) SyncVersionConfig(cv *cv1.ContainerVersion, version string) e
 			_, err = k.cs.CoreV1().ConfigMaps(k.namespace).Create(
 				newVersionConfig(k.namespace, cv.Spec.Config.Name, cv.Spec.Config.Key, version))
 			if err != nil {
-				k.options.Recorder.Event(events.Warning, "FailedCreateVersionConfigMap", "Failed to create version configmap")
+				k.options.Recorder.Event(events.Warning, events.ReasonCreateVersionConfigMapFailed, "Failed to create version configmap")
 				return errors.Wrapf(err, "failed to create version configmap from %s/%s:%s",
 					k.namespace, cv.Spec.Config.Name, cv.Spec.Config.Key)
 			}
@@ -47,7 +47,7 @@ func (k *Provider) SyncVersionConfig(cv *cv1.ContainerVersion, version string) e
 	// }`, s.Config.ConfigMap.Key, version)))
 	_, err = k.cs.CoreV1().ConfigMaps(k.namespace).Update(cm)
 	if err != nil {
-		k.options.Recorder.Event(events.Warning, "FailedUpdateVersionConfigMao", "Failed to update version configmap")
+		k.options.Recorder.Event(events.Warning, events.ReasonUpdateVersionConfigMapFailed, "Failed to update version configmap")
 		return errors.Wrapf(err, "failed to update version configmap from %s/%s:%s",
 			k.namespace, cv.Spec.Config.Name, cv.Spec.Config.Key)
 	}
@@ -0,0 +1,189 @@
+package k8s
+
+import (
+	"encoding/json"
+	"strings"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Container is a container or init container of a pod spec that is managed by a ContainerVersion.
+type Container struct {
+	corev1.Container
+
+	// Init is true for init containers.
+	Init bool
+
+	// ImageRepo is the repository that versions of the container are rolled out from.
+	ImageRepo string
+}
+
+// Version returns the version of the container's image, or an empty string if the image
+// has no tag.
+func (c Container) Version() string {
+	parts := strings.SplitN(c.Image, ":", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ContainerImage sets the image of a container or init container of a pod spec.
+type ContainerImage struct {
+	Name  string
+	Image string
+	Init  bool
+}
+
+// ContainerRefs returns the containers managed by the cv, which are the container of the
+// spec and the containers it lists, with their image repositories. A container that is
+// named more than once is only returned for its first occurrence.
+func ContainerRefs(cv *cv1.ContainerVersion) []cv1.ContainerRef {
+	var refs []cv1.ContainerRef
+	seen := make(map[string]bool)
+	add := func(ref cv1.ContainerRef) {
+		if ref.Name == "" || seen[ref.Name] {
+			return
+		}
+		seen[ref.Name] = true
+		if ref.ImageRepo == "" {
+			ref.ImageRepo = cv.Spec.ImageRepo
+		}
+		refs = append(refs, ref)
+	}
+
+	add(cv1.ContainerRef{Name: cv.Spec.Container.Name})
+	for _, ref := range cv.Spec.Containers {
+		add(ref)
+	}
+	return refs
+}
+
+// ImageRepos returns the distinct image repositories of the containers managed by the cv,
+// in the order of the cv spec, or the image repository of the cv if it names no containers.
+func ImageRepos(cv *cv1.ContainerVersion) []string {
+	var repos []string
+	seen := make(map[string]bool)
+	for _, ref := range ContainerRefs(cv) {
+		if !seen[ref.ImageRepo] {
+			seen[ref.ImageRepo] = true
+			repos = append(repos, ref.ImageRepo)
+		}
+	}
+	if len(repos) == 0 {
+		repos = append(repos, cv.Spec.ImageRepo)
+	}
+	return repos
+}
+
+// Containers returns the containers and init containers of the pod spec that are managed
+// by the cv, in the order of the cv spec. Returns an error if the pod spec does not have
+// one of the containers.
+func Containers(cv *cv1.ContainerVersion, podSpec corev1.PodSpec) ([]Container, error) {
+	refs := ContainerRefs(cv)
+	if len(refs) == 0 {
+		return nil, errors.Errorf("cv %s does not name any containers", cv.Name)
+	}
+
+	var containers []Container
+	for _, ref := range refs {
+		container, ok := findContainer(podSpec, ref)
+		if !ok {
+			return nil, errors.Errorf("no container of name %s was found in workload", ref.Name)
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// findContainer returns the container or init container of the pod spec with the name of
+// the given reference.
+func findContainer(podSpec corev1.PodSpec, ref cv1.ContainerRef) (Container, bool) {
+	for _, c := range podSpec.Containers {
+		if c.Name == ref.Name {
+			return Container{Container: c, ImageRepo: ref.ImageRepo}, true
+		}
+	}
+	for _, c := range podSpec.InitContainers {
+		if c.Name == ref.Name {
+			return Container{Container: c, Init: true, ImageRepo: ref.ImageRepo}, true
+		}
+	}
+	return Container{}, false
+}
+
+// VersionImages returns the images that roll out the given version to the containers.
+func VersionImages(containers []Container, version string) []ContainerImage {
+	var images []ContainerImage
+	for _, c := range containers {
+		images = append(images, ContainerImage{Name: c.Name, Image: c.ImageRepo + ":" + version, Init: c.Init})
+	}
+	return images
+}
+
+// CurrentImages returns the images that the containers currently run, for instance to roll
+// them back after they have been patched.
+func CurrentImages(containers []Container) []ContainerImage {
+	var images []ContainerImage
+	for _, c := range containers {
+		images = append(images, ContainerImage{Name: c.Name, Image: c.Image, Init: c.Init})
+	}
+	return images
+}
+
+// podSpecPatch returns a strategic merge patch that sets the images of the containers and
+// init containers of the pod spec at the given path of the workload, such as spec.template.spec.
+func podSpecPatch(images []ContainerImage, path ...string) ([]byte, error) {
+	type container struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+	var spec struct {
+		Containers     []container `json:"containers,omitempty"`
+		InitContainers []container `json:"initContainers,omitempty"`
+	}
+	for _, image := range images {
+		c := container{Name: image.Name, Image: image.Image}
+		if image.Init {
+			spec.InitContainers = append(spec.InitContainers, c)
+		} else {
+			spec.Containers = append(spec.Containers, c)
+		}
+	}
+
+	var patch interface{} = spec
+	for i := len(path) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{path[i]: patch}
+	}
+	data, err := json.Marshal(patch)
+	return data, errors.WithStack(err)
+}
+
+// newResource returns a Resource for the workload with the given type, name and pod spec,
+// or nil if the pod spec does not have the containers of the cv.
+func newResource(cv *cv1.ContainerVersion, typ, name string, podSpec corev1.PodSpec) *Resource {
+	containers, err := Containers(cv, podSpec)
+	if err != nil {
+		return nil
+	}
+
+	resource := &Resource{
+		Namespace: cv.Namespace,
+		Name:      name,
+		Type:      typ,
+		Container: containers[0].Name,
+		Version:   containers[0].Version(),
+		CV:        cv.Name,
+		Tag:       cv.Spec.Tag,
+	}
+	for _, c := range containers {
+		resource.Containers = append(resource.Containers, ResourceContainer{
+			Name:    c.Name,
+			Version: c.Version(),
+			Init:    c.Init,
+		})
+	}
+	return resource
+}
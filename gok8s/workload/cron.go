@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	v1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	goappsv1beta1 "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
@@ -51,6 +52,11 @@ func (cj *CronJob) Namespace() string {
 	return cj.cronJob.Namespace
 }
 
+// Object implements the Workload interface.
+func (cj *CronJob) Object() runtime.Object {
+	return cj.cronJob
+}
+
 // Type implements the Workload interface.
 func (cj *CronJob) Type() string {
 	return TypeCronJob
@@ -77,42 +83,20 @@ func (cj *CronJob) PodTemplateSpec() corev1.PodTemplateSpec {
 	return cj.cronJob.Spec.JobTemplate.Spec.Template
 }
 
-var (
-	cronJobPatchPodJSON = fmt.Sprintf(`
-	{
-		"spec": {
-			"jobTemplate": %s
-			}
-		}
-	}
-	`, podTemplateSpecJSON)
-)
-
 // PatchPodSpec implements the Workload interface.
-func (cj *CronJob) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := cj.client.Patch(cj.cronJob.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(cronJobPatchPodJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (cj *CronJob) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec", "jobTemplate", "spec", "template", "spec")
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for CronJOb %s", cj.cronJob.Name)
+		return errors.WithStack(err)
+	}
+	_, err = cj.client.Patch(cj.cronJob.ObjectMeta.Name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return errors.Wrapf(err, "failed to patch pod template spec containers for CronJob %s", cj.cronJob.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (cj *CronJob) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range cj.cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      cj.cronJob.Name,
-				Type:      TypeCronJob,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypeCronJob, cj.cronJob.Name, cj.cronJob.Spec.JobTemplate.Spec.Template.Spec)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	goappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
@@ -49,6 +50,11 @@ func (ds *DaemonSet) Namespace() string {
 	return ds.daemonSet.Namespace
 }
 
+// Object implements the Workload interface.
+func (ds *DaemonSet) Object() runtime.Object {
+	return ds.daemonSet
+}
+
 // Type implements the Workload interface.
 func (ds *DaemonSet) Type() string {
 	return TypeDaemonSet
@@ -76,30 +82,19 @@ func (ds *DaemonSet) PodTemplateSpec() corev1.PodTemplateSpec {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (ds *DaemonSet) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := ds.client.Patch(ds.daemonSet.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (ds *DaemonSet) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec", "template", "spec")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = ds.client.Patch(ds.daemonSet.ObjectMeta.Name, types.StrategicMergePatchType, patch)
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for DaemonSet %s", ds.daemonSet.Name)
+		return errors.Wrapf(err, "failed to patch pod template spec containers for DaemonSet %s", ds.daemonSet.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (ds *DaemonSet) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range ds.daemonSet.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      ds.daemonSet.Name,
-				Type:      TypeDaemonSet,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypeDaemonSet, ds.daemonSet.Name, ds.daemonSet.Spec.Template.Spec)
 }
@@ -11,6 +11,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	goappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
@@ -67,6 +68,11 @@ func (d *Deployment) Namespace() string {
 	return d.deployment.Namespace
 }
 
+// Object implements the Workload interface.
+func (d *Deployment) Object() runtime.Object {
+	return d.deployment
+}
+
 // Type implements the Workload interface.
 func (d *Deployment) Type() string {
 	return TypeDeployment
@@ -130,12 +136,15 @@ func (d *Deployment) PodTemplateSpec() corev1.PodTemplateSpec {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (d *Deployment) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
+func (d *Deployment) PatchPodSpec(images []ContainerImage) error {
 	// TODO: should we update the deployment with the returned patch version?
-	_, err := d.client.Patch(d.deployment.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+	patch, err := podSpecPatch(images, "spec", "template", "spec")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = d.client.Patch(d.deployment.ObjectMeta.Name, types.StrategicMergePatchType, patch)
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for deployment %s", d.deployment.Name)
+		return errors.Wrapf(err, "failed to patch pod template spec containers for deployment %s", d.deployment.Name)
 	}
 	return nil
 }
@@ -223,20 +232,9 @@ func (d *Deployment) PatchNumReplicas(num int32) error {
 
 // AsResource implements the Workload interface.
 func (d *Deployment) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range d.deployment.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace:     cv.Namespace,
-				Name:          d.deployment.Name,
-				Type:          TypeDeployment,
-				Container:     c.Name,
-				Version:       version(c.Image),
-				AvailablePods: d.deployment.Status.AvailableReplicas,
-				CV:            cv.Name,
-				Tag:           cv.Spec.Tag,
-			}
-		}
+	resource := newResource(cv, TypeDeployment, d.deployment.Name, d.deployment.Spec.Template.Spec)
+	if resource != nil {
+		resource.AvailablePods = d.deployment.Status.AvailableReplicas
 	}
-
-	return nil
+	return resource
 }
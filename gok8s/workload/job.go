@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	gobatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
@@ -49,6 +50,11 @@ func (j *Job) Namespace() string {
 	return j.job.Namespace
 }
 
+// Object implements the Workload interface.
+func (j *Job) Object() runtime.Object {
+	return j.job
+}
+
 // Type implements the Workload interface.
 func (j *Job) Type() string {
 	return TypeJob
@@ -76,30 +82,19 @@ func (j *Job) PodTemplateSpec() corev1.PodTemplateSpec {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (j *Job) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := j.client.Patch(j.job.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (j *Job) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec", "template", "spec")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = j.client.Patch(j.job.ObjectMeta.Name, types.StrategicMergePatchType, patch)
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for Job %s", j.job.Name)
+		return errors.Wrapf(err, "failed to patch pod template spec containers for Job %s", j.job.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (j *Job) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range j.job.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      j.job.Name,
-				Type:      TypeJob,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypeJob, j.job.Name, j.job.Spec.Template.Spec)
 }
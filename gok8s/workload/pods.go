@@ -10,31 +10,12 @@ import (
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	gocorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
-const (
-	podTemplateSpecJSON = `
-						{
-							"spec": {
-								"template": {
-									"spec": {
-										"containers": [
-												{
-													"name":  "%s",
-													"image": "%s:%s"
-												}
-											]
-										}
-									}
-								}
-							}
-						}
-						`
-)
-
 const (
 	TypePod = "Pod"
 )
@@ -71,6 +52,11 @@ func (p *Pod) Namespace() string {
 	return p.pod.Namespace
 }
 
+// Object implements the Workload interface.
+func (p *Pod) Object() runtime.Object {
+	return p.pod
+}
+
 // Type implements the Workload interface.
 func (p *Pod) Type() string {
 	return TypePod
@@ -93,68 +79,54 @@ func (p *Pod) ProgressHealth(startTime time.Time) (*bool, error) {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (p *Pod) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := p.client.Patch(p.pod.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (p *Pod) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec")
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for Pod %s", p.pod.Name)
+		return errors.WithStack(err)
+	}
+	_, err = p.client.Patch(p.pod.ObjectMeta.Name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return errors.Wrapf(err, "failed to patch pod spec containers for Pod %s", p.pod.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (p *Pod) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range p.pod.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      p.pod.Name,
-				Type:      TypePod,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypePod, p.pod.Name, p.pod.Spec)
 }
 
 // raiseSyncPodErrEvents raises k8s and stats events indicating sync failure
 func (k *Provider) raiseSyncPodErrEvents(err error, typ, name, tag, version string) {
 	glog.Errorf("Failed sync %s with image: digest=%v, tag=%v, err=%v", typ, version, tag, err)
-	k.options.Stats.Event(fmt.Sprintf("%s.sync.failure", name),
+	k.options.Stats.Event("workload_sync_failure",
 		fmt.Sprintf("Failed to sync pod spec with %s", version), "", "error",
-		time.Now().UTC())
-	k.options.Recorder.Event(events.Warning, "CRSyncFailed", fmt.Sprintf("Error syncing %s name:%s", typ, name))
+		time.Now().UTC(), "namespace:"+k.namespace, "workload:"+name, "kind:"+typ)
+	k.options.Recorder.Event(events.Warning, events.ReasonSyncFailed, fmt.Sprintf("Error syncing %s name:%s", typ, name))
 }
 
-// CheckPodSpecContainerVersions tests whether all containers in the pod spec with container
-// names that match the cv spec have the given version.
+// CheckPodSpecContainerVersions tests whether all containers and init containers in the pod
+// spec that are managed by the cv have the given version.
 // Returns false if at least one container's version does not match.
 func CheckPodSpecContainerVersions(cv *cv1.ContainerVersion, version string, podSpec corev1.PodSpec) (bool, error) {
-	match := false
-	for _, c := range podSpec.Containers {
-		if c.Name == cv.Spec.Container.Name {
-			match = true
-			parts := strings.SplitN(c.Image, ":", 2)
-			if len(parts) > 2 {
-				return false, errors.New("invalid image on container")
-			}
-			if parts[0] != cv.Spec.ImageRepo {
-				return false, errors.Errorf("Repository mismatch for container %s: %s and requested %s don't match",
-					cv.Spec.Container.Name, parts[0], cv.Spec.ImageRepo)
-			}
-			if version != parts[1] {
-				return false, nil
-			}
-		}
+	containers, err := Containers(cv, podSpec)
+	if err != nil {
+		return false, errors.WithStack(err)
 	}
 
-	if !match {
-		return false, errors.Errorf("no container of name %s was found in workload", cv.Spec.Container.Name)
+	match := true
+	for _, c := range containers {
+		parts := strings.SplitN(c.Image, ":", 2)
+		if len(parts) != 2 {
+			return false, errors.Errorf("invalid image %s on container %s", c.Image, c.Name)
+		}
+		if parts[0] != c.ImageRepo {
+			return false, errors.Errorf("Repository mismatch for container %s: %s and requested %s don't match",
+				c.Name, parts[0], c.ImageRepo)
+		}
+		if version != parts[1] {
+			match = false
+		}
 	}
-
-	return true, nil
+	return match, nil
 }
@@ -1,7 +1,6 @@
 package k8s
 
 import (
-	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -9,10 +8,16 @@ import (
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
 	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
@@ -29,15 +34,19 @@ type Workload interface {
 	// Namespace returns the namespace the workload belongs to.
 	Namespace() string
 
+	// Object returns the Kubernetes object of the workload, to which events of its
+	// rollouts are attached.
+	Object() runtime.Object
+
 	// Type returns the type of the spec.
 	Type() string
 
 	// PodSpec returns the PodSpec for the workload.
 	PodSpec() corev1.PodSpec
 
-	// PatchPodSpec receives a pod spec and container which is to be patched
-	// according to an appropriate strategy for the type.
-	PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error
+	// PatchPodSpec sets the images of the given containers and init containers of the
+	// pod spec in a single patch, according to an appropriate strategy for the type.
+	PatchPodSpec(images []ContainerImage) error
 
 	// RollbackAfter indicates duration after which a failed rollout
 	// should attempt rollback
@@ -84,16 +93,30 @@ type Resource struct {
 	Version       string
 	AvailablePods int32
 
+	// Containers lists all containers and init containers managed by the CV, of which
+	// Container and Version describe the first.
+	Containers []ResourceContainer
+
 	CV  string
 	Tag string
 }
 
+// ResourceContainer is the version of a container of a Resource.
+type ResourceContainer struct {
+	Name    string
+	Version string
+	Init    bool
+}
+
 // Provider manages workloads.
 type Provider struct {
 	cs        kubernetes.Interface
 	cvcs      clientset.Interface
 	namespace string
 
+	// cache provides informer backed workload lookups if enabled via options.
+	cache *informerCache
+
 	options *config.Options
 }
 
@@ -105,10 +128,16 @@ func NewProvider(cs kubernetes.Interface, cvcs clientset.Interface, ns string, o
 		opt(opts)
 	}
 
+	var ic *informerCache
+	if opts.InformerStop != nil {
+		ic = newInformerCache(cs, opts.InformerStop)
+	}
+
 	return &Provider{
 		cs:        cs,
 		cvcs:      cvcs,
 		namespace: ns,
+		cache:     ic,
 		options:   opts,
 	}
 }
@@ -118,6 +147,44 @@ func (k *Provider) Namespace() string {
 	return k.namespace
 }
 
+// InNamespace returns a provider for the given namespace that shares the clients,
+// options and informer cache of the receiver.
+func (k *Provider) InNamespace(namespace string) *Provider {
+	if namespace == k.namespace {
+		return k
+	}
+	p := *k
+	p.namespace = namespace
+	return &p
+}
+
+// WatchesNamespace returns true if the given namespace is within the namespaces of the
+// provider options, which include all namespaces if empty.
+func (k *Provider) WatchesNamespace(namespace string) bool {
+	if len(k.options.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range k.options.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// InScope returns true if the given cv is within the namespaces and ContainerVersion label
+// selector of the provider options.
+func (k *Provider) InScope(cv *cv1.ContainerVersion) (bool, error) {
+	if !k.WatchesNamespace(cv.Namespace) {
+		return false, nil
+	}
+	selector, err := labels.Parse(k.options.CVLabelSelector)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid cv label selector %s", k.options.CVLabelSelector)
+	}
+	return selector.Matches(labels.Set(cv.Labels)), nil
+}
+
 // Client returns a kubernetes client interface for working directly with the kubernetes API.
 // The client will only work within the namespace of the provider.
 func (k *Provider) Client() kubernetes.Interface {
@@ -155,6 +222,7 @@ func (k *Provider) UpdateRolloutStatus(cvName string, version, status string, tm
 	cv.Status.CurrVersion = version
 	cv.Status.CurrStatus = status
 	cv.Status.CurrStatusTime = metav1.NewTime(tm)
+	cv.Status.AdoptedFrom = ""
 
 	if status == StatusSuccess {
 		cv.Status.SuccessVersion = version
@@ -165,20 +233,74 @@ func (k *Provider) UpdateRolloutStatus(cvName string, version, status string, tm
 		return nil, errors.Wrapf(err, "failed to update ContainerVersion spec %s", cv.Name)
 	}
 
-	glog.V(2).Info("Successfully updated rollout status: %+v", result)
+	glog.V(2).Infof("Successfully updated rollout status: %+v", result)
 	return result, nil
 }
 
+// SetCVAnnotation sets the annotation with the given key on the ContainerVersion with the given name.
+// The annotation is removed if the value is empty.
+func (k *Provider) SetCVAnnotation(cvName, key, value string) error {
+	glog.V(4).Infof("Setting annotation for cv=%s, key=%s", cvName, key)
+
+	client := k.cvcs.CustomV1().ContainerVersions(k.namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cv, err := client.Get(cvName, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get ContainerVersion instance with name %s", cvName)
+		}
+
+		if value == "" {
+			if _, ok := cv.Annotations[key]; !ok {
+				return nil
+			}
+			delete(cv.Annotations, key)
+		} else {
+			if cv.Annotations == nil {
+				cv.Annotations = make(map[string]string)
+			}
+			cv.Annotations[key] = value
+		}
+
+		_, err = client.Update(cv)
+		return err
+	})
+}
+
 // AllResources returns all resources managed by container versions in the current namespace.
+// If the provider is not bound to a namespace, the namespaces and ContainerVersion label selector
+// from the provider options are used to scope the results.
 func (k *Provider) AllResources() ([]*Resource, error) {
-	cvs, err := k.cvcs.CustomV1().ContainerVersions(k.namespace).List(metav1.ListOptions{})
+	namespaces := []string{k.namespace}
+	if k.namespace == "" && len(k.options.Namespaces) > 0 {
+		namespaces = k.options.Namespaces
+	}
+
+	var cvsList []*Resource
+	for _, namespace := range namespaces {
+		resources, err := k.namespaceResources(namespace)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		cvsList = append(cvsList, resources...)
+	}
+
+	return cvsList, nil
+}
+
+// namespaceResources returns all resources managed by container versions in the given namespace.
+func (k *Provider) namespaceResources(namespace string) ([]*Resource, error) {
+	listOpts := metav1.ListOptions{LabelSelector: k.options.CVLabelSelector}
+	cvs, err := k.cvcs.CustomV1().ContainerVersions(namespace).List(listOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to generate template of CV list")
 	}
 
+	provider := k.InNamespace(namespace)
+
 	var cvsList []*Resource
 	for _, cv := range cvs.Items {
-		cvs, err := k.CVResources(&cv)
+		cvs, err := provider.CVResources(&cv)
 		if err != nil {
 			return nil, errors.Wrap(err, "Failed to generate template of CV list")
 		}
@@ -204,89 +326,112 @@ func (k *Provider) CVResources(cv *cv1.ContainerVersion) ([]*Resource, error) {
 	return resources, nil
 }
 
+// WorkloadKinds lists all kinds of workload that can be managed by a container version.
+var WorkloadKinds = []string{
+	TypeDeployment,
+	TypeCronJob,
+	TypeDaemonSet,
+	TypeJob,
+	TypePod,
+	TypeReplicaSet,
+	TypeStatefulSet,
+}
+
 // Workloads returns the workload instances that match the given container version resource.
+// Only the kinds listed in the resource's workload kinds are returned, or all kinds if none
+// are given. Pods and ReplicaSets that are managed by another controller are excluded.
 func (k *Provider) Workloads(cv *cv1.ContainerVersion) ([]Workload, error) {
 	var result []Workload
 
 	glog.V(4).Infof("Retrieving Workloads for cv=%s", cv.Name)
 
-	set := labels.Set(cv.Spec.Selector)
-	listOpts := metav1.ListOptions{LabelSelector: set.AsSelector().String()}
-
-	deployments, err := k.cs.AppsV1().Deployments(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "deployments")
-	}
-	for _, item := range deployments.Items {
-		wl := item
-		result = append(result, NewDeployment(k.cs, k.namespace, &wl))
+	kinds := cv.Spec.WorkloadKinds
+	if len(kinds) == 0 {
+		kinds = WorkloadKinds
 	}
 
-	cronJobs, err := k.cs.BatchV1beta1().CronJobs(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "cronJobs")
-	} else {
-		for _, item := range cronJobs.Items {
-			wl := item
-			result = append(result, NewCronJob(k.cs, k.namespace, &wl))
+	selector := labels.Set(cv.Spec.Selector).AsSelector()
+	for _, kind := range kinds {
+		workloads, err := k.workloadsOfKind(kind, selector)
+		if err != nil {
+			return nil, err
 		}
+		result = append(result, workloads...)
 	}
 
-	daemonSets, err := k.cs.AppsV1().DaemonSets(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "daemonSets")
-	}
-	for _, item := range daemonSets.Items {
-		wl := item
-		result = append(result, NewDaemonSet(k.cs, k.namespace, &wl))
-	}
+	glog.V(2).Infof("Retrieved %d workloads", len(result))
 
-	jobs, err := k.cs.BatchV1().Jobs(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "jobs")
-	}
-	for _, item := range jobs.Items {
-		wl := item
-		result = append(result, NewJob(k.cs, k.namespace, &wl))
-	}
+	return result, nil
+}
 
-	pods, err := k.cs.CoreV1().Pods(k.namespace).List(listOpts)
+// workloadsOfKind returns the workloads of the given kind that match the selector.
+func (k *Provider) workloadsOfKind(kind string, selector labels.Selector) ([]Workload, error) {
+	objs, err := k.list(kind, selector)
 	if err != nil {
-		return nil, k.handleError(err, "pods")
-	}
-	for _, item := range pods.Items {
-		wl := item
-		result = append(result, NewPod(k.cs, k.namespace, &wl))
+		return nil, k.handleError(err, kind)
 	}
 
-	replicaSets, err := k.cs.AppsV1().ReplicaSets(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "replicaSets")
+	var result []Workload
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			result = append(result, NewDeployment(k.cs, k.namespace, o))
+		case *batchv1beta1.CronJob:
+			result = append(result, NewCronJob(k.cs, k.namespace, o))
+		case *appsv1.DaemonSet:
+			result = append(result, NewDaemonSet(k.cs, k.namespace, o))
+		case *batchv1.Job:
+			result = append(result, NewJob(k.cs, k.namespace, o))
+		case *corev1.Pod:
+			if !hasController(o) {
+				result = append(result, NewPod(k.cs, k.namespace, o))
+			}
+		case *appsv1.ReplicaSet:
+			if !hasController(o) {
+				result = append(result, NewReplicaSet(k.cs, k.namespace, o))
+			}
+		case *appsv1.StatefulSet:
+			result = append(result, NewStatefulSet(k.cs, k.namespace, o))
+		}
 	}
-	for _, item := range replicaSets.Items {
-		wl := item
-		result = append(result, NewReplicaSet(k.cs, k.namespace, &wl))
+	return result, nil
+}
+
+// list returns the workloads of the given kind in the provider's namespace that match
+// the selector, from the informer cache if enabled or else from the API server.
+func (k *Provider) list(kind string, selector labels.Selector) ([]runtime.Object, error) {
+	if k.cache != nil {
+		return k.cache.list(k.namespace, kind, selector)
 	}
 
-	statefulSets, err := k.cs.AppsV1().StatefulSets(k.namespace).List(listOpts)
-	if err != nil {
-		return nil, k.handleError(err, "statefulSets")
+	opts := metav1.ListOptions{LabelSelector: selector.String()}
+	var list runtime.Object
+	var err error
+	switch kind {
+	case TypeDeployment:
+		list, err = k.cs.AppsV1().Deployments(k.namespace).List(opts)
+	case TypeCronJob:
+		list, err = k.cs.BatchV1beta1().CronJobs(k.namespace).List(opts)
+	case TypeDaemonSet:
+		list, err = k.cs.AppsV1().DaemonSets(k.namespace).List(opts)
+	case TypeJob:
+		list, err = k.cs.BatchV1().Jobs(k.namespace).List(opts)
+	case TypePod:
+		list, err = k.cs.CoreV1().Pods(k.namespace).List(opts)
+	case TypeReplicaSet:
+		list, err = k.cs.AppsV1().ReplicaSets(k.namespace).List(opts)
+	case TypeStatefulSet:
+		list, err = k.cs.AppsV1().StatefulSets(k.namespace).List(opts)
+	default:
+		return nil, errors.Errorf("unsupported workload kind %s", kind)
 	}
-	for _, item := range statefulSets.Items {
-		wl := item
-		result = append(result, NewStatefulSet(k.cs, k.namespace, &wl))
+	if err != nil {
+		return nil, err
 	}
-
-	glog.V(2).Infof("Retrieved %d workloads", len(result))
-
-	return result, nil
+	return meta.ExtractList(list)
 }
 
 func (k *Provider) handleError(err error, typ string) error {
 	//k.options.Recorder.Event(events.Warning, "CRSyncFailed", "Failed to get workload")
 	return errors.Wrapf(err, "failed to get %s", typ)
 }
-
-func version(img string) string {
-	return strings.SplitAfterN(img, ":", 2)[1]
-}
@@ -0,0 +1,227 @@
+package k8s
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nearmap/cvmanager/config"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	customfake "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newWorkloadsClientset() *fake.Clientset {
+	selected := map[string]string{"app": "test"}
+	controller := true
+	owner := []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Controller: &controller}}
+
+	return fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "a", Labels: selected}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "a", Labels: map[string]string{"app": "other"}}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "b", Labels: selected}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "app-123", Namespace: "a", Labels: selected, OwnerReferences: owner}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "a", Labels: selected}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app-123-abc", Namespace: "a", Labels: selected, OwnerReferences: owner}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "bare", Namespace: "a", Labels: selected}},
+	)
+}
+
+// workloadNames returns the sorted type/name of the given workloads.
+func workloadNames(workloads []Workload) string {
+	var names []string
+	for _, wl := range workloads {
+		names = append(names, wl.Type()+"/"+wl.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestProviderWorkloads(t *testing.T) {
+	var tests = []struct {
+		message  string
+		kinds    []string
+		expected string
+	}{
+		{"all kinds", nil, "Deployment/app,Pod/bare,ReplicaSet/bare"},
+		{"deployments", []string{TypeDeployment}, "Deployment/app"},
+		{"pods and replica sets", []string{TypePod, TypeReplicaSet}, "Pod/bare,ReplicaSet/bare"},
+		{"stateful sets", []string{TypeStatefulSet}, ""},
+	}
+
+	for _, cached := range []bool{false, true} {
+		stopCh := make(chan struct{})
+		var options []func(*config.Options)
+		if cached {
+			options = append(options, config.WithInformers(stopCh))
+		}
+		provider := NewProvider(newWorkloadsClientset(), customfake.NewSimpleClientset(), "a", options...)
+
+		for _, test := range tests {
+			cv := &cv1.ContainerVersion{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cv", Namespace: "a"},
+				Spec: cv1.ContainerVersionSpec{
+					Selector:      map[string]string{"app": "test"},
+					WorkloadKinds: test.kinds,
+				},
+			}
+			workloads, err := provider.Workloads(cv)
+			if err != nil {
+				t.Fatalf("%s (cached=%v): failed to get workloads: %v", test.message, cached, err)
+			}
+			if names := workloadNames(workloads); names != test.expected {
+				t.Errorf("%s (cached=%v): expected workloads %q, got %q", test.message, cached, test.expected, names)
+			}
+		}
+		close(stopCh)
+	}
+}
+
+func TestInformerCacheLazyStart(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	provider := NewProvider(newWorkloadsClientset(), customfake.NewSimpleClientset(), "",
+		config.WithInformers(stopCh))
+	cv := &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cv", Namespace: "a"},
+		Spec: cv1.ContainerVersionSpec{
+			Selector:      map[string]string{"app": "test"},
+			WorkloadKinds: []string{TypeDeployment},
+		},
+	}
+
+	started := func() string {
+		provider.cache.mu.Lock()
+		defer provider.cache.mu.Unlock()
+
+		var keys []string
+		for key := range provider.cache.synced {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, ",")
+	}
+
+	if keys := started(); keys != "" {
+		t.Errorf("Expected no informers to be started before workloads are listed, got %s", keys)
+	}
+
+	if _, err := provider.InNamespace("a").Workloads(cv); err != nil {
+		t.Fatalf("Failed to get workloads: %v", err)
+	}
+	if keys := started(); keys != "a/Deployment" {
+		t.Errorf("Expected only the deployment informer of namespace a to be started, got %s", keys)
+	}
+	provider.cache.mu.Lock()
+	factories := len(provider.cache.factories)
+	provider.cache.mu.Unlock()
+	if factories != 1 {
+		t.Errorf("Expected a single informer factory, got %d", factories)
+	}
+
+	cv.Spec.WorkloadKinds = []string{TypeDeployment, TypePod}
+	if _, err := provider.InNamespace("b").Workloads(cv); err != nil {
+		t.Fatalf("Failed to get workloads: %v", err)
+	}
+	if keys := started(); keys != "a/Deployment,b/Deployment,b/Pod" {
+		t.Errorf("Expected the informers of namespace b to be started on demand, got %s", keys)
+	}
+}
+
+func TestProviderScope(t *testing.T) {
+	var tests = []struct {
+		message    string
+		namespaces []string
+		selector   string
+		namespace  string
+		labels     map[string]string
+		watched    bool
+		inScope    bool
+	}{
+		{"all namespaces", nil, "", "team-b", nil, true, true},
+		{"watched namespace", []string{"team-a", "team-b"}, "", "team-b", nil, true, true},
+		{"other namespace", []string{"team-a"}, "", "team-b", map[string]string{"team": "a"}, false, false},
+		{"matching labels", []string{"team-a"}, "team=a", "team-a", map[string]string{"team": "a"}, true, true},
+		{"other labels", []string{"team-a"}, "team=a", "team-a", map[string]string{"team": "b"}, true, false},
+		{"no labels", nil, "team=a", "team-a", nil, true, false},
+	}
+
+	for _, test := range tests {
+		provider := NewProvider(fake.NewSimpleClientset(), customfake.NewSimpleClientset(), "",
+			config.WithNamespaces(test.namespaces), config.WithCVLabelSelector(test.selector))
+		cv := &cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: test.namespace, Labels: test.labels}}
+
+		if watched := provider.WatchesNamespace(test.namespace); watched != test.watched {
+			t.Errorf("%s: expected namespace to be watched=%v, got %v", test.message, test.watched, watched)
+		}
+		inScope, err := provider.InScope(cv)
+		if err != nil {
+			t.Fatalf("%s: failed to check scope: %v", test.message, err)
+		}
+		if inScope != test.inScope {
+			t.Errorf("%s: expected cv to be in scope=%v, got %v", test.message, test.inScope, inScope)
+		}
+	}
+}
+
+func TestProviderAllResources(t *testing.T) {
+	newCV := func(namespace, team string) *cv1.ContainerVersion {
+		return &cv1.ContainerVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace, Labels: map[string]string{"team": team}},
+			Spec: cv1.ContainerVersionSpec{
+				ImageRepo:     "nearmap/app",
+				Container:     cv1.ContainerSpec{Name: "app"},
+				Selector:      map[string]string{"app": "test"},
+				WorkloadKinds: []string{TypeDeployment},
+			},
+		}
+	}
+	newDeployment := func(namespace string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace, Labels: map[string]string{"app": "test"}},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nearmap/app:abc"}}},
+				},
+			},
+		}
+	}
+	cs := fake.NewSimpleClientset(newDeployment("team-a"), newDeployment("team-b"), newDeployment("team-c"))
+	cvcs := customfake.NewSimpleClientset(newCV("team-a", "a"), newCV("team-b", "b"), newCV("team-c", "a"))
+
+	var tests = []struct {
+		message    string
+		namespaces []string
+		selector   string
+		expected   string
+	}{
+		{"namespaces", []string{"team-a", "team-b"}, "", "team-a,team-b"},
+		{"label selector", []string{"team-a", "team-b", "team-c"}, "team=a", "team-a,team-c"},
+		{"namespaces and label selector", []string{"team-b", "team-c"}, "team=a", "team-c"},
+	}
+
+	for _, test := range tests {
+		provider := NewProvider(cs, cvcs, "",
+			config.WithNamespaces(test.namespaces), config.WithCVLabelSelector(test.selector))
+		resources, err := provider.AllResources()
+		if err != nil {
+			t.Fatalf("%s: failed to get resources: %v", test.message, err)
+		}
+
+		var namespaces []string
+		for _, r := range resources {
+			if r.Version != "abc" {
+				t.Errorf("%s: expected version abc of resource %s/%s, got %s", test.message, r.Namespace, r.Name, r.Version)
+			}
+			namespaces = append(namespaces, r.Namespace)
+		}
+		sort.Strings(namespaces)
+		if strings.Join(namespaces, ",") != test.expected {
+			t.Errorf("%s: expected resources in namespaces %s, got %v", test.message, test.expected, namespaces)
+		}
+	}
+}
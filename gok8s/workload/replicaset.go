@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	goappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
@@ -49,6 +50,11 @@ func (rs *ReplicaSet) Namespace() string {
 	return rs.replicaSet.Namespace
 }
 
+// Object implements the Workload interface.
+func (rs *ReplicaSet) Object() runtime.Object {
+	return rs.replicaSet
+}
+
 // Type implements the Workload interface.
 func (rs *ReplicaSet) Type() string {
 	return TypeReplicaSet
@@ -76,30 +82,19 @@ func (rs *ReplicaSet) PodTemplateSpec() corev1.PodTemplateSpec {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (rs *ReplicaSet) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := rs.client.Patch(rs.replicaSet.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (rs *ReplicaSet) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec", "template", "spec")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = rs.client.Patch(rs.replicaSet.ObjectMeta.Name, types.StrategicMergePatchType, patch)
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for ReplicaSet %s", rs.replicaSet.Name)
+		return errors.Wrapf(err, "failed to patch pod template spec containers for ReplicaSet %s", rs.replicaSet.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (rs *ReplicaSet) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range rs.replicaSet.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      rs.replicaSet.Name,
-				Type:      TypeReplicaSet,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypeReplicaSet, rs.replicaSet.Name, rs.replicaSet.Spec.Template.Spec)
 }
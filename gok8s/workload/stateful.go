@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	goappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
@@ -49,6 +50,11 @@ func (ss *StatefulSet) Namespace() string {
 	return ss.statefulSet.Namespace
 }
 
+// Object implements the Workload interface.
+func (ss *StatefulSet) Object() runtime.Object {
+	return ss.statefulSet
+}
+
 // Type implements the Workload interface.
 func (ss *StatefulSet) Type() string {
 	return TypeStatefulSet
@@ -76,30 +82,19 @@ func (ss *StatefulSet) PodTemplateSpec() corev1.PodTemplateSpec {
 }
 
 // PatchPodSpec implements the Workload interface.
-func (ss *StatefulSet) PatchPodSpec(cv *cv1.ContainerVersion, container corev1.Container, version string) error {
-	_, err := ss.client.Patch(ss.statefulSet.ObjectMeta.Name, types.StrategicMergePatchType,
-		[]byte(fmt.Sprintf(podTemplateSpecJSON, container.Name, cv.Spec.ImageRepo, version)))
+func (ss *StatefulSet) PatchPodSpec(images []ContainerImage) error {
+	patch, err := podSpecPatch(images, "spec", "template", "spec")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = ss.client.Patch(ss.statefulSet.ObjectMeta.Name, types.StrategicMergePatchType, patch)
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch pod template spec container for StatefulSet %s", ss.statefulSet.Name)
+		return errors.Wrapf(err, "failed to patch pod template spec containers for StatefulSet %s", ss.statefulSet.Name)
 	}
 	return nil
 }
 
 // AsResource implements the Workload interface.
 func (ss *StatefulSet) AsResource(cv *cv1.ContainerVersion) *Resource {
-	for _, c := range ss.statefulSet.Spec.Template.Spec.Containers {
-		if cv.Spec.Container.Name == c.Name {
-			return &Resource{
-				Namespace: cv.Namespace,
-				Name:      ss.statefulSet.Name,
-				Type:      TypeStatefulSet,
-				Container: c.Name,
-				Version:   version(c.Image),
-				CV:        cv.Name,
-				Tag:       cv.Spec.Tag,
-			}
-		}
-	}
-
-	return nil
+	return newResource(cv, TypeStatefulSet, ss.statefulSet.Name, ss.statefulSet.Spec.Template.Spec)
 }
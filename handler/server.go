@@ -2,14 +2,18 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/nearmap/cvmanager/cv"
 	k8s "github.com/nearmap/cvmanager/gok8s/workload"
 	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/signals"
+	"github.com/nearmap/cvmanager/sync"
 	goji "goji.io"
 	"goji.io/pat"
 )
@@ -24,16 +28,21 @@ func StaticContentHandler(content string) http.HandlerFunc {
 	}
 }
 
-// NewServer creates and starts an http server to serve alive and deployment status endpoints
-// if server fails to start then, stop channel is closed notifying all listeners to the channel
+// NewServer creates and starts an http server to serve the read-only alive and deployment status
+// endpoints if server fails to start then, stop channel is closed notifying all listeners to the channel.
+// The metrics handler is served on /metrics if not nil.
 func NewServer(port int, version string,
-	k8sProvider *k8s.Provider, historyProvider history.Provider, stopCh chan struct{}) {
+	k8sProvider *k8s.Provider, historyProvider history.Provider, metrics http.Handler, stop *signals.Stop) {
 
 	mux := goji.NewMux()
 	mux.Handle(pat.Get("/alive"), StaticContentHandler("alive"))
 	mux.Handle(pat.Get("/version"), StaticContentHandler(version))
 	mux.Handle(pat.Get("/v1/cv/workloads"), cv.NewCVHandler(k8sProvider))
 	mux.Handle(pat.Get("/v1/cv/workloads/:name"), history.NewHandler(historyProvider))
+	mux.Handle(pat.Get("/v1/cv/:name/operations"), cv.NewOperationsHandler(k8sProvider))
+	if metrics != nil {
+		mux.Handle(pat.Get("/metrics"), metrics)
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
@@ -45,15 +54,92 @@ func NewServer(port int, version string,
 		if err := srv.ListenAndServe(); err != nil {
 			if err.Error() != "http: Server closed" {
 				glog.V(2).Infof("Server error during ListenAndServe: %v", err)
-				close(stopCh)
+				stop.Close()
 			}
 		}
 	}()
 
-	<-stopCh
+	<-stop.C
 	glog.V(2).Infof("Shutting down http server")
 
 	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
 	srv.Shutdown(ctx)
 	glog.V(1).Infof("Server gracefully stopped")
 }
+
+// RequireToken returns a handler that serves requests with the given bearer token in their
+// Authorization header using the given handler, and rejects all other requests.
+func RequireToken(token string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// NewControlServer creates and starts an http server to serve the endpoint that pauses, resumes
+// and aborts rollouts until the stop channel is closed. Requests must be authorized with the
+// given bearer token.
+func NewControlServer(port int, token string, k8sProvider *k8s.Provider, stopCh <-chan struct{}) {
+	mux := goji.NewMux()
+	mux.Handle(pat.Post("/v1/cv/:name/:action"), RequireToken(token, sync.NewControlHandler(k8sProvider)))
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 1 * time.Minute,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Control server error during ListenAndServe: %v", err)
+		}
+	}()
+
+	<-stopCh
+	glog.V(2).Infof("Shutting down control http server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		glog.Errorf("Failed to shut down control http server: %v", err)
+	}
+}
+
+// NewSyncServer creates and starts an http server to serve the alive and operations endpoints
+// of the given syncer until the stop channel is closed. The metrics handler is served on
+// /metrics if not nil.
+func NewSyncServer(port int, syncer *sync.Syncer, metrics http.Handler, stopCh <-chan struct{}) {
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/alive"), StaticContentHandler("alive"))
+	mux.Handle(pat.Get(sync.OperationsPath), sync.NewOperationsHandler(syncer))
+	if metrics != nil {
+		mux.Handle(pat.Get("/metrics"), metrics)
+	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 1 * time.Minute,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Syncer server error during ListenAndServe: %v", err)
+		}
+	}()
+
+	<-stopCh
+	glog.V(2).Infof("Shutting down syncer http server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		glog.Errorf("Failed to shut down syncer http server: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// historyLabel is the label of RolloutRecord resources holding the name of their history.
+	historyLabel = "cvmanager/history"
+)
+
+type crdProvider struct {
+	cs    clientset.Interface
+	stats stats.Stats
+	ttl   time.Duration
+}
+
+// NewCRDProvider returns a history provider that stores each history record as a
+// RolloutRecord resource. Records older than the given ttl are deleted when a new
+// record is added to the same history. Records are kept indefinitely if ttl is zero.
+func NewCRDProvider(cs clientset.Interface, stats stats.Stats, ttl time.Duration) Provider {
+	return &crdProvider{
+		cs:    cs,
+		stats: stats,
+		ttl:   ttl,
+	}
+}
+
+func (p *crdProvider) History(namespace, name string, query Query) (*Page, error) {
+	list, err := p.list(namespace, name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	records := make([]*Record, 0, len(list.Items))
+	for i := range list.Items {
+		records = append(records, fromRolloutRecord(&list.Items[i]))
+	}
+	return query.Apply(records)
+}
+
+func (p *crdProvider) Add(namespace, name string, record *Record) error {
+	rr := toRolloutRecord(namespace, name, record)
+	_, err := p.cs.CustomV1().RolloutRecords(namespace).Create(rr)
+	if err != nil && !k8serr.IsAlreadyExists(err) {
+		p.stats.IncCount("history_save_failures_total", "backend:"+BackendCRD)
+		return errors.Wrapf(err, "failed to create rollout record %s/%s", namespace, rr.Name)
+	}
+
+	if p.ttl > 0 {
+		if err := p.expire(namespace, name, time.Now().UTC().Add(-p.ttl)); err != nil {
+			glog.Errorf("Failed to delete expired rollout records of %s/%s: %v", namespace, name, err)
+		}
+	}
+	return nil
+}
+
+func (p *crdProvider) list(namespace, name string) (*cv1.RolloutRecordList, error) {
+	list, err := p.cs.CustomV1().RolloutRecords(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", historyLabel, name),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list rollout records of %s/%s", namespace, name)
+	}
+	return list, nil
+}
+
+// expire deletes the records of the named history that occurred before the given time.
+func (p *crdProvider) expire(namespace, name string, before time.Time) error {
+	list, err := p.list(namespace, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, rr := range list.Items {
+		if !rr.Spec.Time.Time.Before(before) {
+			continue
+		}
+		glog.V(4).Infof("Deleting expired rollout record %s/%s", namespace, rr.Name)
+		err := p.cs.CustomV1().RolloutRecords(namespace).Delete(rr.Name, &metav1.DeleteOptions{})
+		if err != nil && !k8serr.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete rollout record %s/%s", namespace, rr.Name)
+		}
+	}
+	return nil
+}
+
+// toRolloutRecord returns a RolloutRecord resource for the given record of the named history.
+// The resource name is derived from the record time so that adding the same record again
+// does not create a duplicate.
+func toRolloutRecord(namespace, name string, record *Record) *cv1.RolloutRecord {
+	rr := &cv1.RolloutRecord{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", name, record.Time.UnixNano()),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"OWNED_BY":   "CVManager",
+				historyLabel: name,
+			},
+		},
+		Spec: cv1.RolloutRecordSpec{
+			History:         name,
+			Type:            record.Type,
+			Name:            record.Name,
+			Version:         record.Version,
+			PreviousVersion: record.PreviousVersion,
+			Digest:          record.Digest,
+			Status:          record.Status,
+			Strategy:        record.Strategy,
+			Time:            metav1.NewTime(record.Time),
+			DurationSeconds: record.Duration,
+			Actor:           record.Actor,
+			Reason:          record.Reason,
+			TraceID:         record.TraceID,
+		},
+	}
+	for _, v := range record.Verifiers {
+		rr.Spec.Verifiers = append(rr.Spec.Verifiers, cv1.RolloutVerifierResult{
+			Kind:    v.Kind,
+			Image:   v.Image,
+			Passed:  v.Passed,
+			Message: v.Message,
+		})
+	}
+	return rr
+}
+
+// fromRolloutRecord returns the history record of the given RolloutRecord resource.
+func fromRolloutRecord(rr *cv1.RolloutRecord) *Record {
+	record := &Record{
+		Type:            rr.Spec.Type,
+		Name:            rr.Spec.Name,
+		Version:         rr.Spec.Version,
+		PreviousVersion: rr.Spec.PreviousVersion,
+		Digest:          rr.Spec.Digest,
+		Status:          rr.Spec.Status,
+		Strategy:        rr.Spec.Strategy,
+		Time:            rr.Spec.Time.Time.UTC(),
+		Duration:        rr.Spec.DurationSeconds,
+		Actor:           rr.Spec.Actor,
+		Reason:          rr.Spec.Reason,
+		TraceID:         rr.Spec.TraceID,
+	}
+	for _, v := range rr.Spec.Verifiers {
+		record.Verifiers = append(record.Verifiers, VerifierResult{
+			Kind:    v.Kind,
+			Image:   v.Image,
+			Passed:  v.Passed,
+			Message: v.Message,
+		})
+	}
+	return record
+}
@@ -0,0 +1,43 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	"github.com/nearmap/cvmanager/stats"
+)
+
+func TestCRDProvider(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	p := NewCRDProvider(cs, stats.NewFake(), time.Hour)
+
+	now := time.Now().UTC()
+	records := []*Record{
+		{Name: "app", Version: "a", Status: StatusSuccess, Time: now.Add(-2 * time.Hour)},
+		{Name: "app", Version: "b", Status: StatusRolledBack, Time: now.Add(-time.Minute), PreviousVersion: "a",
+			Verifiers: []VerifierResult{{Kind: "Image", Passed: true}}},
+		{Name: "app", Version: "c", Status: StatusSuccess, Time: now},
+	}
+	for _, r := range records {
+		if err := p.Add("ns", "app", r); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+	if err := p.Add("ns", "other", &Record{Name: "other", Version: "x", Time: now}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	page, err := p.History("ns", "app", Query{})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if versions(page) != "c,b" {
+		t.Errorf("expected expired record to be deleted and other histories excluded, got versions=%s", versions(page))
+	}
+
+	rb := page.Records[1]
+	if rb.PreviousVersion != "a" || len(rb.Verifiers) != 1 || !rb.Verifiers[0].Passed || !rb.Time.Equal(records[1].Time) {
+		t.Errorf("unexpected record after round trip: %#v", rb)
+	}
+}
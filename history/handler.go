@@ -1,14 +1,25 @@
 package history
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 	"goji.io/pat"
 )
 
+const (
+	defaultLimit = 100
+)
+
 // NewHandler is web handler to return history of workload updates
-// as performed by cvmanager
+// as performed by cvmanager as json. Records can be filtered with the since and
+// until (RFC3339) and status (comma separated) query parameters, and paginated
+// with the limit and continue query parameters.
 func NewHandler(provider Provider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -18,11 +29,56 @@ func NewHandler(provider Provider) http.HandlerFunc {
 			ns = "default"
 		}
 
-		msg, err := provider.History(ns, name)
+		query, err := parseQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := provider.History(ns, name, query)
 		if err != nil {
 			glog.Errorf("Failed to get history of workload %v", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(page)
+		if err != nil {
+			glog.Errorf("Failed to encode history of workload %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// parseQuery returns the history query defined by the request's query parameters.
+func parseQuery(r *http.Request) (Query, error) {
+	params := r.URL.Query()
+	query := Query{
+		Limit:    defaultLimit,
+		Continue: params.Get("continue"),
+	}
+
+	var err error
+	if since := params.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return query, errors.Errorf("invalid since time %s", since)
+		}
+	}
+	if until := params.Get("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return query, errors.Errorf("invalid until time %s", until)
+		}
+	}
+	if status := params.Get("status"); status != "" {
+		query.Statuses = strings.Split(status, ",")
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 0 {
+			return query, errors.Errorf("invalid limit %s", limit)
 		}
-		w.Write([]byte(msg))
 	}
+	return query, nil
 }
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// legacyRecordExp matches records written as text by earlier versions.
+var legacyRecordExp = regexp.MustCompile(`(?m)^Update occurred at:(.*):\nWorkload:(.*) to version:(.*)$`)
+
+// Migrate imports the records of the history configmaps in the given namespace into the
+// given provider, skipping records that the provider already contains. Returns the number
+// of records that were imported.
+func Migrate(cs kubernetes.Interface, namespace string, dst Provider) (int, error) {
+	cms, err := cs.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{
+		LabelSelector: "OWNED_BY=CVManager",
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to list history configmaps in namespace %s", namespace)
+	}
+
+	var imported int
+	for i := range cms.Items {
+		cm := &cms.Items[i]
+		if !strings.HasSuffix(cm.Name, ".history") {
+			continue
+		}
+		name := strings.TrimSuffix(cm.Name, ".history")
+
+		existing, err := dst.History(namespace, name, Query{})
+		if err != nil {
+			return imported, errors.Wrapf(err, "failed to get existing history %s/%s", namespace, name)
+		}
+		seen := make(map[string]bool)
+		for _, r := range existing.Records {
+			seen[recordKey(r)] = true
+		}
+
+		for _, r := range configMapRecords(cm) {
+			if seen[recordKey(r)] {
+				continue
+			}
+			if err := dst.Add(namespace, name, r); err != nil {
+				return imported, errors.Wrapf(err, "failed to import history %s/%s", namespace, name)
+			}
+			imported++
+		}
+		glog.V(2).Infof("Migrated history configmap %s/%s", namespace, cm.Name)
+	}
+	return imported, nil
+}
+
+func recordKey(r *Record) string {
+	return fmt.Sprintf("%s/%s/%d", r.Name, r.Version, r.Time.UnixNano())
+}
+
+// configMapRecords returns the records of the given history configmap, oldest first,
+// including those written as text by earlier versions.
+func configMapRecords(cm *corev1.ConfigMap) []*Record {
+	records := append(decodeLegacyRecords(cm.Data[legacyKey]), decodeRecords(cm.Data[key])...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records
+}
+
+// decodeLegacyRecords decodes records written as text by earlier versions, which only
+// recorded successful rollouts.
+func decodeLegacyRecords(data string) []*Record {
+	var records []*Record
+	for _, m := range legacyRecordExp.FindAllStringSubmatch(data, -1) {
+		t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", m[1])
+		if err != nil {
+			glog.V(4).Infof("Skipping history record with invalid time %s: %v", m[1], err)
+			continue
+		}
+		records = append(records, &Record{
+			Name:    m[2],
+			Version: m[3],
+			Status:  StatusSuccess,
+			Time:    t.UTC(),
+		})
+	}
+	return records
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	"github.com/nearmap/cvmanager/stats"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gofake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigrate(t *testing.T) {
+	t1 := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	// legacy records were prepended as text, most recent first
+	legacy := fmt.Sprintf("Update occurred at:%s:\nWorkload:app to version:b\n\nUpdate occurred at:%s:\nWorkload:app to version:a\n", t2, t1)
+	current, err := encodeRecords([]*Record{{Name: "app", Version: "c", Status: StatusFailed, Time: t3}})
+	if err != nil {
+		t.Fatalf("failed to encode records: %v", err)
+	}
+
+	cs := gofake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "app.history", Namespace: "ns", Labels: labels()},
+			Data:       map[string]string{legacyKey: legacy, key: current},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ns", Labels: labels()},
+			Data:       map[string]string{"key": "value"},
+		},
+	)
+	dst := NewCRDProvider(fake.NewSimpleClientset(), stats.NewFake(), 0)
+
+	n, err := Migrate(cs, "ns", dst)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 records to be imported, got %d", n)
+	}
+
+	page, err := dst.History("ns", "app", Query{})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if versions(page) != "c,b,a" {
+		t.Errorf("unexpected migrated versions %s", versions(page))
+	}
+	if !page.Records[2].Time.Equal(t1) || page.Records[2].Status != StatusSuccess {
+		t.Errorf("unexpected legacy record %+v", page.Records[2])
+	}
+
+	if n, err = Migrate(cs, "ns", dst); err != nil || n != 0 {
+		t.Errorf("expected migrating again to import nothing, got %d records, err=%v", n, err)
+	}
+}
@@ -2,7 +2,6 @@ package history
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -15,26 +14,25 @@ import (
 )
 
 const (
-	key       = "Info"
+	// key is the configmap key holding history records as JSON lines, oldest first.
+	key = "records"
+
+	// legacyKey is the configmap key holding history as text in earlier versions.
+	legacyKey = "Info"
+
 	sizeLimit = 1000000
 )
 
-// Record contains details of a release
-type Record struct {
-	Type    string
-	Name    string
-	Version string
-	Time    time.Time
-}
-
-func (r *Record) String() string {
-	return fmt.Sprintf("Update occurred at:%s:\nWorkload:%s to version:%s\n", r.Time, r.Name, r.Version)
-}
+// History backends.
+const (
+	BackendConfigMap = "configmap"
+	BackendCRD       = "crd"
+)
 
 // Provider is an interface to add and fetch cv release/update history
 type Provider interface {
-	// History returns the historical record in CV update history
-	History(namespace, name string) (string, error)
+	// History returns the records in the named CV update history that match the query.
+	History(namespace, name string, query Query) (*Page, error)
 
 	// Add adds the history record in CV update history
 	Add(namespace, name string, record *Record) error
@@ -45,29 +43,35 @@ type provider struct {
 	stats stats.Stats
 }
 
-func NewProvider(cs kubernetes.Interface, stats stats.Stats) *provider {
+// NewProvider returns a history provider that stores history records in a configmap
+// named after the history.
+func NewProvider(cs kubernetes.Interface, stats stats.Stats) Provider {
 	return &provider{
 		cs:    cs,
 		stats: stats,
 	}
 }
 
-func (p *provider) History(namespace, name string) (string, error) {
+func (p *provider) History(namespace, name string, query Query) (*Page, error) {
 	cm, err := p.cs.CoreV1().ConfigMaps(namespace).Get(configName(name), metav1.GetOptions{})
 	if err != nil {
 		if k8serr.IsNotFound(err) {
-			return "", nil
+			return query.Apply(nil)
 		}
-		return "", errors.Wrapf(err, "failed to find cv history in configmap: %s/%s", namespace, name)
+		return nil, errors.Wrapf(err, "failed to find cv history in configmap: %s/%s", namespace, name)
 	}
-	return cm.Data[key], nil
+	return query.Apply(configMapRecords(cm))
 }
 
 func (p *provider) Add(namespace, name string, record *Record) error {
 	cm, err := p.cs.CoreV1().ConfigMaps(namespace).Get(configName(name), metav1.GetOptions{})
 	if err != nil {
 		if k8serr.IsNotFound(err) {
-			_, err = p.cs.CoreV1().ConfigMaps(namespace).Create(newRecordConfig(namespace, name, record))
+			cm, err = newRecordConfig(namespace, name, record)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			_, err = p.cs.CoreV1().ConfigMaps(namespace).Create(cm)
 			if err != nil {
 				return errors.Wrapf(err, "failed to create cv history configmap:%s/%s", namespace, name)
 			}
@@ -76,7 +80,11 @@ func (p *provider) Add(namespace, name string, record *Record) error {
 		return errors.Wrapf(err, "failed to get cv history configmap:%s/%s", namespace, name)
 	}
 
-	_, err = p.cs.CoreV1().ConfigMaps(namespace).Update(updateRecordConfig(cm, record))
+	cm, err = updateRecordConfig(cm, record)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = p.cs.CoreV1().ConfigMaps(namespace).Update(cm)
 	if err != nil {
 		glog.Errorf("failed to update cv update history in configmap: %s/%s", namespace, name)
 		return errors.Wrapf(err, "failed to update cv update history in configmap: %s/%s", namespace, name)
@@ -90,12 +98,11 @@ func configName(name string) string {
 
 // newRecordConfig creates a new configmap to capture update history performed by cvmanager
 // specifically syncers
-func newRecordConfig(namespace, name string, records ...*Record) *corev1.ConfigMap {
-	var strRecords []string
-	for _, r := range records {
-		strRecords = append(strRecords, r.String())
+func newRecordConfig(namespace, name string, records ...*Record) (*corev1.ConfigMap, error) {
+	data, err := encodeRecords(retain(records, sizeLimit))
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
-	msg := strings.Join(strRecords, "\n")
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      configName(name),
@@ -103,29 +110,29 @@ func newRecordConfig(namespace, name string, records ...*Record) *corev1.ConfigM
 			Labels:    labels(),
 		},
 		Data: map[string]string{
-			key: msg,
+			key: data,
 		},
-	}
+	}, nil
 }
 
 // updateRecordConfig update history configmap with new update records
-func updateRecordConfig(cm *corev1.ConfigMap, records ...*Record) *corev1.ConfigMap {
-	var strRecords []string
-	for _, r := range records {
-		strRecords = append(strRecords, r.String())
+func updateRecordConfig(cm *corev1.ConfigMap, records ...*Record) (*corev1.ConfigMap, error) {
+	all := append(decodeRecords(cm.Data[key]), records...)
+
+	// ConfigMap can only hold 1MB size data, so the oldest records are dropped
+	// see https://github.com/kubernetes/kubernetes/issues/19781
+	size := sizeLimit - len(cm.Data[legacyKey])
+	data, err := encodeRecords(retain(all, size))
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
-	msg := strings.Join(strRecords, "\n")
-	msg = fmt.Sprintf("%s\n%s", msg, cm.Data[key])
 
 	cm.ObjectMeta.Labels = labels()
-	// ConfigMap can only hold 1MB size data
-	// see https://github.com/kubernetes/kubernetes/issues/19781
-	bytLen := len([]byte(msg))
-	if bytLen > sizeLimit {
-		msg = msg[:sizeLimit]
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
 	}
-	cm.Data[key] = string(msg)
-	return cm
+	cm.Data[key] = data
+	return cm, nil
 }
 
 func labels() map[string]string {
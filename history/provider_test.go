@@ -0,0 +1,117 @@
+package history
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/stats"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gofake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProviderAddHistory(t *testing.T) {
+	cs := gofake.NewSimpleClientset()
+	p := NewProvider(cs, stats.NewFake())
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []string{StatusSuccess, StatusFailed, StatusSuccess, StatusRolledBack, StatusSuccess}
+	for i, status := range statuses {
+		err := p.Add("ns", "app", &Record{
+			Name:    "app",
+			Version: string('a' + rune(i)),
+			Status:  status,
+			Time:    start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	page, err := p.History("ns", "app", Query{Limit: 2})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if versions(page) != "e,d" || page.Continue == "" {
+		t.Errorf("unexpected first page: versions=%s, continue=%s", versions(page), page.Continue)
+	}
+
+	page, err = p.History("ns", "app", Query{Limit: 2, Continue: page.Continue})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if versions(page) != "c,b" {
+		t.Errorf("unexpected second page: versions=%s", versions(page))
+	}
+
+	page, err = p.History("ns", "app", Query{
+		Since:    start.Add(time.Hour),
+		Until:    start.Add(3 * time.Hour),
+		Statuses: []string{StatusSuccess},
+	})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if versions(page) != "c" || page.Continue != "" {
+		t.Errorf("unexpected filtered page: versions=%s, continue=%s", versions(page), page.Continue)
+	}
+
+	if _, err = p.History("ns", "app", Query{Continue: "bad"}); err == nil {
+		t.Errorf("expected error for invalid continue token")
+	}
+
+	page, err = p.History("ns", "missing", Query{})
+	if err != nil {
+		t.Fatalf("failed to get missing history: %v", err)
+	}
+	if len(page.Records) != 0 {
+		t.Errorf("expected no records for missing history, got %d", len(page.Records))
+	}
+}
+
+func TestUpdateRecordConfigRetention(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: configName("app")},
+		Data: map[string]string{
+			legacyKey: strings.Repeat("x", sizeLimit-1000),
+		},
+	}
+
+	var err error
+	for i := 0; i < 20; i++ {
+		cm, err = updateRecordConfig(cm, &Record{
+			Name:    "app",
+			Version: strings.Repeat(string('a'+rune(i)), 50),
+			Status:  StatusSuccess,
+		})
+		if err != nil {
+			t.Fatalf("failed to update config: %v", err)
+		}
+	}
+
+	if size := len(cm.Data[key]) + len(cm.Data[legacyKey]); size > sizeLimit {
+		t.Errorf("expected configmap data within %d bytes, got %d", sizeLimit, size)
+	}
+
+	records := decodeRecords(cm.Data[key])
+	if len(records) == 0 || len(records) == 20 {
+		t.Fatalf("expected oldest records to be dropped, got %d records", len(records))
+	}
+	if last := records[len(records)-1].Version; last != strings.Repeat("t", 50) {
+		t.Errorf("expected most recent record to be retained, got version %s", last)
+	}
+	for _, line := range strings.Split(cm.Data[key], "\n") {
+		if !strings.HasPrefix(line, "{") || !strings.HasSuffix(line, "}") {
+			t.Errorf("expected whole records, got line %s", line)
+		}
+	}
+}
+
+func versions(page *Page) string {
+	var vs []string
+	for _, r := range page.Records {
+		vs = append(vs, r.Version)
+	}
+	return strings.Join(vs, ",")
+}
@@ -0,0 +1,196 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Rollout statuses of history records.
+const (
+	StatusSuccess            = "success"
+	StatusFailed             = "failed"
+	StatusRolledBack         = "rolled-back"
+	StatusVerificationFailed = "verification-failed"
+	StatusAborted            = "aborted"
+	StatusDeferred           = "deferred"
+)
+
+// Record contains details of a release
+type Record struct {
+	Type            string `json:"type"`
+	Name            string `json:"name"`
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	Digest          string `json:"digest,omitempty"`
+
+	// Status is the outcome of the rollout.
+	Status string `json:"status"`
+
+	// Strategy is the kind of rollout strategy used.
+	Strategy string `json:"strategy,omitempty"`
+
+	// Time is the time at which the rollout completed and Duration the number of
+	// seconds it took.
+	Time     time.Time `json:"time"`
+	Duration float64   `json:"duration,omitempty"`
+
+	// Verifiers contains the results of the verifications performed during the rollout.
+	Verifiers []VerifierResult `json:"verifiers,omitempty"`
+
+	// Actor describes what triggered the rollout.
+	Actor string `json:"actor,omitempty"`
+
+	// Reason describes why the rollout did not succeed.
+	Reason string `json:"reason,omitempty"`
+
+	// TraceID identifies the trace of the rollout operation, if traced.
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// VerifierResult contains the result of a verification performed during a rollout.
+type VerifierResult struct {
+	Kind    string `json:"kind"`
+	Image   string `json:"image,omitempty"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r *Record) String() string {
+	msg := fmt.Sprintf("Update occurred at:%s:\nWorkload:%s to version:%s\nStatus:%s\n", r.Time, r.Name, r.Version, r.Status)
+	if r.Reason != "" {
+		msg = fmt.Sprintf("%sReason:%s\n", msg, r.Reason)
+	}
+	return msg
+}
+
+// Query restricts the history records that are returned.
+type Query struct {
+	// Since and Until restrict records to those between the given times, if non-zero.
+	Since time.Time
+	Until time.Time
+
+	// Statuses restricts records to those with one of the given statuses, if not empty.
+	Statuses []string
+
+	// Limit is the maximum number of records to return. Zero means no limit.
+	Limit int
+
+	// Continue is the token returned by a previous query to obtain the next page of records.
+	Continue string
+}
+
+// Page contains history records, most recent first.
+type Page struct {
+	Records []*Record `json:"records"`
+
+	// Continue is a token for obtaining the next page of records, or empty if there are no more.
+	Continue string `json:"continue,omitempty"`
+}
+
+// Matches returns true if the record matches the time range and statuses of the query.
+func (q Query) Matches(r *Record) bool {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	if len(q.Statuses) == 0 {
+		return true
+	}
+	for _, s := range q.Statuses {
+		if s == r.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the page of the given records that matches the query, ordering them most recent first.
+func (q Query) Apply(records []*Record) (*Page, error) {
+	var offset int
+	if q.Continue != "" {
+		var err error
+		if offset, err = strconv.Atoi(q.Continue); err != nil || offset < 0 {
+			return nil, errors.Errorf("invalid continue token %s", q.Continue)
+		}
+	}
+
+	var matched []*Record
+	for _, r := range records {
+		if q.Matches(r) {
+			matched = append(matched, r)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Time.After(matched[j].Time)
+	})
+
+	page := &Page{Records: []*Record{}}
+	if offset >= len(matched) {
+		return page, nil
+	}
+	matched = matched[offset:]
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		page.Continue = strconv.Itoa(offset + q.Limit)
+	}
+	page.Records = matched
+	return page, nil
+}
+
+// encodeRecords encodes the given records as JSON lines.
+func encodeRecords(records []*Record) (string, error) {
+	var lines []string
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to encode history record for %s", r.Name)
+		}
+		lines = append(lines, string(line))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// decodeRecords decodes records from JSON lines, skipping any lines that are not valid records.
+func decodeRecords(data string) []*Record {
+	var records []*Record
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), sizeLimit)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			continue
+		}
+		records = append(records, &r)
+	}
+	return records
+}
+
+// retain returns the most recent of the given records, which are ordered oldest first,
+// whose JSON lines encoding fits within the given size.
+func retain(records []*Record, size int) []*Record {
+	total := 0
+	for i := len(records) - 1; i >= 0; i-- {
+		line, err := json.Marshal(records[i])
+		if err != nil {
+			continue
+		}
+		total += len(line) + 1
+		if total > size {
+			return records[i+1:]
+		}
+	}
+	return records
+}
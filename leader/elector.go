@@ -0,0 +1,267 @@
+// Package leader provides leader election so that only a single replica of a
+// component performs work at any one time.
+package leader
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	// ErrLeadershipLost is returned by Run when the elector fails to renew its lease.
+	ErrLeadershipLost = errors.New("leadership lost")
+)
+
+// Options contains optional leader election parameters.
+type Options struct {
+	// LeaseDuration is the duration that non-leaders will wait before attempting to
+	// acquire a lease that has not been renewed.
+	LeaseDuration time.Duration
+
+	// RenewDeadline is the duration that the leader will keep retrying to renew
+	// its lease before giving up leadership.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is the duration between attempts to acquire or renew the lease.
+	RetryPeriod time.Duration
+}
+
+// WithLeaseDuration sets the lease duration as options.
+func WithLeaseDuration(dur time.Duration) func(*Options) {
+	return func(op *Options) {
+		op.LeaseDuration = dur
+	}
+}
+
+// WithRenewDeadline sets the renew deadline as options.
+func WithRenewDeadline(dur time.Duration) func(*Options) {
+	return func(op *Options) {
+		op.RenewDeadline = dur
+	}
+}
+
+// WithRetryPeriod sets the retry period as options.
+func WithRetryPeriod(dur time.Duration) func(*Options) {
+	return func(op *Options) {
+		op.RetryPeriod = dur
+	}
+}
+
+// Elector performs leader election against a Lock.
+type Elector struct {
+	lock     Lock
+	identity string
+	options  *Options
+
+	mu           sync.Mutex
+	observed     *Record
+	observedTime time.Time
+	leading      bool
+}
+
+// NewElector returns an Elector that competes for the given lock using the given identity,
+// which must be unique amongst all candidates.
+func NewElector(lock Lock, identity string, options ...func(*Options)) (*Elector, error) {
+	opts := &Options{
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	if identity == "" {
+		return nil, errors.New("leader election identity must not be empty")
+	}
+	if opts.LeaseDuration <= opts.RenewDeadline {
+		return nil, errors.Errorf("lease duration (%s) must be greater than renew deadline (%s)",
+			opts.LeaseDuration, opts.RenewDeadline)
+	}
+	if opts.RenewDeadline <= opts.RetryPeriod {
+		return nil, errors.Errorf("renew deadline (%s) must be greater than retry period (%s)",
+			opts.RenewDeadline, opts.RetryPeriod)
+	}
+
+	return &Elector{
+		lock:     lock,
+		identity: identity,
+		options:  opts,
+	}, nil
+}
+
+// IsLeader returns true if the elector currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Run blocks until the lease is acquired, then invokes onStarted in a new goroutine with
+// a channel that is closed when leadership ends. Run returns nil once stopCh is closed,
+// releasing the lease if held, or ErrLeadershipLost if the lease could not be renewed.
+func (e *Elector) Run(stopCh <-chan struct{}, onStarted func(stop <-chan struct{})) error {
+	glog.V(1).Infof("Attempting to acquire leader lease %s as %s", e.lock.Describe(), e.identity)
+
+	if !e.acquire(stopCh) {
+		return nil
+	}
+
+	glog.V(1).Infof("Acquired leader lease %s as %s", e.lock.Describe(), e.identity)
+
+	leaderStop := make(chan struct{})
+	defer close(leaderStop)
+	go onStarted(leaderStop)
+
+	if !e.renew(stopCh) {
+		glog.Errorf("Failed to renew leader lease %s as %s", e.lock.Describe(), e.identity)
+		return ErrLeadershipLost
+	}
+
+	e.release()
+	return nil
+}
+
+// acquire loops until the lease is acquired or stopCh is closed.
+// Returns true if the lease was acquired.
+func (e *Elector) acquire(stopCh <-chan struct{}) bool {
+	for {
+		if e.tryAcquireOrRenew() {
+			e.setLeading(true)
+			return true
+		}
+		glog.V(4).Infof("Leader lease %s is held by %s", e.lock.Describe(), e.holder())
+
+		select {
+		case <-stopCh:
+			return false
+		case <-time.After(wait.Jitter(e.options.RetryPeriod, 1.2)):
+		}
+	}
+}
+
+// renew loops until stopCh is closed or the lease cannot be renewed within the renew
+// deadline. Returns true if renewing stopped because stopCh was closed.
+func (e *Elector) renew(stopCh <-chan struct{}) bool {
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return true
+		case <-time.After(e.options.RetryPeriod):
+		}
+
+		if e.tryAcquireOrRenew() {
+			lastRenew = time.Now()
+			continue
+		}
+		if time.Since(lastRenew) > e.options.RenewDeadline {
+			e.setLeading(false)
+			return false
+		}
+	}
+}
+
+// release gives up the lease so that other candidates do not need to wait for it to expire.
+func (e *Elector) release() {
+	e.setLeading(false)
+
+	e.mu.Lock()
+	observed := e.observed
+	e.mu.Unlock()
+	if observed == nil || observed.HolderIdentity != e.identity {
+		return
+	}
+
+	r := Record{
+		LeaderTransitions: observed.LeaderTransitions,
+		LeaseDuration:     time.Second,
+		AcquireTime:       time.Now().UTC(),
+		RenewTime:         time.Now().UTC(),
+	}
+	if err := e.lock.Update(r); err != nil {
+		glog.Errorf("Failed to release leader lease %s: %v", e.lock.Describe(), err)
+		return
+	}
+	glog.V(1).Infof("Released leader lease %s", e.lock.Describe())
+}
+
+// tryAcquireOrRenew attempts to acquire the lease if it is free or expired, or renew it if
+// already held. Returns true on success.
+func (e *Elector) tryAcquireOrRenew() bool {
+	now := time.Now().UTC()
+	r := Record{
+		HolderIdentity: e.identity,
+		LeaseDuration:  e.options.LeaseDuration,
+		AcquireTime:    now,
+		RenewTime:      now,
+	}
+
+	old, err := e.lock.Get()
+	if err != nil {
+		if !k8serr.IsNotFound(err) {
+			glog.Errorf("Failed to get leader lease %s: %v", e.lock.Describe(), err)
+			return false
+		}
+		if err = e.lock.Create(r); err != nil {
+			glog.Errorf("Failed to create leader lease %s: %v", e.lock.Describe(), err)
+			return false
+		}
+		e.observe(&r, now)
+		return true
+	}
+
+	e.mu.Lock()
+	if !reflect.DeepEqual(e.observed, old) {
+		e.observed = old
+		e.observedTime = now
+	}
+	expired := e.observedTime.Add(old.LeaseDuration).Before(now)
+	e.mu.Unlock()
+
+	if old.HolderIdentity != "" && old.HolderIdentity != e.identity && !expired {
+		return false
+	}
+
+	if old.HolderIdentity == e.identity {
+		r.AcquireTime = old.AcquireTime
+		r.LeaderTransitions = old.LeaderTransitions
+	} else {
+		r.LeaderTransitions = old.LeaderTransitions + 1
+	}
+
+	if err = e.lock.Update(r); err != nil {
+		glog.V(2).Infof("Failed to update leader lease %s: %v", e.lock.Describe(), err)
+		return false
+	}
+	e.observe(&r, now)
+	return true
+}
+
+func (e *Elector) observe(r *Record, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.observed = r
+	e.observedTime = now
+}
+
+func (e *Elector) holder() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.observed == nil {
+		return ""
+	}
+	return e.observed.HolderIdentity
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+}
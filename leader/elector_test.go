@@ -0,0 +1,160 @@
+package leader
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// memoryLock is an in-memory implementation of the Lock interface for testing purposes.
+type memoryLock struct {
+	sync.Mutex
+	record *Record
+}
+
+func (ml *memoryLock) Get() (*Record, error) {
+	ml.Lock()
+	defer ml.Unlock()
+	if ml.record == nil {
+		return nil, k8serr.NewNotFound(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "test")
+	}
+	r := *ml.record
+	return &r, nil
+}
+
+func (ml *memoryLock) Create(r Record) error {
+	ml.Lock()
+	defer ml.Unlock()
+	if ml.record != nil {
+		return k8serr.NewAlreadyExists(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "test")
+	}
+	ml.record = &r
+	return nil
+}
+
+func (ml *memoryLock) Update(r Record) error {
+	ml.Lock()
+	defer ml.Unlock()
+	ml.record = &r
+	return nil
+}
+
+func (ml *memoryLock) Describe() string {
+	return "memory/test"
+}
+
+func (ml *memoryLock) holder() string {
+	ml.Lock()
+	defer ml.Unlock()
+	if ml.record == nil {
+		return ""
+	}
+	return ml.record.HolderIdentity
+}
+
+func newTestElector(t *testing.T, lock Lock, identity string) *Elector {
+	e, err := NewElector(lock, identity,
+		WithLeaseDuration(300*time.Millisecond),
+		WithRenewDeadline(200*time.Millisecond),
+		WithRetryPeriod(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error creating elector: %v", err)
+	}
+	return e
+}
+
+func TestNewElectorValidation(t *testing.T) {
+	lock := &memoryLock{}
+
+	var tests = []struct {
+		message  string
+		identity string
+		options  []func(*Options)
+		isErr    bool
+	}{
+		{"defaults", "a", nil, false},
+		{"empty identity", "", nil, true},
+		{"lease not greater than renew", "a", []func(*Options){WithLeaseDuration(time.Second), WithRenewDeadline(time.Second)}, true},
+		{"renew not greater than retry", "a", []func(*Options){WithRenewDeadline(time.Second), WithRetryPeriod(time.Second)}, true},
+	}
+
+	for _, test := range tests {
+		_, err := NewElector(lock, test.identity, test.options...)
+		if test.isErr && err == nil {
+			t.Errorf("%s: expected error", test.message)
+		}
+		if !test.isErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.message, err)
+		}
+	}
+}
+
+func TestElectorSingleLeaderAndFailover(t *testing.T) {
+	lock := &memoryLock{}
+
+	first := newTestElector(t, lock, "first")
+	second := newTestElector(t, lock, "second")
+
+	started := make(chan string, 2)
+	onStarted := func(id string) func(<-chan struct{}) {
+		return func(stop <-chan struct{}) {
+			started <- id
+			<-stop
+		}
+	}
+
+	firstStop := make(chan struct{})
+	firstDone := make(chan error, 1)
+	go func() {
+		firstDone <- first.Run(firstStop, onStarted("first"))
+	}()
+
+	select {
+	case id := <-started:
+		if id != "first" {
+			t.Fatalf("Expected first to lead, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for first elector to lead")
+	}
+
+	secondStop := make(chan struct{})
+	defer close(secondStop)
+	secondDone := make(chan error, 1)
+	go func() {
+		secondDone <- second.Run(secondStop, onStarted("second"))
+	}()
+
+	// The second elector must not lead while the first keeps renewing.
+	select {
+	case id := <-started:
+		t.Fatalf("Expected only one leader, %s also started", id)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("Expected first to be the only leader")
+	}
+
+	close(firstStop)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("Unexpected error from first elector: %v", err)
+	}
+	if first.IsLeader() {
+		t.Errorf("Expected first to no longer be leader after stopping")
+	}
+
+	select {
+	case id := <-started:
+		if id != "second" {
+			t.Fatalf("Expected second to lead, got %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for second elector to take over")
+	}
+	if lock.holder() != "second" {
+		t.Errorf("Expected lock to be held by second, got %s", lock.holder())
+	}
+}
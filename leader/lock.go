@@ -0,0 +1,187 @@
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Record is the leader election record held by a Lock.
+type Record struct {
+	HolderIdentity    string
+	LeaseDuration     time.Duration
+	AcquireTime       time.Time
+	RenewTime         time.Time
+	LeaderTransitions int32
+}
+
+// Lock is an interface to the resource that holds the leader election record.
+type Lock interface {
+	// Get returns the current election record. Returns a NotFound error if the
+	// underlying resource does not exist.
+	Get() (*Record, error)
+
+	// Create attempts to create the election record.
+	Create(r Record) error
+
+	// Update updates the existing election record. Updates fail with a conflict if the
+	// record was modified since it was last read with Get.
+	Update(r Record) error
+
+	// Describe returns a human readable description of the lock.
+	Describe() string
+}
+
+// lease is the wire representation of a coordination.k8s.io/v1 Lease.
+// The vendored client-go does not provide a typed client for the coordination
+// API group so leases are read and written as raw JSON.
+type lease struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Spec       leaseSpec         `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       *string           `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32            `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *metav1.MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *metav1.MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32            `json:"leaseTransitions,omitempty"`
+}
+
+// LeaseLock implements the Lock interface using a coordination.k8s.io/v1 Lease object.
+type LeaseLock struct {
+	client    rest.Interface
+	namespace string
+	name      string
+
+	observed *lease
+}
+
+// NewLeaseLock returns a Lock backed by the Lease with the given namespace and name.
+func NewLeaseLock(cs kubernetes.Interface, namespace, name string) *LeaseLock {
+	return &LeaseLock{
+		client:    cs.CoreV1().RESTClient(),
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (ll *LeaseLock) path(name string) []string {
+	segments := []string{"/apis/coordination.k8s.io/v1/namespaces", ll.namespace, "leases"}
+	if name != "" {
+		segments = append(segments, name)
+	}
+	return segments
+}
+
+// Get implements the Lock interface.
+func (ll *LeaseLock) Get() (*Record, error) {
+	body, err := ll.client.Get().AbsPath(ll.path(ll.name)...).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var l lease
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode lease %s", ll.Describe())
+	}
+	ll.observed = &l
+
+	return leaseToRecord(&l.Spec), nil
+}
+
+// Create implements the Lock interface.
+func (ll *LeaseLock) Create(r Record) error {
+	l := &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata: metav1.ObjectMeta{
+			Name:      ll.name,
+			Namespace: ll.namespace,
+		},
+		Spec: recordToLease(r),
+	}
+
+	return ll.write(ll.client.Post().AbsPath(ll.path("")...), l)
+}
+
+// Update implements the Lock interface.
+func (ll *LeaseLock) Update(r Record) error {
+	if ll.observed == nil {
+		return errors.New("lease not initialized, call Get or Create first")
+	}
+
+	l := *ll.observed
+	l.APIVersion = "coordination.k8s.io/v1"
+	l.Kind = "Lease"
+	l.Spec = recordToLease(r)
+
+	return ll.write(ll.client.Put().AbsPath(ll.path(ll.name)...), &l)
+}
+
+func (ll *LeaseLock) write(req *rest.Request, l *lease) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode lease %s", ll.Describe())
+	}
+
+	result, err := req.SetHeader("Content-Type", "application/json").Body(body).Do().Raw()
+	if err != nil {
+		return err
+	}
+
+	var updated lease
+	if err := json.Unmarshal(result, &updated); err != nil {
+		return errors.Wrapf(err, "failed to decode lease %s", ll.Describe())
+	}
+	ll.observed = &updated
+	return nil
+}
+
+// Describe implements the Lock interface.
+func (ll *LeaseLock) Describe() string {
+	return fmt.Sprintf("%s/%s", ll.namespace, ll.name)
+}
+
+func recordToLease(r Record) leaseSpec {
+	holder := r.HolderIdentity
+	duration := int32(r.LeaseDuration / time.Second)
+	acquire := metav1.NewMicroTime(r.AcquireTime)
+	renew := metav1.NewMicroTime(r.RenewTime)
+	transitions := r.LeaderTransitions
+
+	return leaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &acquire,
+		RenewTime:            &renew,
+		LeaseTransitions:     &transitions,
+	}
+}
+
+func leaseToRecord(spec *leaseSpec) *Record {
+	var r Record
+	if spec.HolderIdentity != nil {
+		r.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		r.LeaseDuration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	if spec.AcquireTime != nil {
+		r.AcquireTime = spec.AcquireTime.Time
+	}
+	if spec.RenewTime != nil {
+		r.RenewTime = spec.RenewTime.Time
+	}
+	if spec.LeaseTransitions != nil {
+		r.LeaderTransitions = *spec.LeaseTransitions
+	}
+	return &r
+}
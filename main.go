@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -12,13 +14,17 @@ import (
 	"github.com/nearmap/cvmanager/cv"
 	"github.com/nearmap/cvmanager/events"
 	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
-	informer "github.com/nearmap/cvmanager/gok8s/client/informers/externalversions"
 	"github.com/nearmap/cvmanager/gok8s/workload"
 	"github.com/nearmap/cvmanager/handler"
 	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/leader"
+	"github.com/nearmap/cvmanager/promotion"
+	"github.com/nearmap/cvmanager/registry"
 	"github.com/nearmap/cvmanager/signals"
 	"github.com/nearmap/cvmanager/stats"
 	"github.com/nearmap/cvmanager/stats/datadog"
+	"github.com/nearmap/cvmanager/stats/prometheus"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -28,7 +34,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
-	k8sinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -66,6 +71,7 @@ func withExitCode() (code int) {
 	rootCmd.AddCommand(newRunCommand())
 	rootCmd.AddCommand(newCRCommands())
 	rootCmd.AddCommand(newCVCommand())
+	rootCmd.AddCommand(newHistoryCommand())
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -82,35 +88,178 @@ type statsParams struct {
 }
 
 func (sp *statsParams) addFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&sp.provider, "stats-provider", "datadog", "Name of the stats provider, e.g. datadog.")
-	cmd.PersistentFlags().StringVar(&sp.host, "stats-host", os.Getenv("STATS_HOST"), "Host to send stats.")
+	cmd.PersistentFlags().StringVar(&sp.provider, "stats-provider", "datadog", "Name of the stats provider: datadog or prometheus. Prometheus stats are served on /metrics")
+	cmd.PersistentFlags().StringVar(&sp.host, "stats-host", os.Getenv("STATS_HOST"), "Host to send stats. Not required for prometheus")
 }
 
-func (sp *statsParams) stats(namespace string, tags ...string) (stats.Stats, error) {
-	if sp.host == "" {
-		return stats.NewFake(), nil
+// syncerArgs returns the arguments that select the stats provider of the syncers
+// started by the controller, if it is not the default.
+func (sp *statsParams) syncerArgs() []string {
+	if sp.provider == "datadog" {
+		return nil
 	}
+	return []string{fmt.Sprintf("--stats-provider=%s", sp.provider)}
+}
 
+func (sp *statsParams) stats(namespace string, tags ...string) (stats.Stats, error) {
 	switch sp.provider {
 	case "datadog":
+		if sp.host == "" {
+			return stats.NewFake(), nil
+		}
 		return datadog.New(sp.host, namespace, tags...)
+	case "prometheus":
+		return prometheus.New("cvmanager"), nil
+	default:
+		return nil, errors.Errorf("unknown stats provider %s", sp.provider)
+	}
+}
+
+// metricsHandler returns the handler serving the given stats on /metrics, or nil if
+// the stats are not served.
+func metricsHandler(s stats.Stats) http.Handler {
+	if ps, ok := s.(*prometheus.PrometheusStats); ok {
+		return ps.Handler()
+	}
+	return nil
+}
+
+type leaderParams struct {
+	enabled       bool
+	lease         string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+}
+
+func (lp *leaderParams) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&lp.enabled, "leader-elect", false, "Enable leader election so that only one replica processes container versions at a time")
+	cmd.Flags().StringVar(&lp.lease, "leader-elect-lease", "kube-system/cvmanager", "Namespaced key of the lease used for leader election")
+	cmd.Flags().DurationVar(&lp.leaseDuration, "leader-elect-lease-duration", 15*time.Second, "Duration that non-leaders wait before attempting to acquire an expired lease")
+	cmd.Flags().DurationVar(&lp.renewDeadline, "leader-elect-renew-deadline", 10*time.Second, "Duration that the leader retries renewing its lease before giving up leadership")
+	cmd.Flags().DurationVar(&lp.retryPeriod, "leader-elect-retry-period", 2*time.Second, "Duration between attempts to acquire or renew the lease")
+}
+
+type historyParams struct {
+	backend string
+	ttl     time.Duration
+}
+
+func (hp *historyParams) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&hp.backend, "history-backend", history.BackendConfigMap, "Backend that stores rollout history: configmap or crd")
+	cmd.Flags().DurationVar(&hp.ttl, "history-ttl", 0, "Age after which rollout records are deleted by the crd history backend. Records are kept indefinitely if 0")
+}
+
+func (hp *historyParams) provider(cs kubernetes.Interface, customCS clientset.Interface, stats stats.Stats) (history.Provider, error) {
+	switch hp.backend {
+	case history.BackendConfigMap:
+		return history.NewProvider(cs, stats), nil
+	case history.BackendCRD:
+		return history.NewCRDProvider(customCS, stats, hp.ttl), nil
 	default:
-		return stats.NewFake(), nil
+		return nil, errors.Errorf("unknown history backend %s", hp.backend)
 	}
 }
 
+// syncerArgs returns the arguments that select the history backend of the syncers
+// started by the controller.
+func (hp *historyParams) syncerArgs() []string {
+	if hp.backend != history.BackendCRD {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("--history-backend=%s", hp.backend),
+		fmt.Sprintf("--history-ttl=%s", hp.ttl),
+	}
+}
+
+type tracingParams struct {
+	exporter string
+	endpoint string
+	file     string
+}
+
+func (tp *tracingParams) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tp.exporter, "trace-exporter", "", "Exporter of rollout traces: otlp or file. Rollouts are not traced if empty")
+	cmd.Flags().StringVar(&tp.endpoint, "trace-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "Endpoint of the OTLP/HTTP receiver that traces are exported to, e.g. http://otel-collector:4318")
+	cmd.Flags().StringVar(&tp.file, "trace-file", "/tmp/cvmanager-traces.jsonl", "File that traces are written to by the file exporter")
+}
+
+// tracer returns a tracer for the given service that exports traces with the selected
+// exporter, or nil if tracing is disabled.
+func (tp *tracingParams) tracer(service string, attrs ...string) (*tracing.Tracer, error) {
+	switch tp.exporter {
+	case "":
+		return nil, nil
+	case "otlp":
+		exporter, err := tracing.NewOTLPExporter(tp.endpoint)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return tracing.New(service, exporter, attrs...), nil
+	case "file":
+		return tracing.New(service, tracing.NewFileExporter(tp.file), attrs...), nil
+	default:
+		return nil, errors.Errorf("unknown trace exporter %s", tp.exporter)
+	}
+}
+
+// syncerArgs returns the arguments that configure tracing by the syncers started by
+// the controller, if enabled.
+func (tp *tracingParams) syncerArgs() []string {
+	if tp.exporter == "" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("--trace-exporter=%s", tp.exporter),
+		fmt.Sprintf("--trace-endpoint=%s", tp.endpoint),
+		fmt.Sprintf("--trace-file=%s", tp.file),
+	}
+}
+
+func (lp *leaderParams) elector(cs kubernetes.Interface) (*leader.Elector, error) {
+	parts := strings.Split(lp.lease, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("invalid leader election lease %s: expected namespace/name", lp.lease)
+	}
+
+	identity := os.Getenv("NAME")
+	if identity == "" {
+		var err error
+		if identity, err = os.Hostname(); err != nil {
+			return nil, errors.Wrap(err, "failed to determine leader election identity")
+		}
+	}
+
+	return leader.NewElector(leader.NewLeaseLock(cs, parts[0], parts[1]), identity,
+		leader.WithLeaseDuration(lp.leaseDuration),
+		leader.WithRenewDeadline(lp.renewDeadline),
+		leader.WithRetryPeriod(lp.retryPeriod))
+}
+
 type runParams struct {
 	k8sConfig    string
 	configMapKey string
 
 	cvImgRepo string
 
+	namespaces      []string
+	cvLabelSelector string
+
 	port int
 
+	controlPort      int
+	controlTokenFile string
+
+	leader leaderParams
+
+	historyParams historyParams
+
 	history  bool // unused
 	rollback bool // unused
 
-	stats statsParams
+	stats   statsParams
+	tracing tracingParams
 }
 
 func newRunCommand() *cobra.Command {
@@ -124,10 +273,17 @@ func newRunCommand() *cobra.Command {
 	rc.Flags().StringVar(&params.k8sConfig, "k8s-config", "", "Path to the kube config file. Only required for running outside k8s cluster. In cluster, pods credentials are used")
 	rc.Flags().StringVar(&params.configMapKey, "configmap-key", "kube-system/cvmanager", "Namespaced key of configmap that container version and region config defined")
 	rc.Flags().StringVar(&params.cvImgRepo, "cv-img-repo", "nearmap/cvmanager", "Name of the docker registry to used be controller. defaults to nearmap/cvmanager")
+	rc.Flags().StringSliceVar(&params.namespaces, "namespaces", nil, "Namespaces to manage container versions in. Defaults to all namespaces")
+	rc.Flags().StringVar(&params.cvLabelSelector, "cv-label-selector", "", "Label selector restricting the container version resources managed by this controller")
 	rc.Flags().BoolVar(&params.history, "history", false, "unused")
 	rc.Flags().BoolVar(&params.rollback, "rollback", false, "unused")
 	rc.Flags().IntVar(&params.port, "port", 8081, "Port to run http server on")
+	rc.Flags().IntVar(&params.controlPort, "control-port", 0, "Port to serve the endpoint that pauses, resumes and aborts rollouts on. Disabled if 0")
+	rc.Flags().StringVar(&params.controlTokenFile, "control-token-file", "", "Path to a file holding the bearer token required by the control endpoint")
+	(&params.leader).addFlags(rc)
 	(&params.stats).addFlags(rc)
+	(&params.historyParams).addFlags(rc)
+	(&params.tracing).addFlags(rc)
 
 	rc.RunE = func(cmd *cobra.Command, args []string) (err error) {
 		stats, err := params.stats.stats("cvmanager")
@@ -138,7 +294,15 @@ func newRunCommand() *cobra.Command {
 		scStatus := 0
 		defer stats.ServiceCheck("cvmanager.exec", "", scStatus, time.Now())
 
-		stopCh := signals.SetupSignalHandler()
+		var controlToken string
+		if params.controlPort != 0 {
+			if controlToken, err = readToken(params.controlTokenFile); err != nil {
+				return errors.Wrap(err, "failed to read control endpoint token")
+			}
+		}
+
+		stop := signals.SetupSignalHandler()
+		stopCh := stop.C
 
 		var cfg *rest.Config
 		if params.k8sConfig != "" {
@@ -175,42 +339,106 @@ func newRunCommand() *cobra.Command {
 		// 	//return errors.Wrap(err, "Failed to read CV CRD specification")
 		// }
 
-		k8sInformerFactory := k8sinformers.NewSharedInformerFactory(k8sClient, time.Second*30)
-		customInformerFactory := informer.NewSharedInformerFactory(customClient, time.Second*30)
+		informers := cv.NewInformers(k8sClient, customClient, time.Second*30, params.namespaces, params.cvLabelSelector)
 
 		// Controllers here
 		cvc, err := cv.NewCVController(params.configMapKey, params.cvImgRepo,
-			k8sClient, customClient,
-			k8sInformerFactory, customInformerFactory,
-			conf.WithStats(stats))
+			k8sClient, customClient, informers,
+			conf.WithStats(stats), conf.WithSyncerArgs(params.historyParams.syncerArgs()...),
+			conf.WithSyncerArgs(params.stats.syncerArgs()...), conf.WithSyncerArgs(params.tracing.syncerArgs()...))
 		if err != nil {
 			return errors.Wrap(err, "Failed to create controller")
 		}
 
-		k8sInformerFactory.Start(stopCh)
-		customInformerFactory.Start(stopCh)
-		glog.V(1).Info("Started informer factory")
-
 		stats.ServiceCheck("cvmanager.exec", "", scStatus, time.Now())
 
 		recorder := events.PodEventRecorder(k8sClient, "")
-		k8sProvider := k8s.NewProvider(k8sClient, customClient, "", conf.WithStats(stats), conf.WithRecorder(recorder))
-		historyProvider := history.NewProvider(k8sClient, stats)
+		k8sProvider := k8s.NewProvider(k8sClient, customClient, "",
+			conf.WithStats(stats), conf.WithRecorder(recorder),
+			conf.WithNamespaces(params.namespaces), conf.WithCVLabelSelector(params.cvLabelSelector),
+			conf.WithInformers(stopCh))
+		historyProvider, err := params.historyParams.provider(k8sClient, customClient, stats)
+		if err != nil {
+			scStatus = 2
+			return errors.Wrap(err, "Failed to create history provider")
+		}
+
+		promotions := promotion.NewController(k8sClient, customClient, k8sProvider, historyProvider,
+			func(imageRepo, versionSyntax string) (registry.Tagger, error) {
+				if versionSyntax == "" {
+					versionSyntax = "[0-9a-f]{5,40}"
+				}
+				return newTagger(imageRepo, versionSyntax, stats)
+			}, informers, conf.WithStats(stats))
 
-		go func() {
-			if err = cvc.Run(2, stopCh); err != nil {
+		cv.StartInformers(informers, stopCh)
+		glog.V(1).Info("Started informer factory")
+
+		runController := func(stop <-chan struct{}) {
+			go func() {
+				if err := promotions.Run(1, stop); err != nil {
+					glog.V(1).Infof("Shutting down promotion controller: %v", err)
+				}
+			}()
+			if err := cvc.Run(2, stop); err != nil {
 				glog.V(1).Infof("Shutting down container version controller: %v", err)
 				//return errors.Wrap(err, "Shutting down container version controller")
 			}
-		}()
-		handler.NewServer(params.port, Version, k8sProvider, historyProvider, stopCh)
+		}
+
+		// Non-leaders continue to serve the read-only HTTP endpoints while waiting
+		// for the lease; only the leader runs the controller. Losing the lease shuts
+		// down the process so that it restarts as a candidate.
+		leaderErr := make(chan error, 1)
+		if params.leader.enabled {
+			elector, err := params.leader.elector(k8sClient)
+			if err != nil {
+				scStatus = 2
+				return errors.Wrap(err, "Failed to create leader elector")
+			}
+			go func() {
+				if err := elector.Run(stopCh, runController); err != nil {
+					leaderErr <- err
+					stop.Close()
+				}
+			}()
+		} else {
+			go runController(stopCh)
+		}
 
+		if params.controlPort != 0 {
+			go handler.NewControlServer(params.controlPort, controlToken, k8sProvider, stopCh)
+		}
+		handler.NewServer(params.port, Version, k8sProvider, historyProvider, metricsHandler(stats), stop)
+
+		select {
+		case err := <-leaderErr:
+			scStatus = 2
+			return errors.Wrap(err, "Shutting down container version controller")
+		default:
+		}
 		return nil
 	}
 
 	return rc
 }
 
+// readToken returns the token held by the given file.
+func readToken(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no token file given")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read token file %s", path)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
 func updateCVCRDSpec(cfg *rest.Config) error {
 	apiExtCS, err := apiextCS.NewForConfig(cfg)
 	if err != nil {
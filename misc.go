@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"text/tabwriter"
 	"time"
 
 	"github.com/golang/glog"
@@ -12,6 +14,7 @@ import (
 	"github.com/nearmap/cvmanager/events"
 	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
 	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/handler"
 	"github.com/nearmap/cvmanager/history"
 	"github.com/nearmap/cvmanager/registry"
 	dh "github.com/nearmap/cvmanager/registry/dockerhub"
@@ -92,6 +95,10 @@ type crSyncParams struct {
 	namespace string
 	cvName    string
 	version   string
+	port      int
+
+	history historyParams
+	tracing tracingParams
 }
 
 func newCRSyncCommand(root *crRoot) *cobra.Command {
@@ -106,6 +113,9 @@ func newCRSyncCommand(root *crRoot) *cobra.Command {
 	cmd.Flags().StringVar(&params.namespace, "namespace", "", "namespace of container version resource that the syncer is based on.")
 	cmd.Flags().StringVar(&params.cvName, "cv", "", "name of container version resource that the syncer is based on")
 	cmd.Flags().StringVar(&params.version, "version", "", "Indicates version of cv resources to use in CR Syncer")
+	cmd.Flags().IntVar(&params.port, "port", sync.DefaultPort, "Port on which the syncer serves its operations endpoint. Disabled if 0")
+	(&params.history).addFlags(cmd)
+	(&params.tracing).addFlags(cmd)
 
 	cmd.PreRunE = func(cmd *cobra.Command, args []string) (err error) {
 		if params.cvName == "" || params.namespace == "" {
@@ -156,11 +166,6 @@ func newCRSyncCommand(root *crRoot) *cobra.Command {
 			return errors.Wrap(err, "Error building k8s container version clientset")
 		}
 
-		recorder := events.PodEventRecorder(k8sClient, params.namespace)
-
-		k8sProvider := k8s.NewProvider(k8sClient, customCS, params.namespace,
-			conf.WithRecorder(recorder), conf.WithStats(stats))
-
 		cv, err := customCS.CustomV1().ContainerVersions(params.namespace).Get(params.cvName, metav1.GetOptions{})
 		if err != nil {
 			scStatus = 2
@@ -168,6 +173,13 @@ func newCRSyncCommand(root *crRoot) *cobra.Command {
 			return errors.Wrap(err, "Failed to find CV resource")
 		}
 
+		// events are attached to the cv and the workloads being rolled out
+		recorder := events.NewBroadcaster(k8sClient).Recorder(cv)
+
+		// workloads are read from the API server so that the syncer observes its own patches
+		k8sProvider := k8s.NewProvider(k8sClient, customCS, params.namespace,
+			conf.WithRecorder(recorder), conf.WithStats(stats))
+
 		// CRD does not allow us to specify default type on OpenAPISpec
 		// TODO: this needs a better strategy but hacking it for now
 		//
@@ -187,10 +199,21 @@ func newCRSyncCommand(root *crRoot) *cobra.Command {
 			return errors.Wrap(err, "Failed to create registry provider")
 		}
 
-		historyProvider := history.NewProvider(k8sClient, stats)
+		historyProvider, err := params.history.provider(k8sClient, customCS, stats)
+		if err != nil {
+			scStatus = 2
+			return errors.Wrap(err, "Failed to create history provider")
+		}
+
+		tracer, err := params.tracing.tracer("cvmanager-sync", "cv", params.cvName, "namespace", params.namespace)
+		if err != nil {
+			scStatus = 2
+			return errors.Wrap(err, "Failed to create tracer")
+		}
+		defer tracer.Close()
 
 		crSyncer, err := sync.NewSyncer(k8sProvider, cv, registryProvider, historyProvider,
-			conf.WithRecorder(recorder), conf.WithStats(stats))
+			conf.WithRecorder(recorder), conf.WithStats(stats), conf.WithTracer(tracer))
 		if err != nil {
 			glog.Errorf("Failed to create syncer in namespace=%s for cv name=%s, error=%v",
 				params.namespace, params.cvName, err)
@@ -206,7 +229,13 @@ func newCRSyncCommand(root *crRoot) *cobra.Command {
 			crSyncer.Start()
 		}()
 
+		serverStop := make(chan struct{})
+		if params.port > 0 {
+			go handler.NewSyncServer(params.port, crSyncer, metricsHandler(stats), serverStop)
+		}
+
 		<-root.stopChan
+		close(serverStop)
 		if err = crSyncer.Stop(); err != nil {
 			glog.Errorf("error received while stopping state machine: %v", err)
 		}
@@ -243,6 +272,16 @@ type crTagParams struct {
 	tags    []string
 	version string
 
+	output string
+
+	from   string
+	to     string
+	digest string
+
+	keep      int
+	olderThan time.Duration
+	dryRun    bool
+
 	username string
 	pwd      string
 	verPat   string
@@ -269,17 +308,8 @@ func newCRTagCommand(root *crRoot) *cobra.Command {
 			return errors.Wrap(err, "failed to initialize stats")
 		}
 
-		switch registry.ProviderByRepo(root.params.cr) {
-		case "ecr":
-			crProvider, err = ecr.NewECR(root.params.cr, params.verPat, root.stats)
-		case "dockerhub":
-			crProvider, err = dh.NewDHV2(root.params.cr, params.verPat, dh.WithStats(root.stats))
-		}
-		if err != nil {
-			return err
-		}
-
-		return nil
+		crProvider, err = newTagger(root.params.cr, params.verPat, root.stats)
+		return err
 	}
 
 	addTagCmd := &cobra.Command{
@@ -335,16 +365,142 @@ func newCRTagCommand(root *crRoot) *cobra.Command {
 		return nil
 	}
 
+	listTagCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tags of images in given cr repository",
+		Long:  "List tags of images in given cr repository with their digests and push times, most recently pushed first",
+	}
+	listTagCmd.Flags().StringVarP(&params.output, "output", "o", "text", "Output format: text or json")
+	listTagCmd.PreRunE = func(cmd *cobra.Command, args []string) (err error) {
+		if root.params.cr == "" {
+			return errors.New("cr repository name/URI is required")
+		}
+
+		return nil
+	}
+	listTagCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		tags, err := crProvider.List()
+		if err != nil {
+			return err
+		}
+		return writeTags(params.output, tags)
+	}
+
+	moveTagCmd := &cobra.Command{
+		Use:   "move",
+		Short: "Move tag to image of another tag in given cr repository",
+		Long: `Move tag to image of another tag in given cr repository. The tag is only moved if it still
+refers to the image with the given digest, or to the image it refers to when the command starts if no
+digest is given. Registries do not support conditional updates of tags, so the check is best-effort
+rather than atomic: the tag is compared immediately before it is moved and verified afterwards, but a
+concurrent move of the tag in between is overwritten.`,
+	}
+	moveTagCmd.Flags().StringVar(&params.from, "from", "", "tag of the image that the tag is moved to")
+	moveTagCmd.Flags().StringVar(&params.to, "to", "", "tag that is moved")
+	moveTagCmd.Flags().StringVar(&params.digest, "digest", "", "digest of the image that the moved tag is expected to refer to")
+	moveTagCmd.PreRunE = func(cmd *cobra.Command, args []string) (err error) {
+		if root.params.cr == "" || params.from == "" || params.to == "" {
+			return errors.New("cr repository name/URI and from and to tags are required")
+		}
+
+		return nil
+	}
+	moveTagCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		digest := params.digest
+		if !cmd.Flags().Changed("digest") {
+			tags, err := crProvider.List()
+			if err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				if tag.Name == params.to {
+					digest = tag.Digest
+				}
+			}
+		}
+		if err := crProvider.Move(params.from, params.to, digest); err != nil {
+			return err
+		}
+		fmt.Printf("Moved tag %s to image of tag %s \n", params.to, params.from)
+		return nil
+	}
+
+	pruneTagCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Prune version tags of images in given cr repository",
+		Long: `Prune version tags of images in given cr repository that no environment tag references.
+Images whose tags all match the version pattern are removed, except for the most recently pushed images
+and images pushed within the given age.`,
+	}
+	pruneTagCmd.Flags().IntVar(&params.keep, "keep", 10, "number of the most recently pushed unreferenced images to keep")
+	pruneTagCmd.Flags().DurationVar(&params.olderThan, "older-than", 30*24*time.Hour, "minimum age of pruned images")
+	pruneTagCmd.Flags().BoolVar(&params.dryRun, "dry-run", false, "only list the tags that would be pruned")
+	pruneTagCmd.Flags().StringVarP(&params.output, "output", "o", "text", "Output format: text or json")
+	pruneTagCmd.PreRunE = func(cmd *cobra.Command, args []string) (err error) {
+		if root.params.cr == "" {
+			return errors.New("cr repository name/URI is required")
+		}
+		if params.keep < 0 || params.olderThan < 0 {
+			return errors.New("keep and older-than must not be negative")
+		}
+
+		return nil
+	}
+	pruneTagCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		tags, err := crProvider.Prune(params.keep, time.Now().Add(-params.olderThan), params.dryRun)
+		if err != nil {
+			return err
+		}
+		return writeTags(params.output, tags)
+	}
+
 	cmd.AddCommand(addTagCmd)
 	cmd.AddCommand(rmTagCmd)
 	cmd.AddCommand(getTagCmd)
+	cmd.AddCommand(listTagCmd)
+	cmd.AddCommand(moveTagCmd)
+	cmd.AddCommand(pruneTagCmd)
 
 	return cmd
 }
 
+// writeTags writes the given tags to standard output in the given format.
+func writeTags(output string, tags []registry.Tag) error {
+	if output == "json" {
+		if tags == nil {
+			tags = []registry.Tag{}
+		}
+		return errors.WithStack(json.NewEncoder(os.Stdout).Encode(tags))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tDIGEST\tPUSHED")
+	for _, tag := range tags {
+		pushed := "unknown"
+		if !tag.Pushed.IsZero() {
+			pushed = tag.Pushed.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", tag.Name, tag.Digest, pushed)
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// newTagger returns the tagger of the given image repository, whose versions match the
+// given version pattern.
+func newTagger(imageRepo, verPat string, stats stats.Stats) (registry.Tagger, error) {
+	switch registry.ProviderByRepo(imageRepo) {
+	case "ecr":
+		return ecr.NewECR(imageRepo, verPat, stats)
+	default:
+		return dh.NewDHV2(imageRepo, verPat, dh.WithStats(stats))
+	}
+}
+
 // newCVListCommand is CLI interface to list the current status of CV resources
 func newCVCommand() *cobra.Command {
 	var k8sConfig string
+	var namespaces []string
+	var cvLabelSelector string
 	cmd := &cobra.Command{
 		Use:   "cv",
 		Short: "Manages current status (version and status) of deployments managed by CV resources",
@@ -352,6 +508,8 @@ func newCVCommand() *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&k8sConfig, "k8s-config", "", "Path to the kube config file. Only required for running outside k8s cluster. In cluster, pods credentials are used")
+	cmd.PersistentFlags().StringSliceVar(&namespaces, "namespaces", nil, "Namespaces to list container versions in. Defaults to all namespaces")
+	cmd.PersistentFlags().StringVar(&cvLabelSelector, "cv-label-selector", "", "Label selector restricting the container version resources listed")
 
 	listCmd := &cobra.Command{
 		Use:   "get",
@@ -360,36 +518,161 @@ func newCVCommand() *cobra.Command {
 	}
 
 	listCmd.RunE = func(cmd *cobra.Command, args []string) error {
-		var cfg *rest.Config
-		var err error
-		if k8sConfig != "" {
-			cfg, err = clientcmd.BuildConfigFromFlags("", k8sConfig)
-		} else {
-			cfg, err = rest.InClusterConfig()
+		k8sClient, customClient, err := k8sClients(k8sConfig)
+		if err != nil {
+			return errors.WithStack(err)
 		}
+
+		k8sProvider := k8s.NewProvider(k8sClient, customClient, "",
+			conf.WithNamespaces(namespaces), conf.WithCVLabelSelector(cvLabelSelector))
+
+		return cv.AllContainerVersions(os.Stdout, "json", k8sProvider)
+	}
+
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(newCVStatusCommand(&k8sConfig))
+	cmd.AddCommand(newCVControlCommand(&k8sConfig, sync.ControlPause, "Pauses in-flight rollouts of a CV resource at their next step"))
+	cmd.AddCommand(newCVControlCommand(&k8sConfig, sync.ControlResume, "Resumes paused rollouts of a CV resource"))
+	cmd.AddCommand(newCVControlCommand(&k8sConfig, sync.ControlAbort, "Aborts the in-flight rollout of a CV resource, marking it as failed"))
+
+	return cmd
+}
+
+// newCVStatusCommand is CLI interface to print the rollout operations in progress for a CV resource
+func newCVStatusCommand(k8sConfig *string) *cobra.Command {
+	var namespace string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "status <cv name>",
+		Short: "Shows the rollout operations in progress for a CV resource",
+		Long:  "Shows the rollout operations in progress for a CV resource, as reported by its syncer",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "default", "namespace of the container version resource")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		k8sClient, _, err := k8sClients(*k8sConfig)
 		if err != nil {
-			glog.Errorf("Failed to get k8s config: %v", err)
-			return errors.Wrap(err, "Error building k8s configs either run in cluster or provide config file via k8s-config arg")
+			return errors.WithStack(err)
 		}
 
-		k8sClient, err := kubernetes.NewForConfig(cfg)
+		ops, err := cv.SyncerOperations(k8sClient, namespace, args[0])
 		if err != nil {
-			glog.Errorf("Error building k8s clientset: %v", err)
-			return errors.Wrap(err, "Error building k8s clientset")
+			return errors.WithStack(err)
+		}
+
+		if output == "json" {
+			return errors.WithStack(json.NewEncoder(os.Stdout).Encode(ops))
 		}
+		cv.WriteOperations(os.Stdout, ops, time.Now().UTC())
+		return nil
+	}
+
+	return cmd
+}
+
+// newCVControlCommand is CLI interface to apply a control action to the rollouts of a CV resource
+func newCVControlCommand(k8sConfig *string, action, description string) *cobra.Command {
+	var namespace string
+	cmd := &cobra.Command{
+		Use:   fmt.Sprintf("%s <cv name>", action),
+		Short: description,
+		Long:  description,
+		Args:  cobra.ExactArgs(1),
+	}
 
-		customClient, err := clientset.NewForConfig(cfg)
+	cmd.Flags().StringVar(&namespace, "namespace", "default", "namespace of the container version resource")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		k8sClient, customClient, err := k8sClients(*k8sConfig)
 		if err != nil {
-			glog.Errorf("Error building k8s container version clientset: %v", err)
-			return errors.Wrap(err, "Error building k8s container version clientset")
+			return errors.WithStack(err)
 		}
 
-		k8sProvider := k8s.NewProvider(k8sClient, customClient, "")
+		k8sProvider := k8s.NewProvider(k8sClient, customClient, namespace)
+		return sync.Control(k8sProvider, args[0], action)
+	}
 
-		return cv.AllContainerVersions(os.Stdout, "json", k8sProvider)
+	return cmd
+}
+
+// newHistoryCommand is CLI interface to manage rollout history
+func newHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Manages rollout history",
+		Long:  "Manages the rollout history recorded by cvmanager",
 	}
 
-	cmd.AddCommand(listCmd)
+	var k8sConfig string
+	var namespaces []string
+	var params historyParams
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Imports history configmaps into another history backend",
+		Long:  "Imports the records of <name>.history configmaps into the history backend selected by --history-backend. Records already in the backend are skipped",
+	}
+	migrateCmd.Flags().StringVar(&k8sConfig, "k8s-config", "", "Path to the kube config file. Only required for running outside k8s cluster. In cluster, pods credentials are used")
+	migrateCmd.Flags().StringSliceVar(&namespaces, "namespaces", []string{"default"}, "Namespaces of the history configmaps to import")
+	(&params).addFlags(migrateCmd)
+
+	migrateCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if params.backend == history.BackendConfigMap {
+			return errors.New("history backend to migrate to must be crd or file")
+		}
+
+		k8sClient, customClient, err := k8sClients(k8sConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
 
+		dst, err := params.provider(k8sClient, customClient, stats.NewFake())
+		if err != nil {
+			return errors.Wrap(err, "failed to create history provider")
+		}
+
+		for _, ns := range namespaces {
+			n, err := history.Migrate(k8sClient, ns, dst)
+			if err != nil {
+				return errors.Wrapf(err, "failed to migrate history in namespace %s", ns)
+			}
+			fmt.Printf("Imported %d records in namespace %s\n", n, ns)
+		}
+		return nil
+	}
+
+	cmd.AddCommand(migrateCmd)
 	return cmd
 }
+
+// k8sClients returns the k8s and container version clientsets for the given kube config file,
+// or for the cluster if no config file is given.
+func k8sClients(k8sConfig string) (kubernetes.Interface, clientset.Interface, error) {
+	var cfg *rest.Config
+	var err error
+	if k8sConfig != "" {
+		cfg, err = clientcmd.BuildConfigFromFlags("", k8sConfig)
+	} else {
+		cfg, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		glog.Errorf("Failed to get k8s config: %v", err)
+		return nil, nil, errors.Wrap(err, "Error building k8s configs either run in cluster or provide config file via k8s-config arg")
+	}
+
+	k8sClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		glog.Errorf("Error building k8s clientset: %v", err)
+		return nil, nil, errors.Wrap(err, "Error building k8s clientset")
+	}
+
+	customClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		glog.Errorf("Error building k8s container version clientset: %v", err)
+		return nil, nil, errors.Wrap(err, "Error building k8s container version clientset")
+	}
+
+	return k8sClient, customClient, nil
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Dispatcher sends rollout events to the channels defined by the notification specs
+// of a ContainerVersion.
+type Dispatcher struct {
+	cs        kubernetes.Interface
+	namespace string
+	stats     stats.Stats
+	client    *http.Client
+}
+
+// NewDispatcher returns a Dispatcher that resolves the secrets referenced by notification
+// specs in the given namespace.
+func NewDispatcher(cs kubernetes.Interface, namespace string, stats stats.Stats) *Dispatcher {
+	return &Dispatcher{
+		cs:        cs,
+		namespace: namespace,
+		stats:     stats,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(nil),
+		},
+	}
+}
+
+// Notify sends the given event to each channel of the given specs whose event filter
+// accepts it. All channels are notified even if some fail, and an error describing
+// the failures is returned.
+func (d *Dispatcher) Notify(ctx context.Context, specs []cv1.NotificationSpec, event *Event) error {
+	var failures []string
+	for _, spec := range specs {
+		if !Accepts(spec, event.Type) {
+			continue
+		}
+
+		err := d.notify(ctx, spec, event)
+		if err != nil {
+			glog.Errorf("Failed to send %s notification of %s event for %s: %v", spec.Kind, event.Type, event.Workload, err)
+			d.stats.IncCount("notification_failures_total", "kind:"+spec.Kind, "event:"+event.Type)
+			failures = append(failures, spec.Kind+": "+err.Error())
+			continue
+		}
+		d.stats.IncCount("notifications_total", "kind:"+spec.Kind, "event:"+event.Type)
+	}
+
+	if len(failures) > 0 {
+		return errors.Errorf("failed to send notifications: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (d *Dispatcher) notify(ctx context.Context, spec cv1.NotificationSpec, event *Event) error {
+	ctx, span := tracing.Start(ctx, "notify."+spec.Kind, "event", event.Type)
+	notifier, err := d.notifier(spec)
+	if err == nil {
+		err = notifier.Notify(ctx, event)
+	}
+	span.Finish(err)
+	return err
+}
+
+// notifier returns the notifier for the given spec.
+func (d *Dispatcher) notifier(spec cv1.NotificationSpec) (Notifier, error) {
+	url := spec.URL
+	if spec.URLFrom != nil {
+		var err error
+		if url, err = d.secret(spec.URLFrom); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		url = strings.TrimSpace(url)
+	}
+	if url == "" {
+		return nil, errors.Errorf("no url defined for %s notification", spec.Kind)
+	}
+
+	switch spec.Kind {
+	case KindSlack:
+		return NewSlackNotifier(url, d.client), nil
+	case KindTeams:
+		return NewTeamsNotifier(url, d.client), nil
+	case KindWebhook:
+		var secret string
+		if spec.SigningSecret != nil {
+			var err error
+			if secret, err = d.secret(spec.SigningSecret); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		return NewWebhookNotifier(url, []byte(secret), d.client), nil
+	default:
+		return nil, errors.Errorf("unknown notification kind %s", spec.Kind)
+	}
+}
+
+// secret returns the value of the given secret key.
+func (d *Dispatcher) secret(ref *cv1.SecretKeyRef) (string, error) {
+	secret, err := d.cs.CoreV1().Secrets(d.namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get secret %s", ref.Name)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", errors.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return string(value), nil
+}
+
+// Accepts returns true if the event filter of the given spec accepts events of the given type.
+func Accepts(spec cv1.NotificationSpec, eventType string) bool {
+	if len(spec.Events) == 0 {
+		return true
+	}
+	for _, e := range spec.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KindSlack represents the Slack incoming webhook notification kind.
+	KindSlack = "Slack"
+	// KindTeams represents the Microsoft Teams incoming webhook notification kind.
+	KindTeams = "Teams"
+	// KindWebhook represents the generic JSON webhook notification kind.
+	KindWebhook = "Webhook"
+)
+
+// Rollout events that channels can be notified of.
+const (
+	EventStarted    = "started"
+	EventVerified   = "verified"
+	EventSucceeded  = "succeeded"
+	EventFailed     = "failed"
+	EventRolledBack = "rolled-back"
+)
+
+// Event describes a rollout lifecycle event of a workload.
+type Event struct {
+	Type            string    `json:"event"`
+	CV              string    `json:"cv"`
+	Namespace       string    `json:"namespace"`
+	Workload        string    `json:"workload"`
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previousVersion,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	TraceID         string    `json:"traceId,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// Summary returns a one line description of the event.
+func (e *Event) Summary() string {
+	var action string
+	switch e.Type {
+	case EventStarted:
+		action = "started rolling out"
+	case EventVerified:
+		action = "verified"
+	case EventSucceeded:
+		action = "rolled out"
+	case EventFailed:
+		action = "failed to roll out"
+	case EventRolledBack:
+		action = "rolled back"
+	default:
+		action = e.Type
+	}
+	return fmt.Sprintf("%s/%s %s version %s", e.Namespace, e.Workload, action, e.Version)
+}
+
+// color returns the color in which the event is displayed by chat services.
+func (e *Event) color() string {
+	switch e.Type {
+	case EventSucceeded, EventVerified:
+		return "2eb886"
+	case EventFailed, EventRolledBack:
+		return "a30200"
+	}
+	return "439fe0"
+}
+
+// Notifier sends notifications of rollout events to a channel.
+type Notifier interface {
+	// Notify sends a notification of the given event.
+	Notify(ctx context.Context, event *Event) error
+}
+
+// post sends the given JSON body to the given URL with the given additional headers.
+// Errors do not include the URL, which is often a secret.
+func post(ctx context.Context, client *http.Client, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(redactURL(err), "failed to create notification request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(redactURL(err), "failed to send notification")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("failed to send notification: %s", resp.Status)
+	}
+	return nil
+}
+
+// redactURL returns the underlying error of the given url error, which describes the
+// request by its URL.
+func redactURL(err error) error {
+	if uerr, ok := err.(*url.Error); ok {
+		return errors.Errorf("%s: %v", uerr.Op, uerr.Err)
+	}
+	return err
+}
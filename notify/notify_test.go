@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/stats"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// request is a request received by a webhook stand-in.
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newServer returns a local HTTP stand-in for notification webhooks that records the
+// requests it receives.
+func newServer(t *testing.T) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request body: %v", err)
+		}
+		if strings.HasSuffix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		requests <- request{path: r.URL.Path, header: r.Header, body: body}
+	}))
+	return server, requests
+}
+
+func testEvent(eventType string) *Event {
+	return &Event{
+		Type:            eventType,
+		CV:              "app-cv",
+		Namespace:       "default",
+		Workload:        "app",
+		Version:         "abc",
+		PreviousVersion: "def",
+		Time:            time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	server, requests := newServer(t)
+	defer server.Close()
+
+	if err := NewSlackNotifier(server.URL, http.DefaultClient).Notify(context.Background(), testEvent(EventSucceeded)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var msg slackMessage
+	if err := json.Unmarshal((<-requests).body, &msg); err != nil {
+		t.Fatalf("Failed to decode slack message: %v", err)
+	}
+	if msg.Text != "default/app rolled out version abc" {
+		t.Errorf("Unexpected text %q", msg.Text)
+	}
+	if len(msg.Attachments) != 1 || len(msg.Attachments[0].Fields) != 3 {
+		t.Errorf("Unexpected attachments %+v", msg.Attachments)
+	}
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	server, requests := newServer(t)
+	defer server.Close()
+
+	if err := NewTeamsNotifier(server.URL, http.DefaultClient).Notify(context.Background(), testEvent(EventRolledBack)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var card teamsCard
+	if err := json.Unmarshal((<-requests).body, &card); err != nil {
+		t.Fatalf("Failed to decode teams message card: %v", err)
+	}
+	if card.Type != "MessageCard" || card.Title != "default/app rolled back version abc" || card.ThemeColor != "a30200" {
+		t.Errorf("Unexpected message card %+v", card)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests := newServer(t)
+	defer server.Close()
+
+	secret := []byte("s3cret")
+	if err := NewWebhookNotifier(server.URL, secret, http.DefaultClient).Notify(context.Background(), testEvent(EventFailed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req := <-requests
+	if req.header.Get(EventHeader) != EventFailed {
+		t.Errorf("Expected event header %s, got %s", EventFailed, req.header.Get(EventHeader))
+	}
+	expected := `{"event":"failed","cv":"app-cv","namespace":"default","workload":"app","version":"abc",` +
+		`"previousVersion":"def","time":"2018-01-01T00:00:00Z"}`
+	if string(req.body) != expected {
+		t.Errorf("Expected body %s, got %s", expected, req.body)
+	}
+	if sig := req.header.Get(SignatureHeader); sig != "sha256=04794ae082394e7254af8ab61e7a88861ecd7aa6ed6fc3e51ced975c05dfe99d" {
+		t.Errorf("Unexpected signature %s", sig)
+	}
+	var event Event
+	if err := json.Unmarshal(req.body, &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event != *testEvent(EventFailed) {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if err := NewWebhookNotifier(server.URL, nil, http.DefaultClient).Notify(context.Background(), testEvent(EventFailed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sig := (<-requests).header.Get(SignatureHeader); sig != "" {
+		t.Errorf("Expected unsigned request, got signature %s", sig)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	server, requests := newServer(t)
+	defer server.Close()
+
+	cs := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "notifications", Namespace: "default"},
+		Data: map[string][]byte{
+			"slack":   []byte(server.URL + "/slack\n"),
+			"signing": []byte("s3cret"),
+		},
+	})
+	d := NewDispatcher(cs, "default", stats.NewFake())
+
+	specs := []cv1.NotificationSpec{
+		{
+			Kind:    KindSlack,
+			URLFrom: &cv1.SecretKeyRef{Name: "notifications", Key: "slack"},
+			Events:  []string{EventFailed, EventRolledBack},
+		},
+		{
+			Kind:          KindWebhook,
+			URL:           server.URL + "/webhook",
+			SigningSecret: &cv1.SecretKeyRef{Name: "notifications", Key: "signing"},
+		},
+	}
+
+	if err := d.Notify(context.Background(), specs, testEvent(EventStarted)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req := <-requests; req.path != "/webhook" ||
+		req.header.Get(SignatureHeader) != "sha256=e3d43187a2aa0c3788725ef65089ded76a654fba19e9f9e51056a6d6afad1e64" {
+		t.Errorf("Expected signed webhook request, got %s with signature %s", req.path, req.header.Get(SignatureHeader))
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("Expected filtered channel not to be notified, got %s", req.path)
+	default:
+	}
+
+	if err := d.Notify(context.Background(), specs, testEvent(EventFailed)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	paths := []string{(<-requests).path, (<-requests).path}
+	if paths[0] != "/slack" || paths[1] != "/webhook" {
+		t.Errorf("Expected both channels to be notified, got %v", paths)
+	}
+
+	specs = []cv1.NotificationSpec{
+		{Kind: KindTeams, URL: server.URL + "/fail"},
+		{Kind: KindWebhook, URLFrom: &cv1.SecretKeyRef{Name: "missing", Key: "url"}},
+		{Kind: KindSlack, URL: "http://127.0.0.1:0/services/s3cret-token"},
+		{Kind: KindWebhook, URL: server.URL + "/webhook"},
+	}
+	err := d.Notify(context.Background(), specs, testEvent(EventSucceeded))
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "missing") ||
+		!strings.Contains(err.Error(), "Slack") {
+		t.Errorf("Expected errors for failed channels, got %v", err)
+	}
+	if strings.Contains(err.Error(), "s3cret-token") {
+		t.Errorf("Expected errors not to contain the webhook url, got %v", err)
+	}
+	if paths := []string{(<-requests).path, (<-requests).path}; paths[1] != "/webhook" {
+		t.Errorf("Expected remaining channels to be notified after a failure, got %v", paths)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// SlackNotifier is a Notifier that posts messages to a Slack incoming webhook.
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier returns a notifier that posts to the Slack incoming webhook with
+// the given URL.
+func NewSlackNotifier(url string, client *http.Client) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: client,
+	}
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Text   string       `json:"text,omitempty"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Notify implements the Notifier interface.
+func (sn *SlackNotifier) Notify(ctx context.Context, event *Event) error {
+	attachment := slackAttachment{
+		Color: "#" + event.color(),
+		Text:  event.Message,
+		Fields: []slackField{
+			{Title: "ContainerVersion", Value: event.CV, Short: true},
+			{Title: "Version", Value: event.Version, Short: true},
+		},
+	}
+	if event.PreviousVersion != "" {
+		attachment.Fields = append(attachment.Fields,
+			slackField{Title: "Previous version", Value: event.PreviousVersion, Short: true})
+	}
+	if event.TraceID != "" {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Trace", Value: event.TraceID, Short: true})
+	}
+
+	body, err := json.Marshal(&slackMessage{
+		Text:        event.Summary(),
+		Attachments: []slackAttachment{attachment},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode slack message")
+	}
+	return errors.WithStack(post(ctx, sn.client, sn.url, body, nil))
+}
@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TeamsNotifier is a Notifier that posts message cards to a Microsoft Teams incoming webhook.
+type TeamsNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewTeamsNotifier returns a notifier that posts to the Microsoft Teams incoming webhook
+// with the given URL.
+func NewTeamsNotifier(url string, client *http.Client) *TeamsNotifier {
+	return &TeamsNotifier{
+		url:    url,
+		client: client,
+	}
+}
+
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	Summary    string         `json:"summary"`
+	ThemeColor string         `json:"themeColor"`
+	Title      string         `json:"title"`
+	Text       string         `json:"text,omitempty"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Notify implements the Notifier interface.
+func (tn *TeamsNotifier) Notify(ctx context.Context, event *Event) error {
+	facts := []teamsFact{
+		{Name: "ContainerVersion", Value: event.CV},
+		{Name: "Workload", Value: event.Workload},
+		{Name: "Version", Value: event.Version},
+	}
+	if event.PreviousVersion != "" {
+		facts = append(facts, teamsFact{Name: "Previous version", Value: event.PreviousVersion})
+	}
+	if event.TraceID != "" {
+		facts = append(facts, teamsFact{Name: "Trace", Value: event.TraceID})
+	}
+
+	body, err := json.Marshal(&teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    event.Summary(),
+		ThemeColor: event.color(),
+		Title:      event.Summary(),
+		Text:       event.Message,
+		Sections:   []teamsSection{{Facts: facts}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode teams message card")
+	}
+	return errors.WithStack(post(ctx, tn.client, tn.url, body, nil))
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EventHeader is the header of webhook requests that contains the event type.
+	EventHeader = "X-Cvmanager-Event"
+	// SignatureHeader is the header of webhook requests that contains the HMAC-SHA256
+	// signature of the request body, in the form sha256=<hex digest>.
+	SignatureHeader = "X-Cvmanager-Signature"
+)
+
+// WebhookNotifier is a Notifier that posts events as JSON to a URL, optionally signing
+// the request body with a shared secret.
+type WebhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier that posts events to the given URL. Requests
+// are signed with the given secret if it is not empty.
+func NewWebhookNotifier(url string, secret []byte, client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		secret: secret,
+		client: client,
+	}
+}
+
+// Notify implements the Notifier interface.
+func (wn *WebhookNotifier) Notify(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook event")
+	}
+
+	headers := map[string]string{
+		EventHeader: event.Type,
+	}
+	if len(wn.secret) > 0 {
+		headers[SignatureHeader] = Sign(wn.secret, body)
+	}
+	return errors.WithStack(post(ctx, wn.client, wn.url, body, headers))
+}
+
+// Sign returns the signature of the given webhook request body with the given secret,
+// as sent in the SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,374 @@
+package promotion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	conf "github.com/nearmap/cvmanager/config"
+	"github.com/nearmap/cvmanager/cv"
+	"github.com/nearmap/cvmanager/events"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	clientset "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned"
+	customlister "github.com/nearmap/cvmanager/gok8s/client/listers/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxRecords is the number of promotions recorded in the status of a Promotion.
+const maxRecords = 10
+
+// PromoteToAnnotation is the annotation of a ContainerVersion that lists the namespaces,
+// separated by commas, whose Promotions may promote its versions. Versions are only
+// promoted to other namespaces than that of the ContainerVersion if it has the annotation,
+// which may be * to allow all namespaces.
+const PromoteToAnnotation = "cvmanager/promote-to"
+
+// TaggerFunc returns the tagger of the given image repository, whose versions match
+// the given version syntax.
+type TaggerFunc func(imageRepo, versionSyntax string) (registry.Tagger, error)
+
+// Controller promotes versions across environments as specified by Promotion resources.
+// Once a version has been deployed successfully by the source ContainerVersion of a
+// Promotion and meets the conditions of the Promotion, the controller adds the target
+// tag of the Promotion to the version, which is then deployed by any ContainerVersion
+// that follows that tag.
+type Controller struct {
+	customCS        clientset.Interface
+	k8sProvider     *k8s.Provider
+	historyProvider history.Provider
+	taggers         TaggerFunc
+
+	// listers are keyed by the namespace of the informer that provides them,
+	// with an empty namespace covering all namespaces.
+	listers map[string]customlister.PromotionLister
+	synced  []cache.InformerSynced
+
+	queue       workqueue.RateLimitingInterface
+	broadcaster *events.Broadcaster
+
+	opts *conf.Options
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewController returns a new promotion controller, which watches the Promotion resources
+// of the given informers. The k8s provider obtains the source ContainerVersions and their
+// workloads, and the history provider their rollbacks.
+func NewController(k8sCS kubernetes.Interface, customCS clientset.Interface,
+	k8sProvider *k8s.Provider, historyProvider history.Provider, taggers TaggerFunc,
+	infs []*cv.Informers, options ...func(*conf.Options)) *Controller {
+
+	opts := conf.NewOptions()
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	c := &Controller{
+		customCS:        customCS,
+		k8sProvider:     k8sProvider,
+		historyProvider: historyProvider,
+		taggers:         taggers,
+
+		listers: make(map[string]customlister.PromotionLister),
+
+		queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Promotions"),
+		broadcaster: events.NewBroadcaster(k8sCS),
+
+		opts: opts,
+		now:  time.Now,
+	}
+
+	glog.V(1).Info("Setting up event handlers in promotion controller")
+
+	for _, inf := range infs {
+		informer := inf.Promotions.Custom().V1().Promotions()
+
+		c.listers[inf.Namespace] = informer.Lister()
+		c.synced = append(c.synced, informer.Informer().HasSynced)
+
+		// Updates include the periodic resync, which reevaluates promotions as the status
+		// of their source changes.
+		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: c.enqueue,
+			UpdateFunc: func(old, new interface{}) {
+				c.enqueue(new)
+			},
+		})
+	}
+
+	return c
+}
+
+// Run starts the promotion controller and blocks until the given channel is closed.
+func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	glog.V(1).Info("Starting promotion controller")
+
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		return errors.New("Fail to wait for promotion cache sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	glog.V(2).Info("Started promotion controller")
+
+	<-stopCh
+	glog.V(1).Info("Shutting down promotion controller")
+	return nil
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem reads a single promotion key off the queue and syncs it. Failed
+// keys are requeued with a backoff, and promotions that are waiting for their conditions
+// are requeued once they may be met.
+func (c *Controller) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.queue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected string in queue but got %#v", obj))
+		return true
+	}
+
+	after, err := c.syncHandler(key)
+	if err != nil {
+		runtime.HandleError(errors.Wrapf(err, "error syncing promotion '%s'", key))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(obj)
+	if after > 0 {
+		glog.V(2).Infof("Reevaluating promotion %s in %s", key, after)
+		c.queue.AddAfter(key, after)
+	}
+	return true
+}
+
+// syncHandler promotes the current version of the source of the promotion with the given
+// key if it meets the conditions of the promotion. It returns the time after which the
+// promotion should be reevaluated, if its conditions may be met by then.
+func (c *Controller) syncHandler(key string) (time.Duration, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return 0, nil
+	}
+
+	p, err := c.lister(namespace).Promotions(namespace).Get(name)
+	if err != nil {
+		if k8serr.IsNotFound(err) {
+			glog.V(2).Infof("Promotion %s no longer exists", key)
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "failed to get promotion %s", key)
+	}
+
+	sourceNamespace := p.Spec.SourceNamespace
+	if sourceNamespace == "" {
+		sourceNamespace = p.Namespace
+	}
+	if !c.k8sProvider.WatchesNamespace(sourceNamespace) {
+		return 0, c.updateMessage(p, fmt.Sprintf("source namespace %s is not watched by the controller", sourceNamespace))
+	}
+	source, err := c.k8sProvider.InNamespace(sourceNamespace).CV(p.Spec.Source)
+	if err != nil {
+		if k8serr.IsNotFound(errors.Cause(err)) {
+			return 0, c.updateMessage(p, fmt.Sprintf("source %s/%s does not exist", sourceNamespace, p.Spec.Source))
+		}
+		return 0, errors.WithStack(err)
+	}
+	if !promotesTo(source, p.Namespace) {
+		return 0, c.updateMessage(p, fmt.Sprintf("source %s/%s does not allow promotions to namespace %s with the %s annotation",
+			sourceNamespace, p.Spec.Source, p.Namespace, PromoteToAnnotation))
+	}
+
+	version, after, message, err := c.candidate(p, source)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if version == "" {
+		return after, c.updateMessage(p, message)
+	}
+
+	if err := c.promote(p, source, version); err != nil {
+		c.opts.Stats.IncCount("promotion_failures_total", "promotion:"+p.Name, "namespace:"+p.Namespace)
+		c.broadcaster.Recorder(p).Eventf(events.Warning, events.ReasonPromotionFailed,
+			"Failed to promote version %s of %s to tag %s: %v", version, source.Name, p.Spec.TargetTag, err)
+		return 0, errors.WithStack(err)
+	}
+
+	c.opts.Stats.IncCount("promotions_total", "promotion:"+p.Name, "namespace:"+p.Namespace)
+	c.broadcaster.Recorder(p, source).Eventf(events.Normal, events.ReasonPromoted,
+		"Promoted version %s of %s to tag %s", version, source.Name, p.Spec.TargetTag)
+	return 0, nil
+}
+
+// promotesTo returns true if the versions of the given source may be promoted by the
+// Promotions of the given namespace.
+func promotesTo(source *cv1.ContainerVersion, namespace string) bool {
+	if source.Namespace == namespace {
+		return true
+	}
+	for _, ns := range strings.Split(source.Annotations[PromoteToAnnotation], ",") {
+		if ns = strings.TrimSpace(ns); ns == namespace || ns == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Controller) lister(namespace string) customlister.PromotionLister {
+	if l, ok := c.listers[namespace]; ok {
+		return l
+	}
+	return c.listers[metav1.NamespaceAll]
+}
+
+// candidate returns the version of the source that should be promoted, or an empty
+// version and a message describing why there is none. If the current version of the
+// source has not succeeded for long enough, candidate also returns the time until it has.
+func (c *Controller) candidate(p *cv1.Promotion, source *cv1.ContainerVersion) (string, time.Duration, string, error) {
+	status := source.Status
+	if status.CurrStatus != k8s.StatusSuccess || status.CurrVersion == "" || status.CurrVersion != status.SuccessVersion {
+		return "", 0, fmt.Sprintf("waiting for a successful rollout of %s", source.Name), nil
+	}
+	version := status.CurrVersion
+	if version == p.Status.Version {
+		return "", 0, "", nil
+	}
+
+	conditions := p.Spec.Conditions
+	if conditions.SucceededForSeconds > 0 {
+		required := time.Duration(conditions.SucceededForSeconds) * time.Second
+		elapsed := c.now().Sub(status.CurrStatusTime.Time)
+		if elapsed < required {
+			return "", required - elapsed, fmt.Sprintf("version %s has succeeded for %s of %s",
+				version, elapsed.Truncate(time.Second), required), nil
+		}
+	}
+
+	if conditions.NoRollback {
+		if !source.Spec.History.Enabled {
+			return "", 0, fmt.Sprintf("noRollback requires history to be enabled for %s", source.Name), nil
+		}
+		rolledBack, err := c.rolledBack(source, version)
+		if err != nil {
+			return "", 0, "", errors.WithStack(err)
+		}
+		if rolledBack {
+			return "", 0, fmt.Sprintf("version %s of %s has been rolled back", version, source.Name), nil
+		}
+	}
+
+	return version, 0, "", nil
+}
+
+// rolledBack returns true if the history of the source has a rollback of the given
+// version, or any rollback since the current version succeeded.
+func (c *Controller) rolledBack(source *cv1.ContainerVersion, version string) (bool, error) {
+	var names []string
+	if source.Spec.History.Name != "" {
+		names = []string{source.Spec.History.Name}
+	} else {
+		workloads, err := c.k8sProvider.InNamespace(source.Namespace).Workloads(source)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get workloads of %s", source.Name)
+		}
+		for _, wl := range workloads {
+			names = append(names, wl.Name())
+		}
+	}
+
+	query := history.Query{Statuses: []string{history.StatusRolledBack}}
+	for _, name := range names {
+		page, err := c.historyProvider.History(source.Namespace, name, query)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get history %s of %s", name, source.Name)
+		}
+		for _, r := range page.Records {
+			if r.Version == version || !r.Time.Before(source.Status.CurrStatusTime.Time) {
+				glog.V(2).Infof("Found rollback of version %s at %v in history %s of %s", r.Version, r.Time, name, source.Name)
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// promote adds the target tag of the promotion to the given version and records the
+// promotion in its status.
+func (c *Controller) promote(p *cv1.Promotion, source *cv1.ContainerVersion, version string) error {
+	glog.V(1).Infof("Promoting version %s of %s/%s to tag %s for promotion %s/%s",
+		version, source.Namespace, source.Name, p.Spec.TargetTag, p.Namespace, p.Name)
+
+	tagger, err := c.taggers(source.Spec.ImageRepo, source.Spec.VersionSyntax)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get tagger for %s", source.Spec.ImageRepo)
+	}
+	if err := tagger.Add(version, p.Spec.TargetTag); err != nil {
+		return errors.Wrapf(err, "failed to add tag %s to version %s", p.Spec.TargetTag, version)
+	}
+
+	now := metav1.NewTime(c.now())
+	p = p.DeepCopy()
+	p.Status.Version = version
+	p.Status.Time = now
+	p.Status.Message = ""
+	p.Status.Records = append([]cv1.PromotionRecord{{Version: version, Time: now}}, p.Status.Records...)
+	if len(p.Status.Records) > maxRecords {
+		p.Status.Records = p.Status.Records[:maxRecords]
+	}
+	if _, err := c.customCS.CustomV1().Promotions(p.Namespace).Update(p); err != nil {
+		return errors.Wrapf(err, "failed to update status of promotion %s", p.Name)
+	}
+	return nil
+}
+
+// updateMessage updates the status message of the promotion, if it has changed.
+func (c *Controller) updateMessage(p *cv1.Promotion, message string) error {
+	if p.Status.Message == message {
+		return nil
+	}
+	glog.V(2).Infof("Not promoting for promotion %s/%s: %s", p.Namespace, p.Name, message)
+
+	p = p.DeepCopy()
+	p.Status.Message = message
+	if _, err := c.customCS.CustomV1().Promotions(p.Namespace).Update(p); err != nil {
+		return errors.Wrapf(err, "failed to update status of promotion %s", p.Name)
+	}
+	return nil
+}
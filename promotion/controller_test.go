@@ -0,0 +1,241 @@
+package promotion
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/config"
+	"github.com/nearmap/cvmanager/cv"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/stats"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// tagger records the tags that are added to versions.
+type tagger struct {
+	added []string
+}
+
+func (t *tagger) Add(version string, tags ...string) error {
+	t.added = append(t.added, version+":"+strings.Join(tags, ","))
+	return nil
+}
+
+func (t *tagger) Remove(tags ...string) error {
+	return nil
+}
+
+func (t *tagger) Get(version string) ([]string, error) {
+	return nil, nil
+}
+
+func (t *tagger) List() ([]registry.Tag, error) {
+	return nil, nil
+}
+
+func (t *tagger) Move(from, to, digest string) error {
+	return nil
+}
+
+func (t *tagger) Prune(keep int, before time.Time, dryRun bool) ([]registry.Tag, error) {
+	return nil, nil
+}
+
+var now = time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newSource(status string, succeeded time.Time) *cv1.ContainerVersion {
+	return &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-dev",
+			Namespace:   "dev",
+			Annotations: map[string]string{PromoteToAnnotation: "staging, prod"},
+		},
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo: "nearmap/app",
+			Tag:       "dev",
+			History:   cv1.HistorySpec{Enabled: true, Name: "app-dev"},
+		},
+		Status: cv1.ContainerVersionStatus{
+			CurrVersion:    "abc",
+			CurrStatus:     status,
+			CurrStatusTime: metav1.NewTime(succeeded),
+			SuccessVersion: "abc",
+		},
+	}
+}
+
+func newPromotion(conditions cv1.PromotionConditions) *cv1.Promotion {
+	return &cv1.Promotion{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-staging", Namespace: "staging"},
+		Spec: cv1.PromotionSpec{
+			Source:          "app-dev",
+			SourceNamespace: "dev",
+			TargetTag:       "staging",
+			Conditions:      conditions,
+		},
+	}
+}
+
+// newController returns a controller of the given promotion and source with a synced
+// promotion informer.
+func newController(t *testing.T, p *cv1.Promotion, source *cv1.ContainerVersion, records ...*history.Record) (*Controller, *tagger, *fake.Clientset) {
+	k8sCS := k8sfake.NewSimpleClientset()
+	customCS := fake.NewSimpleClientset(p, source)
+
+	historyProvider := history.NewProvider(k8sCS, stats.NewFake())
+	for _, r := range records {
+		if err := historyProvider.Add(source.Namespace, source.Spec.History.Name, r); err != nil {
+			t.Fatalf("Failed to add history record: %v", err)
+		}
+	}
+
+	tg := &tagger{}
+	infs := cv.NewInformers(k8sCS, customCS, 0, nil, "")
+	c := NewController(k8sCS, customCS, k8s.NewProvider(k8sCS, customCS, ""), historyProvider,
+		func(imageRepo, versionSyntax string) (registry.Tagger, error) { return tg, nil }, infs)
+	c.now = func() time.Time { return now }
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cv.StartInformers(infs, stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		t.Fatalf("Failed to sync promotion informer")
+	}
+	return c, tg, customCS
+}
+
+func promotionStatus(t *testing.T, cs *fake.Clientset) cv1.PromotionStatus {
+	p, err := cs.CustomV1().Promotions("staging").Get("app-staging", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get promotion: %v", err)
+	}
+	return p.Status
+}
+
+func TestPromote(t *testing.T) {
+	p := newPromotion(cv1.PromotionConditions{SucceededForSeconds: 3600, NoRollback: true})
+	c, tg, cs := newController(t, p, newSource(k8s.StatusSuccess, now.Add(-2*time.Hour)))
+
+	after, err := c.syncHandler("staging/app-staging")
+	if err != nil || after != 0 {
+		t.Fatalf("Unexpected result %s: %v", after, err)
+	}
+	if len(tg.added) != 1 || tg.added[0] != "abc:staging" {
+		t.Errorf("Expected version abc to be tagged staging, got %v", tg.added)
+	}
+	status := promotionStatus(t, cs)
+	if status.Version != "abc" || !status.Time.Time.Equal(now) || len(status.Records) != 1 || status.Records[0].Version != "abc" {
+		t.Errorf("Unexpected promotion status %+v", status)
+	}
+}
+
+func TestPromoteConditions(t *testing.T) {
+	tests := []struct {
+		message   string
+		promotion *cv1.Promotion
+		source    *cv1.ContainerVersion
+		records   []*history.Record
+		after     time.Duration
+		status    string
+	}{
+		{
+			message:   "rollout in progress",
+			promotion: newPromotion(cv1.PromotionConditions{}),
+			source:    newSource(k8s.StatusProgressing, now),
+			status:    "waiting for a successful rollout of app-dev",
+		},
+		{
+			message:   "not succeeded for long enough",
+			promotion: newPromotion(cv1.PromotionConditions{SucceededForSeconds: 3600}),
+			source:    newSource(k8s.StatusSuccess, now.Add(-20*time.Minute)),
+			after:     40 * time.Minute,
+			status:    "version abc has succeeded for 20m0s of 1h0m0s",
+		},
+		{
+			message:   "rolled back",
+			promotion: newPromotion(cv1.PromotionConditions{NoRollback: true}),
+			source:    newSource(k8s.StatusSuccess, now.Add(-time.Hour)),
+			records: []*history.Record{
+				{Name: "app", Version: "abc", Status: history.StatusRolledBack, Time: now.Add(-2 * time.Hour)},
+			},
+			status: "version abc of app-dev has been rolled back",
+		},
+	}
+
+	for _, test := range tests {
+		c, tg, cs := newController(t, test.promotion, test.source, test.records...)
+		after, err := c.syncHandler("staging/app-staging")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.message, err)
+		}
+		if after != test.after {
+			t.Errorf("%s: expected reevaluation after %s, got %s", test.message, test.after, after)
+		}
+		if len(tg.added) != 0 {
+			t.Errorf("%s: expected no promotion, got %v", test.message, tg.added)
+		}
+		if status := promotionStatus(t, cs); status.Message != test.status || status.Version != "" {
+			t.Errorf("%s: unexpected promotion status %+v", test.message, status)
+		}
+	}
+}
+
+func TestPromoteOnce(t *testing.T) {
+	p := newPromotion(cv1.PromotionConditions{NoRollback: true})
+	p.Status.Version = "abc"
+	older := &history.Record{Name: "app", Version: "xyz", Status: history.StatusRolledBack, Time: now.Add(-2 * time.Hour)}
+	c, tg, _ := newController(t, p, newSource(k8s.StatusSuccess, now.Add(-time.Hour)), older)
+
+	if _, err := c.syncHandler("staging/app-staging"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tg.added) != 0 {
+		t.Errorf("Expected promoted version not to be promoted again, got %v", tg.added)
+	}
+
+	p.Status.Version = ""
+	source := newSource(k8s.StatusSuccess, now.Add(-time.Hour))
+	if version, _, message, err := c.candidate(p, source); err != nil || version != "abc" {
+		t.Errorf("Expected rollback of another version before the success to be ignored, got %q %q: %v", version, message, err)
+	}
+}
+
+func TestPromoteSourceNamespace(t *testing.T) {
+	tests := []struct {
+		message    string
+		annotation string
+		namespaces []string
+		expected   string
+	}{
+		{"not annotated", "", nil, "does not allow promotions to namespace staging"},
+		{"other namespace", "prod", nil, "does not allow promotions to namespace staging"},
+		{"all namespaces", "*", nil, ""},
+		{"unwatched", "staging", []string{"staging"}, "source namespace dev is not watched"},
+	}
+
+	for _, test := range tests {
+		source := newSource(k8s.StatusSuccess, now.Add(-time.Hour))
+		source.Annotations[PromoteToAnnotation] = test.annotation
+		c, tg, cs := newController(t, newPromotion(cv1.PromotionConditions{}), source)
+		if test.namespaces != nil {
+			c.k8sProvider = k8s.NewProvider(k8sfake.NewSimpleClientset(), cs, "", config.WithNamespaces(test.namespaces))
+		}
+
+		if _, err := c.syncHandler("staging/app-staging"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.message, err)
+		}
+		if promoted := len(tg.added) == 1; promoted != (test.expected == "") {
+			t.Errorf("%s: expected promoted to be %v, got %v", test.message, test.expected == "", tg.added)
+		}
+		if message := promotionStatus(t, cs).Message; !strings.Contains(message, test.expected) {
+			t.Errorf("%s: expected message %q, got %q", test.message, test.expected, message)
+		}
+	}
+}
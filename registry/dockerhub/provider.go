@@ -1,17 +1,43 @@
 package dockerhub
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/golang/glog"
 	"github.com/heroku/docker-registry-client/registry"
 	cvregistry "github.com/nearmap/cvmanager/registry"
 	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
 const dockerhubURL = "https://registry-1.docker.io/"
 
+// manifestMediaTypes are the media types of the manifests of images, which are accepted
+// when the manifest or digest of a tag is requested. Without them the registry responds
+// with a schema1 manifest, whose digest differs from that of the pushed image.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// errManifestNotFound is the cause of errors for tags that do not exist.
+var errManifestNotFound = errors.New("manifest not found")
+
 // Options contains additional (optional) configuration for the controller
 type Options struct {
 	Stats stats.Stats
@@ -47,6 +73,7 @@ func WithCreds(user, password string) func(*Options) {
 type V2Provider struct {
 	repository string
 	client     *registry.Registry
+	vRegex     *regexp.Regexp
 	opts       *Options
 }
 
@@ -63,6 +90,11 @@ func NewDHV2(repository, versionExp string, options ...func(*Options)) (*V2Provi
 		opt(opts)
 	}
 
+	vRegex, err := regexp.Compile(versionExp)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	client, err := registry.New(opts.HubURL, opts.User, opts.Password)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to connect to dockerhub")
@@ -71,6 +103,7 @@ func NewDHV2(repository, versionExp string, options ...func(*Options)) (*V2Provi
 	return &V2Provider{
 		client:     client,
 		repository: repository,
+		vRegex:     vRegex,
 		opts:       opts,
 	}, nil
 }
@@ -80,20 +113,37 @@ func (vp *V2Provider) RegistryFor(imageRepo string) (cvregistry.Registry, error)
 	return &V2Provider{
 		client:     vp.client,
 		repository: imageRepo,
+		vRegex:     vp.vRegex,
 		opts:       vp.opts,
 	}, nil
 }
 
 // Version implements the Registry interface.
 func (vp *V2Provider) Version(ctx context.Context, tag string) (string, error) {
+	defer vp.latencyStats("version", time.Now())
+	_, span := tracing.Start(ctx, "dockerhub.ManifestDigest", "repository", vp.repository, "tag", tag)
 	newVersion, err := vp.getDigest(tag)
+	span.Finish(err)
 	if err != nil {
-		vp.opts.Stats.IncCount(fmt.Sprintf("registry.%s.sync.failure", vp.repository), "badsha")
+		vp.opts.Stats.IncCount("registry_failures_total",
+			"registry:dockerhub", "operation:version", "repository:"+vp.repository, "reason:badsha")
 		return "", errors.Errorf("No version found for tag %s", tag)
 	}
 	return newVersion, nil
 }
 
+// Digest implements the Digester interface.
+func (vp *V2Provider) Digest(ctx context.Context, version string) (string, error) {
+	defer vp.latencyStats("digest", time.Now())
+	_, span := tracing.Start(ctx, "dockerhub.ManifestDigest", "repository", vp.repository, "tag", version)
+	digest, err := vp.getDigest(version)
+	span.Finish(err)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get digest of version %s", version)
+	}
+	return digest, nil
+}
+
 // Add adds list of tags to the image identified with version
 func (vp *V2Provider) Add(version string, tags ...string) error {
 	return vp.addTagsOnImg(version, tags...)
@@ -115,18 +165,299 @@ func (vp *V2Provider) Get(version string) ([]string, error) {
 	return []string{version, digest}, nil
 }
 
+// List implements the Tagger interface. Digests are resolved with HEAD requests, which do
+// not count against the pull rate limit of Docker Hub, so push times are not listed as
+// they require the manifest of each tag.
+func (vp *V2Provider) List() ([]cvregistry.Tag, error) {
+	defer vp.latencyStats("list", time.Now())
+
+	names, err := vp.client.Tags(vp.repository)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list tags of repository %s", vp.repository)
+	}
+
+	var tags []cvregistry.Tag
+	for _, name := range names {
+		digest, err := vp.getDigest(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tags = append(tags, cvregistry.Tag{
+			Name:   name,
+			Digest: digest,
+		})
+	}
+
+	cvregistry.SortTags(tags)
+	return tags, nil
+}
+
+// Move implements the Tagger interface. The registry API does not support conditional
+// updates of tags, so the digest of the tag is compared immediately before the tag is
+// moved, and the tag is verified to refer to the moved image afterwards. The check is
+// best-effort: a concurrent move of the tag in between is overwritten.
+func (vp *V2Provider) Move(from, to, digest string) error {
+	manifest, mediaType, err := vp.rawManifest(from)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to find manifest for tag %s on repository %s", from, vp.repository)
+	}
+	target, err := vp.getDigest(from)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	current, err := vp.tagDigest(to)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if current != digest {
+		return &cvregistry.DigestMismatchError{Tag: to, Expected: digest, Actual: current}
+	}
+	if current == target {
+		glog.V(2).Infof("Tag %s already refers to image %s of tag %s", to, target, from)
+		return nil
+	}
+
+	if err := vp.putManifest(to, manifest, mediaType); err != nil {
+		return errors.Wrapf(err, "Failed to move tag %s to image %s on repository %s", to, target, vp.repository)
+	}
+
+	moved, err := vp.tagDigest(to)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if moved != target {
+		return errors.Errorf("tag %s was concurrently moved to image %s", to, moved)
+	}
+	glog.V(1).Infof("Moved tag %s from image %s to image %s of tag %s", to, current, target, from)
+	return nil
+}
+
+// Prune implements the Tagger interface. The manifests of pruned images are deleted,
+// which requires a registry that allows deletes. The push times of images are the times
+// at which they were created, as recorded by their manifests, which are only fetched for
+// the images that no environment tag references.
+func (vp *V2Provider) Prune(keep int, before time.Time, dryRun bool) ([]cvregistry.Tag, error) {
+	tags, err := vp.List()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pushed := make(map[string]time.Time)
+	for _, tag := range cvregistry.Unreferenced(tags, vp.vRegex) {
+		manifest, err := vp.client.Manifest(vp.repository, tag.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to find manifest for tag %s on repository %s", tag.Name, vp.repository)
+		}
+		pushed[tag.Digest] = created(manifest)
+	}
+	for i := range tags {
+		tags[i].Pushed = pushed[tags[i].Digest]
+	}
+
+	candidates := cvregistry.PruneCandidates(tags, vp.vRegex, keep, before)
+	if dryRun {
+		return candidates, nil
+	}
+
+	deleted := make(map[string]bool)
+	for _, tag := range candidates {
+		if deleted[tag.Digest] {
+			continue
+		}
+		if err := vp.client.DeleteManifest(vp.repository, digest.Digest(tag.Digest)); err != nil {
+			return nil, errors.Wrapf(err, "Failed to delete manifest %s on repository %s", tag.Digest, vp.repository)
+		}
+		deleted[tag.Digest] = true
+	}
+	return candidates, nil
+}
+
+// Signatures implements the SignatureFetcher interface.
+func (vp *V2Provider) Signatures(ctx context.Context, digest string) ([]cvregistry.Signature, error) {
+	defer vp.latencyStats("signatures", time.Now())
+	tag := cvregistry.SignatureTag(digest)
+	ctx, span := tracing.Start(ctx, "dockerhub.Manifest", "repository", vp.repository, "tag", tag)
+	defer span.Finish(nil)
+
+	manifest, err := vp.manifest(ctx, tag)
+	if err != nil {
+		span.SetError(err)
+		return nil, errors.Wrapf(err, "Failed to get signature artifact %s on repository %s", tag, vp.repository)
+	}
+	if manifest == nil {
+		glog.V(2).Infof("No signature artifact %s in repository %s", tag, vp.repository)
+		return nil, nil
+	}
+
+	layers, err := cvregistry.SignatureLayers(manifest)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var signatures []cvregistry.Signature
+	for _, layer := range layers {
+		payload, err := vp.blob(ctx, layer.Digest)
+		if err != nil {
+			span.SetError(err)
+			return nil, errors.Wrapf(err, "Failed to get signature payload of %s on repository %s", tag, vp.repository)
+		}
+		signatures = append(signatures, cvregistry.Signature{Payload: payload, Signature: layer.Signature})
+	}
+	return signatures, nil
+}
+
+// Artifact implements the ArtifactFetcher interface.
+func (vp *V2Provider) Artifact(ctx context.Context, tag string) ([][]byte, error) {
+	defer vp.latencyStats("artifact", time.Now())
+	ctx, span := tracing.Start(ctx, "dockerhub.Manifest", "repository", vp.repository, "tag", tag)
+	defer span.Finish(nil)
+
+	manifest, err := vp.manifest(ctx, tag)
+	if err != nil {
+		span.SetError(err)
+		return nil, errors.Wrapf(err, "Failed to get artifact %s on repository %s", tag, vp.repository)
+	}
+	if manifest == nil {
+		glog.V(2).Infof("No artifact %s in repository %s", tag, vp.repository)
+		return nil, nil
+	}
+
+	digests, err := cvregistry.ArtifactLayers(manifest)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var layers [][]byte
+	for _, digest := range digests {
+		content, err := vp.blob(ctx, digest)
+		if err != nil {
+			span.SetError(err)
+			return nil, errors.Wrapf(err, "Failed to get layer of artifact %s on repository %s", tag, vp.repository)
+		}
+		layers = append(layers, content)
+	}
+	return layers, nil
+}
+
+// manifest returns the OCI or docker v2 manifest of the artifact with the given tag, or
+// nil if there is no such artifact.
+func (vp *V2Provider) manifest(ctx context.Context, tag string) ([]byte, error) {
+	manifest, err := vp.get(ctx, fmt.Sprintf("/v2/%s/manifests/%s", vp.repository, tag),
+		strings.Join(cvregistry.SignatureMediaTypes, ", "))
+	if err != nil {
+		if herr, ok := err.(*registry.HttpStatusError); ok && herr.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// blob returns the content of the blob with the given digest.
+func (vp *V2Provider) blob(ctx context.Context, digest string) ([]byte, error) {
+	return vp.get(ctx, fmt.Sprintf("/v2/%s/blobs/%s", vp.repository, digest), "")
+}
+
+// get returns the content of the given path of the registry, accepting the given media
+// types if any. Errors with an unsuccessful status are returned as HttpStatusErrors.
+func (vp *V2Provider) get(ctx context.Context, path, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(vp.client.URL, "/")+path, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := vp.client.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			return nil, uerr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(io.LimitReader(resp.Body, cvregistry.MaxPayloadSize))
+}
+
+// rawManifest returns the manifest of the given reference as it was pushed, with its
+// media type.
+func (vp *V2Provider) rawManifest(reference string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, vp.manifestURL(reference), nil)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := vp.client.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	manifest, err := ioutil.ReadAll(io.LimitReader(resp.Body, cvregistry.MaxPayloadSize))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	return manifest, resp.Header.Get("Content-Type"), nil
+}
+
+// manifestURL returns the URL of the manifest of the given reference.
+func (vp *V2Provider) manifestURL(reference string) string {
+	return strings.TrimSuffix(vp.client.URL, "/") + fmt.Sprintf("/v2/%s/manifests/%s", vp.repository, reference)
+}
+
+// putManifest tags the given manifest of the given media type with the given tag.
+func (vp *V2Provider) putManifest(tag string, manifest []byte, mediaType string) error {
+	req, err := http.NewRequest(http.MethodPut, vp.manifestURL(tag),
+		bytes.NewReader(manifest))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := vp.client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// tagDigest returns the digest of the image with the given tag, or an empty digest if
+// there is no such image.
+func (vp *V2Provider) tagDigest(tag string) (string, error) {
+	d, err := vp.getDigest(tag)
+	if errors.Cause(err) == errManifestNotFound {
+		return "", nil
+	}
+	return d, err
+}
+
+// created returns the time at which the image of the manifest was created, or the zero
+// time if it is unknown.
+func created(manifest *schema1.SignedManifest) time.Time {
+	if len(manifest.History) == 0 {
+		return time.Time{}
+	}
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.Unmarshal([]byte(manifest.History[0].V1Compatibility), &config); err != nil {
+		return time.Time{}
+	}
+	return config.Created
+}
+
 // addTagsOnImg fetches the manifest of container image of specified version tag
 // and tag additional tags to the same manifest
 // TODO:  allow using credentials to support private dockerhub repos too
 // for now uses anonymous access
 func (vp *V2Provider) addTagsOnImg(version string, tags ...string) error {
-	manifest, err := vp.client.Manifest(vp.repository, version)
+	manifest, mediaType, err := vp.rawManifest(version)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to find manifest for image version %s on repository %s", version, vp.repository)
 	}
 
 	for _, tag := range tags {
-		err := vp.client.PutManifest(vp.repository, tag, manifest)
+		err := vp.putManifest(tag, manifest, mediaType)
 		if err != nil {
 			return errors.Wrapf(err, "Failed to add tags %s on image version %s on repository %s", tag, version, vp.repository)
 		}
@@ -136,9 +467,28 @@ func (vp *V2Provider) addTagsOnImg(version string, tags ...string) error {
 
 // getDigest fetches the digest of dockerhub image of requested repository and tag
 func (vp *V2Provider) getDigest(tag string) (string, error) {
-	digest, err := vp.client.ManifestDigest(vp.repository, tag)
+	req, err := http.NewRequest(http.MethodHead, vp.manifestURL(tag), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := vp.client.Client.Do(req)
 	if err != nil {
 		return "", errors.Wrapf(err, "Failed to get tag %s on repository %s", tag, vp.repository)
 	}
-	return digest.String(), nil
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errors.Wrapf(errManifestNotFound, "Failed to get tag %s on repository %s", tag, vp.repository)
+	}
+	d, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get digest of tag %s on repository %s", tag, vp.repository)
+	}
+	return d.String(), nil
+}
+
+// latencyStats generates stats for the duration of the registry operation that started at the given time.
+func (vp *V2Provider) latencyStats(operation string, start time.Time) {
+	vp.opts.Stats.Timing("registry_request_duration", time.Since(start),
+		"registry:dockerhub", "operation:"+operation, "repository:"+vp.repository)
 }
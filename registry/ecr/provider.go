@@ -3,16 +3,22 @@ package ecr
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"regexp"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/golang/glog"
 	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
 	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -99,6 +105,9 @@ func (ep *Provider) Version(ctx context.Context, tag string) (string, error) {
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, time.Second*15)
 	defer cancel()
+	defer ep.latencyStats("version", time.Now())
+	ctx, span := tracing.Start(ctx, "ecr.DescribeImages", "repository", ep.repoName, "tag", tag)
+	defer span.Finish(nil)
 
 	if glog.V(4) {
 		glog.V(4).Infof("Making ECR DescribeImages request for repository=%s, registry=%s, tag=%s",
@@ -116,13 +125,18 @@ func (ep *Provider) Version(ctx context.Context, tag string) (string, error) {
 	}
 	result, err := ep.ecr.DescribeImagesWithContext(ctx, req)
 	if err != nil {
+		span.SetError(err)
 		glog.Errorf("Failed to get ECR: %v", err)
+		if request.IsErrorThrottle(err) {
+			ep.throttledStats("version")
+			return "", state.NewRateLimited(errors.Wrap(err, "failed to get ecr"), 0)
+		}
 		return "", errors.Wrap(err, "failed to get ecr")
 	}
 	if len(result.ImageDetails) != 1 {
-		ep.stats.Event(fmt.Sprintf("registry.%s.sync.failure", ep.repoName),
+		ep.stats.Event("registry_sync_failure",
 			fmt.Sprintf("Failed to sync with ECR for tag %s", tag), "", "error",
-			time.Now().UTC(), tag)
+			time.Now().UTC(), "registry:ecr", "repository:"+ep.repoName, "tag:"+tag)
 		return "", errors.Errorf("Bad state: More than one image was tagged with %s", tag)
 	}
 
@@ -130,7 +144,7 @@ func (ep *Provider) Version(ctx context.Context, tag string) (string, error) {
 
 	currentVersion := ep.currentVersion(img)
 	if currentVersion == "" {
-		ep.stats.IncCount(fmt.Sprintf("registry.%s.sync.failure", ep.repoName), "badsha")
+		ep.failureStats("version", "reason:badsha")
 		return "", errors.Errorf("No version found for tag %s", tag)
 	}
 
@@ -139,6 +153,40 @@ func (ep *Provider) Version(ctx context.Context, tag string) (string, error) {
 	return currentVersion, nil
 }
 
+// Digest implements the Digester interface.
+func (ep *Provider) Digest(ctx context.Context, version string) (string, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Second*15)
+	defer cancel()
+	defer ep.latencyStats("digest", time.Now())
+	ctx, span := tracing.Start(ctx, "ecr.DescribeImages", "repository", ep.repoName, "tag", version)
+	defer span.Finish(nil)
+
+	req := &ecr.DescribeImagesInput{
+		ImageIds: []*ecr.ImageIdentifier{
+			{
+				ImageTag: aws.String(version),
+			},
+		},
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	result, err := ep.ecr.DescribeImagesWithContext(ctx, req)
+	if err != nil {
+		span.SetError(err)
+		if request.IsErrorThrottle(err) {
+			ep.throttledStats("digest")
+			return "", state.NewRateLimited(errors.Wrapf(err, "failed to get digest of version %s", version), 0)
+		}
+		return "", errors.Wrapf(err, "failed to get digest of version %s", version)
+	}
+	if len(result.ImageDetails) != 1 {
+		return "", errors.Errorf("Bad state: found %d images tagged with %s", len(result.ImageDetails), version)
+	}
+
+	return aws.StringValue(result.ImageDetails[0].ImageDigest), nil
+}
+
 // Add a list of tags to the image identified with version
 func (ep *Provider) Add(version string, tags ...string) error {
 	for _, tag := range tags {
@@ -155,7 +203,7 @@ func (ep *Provider) Add(version string, tags ...string) error {
 
 		getRes, err := ep.ecr.BatchGetImage(getReq)
 		if err != nil {
-			ep.stats.IncCount(fmt.Sprintf("registry.batchget.%s.failure", ep.repoName))
+			ep.failureStats("batchget")
 			return errors.Wrap(err, fmt.Sprintf("failed to get images of tag %s", tag))
 		}
 
@@ -175,7 +223,7 @@ func (ep *Provider) Add(version string, tags ...string) error {
 						continue
 					}
 				}
-				ep.stats.IncCount(fmt.Sprintf("registry.putimage.%s.failure", ep.repoName))
+				ep.failureStats("putimage")
 				return errors.Wrap(err, fmt.Sprintf("failed to add tag %s to image manifest %s",
 					tag, aws.StringValue(img.ImageManifest)))
 			}
@@ -199,7 +247,7 @@ func (ep *Provider) Remove(tags ...string) error {
 
 		getRes, err := ep.ecr.BatchGetImage(getReq)
 		if err != nil {
-			ep.stats.IncCount(fmt.Sprintf("registry.batchget.%s.failure", ep.repoName))
+			ep.failureStats("batchget")
 			return errors.Wrap(err, fmt.Sprintf("failed to get images of tag %s", tag))
 		}
 
@@ -218,7 +266,7 @@ func (ep *Provider) Remove(tags ...string) error {
 
 			_, err = ep.ecr.BatchDeleteImage(delReq)
 			if err != nil {
-				ep.stats.IncCount(fmt.Sprintf("registry.batchdelete.%s.failure", ep.repoName))
+				ep.failureStats("batchdelete")
 				return errors.Wrap(err, fmt.Sprintf("failed to perform batch delete image by tag %s and digest %s",
 					tag, aws.StringValue(img.ImageId.ImageDigest)))
 			}
@@ -241,7 +289,7 @@ func (ep *Provider) Get(version string) ([]string, error) {
 
 	getRes, err := ep.ecr.DescribeImages(getReq)
 	if err != nil {
-		ep.stats.IncCount(fmt.Sprintf("ecr.descimg.%s.failure", ep.repoName))
+		ep.failureStats("describeimages")
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to get images of tag %s", version))
 	}
 
@@ -253,6 +301,302 @@ func (ep *Provider) Get(version string) ([]string, error) {
 
 }
 
+// List implements the Tagger interface.
+func (ep *Provider) List() ([]registry.Tag, error) {
+	defer ep.latencyStats("list", time.Now())
+
+	req := &ecr.DescribeImagesInput{
+		Filter:         &ecr.DescribeImagesFilter{TagStatus: aws.String(ecr.TagStatusTagged)},
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+
+	var tags []registry.Tag
+	err := ep.ecr.DescribeImagesPages(req, func(page *ecr.DescribeImagesOutput, last bool) bool {
+		for _, img := range page.ImageDetails {
+			for _, tag := range aws.StringValueSlice(img.ImageTags) {
+				tags = append(tags, registry.Tag{
+					Name:   tag,
+					Digest: aws.StringValue(img.ImageDigest),
+					Pushed: aws.TimeValue(img.ImagePushedAt),
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		ep.failureStats("describeimages")
+		return nil, errors.Wrapf(err, "failed to list images of repository %s", ep.repoName)
+	}
+
+	registry.SortTags(tags)
+	return tags, nil
+}
+
+// Move implements the Tagger interface. ECR does not support conditional updates of tags,
+// so the digest of the tag is compared immediately before the tag is moved, and the tag
+// is verified to refer to the moved image afterwards.
+func (ep *Provider) Move(from, to, digest string) error {
+	getReq := &ecr.BatchGetImageInput{
+		ImageIds: []*ecr.ImageIdentifier{
+			{
+				ImageTag: aws.String(from),
+			},
+		},
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	getRes, err := ep.ecr.BatchGetImage(getReq)
+	if err != nil {
+		ep.failureStats("batchget")
+		return errors.Wrapf(err, "failed to get images of tag %s", from)
+	}
+	if len(getRes.Images) != 1 {
+		return errors.Errorf("found %d images tagged with %s", len(getRes.Images), from)
+	}
+	img := getRes.Images[0]
+	target := aws.StringValue(img.ImageId.ImageDigest)
+
+	current, err := ep.tagDigest(to)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if current != digest {
+		return &registry.DigestMismatchError{Tag: to, Expected: digest, Actual: current}
+	}
+	if current == target {
+		glog.V(2).Infof("Tag %s already refers to image %s of tag %s", to, target, from)
+		return nil
+	}
+
+	putReq := &ecr.PutImageInput{
+		ImageManifest:  img.ImageManifest,
+		ImageTag:       aws.String(to),
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	if _, err := ep.ecr.PutImage(putReq); err != nil {
+		ep.failureStats("putimage")
+		return errors.Wrapf(err, "failed to move tag %s to image %s", to, target)
+	}
+
+	moved, err := ep.tagDigest(to)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if moved != target {
+		return errors.Errorf("tag %s was concurrently moved to image %s", to, moved)
+	}
+	glog.V(1).Infof("Moved tag %s from image %s to image %s of tag %s", to, current, target, from)
+	return nil
+}
+
+// Prune implements the Tagger interface. Pruned images are deleted.
+func (ep *Provider) Prune(keep int, before time.Time, dryRun bool) ([]registry.Tag, error) {
+	tags, err := ep.List()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	candidates := registry.PruneCandidates(tags, ep.vRegex, keep, before)
+	if dryRun || len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	var ids []*ecr.ImageIdentifier
+	seen := make(map[string]bool)
+	for _, tag := range candidates {
+		if !seen[tag.Digest] {
+			seen[tag.Digest] = true
+			ids = append(ids, &ecr.ImageIdentifier{ImageDigest: aws.String(tag.Digest)})
+		}
+	}
+
+	// BatchDeleteImage deletes at most 100 images per request
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 100 {
+			n = 100
+		}
+		delReq := &ecr.BatchDeleteImageInput{
+			ImageIds:       ids[:n],
+			RegistryId:     aws.String(ep.accountID),
+			RepositoryName: aws.String(ep.repoName),
+		}
+		delRes, err := ep.ecr.BatchDeleteImage(delReq)
+		if err != nil {
+			ep.failureStats("batchdelete")
+			return nil, errors.Wrap(err, "failed to perform batch delete of pruned images")
+		}
+		if len(delRes.Failures) > 0 {
+			f := delRes.Failures[0]
+			ep.failureStats("batchdelete")
+			return nil, errors.Errorf("failed to delete pruned image %s: %s", aws.StringValue(f.ImageId.ImageDigest),
+				aws.StringValue(f.FailureReason))
+		}
+		ids = ids[n:]
+	}
+	return candidates, nil
+}
+
+// Signatures implements the SignatureFetcher interface.
+func (ep *Provider) Signatures(ctx context.Context, digest string) ([]registry.Signature, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+	defer ep.latencyStats("signatures", time.Now())
+	tag := registry.SignatureTag(digest)
+	ctx, span := tracing.Start(ctx, "ecr.BatchGetImage", "repository", ep.repoName, "tag", tag)
+	defer span.Finish(nil)
+
+	manifest, err := ep.manifest(ctx, tag)
+	if err != nil {
+		span.SetError(err)
+		return nil, errors.Wrapf(err, "failed to get signature artifact %s", tag)
+	}
+	if manifest == nil {
+		glog.V(2).Infof("No signature artifact %s in repository %s", tag, ep.repoName)
+		return nil, nil
+	}
+
+	layers, err := registry.SignatureLayers(manifest)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var signatures []registry.Signature
+	for _, layer := range layers {
+		payload, err := ep.layer(ctx, layer.Digest)
+		if err != nil {
+			span.SetError(err)
+			return nil, errors.Wrapf(err, "failed to get signature payload of %s", tag)
+		}
+		signatures = append(signatures, registry.Signature{Payload: payload, Signature: layer.Signature})
+	}
+	return signatures, nil
+}
+
+// Artifact implements the ArtifactFetcher interface.
+func (ep *Provider) Artifact(ctx context.Context, tag string) ([][]byte, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+	defer ep.latencyStats("artifact", time.Now())
+	ctx, span := tracing.Start(ctx, "ecr.BatchGetImage", "repository", ep.repoName, "tag", tag)
+	defer span.Finish(nil)
+
+	manifest, err := ep.manifest(ctx, tag)
+	if err != nil {
+		span.SetError(err)
+		return nil, errors.Wrapf(err, "failed to get artifact %s", tag)
+	}
+	if manifest == nil {
+		glog.V(2).Infof("No artifact %s in repository %s", tag, ep.repoName)
+		return nil, nil
+	}
+
+	digests, err := registry.ArtifactLayers(manifest)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var layers [][]byte
+	for _, digest := range digests {
+		content, err := ep.layer(ctx, digest)
+		if err != nil {
+			span.SetError(err)
+			return nil, errors.Wrapf(err, "failed to get layer of artifact %s", tag)
+		}
+		layers = append(layers, content)
+	}
+	return layers, nil
+}
+
+// manifest returns the OCI or docker v2 manifest of the artifact with the given tag, or
+// nil if there is no such artifact.
+func (ep *Provider) manifest(ctx context.Context, tag string) ([]byte, error) {
+	getReq := &ecr.BatchGetImageInput{
+		AcceptedMediaTypes: aws.StringSlice(registry.SignatureMediaTypes),
+		ImageIds: []*ecr.ImageIdentifier{
+			{
+				ImageTag: aws.String(tag),
+			},
+		},
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	getRes, err := ep.ecr.BatchGetImageWithContext(ctx, getReq)
+	if err != nil {
+		ep.failureStats("batchget")
+		return nil, errors.WithStack(err)
+	}
+	for _, f := range getRes.Failures {
+		if aws.StringValue(f.FailureCode) != ecr.ImageFailureCodeImageNotFound {
+			return nil, errors.New(aws.StringValue(f.FailureReason))
+		}
+	}
+	if len(getRes.Images) == 0 {
+		return nil, nil
+	}
+	return []byte(aws.StringValue(getRes.Images[0].ImageManifest)), nil
+}
+
+// layer returns the content of the layer with the given digest.
+func (ep *Provider) layer(ctx context.Context, digest string) ([]byte, error) {
+	urlReq := &ecr.GetDownloadUrlForLayerInput{
+		LayerDigest:    aws.String(digest),
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	urlRes, err := ep.ecr.GetDownloadUrlForLayerWithContext(ctx, urlReq)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get download url of layer %s", digest)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, aws.StringValue(urlRes.DownloadUrl), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download layer %s", digest)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to download layer %s: %s", digest, resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, registry.MaxPayloadSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read layer %s", digest)
+	}
+	return content, nil
+}
+
+// tagDigest returns the digest of the image with the given tag, or an empty digest if
+// there is no such image.
+func (ep *Provider) tagDigest(tag string) (string, error) {
+	req := &ecr.DescribeImagesInput{
+		ImageIds: []*ecr.ImageIdentifier{
+			{
+				ImageTag: aws.String(tag),
+			},
+		},
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+	res, err := ep.ecr.DescribeImages(req)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeImageNotFoundException {
+			return "", nil
+		}
+		ep.failureStats("describeimages")
+		return "", errors.Wrapf(err, "failed to get image of tag %s", tag)
+	}
+	if len(res.ImageDetails) != 1 {
+		return "", errors.Errorf("found %d images tagged with %s", len(res.ImageDetails), tag)
+	}
+	return aws.StringValue(res.ImageDetails[0].ImageDigest), nil
+}
+
 func (ep *Provider) currentVersion(img *ecr.ImageDetail) string {
 	var tag string
 	for _, t := range aws.StringValueSlice(img.ImageTags) {
@@ -264,3 +608,20 @@ func (ep *Provider) currentVersion(img *ecr.ImageDetail) string {
 	}
 	return tag
 }
+
+// latencyStats generates stats for the duration of the registry operation that started at the given time.
+func (ep *Provider) latencyStats(operation string, start time.Time) {
+	ep.stats.Timing("registry_request_duration", time.Since(start),
+		"registry:ecr", "operation:"+operation, "repository:"+ep.repoName)
+}
+
+// failureStats counts a failure of the registry operation.
+func (ep *Provider) failureStats(operation string, tags ...string) {
+	ep.stats.IncCount("registry_failures_total",
+		append([]string{"registry:ecr", "operation:" + operation, "repository:" + ep.repoName}, tags...)...)
+}
+
+// throttledStats counts a registry operation that was throttled by ECR.
+func (ep *Provider) throttledStats(operation string) {
+	ep.stats.IncCount("registry_throttled_total", "registry:ecr", "operation:"+operation, "repository:"+ep.repoName)
+}
@@ -0,0 +1,148 @@
+package ecr
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/tracing"
+	"github.com/pkg/errors"
+)
+
+// The DescribeImageScanFindings operation is not part of the vendored AWS SDK, so its
+// request and response are defined here and sent with the generic request mechanism of
+// the ECR client, which takes care of the JSON protocol and request signing.
+
+const (
+	opDescribeImageScanFindings = "DescribeImageScanFindings"
+
+	errCodeScanNotFoundException = "ScanNotFoundException"
+
+	scanStatusComplete = "COMPLETE"
+	scanStatusFailed   = "FAILED"
+)
+
+type describeImageScanFindingsInput struct {
+	_ struct{} `type:"structure"`
+
+	ImageId        *ecr.ImageIdentifier `locationName:"imageId" type:"structure" required:"true"`
+	MaxResults     *int64               `locationName:"maxResults" min:"1" type:"integer"`
+	NextToken      *string              `locationName:"nextToken" type:"string"`
+	RegistryId     *string              `locationName:"registryId" type:"string"`
+	RepositoryName *string              `locationName:"repositoryName" min:"2" type:"string" required:"true"`
+}
+
+type describeImageScanFindingsOutput struct {
+	_ struct{} `type:"structure"`
+
+	ImageScanFindings *imageScanFindings `locationName:"imageScanFindings" type:"structure"`
+	ImageScanStatus   *imageScanStatus   `locationName:"imageScanStatus" type:"structure"`
+	NextToken         *string            `locationName:"nextToken" type:"string"`
+}
+
+type imageScanFindings struct {
+	_ struct{} `type:"structure"`
+
+	Findings []*imageScanFinding `locationName:"findings" type:"list"`
+}
+
+type imageScanFinding struct {
+	_ struct{} `type:"structure"`
+
+	Attributes []*attribute `locationName:"attributes" type:"list"`
+	Name       *string      `locationName:"name" type:"string"`
+	Severity   *string      `locationName:"severity" type:"string"`
+}
+
+type attribute struct {
+	_ struct{} `type:"structure"`
+
+	Key   *string `locationName:"key" type:"string"`
+	Value *string `locationName:"value" type:"string"`
+}
+
+type imageScanStatus struct {
+	_ struct{} `type:"structure"`
+
+	Description *string `locationName:"description" type:"string"`
+	Status      *string `locationName:"status" type:"string"`
+}
+
+// ScanFindings implements the Scanner interface.
+func (ep *Provider) ScanFindings(ctx context.Context, digest string) ([]registry.Finding, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+	defer ep.latencyStats("scanfindings", time.Now())
+	ctx, span := tracing.Start(ctx, "ecr.DescribeImageScanFindings", "repository", ep.repoName, "digest", digest)
+	defer span.Finish(nil)
+
+	op := &request.Operation{
+		Name:       opDescribeImageScanFindings,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	input := &describeImageScanFindingsInput{
+		ImageId: &ecr.ImageIdentifier{
+			ImageDigest: aws.String(digest),
+		},
+		MaxResults:     aws.Int64(1000),
+		RegistryId:     aws.String(ep.accountID),
+		RepositoryName: aws.String(ep.repoName),
+	}
+
+	var findings []registry.Finding
+	for {
+		output := &describeImageScanFindingsOutput{}
+		req := ep.ecr.NewRequest(op, input, output)
+		req.SetContext(ctx)
+		if err := req.Send(); err != nil {
+			span.SetError(err)
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeScanNotFoundException {
+				return nil, state.NewFailed("image %s@%s has not been scanned", ep.repoName, digest)
+			}
+			if request.IsErrorThrottle(err) {
+				ep.throttledStats("scanfindings")
+				return nil, state.NewRateLimited(errors.Wrapf(err, "failed to get scan findings of %s", digest), 0)
+			}
+			ep.failureStats("scanfindings")
+			return nil, errors.Wrapf(err, "failed to get scan findings of %s", digest)
+		}
+
+		if status := output.ImageScanStatus; status != nil {
+			switch aws.StringValue(status.Status) {
+			case scanStatusComplete:
+			case scanStatusFailed:
+				return nil, state.NewFailed("scan of image %s@%s failed: %s",
+					ep.repoName, digest, aws.StringValue(status.Description))
+			default:
+				return nil, registry.ErrScanPending
+			}
+		}
+
+		if output.ImageScanFindings != nil {
+			for _, f := range output.ImageScanFindings.Findings {
+				finding := registry.Finding{
+					ID:       aws.StringValue(f.Name),
+					Severity: aws.StringValue(f.Severity),
+				}
+				for _, attr := range f.Attributes {
+					if aws.StringValue(attr.Key) == "package_name" {
+						finding.Package = aws.StringValue(attr.Value)
+					}
+				}
+				findings = append(findings, finding)
+			}
+		}
+
+		if aws.StringValue(output.NextToken) == "" {
+			return findings, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
@@ -3,6 +3,7 @@ package registry
 import (
 	"context"
 	"strings"
+	"time"
 )
 
 // ProviderByRepo generates Type based on image ARN
@@ -23,6 +24,11 @@ type Registry interface {
 	Version(ctx context.Context, tag string) (string, error)
 }
 
+// Digester is implemented by registries that can obtain the digest of an image version.
+type Digester interface {
+	Digest(ctx context.Context, version string) (string, error)
+}
+
 // Tagger provides capability of adding/removing environment tags on ECR
 // This interface is purely designed for CI/CD purposes such that the version
 // tag ex git SHA is unique on images (images can be uniquely identified by such version tags).
@@ -37,4 +43,17 @@ type Tagger interface {
 
 	// Get gets the list of tags to the image identified with version
 	Get(version string) ([]string, error)
+
+	// List returns the tags of the repository, most recently pushed first.
+	List() ([]Tag, error)
+
+	// Move tags the image that is tagged with from with the tag to, provided that to
+	// refers to the image with the given digest, or does not exist if the digest is empty.
+	// A DigestMismatchError is returned if it does not.
+	Move(from, to, digest string) error
+
+	// Prune removes version tags that no environment tag references, as selected by
+	// PruneCandidates, and returns the removed tags. Tags are only returned, and not
+	// removed, on a dry run.
+	Prune(keep int, before time.Time, dryRun bool) ([]Tag, error)
 }
@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrScanPending is returned by a Scanner while the scan of an image has not completed.
+	ErrScanPending = errors.New("image scan has not completed")
+)
+
+// Finding is a vulnerability found in an image.
+type Finding struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+
+	// Package is the name of the vulnerable package, if known.
+	Package string `json:"package,omitempty"`
+}
+
+// Scanner is implemented by registries that scan images for vulnerabilities.
+type Scanner interface {
+	// ScanFindings returns the vulnerabilities found by the scan of the image with the
+	// given digest. ErrScanPending is returned while the scan is in progress.
+	ScanFindings(ctx context.Context, digest string) ([]Finding, error)
+}
+
+// ArtifactFetcher is implemented by registries that can obtain OCI artifacts attached to
+// images, such as vulnerability reports.
+type ArtifactFetcher interface {
+	// Artifact returns the content of the layers of the artifact with the given tag, or no
+	// layers if there is no such artifact.
+	Artifact(ctx context.Context, tag string) ([][]byte, error)
+}
+
+// ReportTag returns the tag of the vulnerability report artifact of the image with the
+// given digest.
+func ReportTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".scan"
+}
+
+// ArtifactLayers returns the digests of the layers of the given artifact manifest.
+func ArtifactLayers(manifest []byte) ([]string, error) {
+	var m struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse artifact manifest")
+	}
+
+	var digests []string
+	for _, l := range m.Layers {
+		digests = append(digests, l.Digest)
+	}
+	return digests, nil
+}
@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureAnnotation is the annotation of the layers of a cosign signature artifact
+	// that holds the base64 encoded signature of the layer.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// MaxPayloadSize is the maximum size of a signed payload that is read from a registry.
+	MaxPayloadSize = 1 << 20
+)
+
+// SignatureMediaTypes are the media types accepted for cosign signature artifacts and other
+// artifacts attached to images.
+var SignatureMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Signature is a signature of an image, stored in a layer of a cosign signature artifact.
+type Signature struct {
+	// Payload is the signed payload, a simple signing document that identifies the image.
+	Payload []byte
+
+	// Signature is the base64 encoded signature of the payload.
+	Signature string
+}
+
+// SignatureFetcher is implemented by registries that can obtain the signatures of images.
+type SignatureFetcher interface {
+	// Signatures returns the signatures of the image with the given digest, which are stored
+	// in the cosign signature artifact of the image, or no signatures if it has none.
+	Signatures(ctx context.Context, digest string) ([]Signature, error)
+}
+
+// SignatureTag returns the tag of the cosign signature artifact of the image with the
+// given digest.
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// SignatureLayer is a layer of a cosign signature artifact.
+type SignatureLayer struct {
+	Digest    string
+	Signature string
+}
+
+// SignatureLayers returns the layers of the given cosign signature artifact manifest
+// that have signatures.
+func SignatureLayers(manifest []byte) ([]SignatureLayer, error) {
+	var m struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, errors.Wrap(err, "failed to parse signature manifest")
+	}
+
+	var layers []SignatureLayer
+	for _, l := range m.Layers {
+		if sig := l.Annotations[SignatureAnnotation]; sig != "" {
+			layers = append(layers, SignatureLayer{Digest: l.Digest, Signature: sig})
+		}
+	}
+	return layers, nil
+}
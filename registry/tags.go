@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Tag is a tag of an image in a repository.
+type Tag struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+
+	// Pushed is the time at which the image was pushed, if known.
+	Pushed time.Time `json:"pushed,omitempty"`
+}
+
+// DigestMismatchError is returned when a tag is moved but does not refer to the expected image.
+type DigestMismatchError struct {
+	Tag      string
+	Expected string
+	Actual   string
+}
+
+func (e *DigestMismatchError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("tag %s already exists with digest %s", e.Tag, e.Actual)
+	}
+	if e.Actual == "" {
+		return fmt.Sprintf("tag %s does not exist, expected digest %s", e.Tag, e.Expected)
+	}
+	return fmt.Sprintf("tag %s has digest %s, expected %s", e.Tag, e.Actual, e.Expected)
+}
+
+// SortTags sorts the tags by the time their images were pushed, most recent first, and
+// then by name.
+func SortTags(tags []Tag) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		if !tags[i].Pushed.Equal(tags[j].Pushed) {
+			return tags[i].Pushed.After(tags[j].Pushed)
+		}
+		return tags[i].Name < tags[j].Name
+	})
+}
+
+// PruneCandidates returns the tags of the images that may be pruned from a repository with
+// the given tags. Images may be pruned if all of their tags are version tags, which match
+// the given version pattern entirely, so that no environment tag references them. The keep
+// most recently pushed of these images are kept, as are images pushed after the given time.
+func PruneCandidates(tags []Tag, versions *regexp.Regexp, keep int, before time.Time) []Tag {
+	images := make(map[string][]Tag)
+	for _, tag := range tags {
+		images[tag.Digest] = append(images[tag.Digest], tag)
+	}
+
+	unreferenced := Unreferenced(tags, versions)
+	SortTags(unreferenced)
+
+	var candidates []Tag
+	for i, image := range unreferenced {
+		if i < keep || !image.Pushed.Before(before) {
+			continue
+		}
+		candidates = append(candidates, images[image.Digest]...)
+	}
+	return candidates
+}
+
+// Unreferenced returns the first of the given tags of each image that no environment tag
+// references, as all of its tags match the given version pattern entirely. Only the push
+// times of these images are needed to find the prune candidates.
+func Unreferenced(tags []Tag, versions *regexp.Regexp) []Tag {
+	referenced := make(map[string]bool)
+	for _, tag := range tags {
+		if !isVersion(tag.Name, versions) {
+			referenced[tag.Digest] = true
+		}
+	}
+
+	var unreferenced []Tag
+	for _, tag := range tags {
+		if !referenced[tag.Digest] {
+			unreferenced = append(unreferenced, tag)
+			referenced[tag.Digest] = true
+		}
+	}
+	return unreferenced
+}
+
+// isVersion returns true if the entire tag matches the version pattern.
+func isVersion(tag string, versions *regexp.Regexp) bool {
+	loc := versions.FindStringIndex(tag)
+	return loc != nil && loc[0] == 0 && loc[1] == len(tag)
+}
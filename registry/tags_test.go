@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneCandidates(t *testing.T) {
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tags := []Tag{
+		{Name: "aaaaaaa", Digest: "sha256:a", Pushed: now.Add(-1 * day)},
+		{Name: "bbbbbbb", Digest: "sha256:b", Pushed: now.Add(-10 * day)},
+		{Name: "env-prod", Digest: "sha256:b", Pushed: now.Add(-10 * day)},
+		{Name: "ccccccc", Digest: "sha256:c", Pushed: now.Add(-20 * day)},
+		{Name: "ddddddd", Digest: "sha256:d", Pushed: now.Add(-30 * day)},
+		{Name: "0ddddddd", Digest: "sha256:d", Pushed: now.Add(-30 * day)},
+		{Name: "eeeeeee", Digest: "sha256:e", Pushed: now.Add(-40 * day)},
+		{Name: "feature-abcdef1", Digest: "sha256:e", Pushed: now.Add(-40 * day)},
+	}
+	versions := regexp.MustCompile("[0-9a-f]{5,40}")
+
+	var tests = []struct {
+		message  string
+		keep     int
+		before   time.Time
+		expected []string
+	}{
+		{"keep none", 0, now.Add(-5 * day), []string{"ccccccc", "ddddddd", "0ddddddd"}},
+		{"keep most recent", 2, now, []string{"ddddddd", "0ddddddd"}},
+		{"keep recently pushed", 0, now.Add(-25 * day), []string{"ddddddd", "0ddddddd"}},
+		{"keep all", 3, now, nil},
+	}
+
+	for _, test := range tests {
+		candidates := PruneCandidates(tags, versions, test.keep, test.before)
+		var names []string
+		for _, tag := range candidates {
+			names = append(names, tag.Name)
+		}
+		if len(names) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.message, test.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.message, test.expected, names)
+				break
+			}
+		}
+	}
+}
+
+func TestUnreferenced(t *testing.T) {
+	tags := []Tag{
+		{Name: "aaaaaaa", Digest: "sha256:a"},
+		{Name: "bbbbbbb", Digest: "sha256:b"},
+		{Name: "env-prod", Digest: "sha256:b"},
+		{Name: "ddddddd", Digest: "sha256:d"},
+		{Name: "0ddddddd", Digest: "sha256:d"},
+	}
+
+	var names []string
+	for _, tag := range Unreferenced(tags, regexp.MustCompile("[0-9a-f]{5,40}")) {
+		names = append(names, tag.Name)
+	}
+	if strings.Join(names, ",") != "aaaaaaa,ddddddd" {
+		t.Errorf("Expected one tag of each unreferenced image, got %v", names)
+	}
+}
+
+func TestDigestMismatchError(t *testing.T) {
+	var tests = []struct {
+		err      *DigestMismatchError
+		expected string
+	}{
+		{&DigestMismatchError{Tag: "prod", Actual: "sha256:a"}, "tag prod already exists with digest sha256:a"},
+		{&DigestMismatchError{Tag: "prod", Expected: "sha256:a"}, "tag prod does not exist, expected digest sha256:a"},
+		{&DigestMismatchError{Tag: "prod", Expected: "sha256:a", Actual: "sha256:b"}, "tag prod has digest sha256:b, expected sha256:a"},
+	}
+	for _, test := range tests {
+		if test.err.Error() != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, test.err.Error())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const gitHubURL = "https://api.github.com"
+
+// gitHub manages the deployments of a GitHub repository.
+type gitHub struct {
+	*client
+	repository string
+}
+
+type gitHubDeployment struct {
+	ID int64 `json:"id"`
+}
+
+type gitHubPullRequest struct {
+	HTMLURL string `json:"html_url"`
+}
+
+func gitHubAuth(req *http.Request, token string) {
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+}
+
+// Find implements the Deployments interface.
+func (gh *gitHub) Find(ctx context.Context, sha, environment string) (string, error) {
+	query := url.Values{}
+	query.Set("sha", sha)
+	query.Set("environment", environment)
+
+	var deployments []gitHubDeployment
+	path := fmt.Sprintf("/repos/%s/deployments?%s", gh.repository, query.Encode())
+	if err := gh.do(ctx, http.MethodGet, path, nil, &deployments); err != nil {
+		return "", err
+	}
+	// deployments are listed most recent first
+	if len(deployments) == 0 {
+		return "", nil
+	}
+	return strconv.FormatInt(deployments[0].ID, 10), nil
+}
+
+// Create implements the Deployments interface.
+func (gh *gitHub) Create(ctx context.Context, sha, environment, description string) (string, error) {
+	req := map[string]interface{}{
+		"ref":               sha,
+		"environment":       environment,
+		"description":       description,
+		"auto_merge":        false,
+		"required_contexts": []string{},
+	}
+
+	var deployment gitHubDeployment
+	if err := gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/deployments", gh.repository), req, &deployment); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(deployment.ID, 10), nil
+}
+
+// SetStatus implements the Deployments interface.
+func (gh *gitHub) SetStatus(ctx context.Context, id, environment, status, description string) error {
+	req := map[string]interface{}{
+		"state":       status,
+		"environment": environment,
+		"description": description,
+	}
+	return gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/deployments/%s/statuses", gh.repository, id), req, nil)
+}
+
+// OpenMergeRequest implements the MergeRequests interface.
+func (gh *gitHub) OpenMergeRequest(ctx context.Context, source, target, title, description string) (string, error) {
+	owner := strings.SplitN(gh.repository, "/", 2)[0]
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("head", owner+":"+source)
+	query.Set("base", target)
+
+	var prs []gitHubPullRequest
+	if err := gh.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", gh.repository, query.Encode()), nil, &prs); err != nil {
+		return "", err
+	}
+	if len(prs) > 0 {
+		return prs[0].HTMLURL, nil
+	}
+
+	req := map[string]interface{}{
+		"title": title,
+		"head":  source,
+		"base":  target,
+		"body":  description,
+	}
+	var pr gitHubPullRequest
+	if err := gh.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls", gh.repository), req, &pr); err != nil {
+		return "", err
+	}
+	return pr.HTMLURL, nil
+}
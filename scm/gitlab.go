@@ -0,0 +1,121 @@
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const gitLabURL = "https://gitlab.com/api/v4"
+
+// gitLab manages the environment deployments of a GitLab project.
+type gitLab struct {
+	*client
+	project string
+}
+
+type gitLabDeployment struct {
+	ID  int64  `json:"id"`
+	SHA string `json:"sha"`
+}
+
+type gitLabMergeRequest struct {
+	WebURL string `json:"web_url"`
+}
+
+func gitLabAuth(req *http.Request, token string) {
+	req.Header.Set("PRIVATE-TOKEN", token)
+}
+
+// gitLabStatus returns the GitLab deployment status for the given status.
+func gitLabStatus(status string) string {
+	switch status {
+	case StatusPending:
+		return "created"
+	case StatusInProgress:
+		return "running"
+	case StatusFailure:
+		return "failed"
+	}
+	return status
+}
+
+func (gl *gitLab) path(format string, args ...interface{}) string {
+	return "/projects/" + url.PathEscape(gl.project) + fmt.Sprintf(format, args...)
+}
+
+// Find implements the Deployments interface.
+func (gl *gitLab) Find(ctx context.Context, sha, environment string) (string, error) {
+	query := url.Values{}
+	query.Set("environment", environment)
+	query.Set("order_by", "id")
+	query.Set("sort", "desc")
+	query.Set("per_page", "100")
+
+	var deployments []gitLabDeployment
+	if err := gl.do(ctx, http.MethodGet, gl.path("/deployments?%s", query.Encode()), nil, &deployments); err != nil {
+		return "", err
+	}
+	for _, d := range deployments {
+		if d.SHA == sha {
+			return strconv.FormatInt(d.ID, 10), nil
+		}
+	}
+	return "", nil
+}
+
+// Create implements the Deployments interface. GitLab deployments have no description.
+func (gl *gitLab) Create(ctx context.Context, sha, environment, description string) (string, error) {
+	req := map[string]interface{}{
+		"environment": environment,
+		"sha":         sha,
+		"ref":         sha,
+		"tag":         false,
+		"status":      gitLabStatus(StatusPending),
+	}
+
+	var deployment gitLabDeployment
+	if err := gl.do(ctx, http.MethodPost, gl.path("/deployments"), req, &deployment); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(deployment.ID, 10), nil
+}
+
+// SetStatus implements the Deployments interface.
+func (gl *gitLab) SetStatus(ctx context.Context, id, environment, status, description string) error {
+	req := map[string]interface{}{
+		"status": gitLabStatus(status),
+	}
+	return gl.do(ctx, http.MethodPut, gl.path("/deployments/%s", id), req, nil)
+}
+
+// OpenMergeRequest implements the MergeRequests interface.
+func (gl *gitLab) OpenMergeRequest(ctx context.Context, source, target, title, description string) (string, error) {
+	query := url.Values{}
+	query.Set("state", "opened")
+	query.Set("source_branch", source)
+	query.Set("target_branch", target)
+
+	var mrs []gitLabMergeRequest
+	if err := gl.do(ctx, http.MethodGet, gl.path("/merge_requests?%s", query.Encode()), nil, &mrs); err != nil {
+		return "", err
+	}
+	if len(mrs) > 0 {
+		return mrs[0].WebURL, nil
+	}
+
+	req := map[string]interface{}{
+		"source_branch":        source,
+		"target_branch":        target,
+		"title":                title,
+		"description":          description,
+		"remove_source_branch": true,
+	}
+	var mr gitLabMergeRequest
+	if err := gl.do(ctx, http.MethodPost, gl.path("/merge_requests"), req, &mr); err != nil {
+		return "", err
+	}
+	return mr.WebURL, nil
+}
@@ -0,0 +1,173 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/tracing"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KindGitHub represents the GitHub deployments integration.
+	KindGitHub = "GitHub"
+	// KindGitLab represents the GitLab environment deployments integration.
+	KindGitLab = "GitLab"
+)
+
+// Deployment statuses, which are mapped to the statuses of each service.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusSuccess    = "success"
+	StatusFailure    = "failure"
+)
+
+// Environment sources of SCMSpec.EnvironmentFrom.
+const (
+	EnvironmentFromTag       = "tag"
+	EnvironmentFromNamespace = "namespace"
+)
+
+// Deployments manages the deployments of the commits of a repository to environments.
+type Deployments interface {
+	// Find returns the ID of the most recent deployment of the given commit to the
+	// given environment, or an empty string if there is none.
+	Find(ctx context.Context, sha, environment string) (string, error)
+
+	// Create creates a deployment of the given commit to the given environment and
+	// returns its ID.
+	Create(ctx context.Context, sha, environment, description string) (string, error)
+
+	// SetStatus sets the status of the deployment with the given ID.
+	SetStatus(ctx context.Context, id, environment, status, description string) error
+}
+
+// MergeRequests manages the merge requests of a repository, which are pull requests on GitHub.
+type MergeRequests interface {
+	// OpenMergeRequest opens a merge request of the source branch into the target branch,
+	// unless one is already open, and returns its URL.
+	OpenMergeRequest(ctx context.Context, source, target, title, description string) (string, error)
+}
+
+// Repository is a repository of a source code management service.
+type Repository interface {
+	Deployments
+	MergeRequests
+}
+
+// New returns the repository of the given spec, authenticating with the given token.
+func New(spec *cv1.SCMSpec, token string) (Repository, error) {
+	if spec.Repository == "" {
+		return nil, errors.New("no repository defined for scm")
+	}
+
+	c := &client{
+		token: token,
+		http: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(nil),
+		},
+	}
+
+	switch spec.Kind {
+	case KindGitHub:
+		c.baseURL = baseURL(spec.BaseURL, gitHubURL)
+		c.auth = gitHubAuth
+		return &gitHub{client: c, repository: spec.Repository}, nil
+	case KindGitLab:
+		c.baseURL = baseURL(spec.BaseURL, gitLabURL)
+		c.auth = gitLabAuth
+		return &gitLab{client: c, project: spec.Repository}, nil
+	default:
+		return nil, errors.Errorf("unknown scm kind %s", spec.Kind)
+	}
+}
+
+// ForSpec returns the repository of the given spec, reading the token from the secret
+// of the spec in the given namespace.
+func ForSpec(cs kubernetes.Interface, namespace string, spec *cv1.SCMSpec) (Repository, error) {
+	secret, err := cs.CoreV1().Secrets(namespace).Get(spec.TokenFrom.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s", spec.TokenFrom.Name)
+	}
+	token, ok := secret.Data[spec.TokenFrom.Key]
+	if !ok {
+		return nil, errors.Errorf("secret %s has no key %s", spec.TokenFrom.Name, spec.TokenFrom.Key)
+	}
+	return New(spec, strings.TrimSpace(string(token)))
+}
+
+// Environment returns the name of the deployment environment of the given cv.
+func Environment(cv *cv1.ContainerVersion) string {
+	if cv.Spec.SCM != nil && cv.Spec.SCM.EnvironmentFrom == EnvironmentFromNamespace {
+		return cv.Namespace
+	}
+	return cv.Spec.Tag
+}
+
+func baseURL(url, defaultURL string) string {
+	if url == "" {
+		url = defaultURL
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// client makes JSON requests to the API of a source code management service.
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+
+	// auth sets the token on a request.
+	auth func(req *http.Request, token string)
+}
+
+// do sends a request with the given method and JSON body to the given path of the API,
+// and decodes the JSON response into result, if not nil.
+func (c *client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode request")
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, r)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.auth != nil {
+		c.auth(req, c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send %s request to %s", method, path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("%s request to %s failed with %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(result), "failed to decode response of %s", path)
+}
@@ -0,0 +1,252 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// request is a request received by an API stand-in.
+type request struct {
+	method string
+	uri    string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newServer returns a local HTTP stand-in for a deployments API that records the requests
+// it receives and responds with the given body.
+func newServer(t *testing.T, response string) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+		}
+		if strings.Contains(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		w.Write([]byte(response))
+		requests <- request{method: r.Method, uri: r.URL.RequestURI(), header: r.Header, body: body}
+	}))
+	return server, requests
+}
+
+func TestGitHub(t *testing.T) {
+	server, requests := newServer(t, `[{"id":42},{"id":41}]`)
+	defer server.Close()
+
+	d, err := New(&cv1.SCMSpec{Kind: KindGitHub, Repository: "nearmap/app", BaseURL: server.URL + "/"}, "t0ken")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, err := d.Find(context.Background(), "abc", "dev")
+	if err != nil || id != "42" {
+		t.Fatalf("Expected deployment 42, got %s: %v", id, err)
+	}
+	req := <-requests
+	if req.method != http.MethodGet || req.uri != "/repos/nearmap/app/deployments?environment=dev&sha=abc" {
+		t.Errorf("Unexpected request %s %s", req.method, req.uri)
+	}
+	if req.header.Get("Authorization") != "token t0ken" || req.header.Get("Accept") != "application/vnd.github+json" {
+		t.Errorf("Unexpected headers %v", req.header)
+	}
+
+	if err := d.SetStatus(context.Background(), id, "dev", StatusInProgress, "Rolling out app"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	req = <-requests
+	if req.method != http.MethodPost || req.uri != "/repos/nearmap/app/deployments/42/statuses" {
+		t.Errorf("Unexpected request %s %s", req.method, req.uri)
+	}
+	if req.body["state"] != "in_progress" || req.body["environment"] != "dev" {
+		t.Errorf("Unexpected status %v", req.body)
+	}
+}
+
+func TestGitHubCreate(t *testing.T) {
+	server, requests := newServer(t, `{"id":7}`)
+	defer server.Close()
+
+	d, err := New(&cv1.SCMSpec{Kind: KindGitHub, Repository: "nearmap/app", BaseURL: server.URL}, "t0ken")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, err := d.Create(context.Background(), "abc", "dev", "Rollout of abc")
+	if err != nil || id != "7" {
+		t.Fatalf("Expected deployment 7, got %s: %v", id, err)
+	}
+	req := <-requests
+	if req.method != http.MethodPost || req.uri != "/repos/nearmap/app/deployments" {
+		t.Errorf("Unexpected request %s %s", req.method, req.uri)
+	}
+	if req.body["ref"] != "abc" || req.body["environment"] != "dev" || req.body["auto_merge"] != false {
+		t.Errorf("Unexpected deployment %v", req.body)
+	}
+
+	d, _ = New(&cv1.SCMSpec{Kind: KindGitHub, Repository: "nearmap/fail", BaseURL: server.URL}, "t0ken")
+	if _, err := d.Create(context.Background(), "abc", "dev", ""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	server, requests := newServer(t, `[{"id":12,"sha":"def"},{"id":11,"sha":"abc"}]`)
+	defer server.Close()
+
+	d, err := New(&cv1.SCMSpec{Kind: KindGitLab, Repository: "nearmap/app", BaseURL: server.URL}, "t0ken")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id, err := d.Find(context.Background(), "abc", "dev")
+	if err != nil || id != "11" {
+		t.Fatalf("Expected deployment 11, got %s: %v", id, err)
+	}
+	req := <-requests
+	if !strings.HasPrefix(req.uri, "/projects/nearmap%2Fapp/deployments?environment=dev&") {
+		t.Errorf("Unexpected request %s", req.uri)
+	}
+	if req.header.Get("PRIVATE-TOKEN") != "t0ken" {
+		t.Errorf("Unexpected headers %v", req.header)
+	}
+
+	if id, err := d.Find(context.Background(), "xyz", "dev"); err != nil || id != "" {
+		t.Errorf("Expected no deployment, got %s: %v", id, err)
+	}
+	<-requests
+
+	for status, expected := range map[string]string{
+		StatusPending:    "created",
+		StatusInProgress: "running",
+		StatusSuccess:    "success",
+		StatusFailure:    "failed",
+	} {
+		if err := d.SetStatus(context.Background(), "11", "dev", status, ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		req := <-requests
+		if req.method != http.MethodPut || req.uri != "/projects/nearmap%2Fapp/deployments/11" {
+			t.Errorf("Unexpected request %s %s", req.method, req.uri)
+		}
+		if req.body["status"] != expected {
+			t.Errorf("Expected status %s for %s, got %v", expected, status, req.body["status"])
+		}
+	}
+}
+
+func TestForSpec(t *testing.T) {
+	server, requests := newServer(t, `[]`)
+	defer server.Close()
+
+	cs := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "scm", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("t0ken\n")},
+	})
+
+	spec := &cv1.SCMSpec{
+		Kind:       KindGitHub,
+		Repository: "nearmap/app",
+		BaseURL:    server.URL,
+		TokenFrom:  cv1.SecretKeyRef{Name: "scm", Key: "token"},
+	}
+	d, err := ForSpec(cs, "default", spec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := d.Find(context.Background(), "abc", "dev"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auth := (<-requests).header.Get("Authorization"); auth != "token t0ken" {
+		t.Errorf("Expected token from secret, got %q", auth)
+	}
+
+	spec.TokenFrom.Key = "missing"
+	if _, err := ForSpec(cs, "default", spec); err == nil {
+		t.Errorf("Expected error for missing secret key")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	cv := &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-cv", Namespace: "staging"},
+		Spec:       cv1.ContainerVersionSpec{Tag: "dev", SCM: &cv1.SCMSpec{}},
+	}
+	if env := Environment(cv); env != "dev" {
+		t.Errorf("Expected tag environment, got %s", env)
+	}
+	cv.Spec.SCM.EnvironmentFrom = EnvironmentFromNamespace
+	if env := Environment(cv); env != "staging" {
+		t.Errorf("Expected namespace environment, got %s", env)
+	}
+}
+
+func TestOpenMergeRequest(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[]`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`{"html_url":"https://github.example.com/pr/1","web_url":"https://gitlab.example.com/mr/1"}`))
+	}))
+	defer server.Close()
+
+	gh, _ := New(&cv1.SCMSpec{Kind: KindGitHub, Repository: "nearmap/manifests", BaseURL: server.URL}, "t0ken")
+	url, err := gh.OpenMergeRequest(context.Background(), "cvmanager/app-abc", "master", "Deploy abc", "")
+	if err != nil || url != "https://github.example.com/pr/1" {
+		t.Fatalf("Expected pull request URL, got %s: %v", url, err)
+	}
+	gl, _ := New(&cv1.SCMSpec{Kind: KindGitLab, Repository: "nearmap/manifests", BaseURL: server.URL}, "t0ken")
+	url, err = gl.OpenMergeRequest(context.Background(), "cvmanager/app-abc", "master", "Deploy abc", "")
+	if err != nil || url != "https://gitlab.example.com/mr/1" {
+		t.Fatalf("Expected merge request URL, got %s: %v", url, err)
+	}
+
+	expected := []string{
+		"GET /repos/nearmap/manifests/pulls?base=master&head=nearmap%3Acvmanager%2Fapp-abc&state=open",
+		"POST /repos/nearmap/manifests/pulls",
+		"GET /projects/nearmap%2Fmanifests/merge_requests?source_branch=cvmanager%2Fapp-abc&state=opened&target_branch=master",
+		"POST /projects/nearmap%2Fmanifests/merge_requests",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected requests:\n%s", strings.Join(requests, "\n"))
+	}
+	if bodies[0]["head"] != "cvmanager/app-abc" || bodies[1]["source_branch"] != "cvmanager/app-abc" {
+		t.Errorf("Unexpected merge requests %v", bodies)
+	}
+}
+
+func TestOpenMergeRequestExisting(t *testing.T) {
+	server, requests := newServer(t, `[{"html_url":"https://github.example.com/pr/1"}]`)
+	defer server.Close()
+
+	gh, _ := New(&cv1.SCMSpec{Kind: KindGitHub, Repository: "nearmap/manifests", BaseURL: server.URL}, "t0ken")
+	url, err := gh.OpenMergeRequest(context.Background(), "cvmanager/app-abc", "master", "Deploy abc", "")
+	if err != nil || url != "https://github.example.com/pr/1" {
+		t.Fatalf("Expected existing pull request URL, got %s: %v", url, err)
+	}
+	<-requests
+	select {
+	case req := <-requests:
+		t.Errorf("Expected no further requests, got %s %s", req.method, req.uri)
+	default:
+	}
+}
@@ -3,17 +3,39 @@ package signals
 import (
 	"os"
 	"os/signal"
+	"sync"
 )
 
-// SetupSignalHandler registered for SIGINT. A stop channel is returned
-// which is closed on one of these signals.
-func SetupSignalHandler() chan struct{} {
-	stop := make(chan struct{})
+// Stop is a stop channel that may be closed by several goroutines, such as the signal
+// handler, a server that fails to start and a leader elector that loses its lease.
+type Stop struct {
+	// C is closed when the process should stop.
+	C chan struct{}
+
+	once sync.Once
+}
+
+// NewStop returns a Stop with an open channel.
+func NewStop() *Stop {
+	return &Stop{C: make(chan struct{})}
+}
+
+// Close closes the stop channel unless it is already closed.
+func (s *Stop) Close() {
+	s.once.Do(func() {
+		close(s.C)
+	})
+}
+
+// SetupSignalHandler registered for SIGINT. A stop is returned whose channel
+// is closed on one of these signals.
+func SetupSignalHandler() *Stop {
+	stop := NewStop()
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		<-c
-		close(stop)
+		stop.Close()
 		<-c
 		os.Exit(1) // second signal. Exit directly.
 	}()
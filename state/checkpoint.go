@@ -0,0 +1,252 @@
+package state
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// Checkpoint records the progress of an operation group so that it can be resumed
+// after a restart.
+type Checkpoint struct {
+	// ID is the identifier of the operation group.
+	ID string `json:"id"`
+
+	// Steps contains the IDs of the steps that have completed.
+	Steps []string `json:"steps,omitempty"`
+
+	// Data contains arbitrary values stored by states for use when resuming.
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// Checkpointer persists the checkpoint of the current operation group.
+type Checkpointer interface {
+	// Save persists the given checkpoint, replacing any existing checkpoint.
+	Save(cp *Checkpoint) error
+
+	// Load returns the persisted checkpoint or nil if there is none.
+	Load() (*Checkpoint, error)
+
+	// Clear removes any persisted checkpoint.
+	Clear() error
+}
+
+// HasStep is an interface defining a State that has a stable step identifier. Step IDs
+// must be unique within a chain of states and deterministic across restarts.
+type HasStep interface {
+	StepID() string
+}
+
+// StepState defines a state operation with a stable step identifier. Once a step has
+// completed its progress is checkpointed, and if the operation is resumed the step is
+// skipped in favour of the given next state.
+type StepState struct {
+	id    string
+	state State
+	next  State
+}
+
+// NewStepState returns a State instance that executes the given state as the step with the
+// given ID. The next state is used in place of the state if the step has already completed.
+func NewStepState(id string, state State, next State) *StepState {
+	return &StepState{
+		id:    id,
+		state: state,
+		next:  next,
+	}
+}
+
+// Do implements the State interface.
+func (ss *StepState) Do(ctx context.Context) (States, error) {
+	if Completed(ctx, ss.id) {
+		glog.V(2).Infof("Skipping completed step %s of operation %s", ss.id, ID(ctx))
+		return Single(ss.next)
+	}
+	return ss.state.Do(ctx)
+}
+
+// StepID implements the HasStep interface.
+func (ss *StepState) StepID() string {
+	return ss.id
+}
+
+// progress tracks the completed steps and stored data of an operation group.
+type progress struct {
+	sync.Mutex
+
+	id    string
+	steps []string
+	data  map[string]string
+
+	checkpointer Checkpointer
+	persisted    bool
+}
+
+func newProgress(id string, checkpointer Checkpointer) *progress {
+	return &progress{
+		id:           id,
+		data:         make(map[string]string),
+		checkpointer: checkpointer,
+	}
+}
+
+// resumeProgress returns progress restored from the given checkpoint.
+func resumeProgress(cp *Checkpoint, checkpointer Checkpointer) *progress {
+	p := newProgress(cp.ID, checkpointer)
+	p.persisted = true
+	p.steps = append(p.steps, cp.Steps...)
+	for k, v := range cp.Data {
+		p.data[k] = v
+	}
+	return p
+}
+
+func (p *progress) completed(step string) bool {
+	p.Lock()
+	defer p.Unlock()
+	for _, s := range p.steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *progress) complete(step string) {
+	if p.completed(step) {
+		return
+	}
+
+	glog.V(4).Infof("Completed step %s of operation %s", step, p.id)
+
+	p.Lock()
+	p.steps = append(p.steps, step)
+	p.Unlock()
+	p.save()
+}
+
+func (p *progress) set(key, value string) {
+	p.Lock()
+	p.data[key] = value
+	p.Unlock()
+	p.save()
+}
+
+func (p *progress) setAll(data map[string]string) {
+	p.Lock()
+	for k, v := range data {
+		p.data[k] = v
+	}
+	p.Unlock()
+	p.save()
+}
+
+func (p *progress) get(key string) string {
+	p.Lock()
+	defer p.Unlock()
+	return p.data[key]
+}
+
+func (p *progress) reset() {
+	p.Lock()
+	p.steps = nil
+	p.data = make(map[string]string)
+	p.Unlock()
+	p.clear()
+}
+
+func (p *progress) save() {
+	if p.checkpointer == nil {
+		return
+	}
+
+	p.Lock()
+	p.persisted = true
+	cp := &Checkpoint{
+		ID:   p.id,
+		Data: make(map[string]string, len(p.data)),
+	}
+	cp.Steps = append(cp.Steps, p.steps...)
+	for k, v := range p.data {
+		cp.Data[k] = v
+	}
+	p.Unlock()
+
+	if err := p.checkpointer.Save(cp); err != nil {
+		glog.Errorf("Failed to save checkpoint for operation %s: %v", p.id, err)
+	}
+}
+
+func (p *progress) clear() {
+	p.Lock()
+	persisted := p.persisted
+	p.persisted = false
+	p.Unlock()
+
+	if p.checkpointer == nil || !persisted {
+		return
+	}
+	if err := p.checkpointer.Clear(); err != nil {
+		glog.Errorf("Failed to clear checkpoint for operation %s: %v", p.id, err)
+	}
+}
+
+func progressFromContext(ctx context.Context) *progress {
+	p, _ := ctx.Value(ctxProgress).(*progress)
+	return p
+}
+
+// Completed returns true if the step with the given ID was completed by the
+// operation group of the context, including by a previous run that is being resumed.
+func Completed(ctx context.Context, step string) bool {
+	if p := progressFromContext(ctx); p != nil {
+		return p.completed(step)
+	}
+	return false
+}
+
+// SetData stores a value in the checkpoint of the operation group of the context.
+func SetData(ctx context.Context, key, value string) {
+	if p := progressFromContext(ctx); p != nil {
+		p.set(key, value)
+	}
+}
+
+// SetDataMap stores the given values in the checkpoint of the operation group of the
+// context, persisting the checkpoint once.
+func SetDataMap(ctx context.Context, data map[string]string) {
+	if p := progressFromContext(ctx); p != nil {
+		p.setAll(data)
+	}
+}
+
+// Data returns a value from the checkpoint of the operation group of the context,
+// or an empty string if not set.
+func Data(ctx context.Context, key string) string {
+	if p := progressFromContext(ctx); p != nil {
+		return p.get(key)
+	}
+	return ""
+}
+
+// Reset discards all progress of the operation group of the context, such as when
+// a resumed checkpoint no longer applies.
+func Reset(ctx context.Context) {
+	if p := progressFromContext(ctx); p != nil {
+		p.reset()
+	}
+}
+
+// stepOf returns the step ID of the given state, if any.
+func stepOf(st State) (string, bool) {
+	switch s := st.(type) {
+	case *AfterState:
+		return stepOf(s.state)
+	case AfterState:
+		return stepOf(s.state)
+	case HasStep:
+		return s.StepID(), true
+	}
+	return "", false
+}
@@ -0,0 +1,146 @@
+package state
+
+import (
+	"container/heap"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memoryCheckpointer is an in-memory implementation of the Checkpointer interface for testing purposes.
+type memoryCheckpointer struct {
+	cp      *Checkpoint
+	saves   [][]string
+	cleared bool
+}
+
+func (mc *memoryCheckpointer) Save(cp *Checkpoint) error {
+	mc.cp = cp
+	mc.saves = append(mc.saves, cp.Steps)
+	return nil
+}
+
+func (mc *memoryCheckpointer) Load() (*Checkpoint, error) {
+	return mc.cp, nil
+}
+
+func (mc *memoryCheckpointer) Clear() error {
+	mc.cp = nil
+	mc.cleared = true
+	return nil
+}
+
+// runGroup executes the ops of the first operation group scheduled on the machine,
+// regardless of when they are due.
+func runGroup(t *testing.T, m *Machine) {
+	var id string
+	for i := 0; i < 100; i++ {
+		m.mu.Lock()
+		if m.queue.Len() == 0 {
+			m.mu.Unlock()
+			t.Fatalf("No operation scheduled")
+		}
+		o := heap.Pop(&m.queue).(*scheduled).op
+		m.mu.Unlock()
+
+		if id == "" {
+			id = ID(o.ctx)
+		}
+		if ID(o.ctx) != id {
+			return
+		}
+		m.executeOp(o)
+	}
+	t.Fatalf("Operation group did not complete")
+}
+
+func newStepChain(invoked *[]string) State {
+	record := func(name string, next State) StateFunc {
+		return func(ctx context.Context) (States, error) {
+			*invoked = append(*invoked, name)
+			if next == nil {
+				return None()
+			}
+			return Single(next)
+		}
+	}
+
+	stepC := NewStepState("c", record("c", nil), nil)
+	stepB := NewStepState("b", record("b", stepC), stepC)
+	return NewStepState("a", record("a", stepB), stepB)
+}
+
+func TestCheckpointSteps(t *testing.T) {
+	var invoked []string
+	cp := &memoryCheckpointer{}
+	m := NewMachine(newStepChain(&invoked), WithCheckpointer(cp), WithStartWaitTime(-time.Second))
+
+	m.Schedule()
+	runGroup(t, m)
+
+	if !reflect.DeepEqual(invoked, []string{"a", "b", "c"}) {
+		t.Errorf("Expected all steps to be invoked, got %v", invoked)
+	}
+	expected := [][]string{{"a"}, {"a", "b"}, {"a", "b", "c"}}
+	if !reflect.DeepEqual(cp.saves, expected) {
+		t.Errorf("Expected checkpoints %v, got %v", expected, cp.saves)
+	}
+	if !cp.cleared || cp.cp != nil {
+		t.Errorf("Expected checkpoint to be cleared once the operation completed")
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	var invoked []string
+	cp := &memoryCheckpointer{
+		cp: &Checkpoint{
+			ID:    "resumed",
+			Steps: []string{"a"},
+			Data:  map[string]string{"key": "value"},
+		},
+	}
+	m := NewMachine(newStepChain(&invoked), WithCheckpointer(cp))
+
+	m.Schedule()
+	runGroup(t, m)
+
+	if !reflect.DeepEqual(invoked, []string{"b", "c"}) {
+		t.Errorf("Expected completed step to be skipped, got %v", invoked)
+	}
+	if !cp.cleared {
+		t.Errorf("Expected checkpoint to be cleared once the operation completed")
+	}
+}
+
+func TestCheckpointData(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ctxProgress, newProgress("id", nil))
+
+	if Data(ctx, "key") != "" {
+		t.Errorf("Expected no data")
+	}
+	SetData(ctx, "key", "value")
+	if Data(ctx, "key") != "value" {
+		t.Errorf("Expected data to be stored")
+	}
+	Reset(ctx)
+	if Data(ctx, "key") != "" {
+		t.Errorf("Expected data to be reset")
+	}
+
+	cp := &memoryCheckpointer{}
+	ctx = context.WithValue(context.Background(), ctxProgress, newProgress("id", cp))
+	SetDataMap(ctx, map[string]string{"a": "1", "b": "2"})
+	if Data(ctx, "a") != "1" || Data(ctx, "b") != "2" {
+		t.Errorf("Expected data to be stored")
+	}
+	if len(cp.saves) != 1 || !reflect.DeepEqual(cp.cp.Data, map[string]string{"a": "1", "b": "2"}) {
+		t.Errorf("Expected data to be saved in a single checkpoint, got %d saves of %v", len(cp.saves), cp.cp.Data)
+	}
+
+	// no progress in context
+	SetData(context.Background(), "key", "value")
+	if Data(context.Background(), "key") != "" || Completed(context.Background(), "a") {
+		t.Errorf("Expected no data without progress")
+	}
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time and timers to the state machine, allowing
+// time to be controlled in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once the given
+	// duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock implements the Clock interface using the system time.
+type realClock struct{}
+
+// Now implements the Clock interface.
+func (realClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// After implements the Clock interface.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Now returns the current time according to the clock of the machine executing the
+// operation of the context, or the system time if there is none.
+func Now(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(ctxClock).(Clock); ok {
+		return clock.Now()
+	}
+	return time.Now().UTC()
+}
+
+// WithClock sets the clock used by the state machine as options.
+func WithClock(clock Clock) func(*Options) {
+	return func(op *Options) {
+		op.Clock = clock
+	}
+}
@@ -1,6 +1,12 @@
 package state
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+)
 
 // ErrorFailed indicates that an operation failed for a permanent reason,
 // such as verification failure. Such operations should not be retried.
@@ -41,16 +47,16 @@ func NewFailedError(err error, message string, args ...interface{}) *ErrorFailed
 	}
 }
 
-// IsPermanent returns true if the error returned by an operation indicates
-// a permanent failure, which should not be retried.
-func IsPermanent(err error) bool {
+// FindCause returns the first error in the cause chain of the given error, starting
+// with the error itself, for which match returns true. Returns nil if there is none.
+func FindCause(err error, match func(error) bool) error {
 	type causer interface {
 		Cause() error
 	}
 
 	for err != nil {
-		if _, ok := err.(*ErrorFailed); ok {
-			return true
+		if match(err) {
+			return err
 		}
 		cause, ok := err.(causer)
 		if !ok {
@@ -58,5 +64,117 @@ func IsPermanent(err error) bool {
 		}
 		err = cause.Cause()
 	}
-	return false
+	return nil
+}
+
+// IsPermanent returns true if the error returned by an operation indicates
+// a permanent failure, which should not be retried.
+func IsPermanent(err error) bool {
+	return FindCause(err, func(err error) bool {
+		_, ok := err.(*ErrorFailed)
+		return ok
+	}) != nil
+}
+
+// HasCause returns true if the given error is, or was caused by, the target error.
+func HasCause(err, target error) bool {
+	return FindCause(err, func(err error) bool {
+		return err == target
+	}) != nil
+}
+
+// ErrorRateLimited indicates that an operation failed because it was throttled by
+// a remote service. Such operations should be retried after a delay.
+type ErrorRateLimited struct {
+	cause      error
+	retryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (erl *ErrorRateLimited) Error() string {
+	return fmt.Sprintf("rate limited: %s", erl.cause.Error())
+}
+
+// Cause implements the errors.Cause interface
+func (erl *ErrorRateLimited) Cause() error {
+	return erl.cause
+}
+
+// NewRateLimited returns an error of type ErrorRateLimited that wraps an existing error,
+// indicating that the operation was throttled. If retryAfter is non-zero the operation
+// will not be retried before the given duration has elapsed.
+func NewRateLimited(err error, retryAfter time.Duration) *ErrorRateLimited {
+	return &ErrorRateLimited{
+		cause:      err,
+		retryAfter: retryAfter,
+	}
+}
+
+// ErrorClass classifies errors returned by operations to determine how they are retried.
+type ErrorClass int
+
+const (
+	// ClassRetryable indicates a transient error that is retried according to the retry policy.
+	ClassRetryable ErrorClass = iota
+	// ClassPermanent indicates an error that should not be retried.
+	ClassPermanent
+	// ClassRateLimited indicates that the operation was throttled and should be retried
+	// without counting against the maximum number of attempts.
+	ClassRateLimited
+)
+
+// String implements the Stringer interface.
+func (ec ErrorClass) String() string {
+	switch ec {
+	case ClassPermanent:
+		return "permanent"
+	case ClassRateLimited:
+		return "rate-limited"
+	}
+	return "retryable"
+}
+
+// Classify returns the class of the error returned by an operation. Kubernetes API
+// errors indicating too many requests are treated as rate limited and invalid
+// requests as permanent.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassRetryable
+	}
+	if IsPermanent(err) {
+		return ClassPermanent
+	}
+	if _, ok := rateLimited(err); ok {
+		return ClassRateLimited
+	}
+
+	cause := errors.Cause(err)
+	switch {
+	case k8serr.IsTooManyRequests(cause):
+		return ClassRateLimited
+	case k8serr.IsInvalid(cause):
+		return ClassPermanent
+	}
+	return ClassRetryable
+}
+
+// RetryAfter returns the minimum duration to wait before retrying an operation that
+// failed with the given error, or zero if the error does not specify one.
+func RetryAfter(err error) time.Duration {
+	if erl, ok := rateLimited(err); ok {
+		return erl.retryAfter
+	}
+	if seconds, ok := k8serr.SuggestsClientDelay(errors.Cause(err)); ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// rateLimited returns the ErrorRateLimited in the cause chain of the given error, if any.
+func rateLimited(err error) (*ErrorRateLimited, bool) {
+	erl, ok := FindCause(err, func(err error) bool {
+		_, ok := err.(*ErrorRateLimited)
+		return ok
+	}).(*ErrorRateLimited)
+	return erl, ok
 }
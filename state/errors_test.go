@@ -3,6 +3,11 @@ package state
 import (
 	"errors"
 	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestFailedWithError(t *testing.T) {
@@ -67,3 +72,69 @@ func TestIsPermanent(t *testing.T) {
 		t.Error("expected error with cause that is of type *ErrorFailed to be permanent")
 	}
 }
+
+func TestHasCause(t *testing.T) {
+	if !HasCause(ErrAborted, ErrAborted) {
+		t.Error("expected error to be its own cause")
+	}
+	if !HasCause(pkgerrors.Wrap(ErrAborted, "wrapped"), ErrAborted) {
+		t.Error("expected wrapped error to have its cause")
+	}
+	if HasCause(NewFailed("operation aborted"), ErrAborted) {
+		t.Error("expected distinct error with the same message not to have the cause")
+	}
+	if HasCause(nil, ErrAborted) {
+		t.Error("expected nil error not to have a cause")
+	}
+}
+
+func TestFindCause(t *testing.T) {
+	failed := NewFailedError(errors.New("cause"), "failed")
+	err := pkgerrors.Wrap(NewRateLimited(failed, 0), "wrapped")
+
+	isFailed := func(err error) bool {
+		_, ok := err.(*ErrorFailed)
+		return ok
+	}
+	if cause := FindCause(err, isFailed); cause != failed {
+		t.Errorf("expected to find failed error in cause chain, got %v", cause)
+	}
+	if cause := FindCause(failed, isFailed); cause != failed {
+		t.Errorf("expected error to match itself, got %v", cause)
+	}
+	if cause := FindCause(err, func(err error) bool { return false }); cause != nil {
+		t.Errorf("expected no cause to match, got %v", cause)
+	}
+	if cause := FindCause(nil, isFailed); cause != nil {
+		t.Errorf("expected nil error to have no cause, got %v", cause)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tooMany := k8serr.NewTooManyRequests("slow down", 7)
+
+	var tests = []struct {
+		message    string
+		err        error
+		class      ErrorClass
+		retryAfter time.Duration
+	}{
+		{"plain error", errors.New("test error"), ClassRetryable, 0},
+		{"failed error", NewFailed("test"), ClassPermanent, 0},
+		{"wrapped failed error", pkgerrors.Wrap(NewFailed("test"), "wrapped"), ClassPermanent, 0},
+		{"rate limited", NewRateLimited(errors.New("test error"), time.Minute), ClassRateLimited, time.Minute},
+		{"wrapped rate limited", pkgerrors.Wrap(NewRateLimited(errors.New("test error"), 0), "wrapped"), ClassRateLimited, 0},
+		{"too many requests", pkgerrors.Wrap(tooMany, "wrapped"), ClassRateLimited, 7 * time.Second},
+		{"invalid", k8serr.NewInvalid(schema.GroupKind{Kind: "Deployment"}, "test", nil), ClassPermanent, 0},
+		{"conflict", k8serr.NewConflict(schema.GroupResource{}, "test", errors.New("")), ClassRetryable, 0},
+	}
+
+	for _, test := range tests {
+		if class := Classify(test.err); class != test.class {
+			t.Errorf("%s: expected class %v, got %v", test.message, test.class, class)
+		}
+		if retryAfter := RetryAfter(test.err); retryAfter != test.retryAfter {
+			t.Errorf("%s: expected retry after %v, got %v", test.message, test.retryAfter, retryAfter)
+		}
+	}
+}
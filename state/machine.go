@@ -4,29 +4,65 @@ import (
 	"context"
 	"fmt"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/nearmap/cvmanager/events"
 	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/pkg/errors"
 	"github.com/twinj/uuid"
 )
 
 const (
-	maxSleepSeconds = 60
+	// healthInterval is the maximum time between updates of the health status while
+	// the machine is waiting for operations to become due.
+	healthInterval = time.Minute
 )
 
+// ErrAborted is the permanent error with which operations fail when they are aborted.
+var ErrAborted = NewFailed("operation aborted")
+
+// ErrTimeout is the permanent error with which operations fail when they do not complete
+// within the operation timeout.
+var ErrTimeout = NewFailed("operation timed out")
+
 // Options contains optional state machine parameters.
 type Options struct {
 	// StartWaitTime is the time to wait before beginning a new "start" operation
 	StartWaitTime time.Duration
 
 	OperationTimeout time.Duration
-	MaxRetries       int
+
+	// RetryPolicy is the default policy for retrying failed operations. States may
+	// declare their own policy by implementing HasRetryPolicy.
+	RetryPolicy RetryPolicy
 
 	Stats    stats.Stats
 	Recorder events.Recorder
+
+	// Checkpointer persists the progress of operations so that they can be resumed.
+	Checkpointer Checkpointer
+
+	// Clock provides the time used for scheduling operations. Defaults to the system time.
+	Clock Clock
+
+	// Observer, if set, is notified of the states executed by the machine.
+	Observer Observer
+
+	// Tracer, if set, records each operation group as a trace in which every executed
+	// state is a span.
+	Tracer *tracing.Tracer
+}
+
+// Observer is notified of the progress of operations executed by the state machine.
+type Observer interface {
+	// Executed is invoked after a state has been executed with the error it returned, if any.
+	Executed(ctx context.Context, st State, err error)
+
+	// Completed is invoked once all operations in a group have completed.
+	Completed(ctx context.Context)
 }
 
 // WithStartWaitTime sets a StartWaitTime duration as options.
@@ -57,11 +93,51 @@ func WithRecorder(rec events.Recorder) func(*Options) {
 	}
 }
 
+// WithCheckpointer sets a checkpointer for options.
+func WithCheckpointer(cp Checkpointer) func(*Options) {
+	return func(op *Options) {
+		op.Checkpointer = cp
+	}
+}
+
+// WithObserver sets an observer for options.
+func WithObserver(obs Observer) func(*Options) {
+	return func(op *Options) {
+		op.Observer = obs
+	}
+}
+
+// WithTracer sets a tracer for options.
+func WithTracer(tracer *tracing.Tracer) func(*Options) {
+	return func(op *Options) {
+		op.Tracer = tracer
+	}
+}
+
 // group tracks a collection of related ops.
 // This allows the machine to determine when a related set of operations
 // has completed so that new ops can be scheduled.
 type group struct {
-	ops []*op
+	id        string
+	ops       []*op
+	report    *report
+	startedAt time.Time
+	// deadline is the time by which the operations of the group time out, according
+	// to the machine's clock.
+	deadline time.Time
+
+	// span is the root span of the trace of the group, if traced.
+	span *tracing.Span
+	// err is the permanent error with which an operation of the group failed, if any.
+	err error
+}
+
+// newGroup returns a group for the operations with the given ID.
+func newGroup(id string) *group {
+	return &group{
+		id:     id,
+		report: &report{},
+	}
 }
 
 // op is an operation to be performed by the machine.
@@ -74,7 +150,12 @@ type op struct {
 
 	complete     bool
 	retries      int
+	failures     int
+	failedAt     time.Time
 	failureFuncs []OnFailure
+
+	// step is the ID of the most recent step in this op's chain of states.
+	step string
 }
 
 // addNewOp adds the given operation to this group.
@@ -103,6 +184,7 @@ func (o *op) new(state State, failureFunc OnFailure) *op {
 		cancel:       o.cancel,
 		retries:      0,
 		failureFuncs: o.failureFuncs,
+		step:         o.step,
 	}
 
 	o.group.addNewOp(newOp)
@@ -117,13 +199,26 @@ func (o *op) String() string {
 	return fmt.Sprintf("op: %s (retries=%d, onFailures=%d, type=%T)", ID(o.ctx), o.retries, len(o.failureFuncs), o.state)
 }
 
-// Machine implements the main state machine loop.
+// Machine implements the main state machine loop. Operations are kept in a queue
+// ordered by the time they are due, and the machine sleeps until either the next
+// operation is due or a new operation is scheduled.
 type Machine struct {
 	start State
-	ops   chan *op
 	stop  chan chan error
 	ctx   context.Context
 
+	mu       sync.Mutex
+	queue    opQueue
+	seq      uint64
+	wake     chan struct{}
+	paused   bool
+	pausedAt time.Time
+	aborting bool
+
+	// executing describes the operation currently being executed, if any.
+	executing      *OperationState
+	executingGroup *group
+
 	options *Options
 }
 
@@ -133,9 +228,10 @@ func NewMachine(start State, options ...func(*Options)) *Machine {
 	opts := &Options{
 		StartWaitTime:    5 * time.Minute,
 		OperationTimeout: 15 * time.Minute,
-		MaxRetries:       5,
+		RetryPolicy:      DefaultRetryPolicy(),
 		Stats:            stats.NewFake(),
 		Recorder:         events.NewFakeRecorder(100),
+		Clock:            realClock{},
 	}
 	for _, opt := range options {
 		opt(opts)
@@ -145,10 +241,12 @@ func NewMachine(start State, options ...func(*Options)) *Machine {
 
 	ctx := stats.NewContext(context.Background(), opts.Stats)
 	ctx = events.NewContext(ctx, opts.Recorder)
+	ctx = context.WithValue(ctx, ctxClock, opts.Clock)
 
 	return &Machine{
 		start:   start,
-		ops:     make(chan *op, 100),
+		stop:    make(chan chan error),
+		wake:    make(chan struct{}, 1),
 		ctx:     ctx,
 		options: opts,
 	}
@@ -162,47 +260,37 @@ func (m *Machine) Start() {
 		}
 	}()
 
-	m.newOp()
+	m.Schedule()
 
-	for i := uint64(0); ; i++ {
-		select {
-		case o := <-m.ops:
-			if err := UpdateHealthStatus(); err != nil {
-				glog.Errorf("Failed to update health status: %v", err)
-			}
-			if m.executeOp(o) {
-				i = 0
-			} else {
-				m.scheduleOps(o)
-				m.sleep(i)
+	for {
+		m.Step()
+
+		if err := UpdateHealthStatus(); err != nil {
+			glog.Errorf("Failed to update health status: %v", err)
+		}
+
+		wait := healthInterval
+		if next, ok := m.NextDue(); ok && !m.Paused() {
+			if d := next.Sub(m.options.Clock.Now()); d < wait {
+				wait = d
 			}
+		}
+
+		select {
+		case <-m.options.Clock.After(wait):
+		case <-m.wake:
 		case ch := <-m.stop:
 			glog.V(1).Info("stop signal received")
 			ch <- nil
 			return
-		default:
-			m.sleep(i)
 		}
 	}
 }
 
-func (m *Machine) sleep(i uint64) {
-	if i == 0 {
-		return
-	}
-
-	sleep := time.Duration(i*3) * time.Second
-	if sleep > maxSleepSeconds*time.Second {
-		sleep = maxSleepSeconds * time.Second
-	}
-
-	time.Sleep(sleep)
-}
-
 // canExecute returns true if the operation is in a state that can be executed.
 func (m *Machine) canExecute(o *op) bool {
 	if aft, ok := o.state.(HasAfter); ok {
-		return time.Now().UTC().After(aft.After())
+		return !m.options.Clock.Now().Before(aft.After())
 	}
 	return true
 }
@@ -226,32 +314,51 @@ func (m *Machine) executeOp(o *op) (finished bool) {
 		m.completeOp(o)
 		return true
 	}
+	remaining := o.group.deadline.Sub(m.options.Clock.Now())
+	if remaining <= 0 {
+		m.permanentFailure(o, ErrTimeout)
+		return true
+	}
 
 	if !m.canExecute(o) {
 		return false
 	}
 
-	states, err := o.state.Do(o.ctx)
-	if err != nil && IsPermanent(err) {
-		m.permanentFailure(o, err)
-		return true
-	}
-	if err != nil && !IsPermanent(err) {
-		glog.V(1).Infof("Operation %s failed with error: %+v", ID(o.ctx), err)
-		o.retries++
-		if o.retries > m.options.MaxRetries {
-			glog.Errorf("Operation %s reached maximum number of retries (%d). Giving up.", ID(o.ctx), m.options.MaxRetries)
-			m.permanentFailure(o, err)
-			return true
+	// a step is complete once the next step in its chain begins
+	if step, ok := stepOf(o.state); ok && step != o.step {
+		if o.step != "" {
+			progressFromContext(o.ctx).complete(o.step)
 		}
+		o.step = step
+	}
 
-		glog.V(2).Infof("Retrying operation %s with retry attempt %d", ID(o.ctx), o.retries)
-		states = NewStates(NewAfterState(time.Now().UTC().Add(5*time.Second*time.Duration(o.retries)), o.state))
+	// the state's context times out with the group, which is measured with the machine's
+	// clock rather than by the context itself
+	ctx, cancel := context.WithTimeout(o.ctx, remaining)
+	defer cancel()
+	ctx, span := tracing.Start(tracing.NewContext(ctx, o.group.span), Name(o.state))
+	ctx = events.NewContext(ctx, tracing.Recorder(ctx, m.options.Recorder))
+
+	start := m.options.Clock.Now()
+	states, err := o.state.Do(ctx)
+	span.Finish(err)
+	m.options.Stats.Timing("state_duration", m.options.Clock.Now().Sub(start),
+		"state:"+Name(o.state), fmt.Sprintf("error:%t", err != nil))
+	if m.options.Observer != nil {
+		m.options.Observer.Executed(ctx, o.state, err)
+	}
+	if err != nil {
+		m.retry(o, err)
+		return true
+	}
+	if states.Empty() && o.step != "" {
+		// the end of the chain completes its last step
+		progressFromContext(o.ctx).complete(o.step)
 	}
 
 	var ops []*op
 	for _, st := range states.States {
-		ops = append(ops, o.new(st, states.OnFailure))
+		ops = append(ops, o.new(m.resolve(st), states.OnFailure))
 	}
 	m.scheduleOps(ops...)
 
@@ -259,14 +366,77 @@ func (m *Machine) executeOp(o *op) (finished bool) {
 	return true
 }
 
+// retry schedules the failed operation to be retried according to its retry policy
+// or fails it permanently if the error is permanent or the policy is exhausted.
+func (m *Machine) retry(o *op, err error) {
+	class := Classify(err)
+	if class == ClassPermanent {
+		m.permanentFailure(o, err)
+		return
+	}
+
+	policy, ok := retryPolicyOf(o.state)
+	if !ok {
+		policy = m.options.RetryPolicy
+	}
+
+	now := m.options.Clock.Now()
+	if o.failedAt.IsZero() {
+		o.failedAt = now
+	}
+	o.failures++
+	if class != ClassRateLimited {
+		o.retries++
+	}
+
+	glog.V(1).Infof("Operation %s failed with %s error: %+v", ID(o.ctx), class, err)
+
+	if policy.MaxAttempts > 0 && o.retries >= policy.MaxAttempts {
+		glog.Errorf("Operation %s reached maximum number of attempts (%d). Giving up.", ID(o.ctx), policy.MaxAttempts)
+		m.permanentFailure(o, err)
+		return
+	}
+	if policy.MaxElapsed > 0 && now.Sub(o.failedAt) >= policy.MaxElapsed {
+		glog.Errorf("Operation %s has been failing for longer than %v. Giving up.", ID(o.ctx), policy.MaxElapsed)
+		m.permanentFailure(o, err)
+		return
+	}
+
+	delay := policy.Delay(o.failures)
+	if after := RetryAfter(err); after > delay {
+		delay = after
+	}
+
+	glog.V(2).Infof("Retrying operation %s with retry attempt %d in %v", ID(o.ctx), o.retries, delay)
+
+	retry := o.new(NewAfterState(now.Add(delay), o.state), nil)
+	retry.retries = o.retries
+	retry.failures = o.failures
+	retry.failedAt = o.failedAt
+	m.scheduleOps(retry)
+
+	m.completeOp(o)
+}
+
 // completeOp marks the operation as complete and schedules a new operation
 // if all ops in the group have finished.
 func (m *Machine) completeOp(o *op) {
 	o.complete = true
 	if o.group.complete() {
 		glog.V(2).Info("op group is complete: cancelling context and scheduling new operation")
+		m.mu.Lock()
+		startedAt := o.group.startedAt
+		m.mu.Unlock()
+		if !startedAt.IsZero() {
+			m.options.Stats.Timing("operation_duration", m.options.Clock.Now().Sub(startedAt))
+		}
+		o.group.span.Finish(o.group.err)
+		progressFromContext(o.ctx).clear()
 		o.cancel()
-		go m.newOp()
+		if m.options.Observer != nil {
+			m.options.Observer.Completed(o.ctx)
+		}
+		m.scheduleOps(m.newOp())
 	}
 	glog.V(6).Info("op group is not yet complete")
 }
@@ -282,63 +452,113 @@ func (m *Machine) permanentFailure(o *op, err error) {
 
 	glog.V(1).Infof("Operation %s failed with permanent error: %+v", ID(o.ctx), err)
 
+	o.group.err = err
+	ctx := tracing.NewContext(o.ctx, o.group.span)
 	for i := len(o.failureFuncs) - 1; i >= 0; i-- {
-		o.failureFuncs[i].Fail(o.ctx, err)
+		o.failureFuncs[i].Fail(ctx, err)
 	}
 
 	o.cancel()
 	m.completeOp(o)
 }
 
-// scheduleOps schedules the given operations on the state machine.
+// scheduleOps schedules the given operations on the state machine and wakes
+// the machine so that it can reconsider when the next operation is due.
 func (m *Machine) scheduleOps(ops ...*op) {
 	glog.V(6).Infof("scheduling %d ops", len(ops))
 
-	var later []*op
-	for _, op := range ops {
-		select {
-		case m.ops <- op:
-		default:
-			later = append(later, op)
-		}
+	m.mu.Lock()
+	for _, o := range ops {
+		m.seq++
+		m.queue.push(o, m.seq)
 	}
+	m.mu.Unlock()
 
-	if len(later) == 0 {
-		return
+	m.notify()
+}
+
+// notify wakes the machine so that it reconsiders which operations can be executed.
+func (m *Machine) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
 	}
+}
 
-	glog.V(6).Infof("%d ops still require scheduling", len(later))
-	go func() {
-		for _, op := range later {
-			m.ops <- op
-		}
-		glog.V(6).Infof("finished scheduling all ops")
-	}()
+// resolve returns the given state with any delay resolved against the machine's clock.
+func (m *Machine) resolve(st State) State {
+	if as, ok := st.(*AfterState); ok && as.d != 0 {
+		return NewAfterState(m.options.Clock.Now().Add(as.d), as.state)
+	}
+	return st
 }
 
-func (m *Machine) newOp() {
+// newOp returns a new operation that invokes the start state after the start wait time.
+func (m *Machine) newOp() *op {
 	var cancel context.CancelFunc
-	ctx := context.WithValue(m.ctx, ctxID, uuid.Formatter(uuid.NewV4(), uuid.FormatCanonical))
-	ctx, cancel = context.WithTimeout(ctx, m.options.OperationTimeout+m.options.StartWaitTime)
+	id := uuid.Formatter(uuid.NewV4(), uuid.FormatCanonical)
+	ctx := context.WithValue(m.ctx, ctxID, id)
+	ctx = context.WithValue(ctx, ctxProgress, newProgress(id, m.options.Checkpointer))
+	g := newGroup(id)
+	g.deadline = m.options.Clock.Now().Add(m.options.OperationTimeout + m.options.StartWaitTime)
+	ctx = context.WithValue(ctx, ctxReport, g.report)
+	ctx, cancel = context.WithCancel(ctx)
 
 	o := &op{
-		group:  &group{},
+		group:  g,
 		ctx:    ctx,
 		cancel: cancel,
-		state:  NewAfterState(time.Now().UTC().Add(m.options.StartWaitTime), m.start),
+		state:  NewAfterState(m.options.Clock.Now().Add(m.options.StartWaitTime), m.start),
 	}
 
 	if glog.V(6) {
 		glog.V(6).Infof("newOp: %+v", o)
 	}
 
-	m.ops <- o
+	return o
+}
+
+// resumeOp returns an operation that resumes from a persisted checkpoint, if any.
+// Returns nil if there was no checkpoint to resume from.
+func (m *Machine) resumeOp() *op {
+	if m.options.Checkpointer == nil {
+		return nil
+	}
+
+	cp, err := m.options.Checkpointer.Load()
+	if err != nil {
+		glog.Errorf("Failed to load checkpoint: %v", err)
+		return nil
+	}
+	if cp == nil {
+		return nil
+	}
+
+	glog.V(1).Infof("Resuming operation %s with completed steps %v", cp.ID, cp.Steps)
+
+	var cancel context.CancelFunc
+	ctx := context.WithValue(m.ctx, ctxID, cp.ID)
+	ctx = context.WithValue(ctx, ctxProgress, resumeProgress(cp, m.options.Checkpointer))
+	g := newGroup(cp.ID)
+	g.deadline = m.options.Clock.Now().Add(m.options.OperationTimeout)
+	ctx = context.WithValue(ctx, ctxReport, g.report)
+	ctx, cancel = context.WithCancel(ctx)
+
+	return &op{
+		group:  g,
+		ctx:    ctx,
+		cancel: cancel,
+		state:  m.start,
+	}
 }
 
 type ctxKey int
 
 const (
 	ctxID ctxKey = iota
+	ctxProgress
+	ctxReport
+	ctxClock
 )
 
 // ID returns the unique identifier of an operation from its context.
@@ -351,6 +571,148 @@ func ID(ctx context.Context) string {
 	return id
 }
 
+// Step executes the operations that are due according to the machine's clock,
+// returning the number of operations executed. Operations scheduled by the executed
+// states are not executed until the next step. Step allows the machine to be driven
+// synchronously, such as in tests, and must not be used while the machine is started.
+// No operations are executed while the machine is paused.
+func (m *Machine) Step() int {
+	m.mu.Lock()
+	var aborted []*op
+	if m.aborting {
+		m.aborting = false
+		aborted = m.queue.popStarted()
+	}
+	var ops []*op
+	if !m.paused {
+		ops = m.queue.popDue(m.options.Clock.Now())
+	}
+	m.mu.Unlock()
+
+	m.abortOps(aborted)
+
+	var executed int
+	for _, o := range ops {
+		m.mu.Lock()
+		if o.group.startedAt.IsZero() {
+			o.group.startedAt = m.options.Clock.Now()
+			o.group.span = m.options.Tracer.StartTrace("operation", "operation.id", o.group.id)
+		}
+		m.executing = &OperationState{
+			State:     Name(o.state),
+			Retries:   o.retries,
+			NextRun:   m.options.Clock.Now(),
+			Executing: true,
+		}
+		m.executingGroup = o.group
+		m.mu.Unlock()
+
+		ok := m.executeOp(o)
+
+		m.mu.Lock()
+		m.executing = nil
+		m.executingGroup = nil
+		m.mu.Unlock()
+
+		if ok {
+			executed++
+		} else {
+			m.scheduleOps(o)
+		}
+	}
+	return executed
+}
+
+// Pause holds all operations at their next state boundary until Resume is called.
+// The time spent paused does not count towards the operation timeout.
+func (m *Machine) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.paused {
+		glog.V(1).Info("Pausing state machine")
+		m.paused = true
+		m.pausedAt = m.options.Clock.Now()
+	}
+}
+
+// Resume continues executing operations after the machine was paused.
+func (m *Machine) Resume() {
+	m.mu.Lock()
+	resumed := m.paused
+	if resumed {
+		m.extendDeadlines(m.options.Clock.Now().Sub(m.pausedAt))
+	}
+	m.paused = false
+	m.mu.Unlock()
+
+	if resumed {
+		glog.V(1).Info("Resuming state machine")
+		m.notify()
+	}
+}
+
+// extendDeadlines extends the deadlines of the operation groups in the queue by the
+// given duration. The machine's lock must be held.
+func (m *Machine) extendDeadlines(d time.Duration) {
+	extended := make(map[*group]bool)
+	for _, s := range m.queue {
+		if g := s.op.group; !extended[g] {
+			extended[g] = true
+			g.deadline = g.deadline.Add(d)
+		}
+	}
+}
+
+// Paused returns true if the machine is paused.
+func (m *Machine) Paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+// Abort fails the operations in progress at their next state boundary with ErrAborted,
+// invoking any registered OnFailure funcs. Operations that have not yet started, such
+// as the next scheduled sync, are unaffected. Abort takes effect even while paused.
+func (m *Machine) Abort() {
+	glog.V(1).Info("Aborting operations in progress")
+
+	m.mu.Lock()
+	m.aborting = true
+	m.mu.Unlock()
+	m.notify()
+}
+
+// abortOps fails each operation group of the given operations with ErrAborted.
+func (m *Machine) abortOps(ops []*op) {
+	failed := make(map[*group]bool)
+	for _, o := range ops {
+		if failed[o.group] {
+			m.completeOp(o)
+			continue
+		}
+		failed[o.group] = true
+		m.permanentFailure(o, ErrAborted)
+	}
+}
+
+// NextDue returns the earliest time at which a scheduled operation can be executed,
+// or false if no operations are scheduled.
+func (m *Machine) NextDue() (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queue.next()
+}
+
+// Schedule schedules a new operation of the start state, or one resuming from a persisted
+// checkpoint. It allows the machine to be driven synchronously via Step.
+func (m *Machine) Schedule() {
+	o := m.resumeOp()
+	if o == nil {
+		o = m.newOp()
+	}
+	m.scheduleOps(o)
+}
+
 // Stop stops the state machine, returning any errors encountered.
 func (m *Machine) Stop() error {
 	ch := make(chan error)
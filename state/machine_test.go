@@ -0,0 +1,242 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
+	"github.com/nearmap/cvmanager/tracing"
+)
+
+func TestMachineWakesWhenDue(t *testing.T) {
+	clock := statetest.NewFakeClock(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+	invoked := make(chan time.Time, 10)
+
+	second := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		invoked <- clock.Now()
+		return state.None()
+	})
+	first := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		invoked <- clock.Now()
+		return state.After(time.Minute, second)
+	})
+
+	m := state.NewMachine(first, state.WithClock(clock), state.WithStartWaitTime(0), state.WithTimeout(time.Hour))
+	go m.Start()
+
+	start := clock.Now()
+	select {
+	case at := <-invoked:
+		if !at.Equal(start) {
+			t.Errorf("Expected first state to execute immediately, got %v", at.Sub(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for first state")
+	}
+
+	select {
+	case <-invoked:
+		t.Fatalf("Expected second state not to execute before it is due")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case at := <-invoked:
+		if at.Sub(start) != time.Minute {
+			t.Errorf("Expected second state to execute after one minute, got %v", at.Sub(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for second state")
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Errorf("Unexpected error stopping machine: %v", err)
+	}
+}
+
+func TestMachinePauseResume(t *testing.T) {
+	var invoked []string
+	second := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		invoked = append(invoked, "second")
+		return state.None()
+	})
+	first := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		invoked = append(invoked, "first")
+		return state.Single(second)
+	})
+
+	h := statetest.New(first)
+	h.Machine.Schedule()
+	h.Machine.Step()
+
+	h.Machine.Pause()
+	for i := 0; i < 3; i++ {
+		if n := h.Machine.Step(); n != 0 {
+			t.Errorf("Expected no operations to execute while paused, got %d", n)
+		}
+	}
+
+	h.Machine.Resume()
+	if err := h.RunOperation(5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(invoked) != 2 || invoked[1] != "second" {
+		t.Errorf("Expected operation to continue once resumed, got %v", invoked)
+	}
+}
+
+func TestMachineAbort(t *testing.T) {
+	var failure error
+	var invoked int
+	var wait state.StateFunc
+	wait = func(ctx context.Context) (state.States, error) {
+		invoked++
+		return state.After(time.Minute, wait)
+	}
+	onFailure := state.OnFailureFunc(func(ctx context.Context, err error) {
+		failure = err
+	})
+
+	h := statetest.New(state.WithFailure(wait, onFailure), state.WithStartWaitTime(time.Hour))
+	h.Machine.Schedule()
+	h.Step()
+	h.Step()
+	h.Machine.Pause()
+
+	h.Machine.Abort()
+	h.Machine.Step()
+
+	if failure != state.ErrAborted {
+		t.Errorf("Expected failure funcs to be invoked with ErrAborted, got %v", failure)
+	}
+
+	// the next operation is scheduled and not aborted
+	next, ok := h.Machine.NextDue()
+	if !ok || next.Sub(h.Clock.Now()) != time.Hour {
+		t.Errorf("Expected next operation after the start wait time, got %v", next.Sub(h.Clock.Now()))
+	}
+
+	failure = nil
+	h.Machine.Resume()
+	h.Machine.Abort()
+	h.Machine.Step()
+	if failure != nil {
+		t.Errorf("Expected operations that have not started to be unaffected by abort, got %v", failure)
+	}
+	if _, ok := h.Machine.NextDue(); !ok {
+		t.Errorf("Expected next operation to remain scheduled")
+	}
+}
+
+type traceExporter struct {
+	spans []*tracing.Span
+}
+
+func (te *traceExporter) Export(spans []*tracing.Span) error {
+	te.spans = append(te.spans, spans...)
+	return nil
+}
+
+func TestMachineTracing(t *testing.T) {
+	var traceIDs []string
+	second := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		traceIDs = append(traceIDs, tracing.TraceID(ctx))
+		return state.None()
+	})
+	first := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		traceIDs = append(traceIDs, tracing.TraceID(ctx))
+		return state.Single(second)
+	})
+
+	exporter := &traceExporter{}
+	tracer := tracing.New("test", exporter)
+	h := statetest.New(first, state.WithTracer(tracer))
+	if err := h.RunOperation(5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tracer.Close()
+
+	if len(exporter.spans) != 3 {
+		t.Fatalf("Expected spans for the operation and both states, got %d", len(exporter.spans))
+	}
+	root := exporter.spans[2]
+	if root.Name != "operation" || root.ParentID != "" {
+		t.Errorf("Expected operation to be the root span, got %+v", root)
+	}
+	for i, s := range exporter.spans[:2] {
+		if s.ParentID != root.SpanID || traceIDs[i] != root.TraceID {
+			t.Errorf("Expected state %s to be traced as a child of the operation", s.Name)
+		}
+	}
+}
+
+func TestMachineTimeout(t *testing.T) {
+	var failure error
+	var invoked int
+	var deadline time.Time
+	var wait state.StateFunc
+	wait = func(ctx context.Context) (state.States, error) {
+		invoked++
+		deadline, _ = ctx.Deadline()
+		return state.After(time.Minute, wait)
+	}
+	onFailure := state.OnFailureFunc(func(ctx context.Context, err error) {
+		failure = err
+	})
+
+	h := statetest.New(state.WithFailure(wait, onFailure), state.WithTimeout(10*time.Minute))
+	start := h.Clock.Now()
+	if err := h.RunOperation(20); err != nil {
+		t.Fatalf("Expected operation to time out: %v", err)
+	}
+	if invoked != 10 {
+		t.Errorf("Expected state to execute until the timeout of the clock, got %d executions", invoked)
+	}
+	if remaining := deadline.Sub(time.Now()); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Expected state context to time out with the operation, got %v remaining", remaining)
+	}
+	if elapsed := h.Clock.Now().Sub(start); elapsed != 10*time.Minute {
+		t.Errorf("Expected operation to time out after 10 minutes, got %v", elapsed)
+	}
+	if failure != state.ErrTimeout {
+		t.Errorf("Expected failure funcs to be invoked with ErrTimeout, got %v", failure)
+	}
+}
+
+func TestMachinePauseTimeout(t *testing.T) {
+	var failure error
+	var invoked int
+	var wait state.StateFunc
+	wait = func(ctx context.Context) (state.States, error) {
+		invoked++
+		return state.After(time.Minute, wait)
+	}
+	onFailure := state.OnFailureFunc(func(ctx context.Context, err error) {
+		failure = err
+	})
+
+	h := statetest.New(state.WithFailure(wait, onFailure), state.WithTimeout(10*time.Minute))
+	h.Machine.Schedule()
+	h.Step()
+	h.Step()
+
+	h.Machine.Pause()
+	h.Clock.Advance(time.Hour)
+	h.Machine.Step()
+	h.Machine.Resume()
+
+	if err := h.RunOperation(20); err != nil {
+		t.Fatalf("Expected operation to time out: %v", err)
+	}
+	// the state that was waiting when paused executes once resumed, and then every
+	// minute until 10 minutes have passed while not paused
+	if invoked != 11 {
+		t.Errorf("Expected time spent paused not to count towards the timeout, got %d executions", invoked)
+	}
+	if failure != state.ErrTimeout {
+		t.Errorf("Expected failure funcs to be invoked with ErrTimeout, got %v", failure)
+	}
+}
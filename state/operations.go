@@ -0,0 +1,103 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation describes an operation group of the state machine.
+type Operation struct {
+	// ID is the identifier of the operation group, as returned by ID.
+	ID string `json:"id"`
+
+	// Started is the time the first state of the group was executed. It is zero if the
+	// group has not yet started.
+	Started time.Time `json:"started"`
+
+	// Message is the most recent message reported by the group's states.
+	Message string `json:"message,omitempty"`
+
+	// States contains the states of the group that are executing or waiting to be executed.
+	States []OperationState `json:"states"`
+}
+
+// OperationState describes a state waiting to be executed by the state machine.
+type OperationState struct {
+	// State is the name of the state, as returned by Name.
+	State string `json:"state"`
+
+	// Retries is the number of times the state has failed and been retried.
+	Retries int `json:"retries"`
+
+	// NextRun is the time at which the state is due to be executed.
+	NextRun time.Time `json:"nextRun"`
+
+	// Executing is true if the state is currently being executed.
+	Executing bool `json:"executing,omitempty"`
+}
+
+// report holds the message reported by the states of an operation group.
+type report struct {
+	sync.Mutex
+	message string
+}
+
+// Report records a description of what the operation group of the context is currently
+// doing, such as waiting for pods to become ready. It is returned by Machine.Operations.
+func Report(ctx context.Context, format string, args ...interface{}) {
+	if r, ok := ctx.Value(ctxReport).(*report); ok {
+		r.Lock()
+		r.message = fmt.Sprintf(format, args...)
+		r.Unlock()
+	}
+}
+
+func (r *report) get() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.message
+}
+
+// Operations returns the operation groups of the machine, ordered by the time at which
+// their next state is due.
+func (m *Machine) Operations() []Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var groups []*group
+	states := make(map[*group][]OperationState)
+	add := func(g *group, st OperationState) {
+		if _, ok := states[g]; !ok {
+			groups = append(groups, g)
+		}
+		states[g] = append(states[g], st)
+	}
+
+	if m.executing != nil {
+		add(m.executingGroup, *m.executing)
+	}
+
+	queued := append(opQueue(nil), m.queue...)
+	sort.Sort(queued)
+	for _, s := range queued {
+		add(s.op.group, OperationState{
+			State:   Name(s.op.state),
+			Retries: s.op.retries,
+			NextRun: s.due,
+		})
+	}
+
+	var ops []Operation
+	for _, g := range groups {
+		ops = append(ops, Operation{
+			ID:      g.id,
+			Started: g.startedAt,
+			Message: g.report.get(),
+			States:  states[g],
+		})
+	}
+	return ops
+}
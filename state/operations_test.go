@@ -0,0 +1,59 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
+	"github.com/pkg/errors"
+)
+
+func TestMachineOperations(t *testing.T) {
+	var waited bool
+	var wait state.StateFunc
+	wait = func(ctx context.Context) (state.States, error) {
+		if waited {
+			return state.Error(errors.New("transient"))
+		}
+		waited = true
+		state.Report(ctx, "waiting for pods (%d/%d ready)", 1, 2)
+		return state.After(time.Minute, state.NewStepState("wait", wait, nil))
+	}
+
+	h := statetest.New(wait, state.WithStartWaitTime(time.Hour))
+	h.Machine.Schedule()
+
+	ops := h.Machine.Operations()
+	if len(ops) != 1 || !ops[0].Started.IsZero() {
+		t.Fatalf("Expected a single operation that has not started, got %+v", ops)
+	}
+	if ops[0].States[0].NextRun.Sub(h.Clock.Now()) != time.Hour {
+		t.Errorf("Expected operation to run after the start wait time, got %v", ops[0].States[0].NextRun)
+	}
+
+	h.Step()
+	started := h.Clock.Now()
+
+	ops = h.Machine.Operations()
+	if len(ops) != 1 {
+		t.Fatalf("Expected a single operation, got %+v", ops)
+	}
+	op := ops[0]
+	if !op.Started.Equal(started) {
+		t.Errorf("Expected operation to have started at %v, got %v", started, op.Started)
+	}
+	if op.Message != "waiting for pods (1/2 ready)" {
+		t.Errorf("Expected reported message, got %q", op.Message)
+	}
+	if len(op.States) != 1 || op.States[0].State != "wait" || op.States[0].NextRun.Sub(started) != time.Minute {
+		t.Errorf("Expected wait step to be scheduled after a minute, got %+v", op.States)
+	}
+
+	h.Step()
+	ops = h.Machine.Operations()
+	if len(ops) != 1 || ops[0].States[0].Retries != 1 {
+		t.Errorf("Expected failed step to be retried, got %+v", ops)
+	}
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"container/heap"
+	"time"
+)
+
+// scheduled is an operation waiting in the machine's queue.
+type scheduled struct {
+	op  *op
+	due time.Time
+	seq uint64
+}
+
+// opQueue implements heap.Interface, ordering operations by the time they are
+// due and then by the order in which they were scheduled.
+type opQueue []*scheduled
+
+func (q opQueue) Len() int {
+	return len(q)
+}
+
+func (q opQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q opQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *opQueue) Push(x interface{}) {
+	*q = append(*q, x.(*scheduled))
+}
+
+func (q *opQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return s
+}
+
+// push adds the given operation to the queue.
+func (q *opQueue) push(o *op, seq uint64) {
+	var due time.Time
+	if aft, ok := o.state.(HasAfter); ok {
+		due = aft.After()
+	}
+	heap.Push(q, &scheduled{op: o, due: due, seq: seq})
+}
+
+// popDue removes and returns all operations that are due at the given time.
+func (q *opQueue) popDue(now time.Time) []*op {
+	var ops []*op
+	for q.Len() > 0 && !(*q)[0].due.After(now) {
+		ops = append(ops, heap.Pop(q).(*scheduled).op)
+	}
+	return ops
+}
+
+// popStarted removes and returns all operations belonging to a group that has started
+// executing, preserving the order of the remaining operations.
+func (q *opQueue) popStarted() []*op {
+	var ops []*op
+	remaining := (*q)[:0]
+	for _, s := range *q {
+		if !s.op.group.startedAt.IsZero() {
+			ops = append(ops, s.op)
+		} else {
+			remaining = append(remaining, s)
+		}
+	}
+	for i := len(remaining); i < len(*q); i++ {
+		(*q)[i] = nil
+	}
+	*q = remaining
+	heap.Init(q)
+	return ops
+}
+
+// next returns the time at which the earliest operation is due, or false if
+// the queue is empty.
+func (q opQueue) next() (time.Time, bool) {
+	if len(q) == 0 {
+		return time.Time{}, false
+	}
+	return q[0].due, true
+}
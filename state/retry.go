@@ -0,0 +1,121 @@
+package state
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy defines how an operation that fails with a retryable error is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the operation is attempted, including
+	// the first attempt. Rate limited attempts are not counted. Zero means no limit.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+
+	// MaxDelay limits the delay between retries. Zero means no limit.
+	MaxDelay time.Duration
+
+	// Multiplier is the factor by which the delay increases with each retry.
+	// Values less than 1 result in a constant delay.
+	Multiplier float64
+
+	// Jitter is the maximum fraction of the delay that is randomly added to it.
+	Jitter float64
+
+	// MaxElapsed is the maximum time since the first failure after which the operation
+	// is no longer retried. Zero means no limit.
+	MaxElapsed time.Duration
+}
+
+// defaultMaxRetries is the number of times a failed operation is retried by default.
+const defaultMaxRetries = 5
+
+// DefaultRetryPolicy returns the retry policy used by the state machine unless
+// otherwise specified.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  1 + defaultMaxRetries,
+		InitialDelay: 5 * time.Second,
+		MaxDelay:     5 * time.Minute,
+		Multiplier:   2,
+		Jitter:       0.1,
+	}
+}
+
+// Delay returns the delay before the given retry attempt, where the first retry is 1.
+func (rp RetryPolicy) Delay(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	multiplier := rp.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(rp.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if rp.MaxDelay > 0 && delay > float64(rp.MaxDelay) {
+		delay = float64(rp.MaxDelay)
+	}
+	if rp.Jitter > 0 {
+		delay += delay * rp.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// HasRetryPolicy is an interface defining a State that declares the retry policy
+// used when it fails, in place of the state machine's default policy.
+type HasRetryPolicy interface {
+	RetryPolicy() RetryPolicy
+}
+
+// RetryState defines a state operation that is retried according to a given policy.
+type RetryState struct {
+	policy RetryPolicy
+	state  State
+}
+
+// NewRetryState returns a State instance that invokes the given state operation,
+// retrying it according to the given policy if it fails.
+func NewRetryState(state State, policy RetryPolicy) *RetryState {
+	return &RetryState{
+		policy: policy,
+		state:  state,
+	}
+}
+
+// Do implements the State interface.
+func (rs *RetryState) Do(ctx context.Context) (States, error) {
+	return rs.state.Do(ctx)
+}
+
+// RetryPolicy implements the HasRetryPolicy interface.
+func (rs *RetryState) RetryPolicy() RetryPolicy {
+	return rs.policy
+}
+
+// retryPolicyOf returns the retry policy declared by the given state, if any.
+func retryPolicyOf(st State) (RetryPolicy, bool) {
+	switch s := st.(type) {
+	case *AfterState:
+		return retryPolicyOf(s.state)
+	case AfterState:
+		return retryPolicyOf(s.state)
+	case HasRetryPolicy:
+		return s.RetryPolicy(), true
+	case *StepState:
+		return retryPolicyOf(s.state)
+	}
+	return RetryPolicy{}, false
+}
+
+// WithRetryPolicy sets the default retry policy for options.
+func WithRetryPolicy(policy RetryPolicy) func(*Options) {
+	return func(op *Options) {
+		op.RetryPolicy = policy
+	}
+}
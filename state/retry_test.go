@@ -0,0 +1,47 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: 5 * time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+	}
+
+	expected := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, exp := range expected {
+		if delay := policy.Delay(i + 1); delay != exp {
+			t.Errorf("Expected delay %v for retry %d, got %v", exp, i+1, delay)
+		}
+	}
+
+	policy.Multiplier = 0
+	if delay := policy.Delay(3); delay != 5*time.Second {
+		t.Errorf("Expected constant delay without a multiplier, got %v", delay)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		if delay := policy.Delay(1); delay < 5*time.Second || delay > 7500*time.Millisecond {
+			t.Errorf("Expected jittered delay within 50%% of 5s, got %v", delay)
+		}
+	}
+}
+
+func TestRetryPolicyOf(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2}
+	st := NewErrorState(nil)
+
+	if _, ok := retryPolicyOf(st); ok {
+		t.Errorf("Expected no retry policy for plain state")
+	}
+
+	wrapped := NewAfterState(time.Now(), NewStepState("step", NewRetryState(st, policy), nil))
+	if p, ok := retryPolicyOf(wrapped); !ok || p != policy {
+		t.Errorf("Expected retry policy of wrapped state, got %+v", p)
+	}
+}
@@ -2,6 +2,10 @@ package state
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 	"time"
 )
 
@@ -67,8 +71,11 @@ type HasAfter interface {
 }
 
 // AfterState defines a state operation that is invoked after a given duration.
+// If created by After the duration is retained so that the state machine can
+// resolve it against its clock when the state is scheduled.
 type AfterState struct {
 	t     time.Time
+	d     time.Duration
 	state State
 }
 
@@ -90,6 +97,15 @@ func NewAfterState(t time.Time, state State) *AfterState {
 	}
 }
 
+// newDelayState returns a State instance that invokes the given state operation once the
+// given duration has elapsed after the state is scheduled. The time reported by After is
+// relative to the system time until the machine resolves it against its own clock.
+func newDelayState(d time.Duration, state State) *AfterState {
+	as := NewAfterState(time.Now().UTC().Add(d), state)
+	as.d = d
+	return as
+}
+
 // Do implements the State interface.
 func (as AfterState) Do(ctx context.Context) (States, error) {
 	return as.state.Do(ctx)
@@ -109,7 +125,24 @@ func NewErrorState(err error) StateFunc {
 
 // After performs the state function after a given duration.
 func After(d time.Duration, state State) (States, error) {
-	return Single(NewAfterState(time.Now().UTC().Add(d), state))
+	return Single(newDelayState(d, state))
+}
+
+// Name returns a descriptive name of the given state. Steps are named by their step ID
+// and state functions by the name of the function that created them.
+func Name(st State) string {
+	switch s := st.(type) {
+	case *AfterState:
+		return Name(s.state)
+	case AfterState:
+		return Name(s.state)
+	case HasStep:
+		return s.StepID()
+	case StateFunc:
+		name := runtime.FuncForPC(reflect.ValueOf(s).Pointer()).Name()
+		return name[strings.LastIndex(name, "/")+1:]
+	}
+	return fmt.Sprintf("%T", st)
 }
 
 // None returns a state that has no additional operations.
@@ -0,0 +1,196 @@
+// Package statetest provides a harness for deterministically testing flows
+// implemented on the state machine.
+package statetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nearmap/cvmanager/state"
+	"github.com/pkg/errors"
+)
+
+// FakeClock implements the state.Clock interface with a time that only changes
+// when explicitly advanced.
+type FakeClock struct {
+	sync.Mutex
+
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	t  time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+	}
+}
+
+// Now implements the state.Clock interface.
+func (fc *FakeClock) Now() time.Time {
+	fc.Lock()
+	defer fc.Unlock()
+	return fc.now
+}
+
+// After implements the state.Clock interface. The returned channel receives
+// once the clock has been advanced by the given duration.
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	fc.Lock()
+	defer fc.Unlock()
+
+	ch := make(chan time.Time, 1)
+	t := fc.now.Add(d)
+	if d <= 0 {
+		ch <- fc.now
+	} else {
+		fc.waiters = append(fc.waiters, waiter{t: t, ch: ch})
+	}
+	return ch
+}
+
+// Advance moves the clock forward by the given duration.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.Set(fc.Now().Add(d))
+}
+
+// Set sets the clock to the given time, notifying any waiters that are due.
+func (fc *FakeClock) Set(t time.Time) {
+	fc.Lock()
+	defer fc.Unlock()
+
+	fc.now = t
+
+	var waiters []waiter
+	for _, w := range fc.waiters {
+		if !w.t.After(t) {
+			w.ch <- t
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	fc.waiters = waiters
+}
+
+// Record describes a state executed by the state machine.
+type Record struct {
+	// State is the name of the executed state as returned by state.Name.
+	State string
+
+	// Time is the time of the fake clock when the state was executed.
+	Time time.Time
+
+	// Err is the error returned by the state, if any.
+	Err error
+}
+
+// Harness drives a state machine synchronously using a fake clock and
+// records the states it executes.
+type Harness struct {
+	sync.Mutex
+
+	Machine *state.Machine
+	Clock   *FakeClock
+
+	records   []Record
+	completed int
+}
+
+// New returns a harness for a state machine with the given start state and options.
+// The machine begins an operation immediately rather than after the start wait time.
+func New(start state.State, options ...func(*state.Options)) *Harness {
+	h := &Harness{
+		Clock: NewFakeClock(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+
+	opts := []func(*state.Options){state.WithStartWaitTime(0)}
+	opts = append(opts, options...)
+	opts = append(opts, state.WithClock(h.Clock), state.WithObserver(h))
+	h.Machine = state.NewMachine(start, opts...)
+
+	return h
+}
+
+// Executed implements the state.Observer interface.
+func (h *Harness) Executed(ctx context.Context, st state.State, err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.records = append(h.records, Record{
+		State: state.Name(st),
+		Time:  h.Clock.Now(),
+		Err:   err,
+	})
+}
+
+// Completed implements the state.Observer interface.
+func (h *Harness) Completed(ctx context.Context) {
+	h.Lock()
+	defer h.Unlock()
+	h.completed++
+}
+
+// Records returns the states executed so far.
+func (h *Harness) Records() []Record {
+	h.Lock()
+	defer h.Unlock()
+	return append([]Record(nil), h.records...)
+}
+
+// States returns the names of the states executed so far.
+func (h *Harness) States() []string {
+	var names []string
+	for _, r := range h.Records() {
+		names = append(names, r.State)
+	}
+	return names
+}
+
+// Step executes the operations that are currently due, advancing the clock to the
+// next scheduled operation if none are. Returns false if no operations are scheduled.
+func (h *Harness) Step() bool {
+	if h.Machine.Step() > 0 {
+		return true
+	}
+
+	next, ok := h.Machine.NextDue()
+	if !ok {
+		return false
+	}
+	if next.After(h.Clock.Now()) {
+		h.Clock.Set(next)
+	}
+	h.Machine.Step()
+	return true
+}
+
+// RunOperation schedules an operation and steps the machine until the operation
+// group completes, executing at most the given number of steps.
+func (h *Harness) RunOperation(maxSteps int) error {
+	h.Lock()
+	completed := h.completed
+	h.Unlock()
+
+	if _, ok := h.Machine.NextDue(); !ok {
+		h.Machine.Schedule()
+	}
+
+	for i := 0; i < maxSteps; i++ {
+		h.Lock()
+		done := h.completed > completed
+		h.Unlock()
+		if done {
+			return nil
+		}
+
+		if !h.Step() {
+			return errors.New("no operations are scheduled")
+		}
+	}
+	return errors.Errorf("operation did not complete within %d steps", maxSteps)
+}
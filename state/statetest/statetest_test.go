@@ -0,0 +1,152 @@
+package statetest_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
+	"github.com/pkg/errors"
+)
+
+func TestHarnessRetries(t *testing.T) {
+	var attempts int
+	flaky := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		attempts++
+		if attempts < 3 {
+			return state.Error(errors.New("transient"))
+		}
+		return state.None()
+	})
+
+	h := statetest.New(flaky, state.WithRetryPolicy(state.RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: 5 * time.Second,
+		Multiplier:   2,
+	}))
+	start := h.Clock.Now()
+
+	if err := h.RunOperation(10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records := h.Records()
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 executions, got %d", len(records))
+	}
+	expected := []time.Duration{0, 5 * time.Second, 15 * time.Second}
+	for i, r := range records {
+		if r.Time.Sub(start) != expected[i] {
+			t.Errorf("Expected attempt %d at %v, got %v", i+1, expected[i], r.Time.Sub(start))
+		}
+		if (r.Err != nil) != (i < 2) {
+			t.Errorf("Unexpected error for attempt %d: %v", i+1, r.Err)
+		}
+	}
+}
+
+func TestHarnessRetryPolicy(t *testing.T) {
+	var attempts int
+	var failure error
+	throttled := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		attempts++
+		if attempts%2 == 1 {
+			return state.Error(state.NewRateLimited(errors.New("throttled"), time.Minute))
+		}
+		return state.Error(errors.New("transient"))
+	})
+	onFailure := state.OnFailureFunc(func(ctx context.Context, err error) {
+		failure = err
+	})
+
+	policy := state.RetryPolicy{
+		MaxAttempts:  2,
+		InitialDelay: time.Second,
+	}
+	h := statetest.New(state.WithFailure(state.NewRetryState(throttled, policy), onFailure))
+	start := h.Clock.Now()
+
+	if err := h.RunOperation(20); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// rate limited attempts are not counted and wait for the suggested duration
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+	if failure == nil || failure.Error() != "transient" {
+		t.Errorf("Expected failure after maximum attempts, got %v", failure)
+	}
+	if elapsed := h.Clock.Now().Sub(start); elapsed != 2*time.Minute+time.Second {
+		t.Errorf("Expected retries to take 2m1s, got %v", elapsed)
+	}
+}
+
+func TestHarnessDefaultRetries(t *testing.T) {
+	var attempts int
+	failing := state.StateFunc(func(ctx context.Context) (state.States, error) {
+		attempts++
+		return state.Error(errors.New("transient"))
+	})
+
+	h := statetest.New(failing)
+	if err := h.RunOperation(20); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the first attempt and 5 retries
+	if attempts != 6 {
+		t.Errorf("Expected 6 attempts, got %d", attempts)
+	}
+}
+
+func TestHarnessAfter(t *testing.T) {
+	var invoked []string
+	record := func(name string, next state.State) state.StateFunc {
+		return func(ctx context.Context) (state.States, error) {
+			invoked = append(invoked, name)
+			if next == nil {
+				return state.None()
+			}
+			return state.After(time.Minute, next)
+		}
+	}
+
+	h := statetest.New(state.NewStepState("first", record("first", state.NewStepState("second", record("second", nil), nil)), nil))
+	start := h.Clock.Now()
+
+	if err := h.RunOperation(10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(h.States(), []string{"first", "second"}) {
+		t.Errorf("Expected steps to be recorded, got %v", h.States())
+	}
+	if !reflect.DeepEqual(invoked, []string{"first", "second"}) {
+		t.Errorf("Expected states to be invoked, got %v", invoked)
+	}
+	if h.Clock.Now().Sub(start) != time.Minute {
+		t.Errorf("Expected clock to advance by one minute, got %v", h.Clock.Now().Sub(start))
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	fc := statetest.NewFakeClock(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ch := fc.After(time.Second)
+	fc.Advance(500 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Errorf("Expected timer not to fire before its duration")
+	default:
+	}
+
+	fc.Advance(500 * time.Millisecond)
+	select {
+	case <-ch:
+	default:
+		t.Errorf("Expected timer to fire once its duration elapsed")
+	}
+}
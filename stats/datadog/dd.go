@@ -96,16 +96,24 @@ func (stats *DataDogStats) Duration(duration time.Duration, name string, tags ..
 }
 
 // Gauge generates Gauge
-func (stats *DataDogStats) Gauge(name string, value int64, tags ...string) {
-	err := stats.client.Gauge(name, float64(value), tags, 1.0)
+func (stats *DataDogStats) Gauge(name string, value float64, tags ...string) {
+	err := stats.client.Gauge(name, value, tags, 1.0)
 	if err != nil {
 		glog.Errorf("Error sending %s gauge: %+v", name, err)
 	}
 }
 
+// Timing generates Timing
+func (stats *DataDogStats) Timing(name string, value time.Duration, tags ...string) {
+	err := stats.client.Timing(name, value, tags, 1.0)
+	if err != nil {
+		glog.Errorf("Error sending timing %s: %+v", name, err)
+	}
+}
+
 // Histogram generates Histogram
-func (stats *DataDogStats) Histogram(name string, value int64, tags ...string) {
-	err := stats.client.Histogram(name, float64(value), tags, 1.0)
+func (stats *DataDogStats) Histogram(name string, value float64, tags ...string) {
+	err := stats.client.Histogram(name, value, tags, 1.0)
 	if err != nil {
 		glog.Errorf("Error sending histogram %s: %+v", name, err)
 	}
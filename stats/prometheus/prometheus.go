@@ -0,0 +1,307 @@
+// Package prometheus provides stats that are exposed to prometheus in its text format.
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// infoLabel is the label of info metrics that holds the value being described. Setting
+	// an info metric replaces any series that differs from it only by this label.
+	infoLabel = "version"
+
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultBuckets are the histogram buckets, in seconds, which cover both
+	// registry calls and rollouts.
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// series is a metric with a specific set of label values.
+type series struct {
+	labels map[string]string
+
+	value float64
+
+	// histogram values
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	name   string
+	typ    metricType
+	series map[string]*series
+}
+
+// PrometheusStats implements the Stats interface and serves the captured stats to
+// prometheus. Dotted stat names are converted to prometheus conventions and tags of the
+// form key:value become labels.
+type PrometheusStats struct {
+	sync.Mutex
+
+	namespace string
+	families  map[string]*family
+}
+
+// New returns a PrometheusStats instance whose metric names are prefixed with the
+// given namespace.
+func New(namespace string) *PrometheusStats {
+	glog.V(1).Infof("Serving prometheus stats with namespace %s", namespace)
+	return &PrometheusStats{
+		namespace: namespace,
+		families:  make(map[string]*family),
+	}
+}
+
+// IncCount increments the counter with the given name.
+func (ps *PrometheusStats) IncCount(name string, tags ...string) {
+	ps.update(ps.metricName(name, "_total"), counterType, tags, func(s *series) {
+		s.value++
+	})
+}
+
+// ServiceCheck sets a gauge with the status of the service.
+func (ps *PrometheusStats) ServiceCheck(name, mesg string, status int, timestamp time.Time, tags ...string) {
+	ps.Gauge(fmt.Sprintf("%s.status", name), float64(status), tags...)
+}
+
+// Event logs the event, as events are not exposed to prometheus.
+func (ps *PrometheusStats) Event(title, mesg, aggKey, typ string, timestamp time.Time, tags ...string) {
+	glog.V(4).Infof("Stats: Event %s of type %s is received with message %s @ time %s, tags are %s",
+		title, typ, mesg, timestamp.String(), tags)
+}
+
+// Gauge sets the gauge with the given name to the value.
+func (ps *PrometheusStats) Gauge(name string, value float64, tags ...string) {
+	metric := ps.metricName(name, "")
+	ps.update(metric, gaugeType, tags, func(s *series) {
+		s.value = value
+	})
+	if strings.HasSuffix(metric, "_info") {
+		ps.replaceInfo(metric, labelsOf(tags))
+	}
+}
+
+// Histogram adds the value to the histogram with the given name.
+func (ps *PrometheusStats) Histogram(name string, value float64, tags ...string) {
+	ps.update(ps.metricName(name, ""), histogramType, tags, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(DefaultBuckets))
+		}
+		for i, b := range DefaultBuckets {
+			if value <= b {
+				s.counts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+// Timing adds the duration in seconds to the histogram with the given name, which
+// is suffixed with _seconds.
+func (ps *PrometheusStats) Timing(name string, value time.Duration, tags ...string) {
+	if !strings.HasSuffix(name, "_seconds") {
+		name += "_seconds"
+	}
+	ps.Histogram(name, value.Seconds(), tags...)
+}
+
+// Handler returns a handler that serves the stats in the prometheus text format.
+func (ps *PrometheusStats) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if err := ps.Write(w); err != nil {
+			glog.Errorf("Failed to write prometheus stats: %v", err)
+		}
+	})
+}
+
+// Write writes the stats to the writer in the prometheus text format.
+func (ps *PrometheusStats) Write(w io.Writer) error {
+	ps.Lock()
+	defer ps.Unlock()
+
+	names := make([]string, 0, len(ps.families))
+	for name := range ps.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := ps.families[name]
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ); err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			var err error
+			switch f.typ {
+			case histogramType:
+				err = writeHistogram(w, f.name, s)
+			default:
+				_, err = fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(s.labels, "", ""), formatValue(s.value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeHistogram(w io.Writer, name string, s *series) error {
+	for i, b := range DefaultBuckets {
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatValue(b)), s.counts[i])
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(s.labels, "", ""), formatValue(s.sum)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(s.labels, "", ""), s.count)
+	return err
+}
+
+// update applies the function to the series of the named metric with the labels of the given tags.
+func (ps *PrometheusStats) update(name string, typ metricType, tags []string, fn func(s *series)) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	f, ok := ps.families[name]
+	if !ok {
+		f = &family{name: name, typ: typ, series: make(map[string]*series)}
+		ps.families[name] = f
+	} else if f.typ != typ {
+		glog.Errorf("Stats: ignoring %s metric %s which is already a %s metric", typ, name, f.typ)
+		return
+	}
+
+	labels := labelsOf(tags)
+	key := formatLabels(labels, "", "")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: labels}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// replaceInfo removes the series of the info metric that have the same labels as those given,
+// other than the info label.
+func (ps *PrometheusStats) replaceInfo(name string, labels map[string]string) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	f := ps.families[name]
+	for key, s := range f.series {
+		if s.labels[infoLabel] == labels[infoLabel] || len(s.labels) != len(labels) {
+			continue
+		}
+		same := true
+		for k, v := range labels {
+			if k != infoLabel && s.labels[k] != v {
+				same = false
+				break
+			}
+		}
+		if same {
+			delete(f.series, key)
+		}
+	}
+}
+
+// metricName returns the prometheus name of the given stat name, prefixed with the
+// namespace and with the given suffix if it does not already have it.
+func (ps *PrometheusStats) metricName(name, suffix string) string {
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if ps.namespace != "" {
+		name = fmt.Sprintf("%s_%s", invalidNameChars.ReplaceAllString(ps.namespace, "_"), name)
+	}
+	if !strings.HasSuffix(name, suffix) {
+		name += suffix
+	}
+	return name
+}
+
+// labelsOf returns the labels of the given tags. Tags of the form key:value become
+// a label with that key and value, and other tags a label with the value "true".
+func labelsOf(tags []string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		parts := strings.SplitN(tag, ":", 2)
+		key := invalidNameChars.ReplaceAllString(parts[0], "_")
+		if len(parts) == 2 {
+			labels[key] = parts[1]
+		} else {
+			labels[key] = "true"
+		}
+	}
+	return labels
+}
+
+// formatLabels formats the labels, along with the extra label if its name is not empty.
+func formatLabels(labels map[string]string, extraName, extraValue string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, labelValueEscaper.Replace(labels[k])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, labelValueEscaper.Replace(extraValue)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("{%s}", strings.Join(parts, ","))
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusStats(t *testing.T) {
+	ps := New("cvmanager")
+
+	ps.IncCount("rollouts_total", "cv:app", "status:success")
+	ps.IncCount("rollouts_total", "cv:app", "status:success")
+	ps.IncCount("crsyn.app.sync.success")
+	ps.Gauge("version_info", 1, "cv:app", "version:abc")
+	ps.Gauge("version_info", 1, "cv:app", "version:def")
+	ps.Gauge("version_info", 1, "cv:other", "version:abc")
+	ps.Histogram("rollout_duration_seconds", 42, "cv:app")
+	ps.Timing("state_duration", 1500*time.Millisecond, "state:deploy")
+
+	var buf bytes.Buffer
+	if err := ps.Write(&buf); err != nil {
+		t.Fatalf("failed to write stats: %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE cvmanager_rollouts_total counter\n",
+		`cvmanager_rollouts_total{cv="app",status="success"} 2` + "\n",
+		"cvmanager_crsyn_app_sync_success_total 1\n",
+		"# TYPE cvmanager_version_info gauge\n",
+		`cvmanager_version_info{cv="app",version="def"} 1` + "\n",
+		`cvmanager_version_info{cv="other",version="abc"} 1` + "\n",
+		"# TYPE cvmanager_rollout_duration_seconds histogram\n",
+		`cvmanager_rollout_duration_seconds_bucket{cv="app",le="30"} 0` + "\n",
+		`cvmanager_rollout_duration_seconds_bucket{cv="app",le="60"} 1` + "\n",
+		`cvmanager_rollout_duration_seconds_bucket{cv="app",le="+Inf"} 1` + "\n",
+		`cvmanager_rollout_duration_seconds_sum{cv="app"} 42` + "\n",
+		`cvmanager_rollout_duration_seconds_count{cv="app"} 1` + "\n",
+		"# TYPE cvmanager_state_duration_seconds histogram\n",
+		`cvmanager_state_duration_seconds_sum{state="deploy"} 1.5` + "\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q, got:\n%s", e, out)
+		}
+	}
+	if strings.Contains(out, `cvmanager_version_info{cv="app",version="abc"}`) {
+		t.Errorf("expected replaced version info to be removed, got:\n%s", out)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	ps := New("")
+	ps.IncCount("syncs_total", `cv:a"b`)
+
+	w := httptest.NewRecorder()
+	ps.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), `syncs_total{cv="a\"b"} 1`) {
+		t.Errorf("unexpected body:\n%s", w.Body.String())
+	}
+}
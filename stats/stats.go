@@ -20,6 +20,16 @@ type Stats interface {
 	// Event contains details of an activity that was captured and
 	// notifies it to stats backend
 	Event(title, mesg, aggKey, typ string, timestamp time.Time, tags ...string)
+
+	// Gauge captures the current value of a stat (identified by name)
+	Gauge(name string, value float64, tags ...string)
+
+	// Timing captures the duration of an activity (identified by name)
+	Timing(name string, value time.Duration, tags ...string)
+
+	// Histogram captures a value of a stat (identified by name) whose distribution
+	// is of interest
+	Histogram(name string, value float64, tags ...string)
 }
 
 // FakeStats implements Stats interface wherein for instead of sending the stats
@@ -49,3 +59,18 @@ func (fs *FakeStats) Event(title, mesg, aggKey, typ string, timestamp time.Time,
 	glog.V(4).Infof("Stats: Event %s of type %s is received with message %s @ time %s, tags are %s",
 		title, typ, mesg, timestamp.String(), tags)
 }
+
+// Gauge logs the value of the gauge
+func (fs *FakeStats) Gauge(name string, value float64, tags ...string) {
+	glog.V(4).Infof("Stats: Gauge %s is %v, tags are %s", name, value, tags)
+}
+
+// Timing logs the duration of the timing
+func (fs *FakeStats) Timing(name string, value time.Duration, tags ...string) {
+	glog.V(4).Infof("Stats: Timing %s is %s, tags are %s", name, value, tags)
+}
+
+// Histogram logs the value of the histogram
+func (fs *FakeStats) Histogram(name string, value float64, tags ...string) {
+	glog.V(4).Infof("Stats: Histogram %s is %v, tags are %s", name, value, tags)
+}
@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"encoding/json"
+
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CheckpointAnnotation is the ContainerVersion annotation holding the checkpoint
+	// of an in-flight sync operation.
+	CheckpointAnnotation = "cvmanager/checkpoint"
+)
+
+// annotationCheckpointer implements the state.Checkpointer interface by storing
+// checkpoints as an annotation on the ContainerVersion resource.
+type annotationCheckpointer struct {
+	k8sProvider *k8s.Provider
+	cvName      string
+}
+
+// Save implements the state.Checkpointer interface.
+func (ac *annotationCheckpointer) Save(cp *state.Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode checkpoint")
+	}
+
+	return errors.WithStack(ac.k8sProvider.SetCVAnnotation(ac.cvName, CheckpointAnnotation, string(data)))
+}
+
+// Load implements the state.Checkpointer interface.
+func (ac *annotationCheckpointer) Load() (*state.Checkpoint, error) {
+	cv, err := ac.k8sProvider.CV(ac.cvName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data, ok := cv.Annotations[CheckpointAnnotation]
+	if !ok || data == "" {
+		return nil, nil
+	}
+
+	var cp state.Checkpoint
+	if err := json.Unmarshal([]byte(data), &cp); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode checkpoint of cv %s", ac.cvName)
+	}
+	return &cp, nil
+}
+
+// Clear implements the state.Checkpointer interface.
+func (ac *annotationCheckpointer) Clear() error {
+	return errors.WithStack(ac.k8sProvider.SetCVAnnotation(ac.cvName, CheckpointAnnotation, ""))
+}
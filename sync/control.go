@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/events"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/pkg/errors"
+	"goji.io/pat"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// PausedAnnotation is the ContainerVersion annotation that pauses in-flight rollouts
+	// at their next step when set to "true".
+	PausedAnnotation = "cvmanager/paused"
+
+	// AbortAnnotation is the ContainerVersion annotation that requests the in-flight
+	// rollout to be aborted. It is removed by the syncer once the rollout is aborted.
+	AbortAnnotation = "cvmanager/abort"
+
+	// controlPollInterval is the interval at which the syncer checks the control annotations.
+	controlPollInterval = 10 * time.Second
+)
+
+// Control actions that can be applied to the rollouts of a ContainerVersion.
+const (
+	ControlPause  = "pause"
+	ControlResume = "resume"
+	ControlAbort  = "abort"
+)
+
+// Control applies the given control action to the rollouts of the named ContainerVersion
+// by setting the corresponding annotation, which is acted upon by its syncer.
+func Control(k8sProvider *k8s.Provider, cvName, action string) error {
+	var err error
+	switch action {
+	case ControlPause:
+		err = k8sProvider.SetCVAnnotation(cvName, PausedAnnotation, "true")
+	case ControlResume:
+		err = k8sProvider.SetCVAnnotation(cvName, PausedAnnotation, "")
+	case ControlAbort:
+		err = k8sProvider.SetCVAnnotation(cvName, AbortAnnotation, time.Now().UTC().Format(time.RFC3339))
+	default:
+		return errors.Errorf("unknown control action %s", action)
+	}
+	return errors.Wrapf(err, "failed to %s rollouts of cv %s", action, cvName)
+}
+
+// NewControlHandler is a web handler that applies control actions to the rollouts
+// of a ContainerVersion. ContainerVersions outside the namespaces and label selector
+// of the provider are not found.
+func NewControlHandler(k8sProvider *k8s.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := pat.Param(r, "name")
+		action := pat.Param(r, "action")
+		ns := r.URL.Query().Get("namespace")
+		if ns == "" {
+			ns = "default"
+		}
+
+		switch action {
+		case ControlPause, ControlResume, ControlAbort:
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if !k8sProvider.WatchesNamespace(ns) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		provider := k8sProvider.InNamespace(ns)
+		err := func() error {
+			cv, err := provider.CV(name)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			ok, err := provider.InScope(cv)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if !ok {
+				return k8serr.NewNotFound(cv1.Resource("containerversion"), name)
+			}
+			return Control(provider, name, action)
+		}()
+		if err != nil {
+			glog.Errorf("Failed to %s rollouts of cv %s/%s: %v", action, ns, name, err)
+			if k8serr.IsNotFound(errors.Cause(err)) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// watchControls polls the control annotations of the syncer's ContainerVersion
+// and pauses, resumes or aborts the state machine accordingly.
+func (s *Syncer) watchControls() {
+	for {
+		s.applyControls()
+
+		select {
+		case <-time.After(controlPollInterval):
+		case <-s.controlStop:
+			return
+		}
+	}
+}
+
+// applyControls applies the control annotations of the syncer's ContainerVersion to the state machine.
+func (s *Syncer) applyControls() {
+	cv, err := s.k8sProvider.CV(s.cv.Name)
+	if err != nil {
+		glog.Errorf("Failed to get cv %s for rollout controls: %v", s.cv.Name, err)
+		return
+	}
+
+	paused := cv.Annotations[PausedAnnotation] == "true"
+	if paused && !s.machine.Paused() {
+		s.machine.Pause()
+		s.options.Recorder.Event(events.Normal, events.ReasonRolloutPaused, "Rollouts paused")
+	} else if !paused && s.machine.Paused() {
+		s.machine.Resume()
+		s.options.Recorder.Event(events.Normal, events.ReasonRolloutResumed, "Rollouts resumed")
+	}
+
+	if _, ok := cv.Annotations[AbortAnnotation]; ok {
+		s.machine.Abort()
+		s.options.Recorder.Event(events.Warning, events.ReasonRolloutAborted, "Rollout in progress aborted")
+		if err := s.k8sProvider.SetCVAnnotation(s.cv.Name, AbortAnnotation, ""); err != nil {
+			glog.Errorf("Failed to remove abort annotation of cv %s: %v", s.cv.Name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nearmap/cvmanager/config"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	customfake "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	goji "goji.io"
+	"goji.io/pat"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestControlHandler(t *testing.T) {
+	cvcs := customfake.NewSimpleClientset(
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a", Labels: map[string]string{"team": "a"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team-a", Labels: map[string]string{"team": "b"}}},
+		&cv1.ContainerVersion{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-b", Labels: map[string]string{"team": "a"}}},
+	)
+	k8sProvider := k8s.NewProvider(fake.NewSimpleClientset(), cvcs, "",
+		config.WithNamespaces([]string{"team-a"}), config.WithCVLabelSelector("team=a"))
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Post("/v1/cv/:name/:action"), NewControlHandler(k8sProvider))
+
+	var tests = []struct {
+		message   string
+		path      string
+		namespace string
+		name      string
+		expected  int
+	}{
+		{"in scope", "/v1/cv/app/pause?namespace=team-a", "team-a", "app", http.StatusAccepted},
+		{"other namespace", "/v1/cv/app/pause?namespace=team-b", "team-b", "app", http.StatusNotFound},
+		{"other labels", "/v1/cv/other/pause?namespace=team-a", "team-a", "other", http.StatusNotFound},
+		{"missing", "/v1/cv/missing/pause?namespace=team-a", "", "", http.StatusNotFound},
+		{"unknown action", "/v1/cv/app/stop?namespace=team-a", "", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", test.path, nil))
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.message, test.expected, w.Code)
+		}
+		if test.name == "" {
+			continue
+		}
+
+		cv, err := cvcs.CustomV1().ContainerVersions(test.namespace).Get(test.name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: failed to get cv: %v", test.message, err)
+		}
+		if paused := cv.Annotations[PausedAnnotation] == "true"; paused != (test.expected == http.StatusAccepted) {
+			t.Errorf("%s: expected paused annotation to be set only for cvs in scope, got %v", test.message, paused)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/state"
+)
+
+const (
+	// DefaultPort is the port on which the syncer serves its operations endpoint.
+	DefaultPort = 8090
+
+	// OperationsPath is the path of the syncer's operations endpoint.
+	OperationsPath = "/v1/operations"
+)
+
+// Operations returns the sync operations in progress or scheduled.
+func (s *Syncer) Operations() []state.Operation {
+	return s.machine.Operations()
+}
+
+// NewOperationsHandler is web handler to return the sync operations of the given syncer as json.
+func NewOperationsHandler(s *Syncer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(s.Operations())
+		if err != nil {
+			glog.Errorf("Failed to encode operations: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
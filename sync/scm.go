@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/events"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/scm"
+	"github.com/pkg/errors"
+)
+
+// scmDeployment is the scm deployment of a version, whose status aggregates the status
+// of the rollout of the version to each of the workloads of the cv.
+type scmDeployment struct {
+	version string
+	id      string
+	status  string
+
+	// workloads maps the names of the workloads being rolled out to their status, which
+	// is empty until the rollout of the workload reports one.
+	workloads map[string]string
+}
+
+// aggregate returns the status of the deployment for the statuses of its workloads. The
+// deployment fails once any workload fails, and succeeds once all of them succeed.
+func (d *scmDeployment) aggregate() string {
+	var pending, succeeded int
+	for _, status := range d.workloads {
+		switch status {
+		case scm.StatusFailure:
+			return scm.StatusFailure
+		case scm.StatusSuccess:
+			succeeded++
+		case scm.StatusPending, "":
+			pending++
+		}
+	}
+	switch {
+	case succeeded == len(d.workloads):
+		return scm.StatusSuccess
+	case pending == len(d.workloads):
+		return scm.StatusPending
+	}
+	return scm.StatusInProgress
+}
+
+// names returns the sorted names of the workloads of the deployment.
+func (d *scmDeployment) names() []string {
+	var names []string
+	for name := range d.workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// trackDeployment sets the workloads that the given version is being rolled out to,
+// whose statuses determine the status of the scm deployment of the version.
+func (s *Syncer) trackDeployment(version string, workloads []k8s.Workload) {
+	if s.deployment == nil || s.deployment.version != version {
+		s.deployment = &scmDeployment{version: version}
+	}
+	s.deployment.workloads = make(map[string]string)
+	for _, wl := range workloads {
+		s.deployment.workloads[wl.Name()] = ""
+	}
+}
+
+// deploymentStatus records the status of the rollout of the given version to the named
+// workload, and sets the status of the scm deployment of the version if that changes
+// its aggregate status, creating the deployment if required. Failures to update the
+// deployment do not affect the rollout.
+func (s *Syncer) deploymentStatus(ctx context.Context, version, workload, status, description string) {
+	spec := s.cv.Spec.SCM
+	if spec == nil {
+		return
+	}
+
+	d := s.deployment
+	if d == nil || d.version != version {
+		d = &scmDeployment{version: version, workloads: make(map[string]string)}
+		s.deployment = d
+	}
+	d.workloads[workload] = status
+	status = d.aggregate()
+	if status == d.status {
+		return
+	}
+	if status == scm.StatusSuccess {
+		description = fmt.Sprintf("Rolled out %s", strings.Join(d.names(), ", "))
+	}
+
+	err := func() error {
+		deployments, err := scm.ForSpec(s.k8sProvider.Client(), s.k8sProvider.Namespace(), spec)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		env := scm.Environment(s.cv)
+
+		if d.id == "" {
+			if d.id, err = deployments.Find(ctx, version, env); err != nil {
+				return errors.Wrapf(err, "failed to find deployment of %s", version)
+			}
+		}
+		if d.id == "" {
+			if d.id, err = deployments.Create(ctx, version, env, fmt.Sprintf("Rollout of %s by cv %s", version, s.cv.Name)); err != nil {
+				return errors.Wrapf(err, "failed to create deployment of %s", version)
+			}
+		}
+
+		return errors.Wrapf(deployments.SetStatus(ctx, d.id, env, status, description),
+			"failed to set status of deployment %s", d.id)
+	}()
+	if err != nil {
+		glog.Errorf("Failed to set %s deployment status %s for cv %s version %s: %v", spec.Kind, status, s.cv.Name, version, err)
+		s.recorder(ctx).Eventf(events.Warning, events.ReasonDeploymentStatusFailed, "Failed to set %s deployment status %s: %v", spec.Kind, status, err)
+		return
+	}
+	d.status = status
+}
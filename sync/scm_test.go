@@ -0,0 +1,29 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/nearmap/cvmanager/scm"
+)
+
+func TestSCMDeploymentAggregate(t *testing.T) {
+	var tests = []struct {
+		message   string
+		workloads map[string]string
+		expected  string
+	}{
+		{"not started", map[string]string{"app": "", "worker": ""}, scm.StatusPending},
+		{"verifying", map[string]string{"app": scm.StatusPending, "worker": ""}, scm.StatusPending},
+		{"rolling out", map[string]string{"app": scm.StatusInProgress, "worker": scm.StatusPending}, scm.StatusInProgress},
+		{"partly rolled out", map[string]string{"app": scm.StatusSuccess, "worker": ""}, scm.StatusInProgress},
+		{"rolled out", map[string]string{"app": scm.StatusSuccess, "worker": scm.StatusSuccess}, scm.StatusSuccess},
+		{"failed", map[string]string{"app": scm.StatusSuccess, "worker": scm.StatusFailure}, scm.StatusFailure},
+	}
+
+	for _, test := range tests {
+		d := &scmDeployment{workloads: test.workloads}
+		if status := d.aggregate(); status != test.expected {
+			t.Errorf("%s: expected status %s, got %s", test.message, test.expected, status)
+		}
+	}
+}
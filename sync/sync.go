@@ -3,22 +3,28 @@ package sync
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/nearmap/cvmanager/config"
 	"github.com/nearmap/cvmanager/deploy"
 	"github.com/nearmap/cvmanager/events"
+	"github.com/nearmap/cvmanager/gitops"
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	k8s "github.com/nearmap/cvmanager/gok8s/workload"
 	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/notify"
 	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/scm"
 	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/nearmap/cvmanager/verify"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // Syncer is responsible for handling the main sync loop.
@@ -29,11 +35,20 @@ type Syncer struct {
 
 	k8sProvider     *k8s.Provider
 	historyProvider history.Provider
+	notifier        *notify.Dispatcher
 
 	registry         registry.Registry // provides version information for the current cv resource
 	registryProvider registry.Provider // used to obtain version information for other registry resoures
 
 	options *config.Options
+
+	// deferred is the most recent version whose deferral was recorded in history.
+	deferred string
+
+	// deployment is the scm deployment of the most recently deployed version.
+	deployment *scmDeployment
+
+	controlStop chan struct{}
 }
 
 // NewSyncer creates a Syncer instance for handling the main sync loop.
@@ -64,19 +79,59 @@ func NewSyncer(k8sProvider *k8s.Provider, cv *cv1.ContainerVersion, registryProv
 		registryProvider: registryProvider,
 		registry:         registry,
 		historyProvider:  hp,
+		notifier:         notify.NewDispatcher(k8sProvider.Client(), k8sProvider.Namespace(), opts.Stats),
 		options:          opts,
+		controlStop:      make(chan struct{}),
 	}
-	s.machine = state.NewMachine(s.initialState(), state.WithStartWaitTime(dur), state.WithTimeout(opTimeout))
+	checkpointer := &annotationCheckpointer{k8sProvider: k8sProvider, cvName: cv.Name}
+	s.machine = state.NewMachine(s.initialState(), state.WithStartWaitTime(dur), state.WithTimeout(opTimeout),
+		state.WithCheckpointer(checkpointer), state.WithRetryPolicy(retryPolicy(cv.Spec.Retry)),
+		state.WithStats(opts.Stats), state.WithRecorder(opts.Recorder), state.WithTracer(opts.Tracer))
 	return s, nil
 }
 
+// recorder returns the event recorder for the rollout operation of the given context,
+// which identifies the operation's trace in events. Events are also attached to the
+// given rollout targets.
+func (s *Syncer) recorder(ctx context.Context, targets ...deploy.RolloutTarget) events.Recorder {
+	var objects []runtime.Object
+	for _, target := range targets {
+		objects = append(objects, target.Object())
+	}
+	return tracing.Recorder(ctx, events.ForObjects(s.options.Recorder, objects...))
+}
+
+// retryPolicy returns the default retry policy with any overrides from the given spec.
+func retryPolicy(spec *cv1.RetrySpec) state.RetryPolicy {
+	policy := state.DefaultRetryPolicy()
+	if spec == nil {
+		return policy
+	}
+
+	if spec.MaxAttempts > 0 {
+		policy.MaxAttempts = spec.MaxAttempts
+	}
+	if spec.InitialDelaySeconds > 0 {
+		policy.InitialDelay = time.Duration(spec.InitialDelaySeconds) * time.Second
+	}
+	if spec.MaxDelaySeconds > 0 {
+		policy.MaxDelay = time.Duration(spec.MaxDelaySeconds) * time.Second
+	}
+	if spec.MaxElapsedSeconds > 0 {
+		policy.MaxElapsed = time.Duration(spec.MaxElapsedSeconds) * time.Second
+	}
+	return policy
+}
+
 // Start begins the sync process.
 func (s *Syncer) Start() {
+	go s.watchControls()
 	s.machine.Start()
 }
 
 // Stop shuts down the sync operation.
 func (s *Syncer) Stop() error {
+	close(s.controlStop)
 	return s.machine.Stop()
 }
 
@@ -91,9 +146,11 @@ func (s *Syncer) initialState() state.StateFunc {
 		}
 		s.cv = cv
 
+		s.options.Stats.IncCount("syncs_total", s.statsTags(nil)...)
+
 		version, err := s.registry.Version(ctx, cv.Spec.Tag)
 		if err != nil {
-			s.options.Recorder.Event(events.Warning, "CRSyncFailed", "Failed to get version from registry")
+			s.recorder(ctx).Event(events.Warning, events.ReasonSyncFailed, "Failed to get version from registry")
 			return state.Error(errors.Wrap(err, "failed to get version from registry"))
 		}
 
@@ -101,7 +158,7 @@ func (s *Syncer) initialState() state.StateFunc {
 
 		workloads, err := s.k8sProvider.Workloads(cv)
 		if err != nil {
-			s.options.Recorder.Event(events.Warning, "CRSyncFailed", "Failed to obtain workloads for cv resource")
+			s.recorder(ctx).Event(events.Warning, events.ReasonSyncFailed, "Failed to obtain workloads for cv resource")
 			return state.Error(errors.Wrapf(err, "failed to obtain workloads for cv resource %s", cv.Name))
 		}
 
@@ -109,6 +166,23 @@ func (s *Syncer) initialState() state.StateFunc {
 			glog.V(4).Infof("Not attempting %s rollout of version %s: %+v", cv.Name, version, cv.Status)
 			return state.None()
 		}
+		if version == cv.Status.AdoptedFrom {
+			glog.V(4).Infof("Not attempting %s rollout of version %s superseded by adopted version %s",
+				cv.Name, version, cv.Status.CurrVersion)
+			if s.deferred != version {
+				s.deferred = version
+				for _, wl := range workloads {
+					record := s.historyRecord(ctx, version, wl, history.StatusDeferred)
+					record.PreviousVersion = cv.Status.CurrVersion
+					record.Reason = fmt.Sprintf("superseded by adopted version %s", cv.Status.CurrVersion)
+					s.addRecord(ctx, wl, record)
+				}
+			}
+			return state.None()
+		}
+
+		// Out-of-band changes to workloads are only reverted by the syncer if the drift policy allows it.
+		revertDrift := cv.Spec.DriftPolicy == "" || cv.Spec.DriftPolicy == cv1.DriftPolicyRevert
 
 		var toUpdate []k8s.Workload
 		for _, wl := range workloads {
@@ -123,60 +197,177 @@ func (s *Syncer) initialState() state.StateFunc {
 			if err != nil {
 				return state.Error(errors.Wrapf(err, "failed to check podspec versions for cv resource %s", cv.Name))
 			}
-			if !eq {
-				toUpdate = append(toUpdate, wl)
+			if eq {
+				s.options.Stats.Gauge("version_info", 1, s.statsTags(wl, "version:"+version)...)
+				continue
 			}
+			if !revertDrift && version == cv.Status.CurrVersion && cv.Status.CurrStatus == k8s.StatusSuccess {
+				glog.V(4).Infof("Not reverting drifted workload %s of cv %s with drift policy %s",
+					wl.Name(), cv.Name, cv.Spec.DriftPolicy)
+				continue
+			}
+			toUpdate = append(toUpdate, wl)
 		}
 
 		glog.V(4).Infof("Found %d workloads to update", len(toUpdate))
 
+		if len(toUpdate) > 0 {
+			// discard progress of a resumed operation that was for a different version
+			if prev := state.Data(ctx, "version"); prev != "" && prev != version {
+				glog.V(1).Infof("Discarding checkpoint for version %s of cv %s", prev, cv.Name)
+				state.Reset(ctx)
+			}
+			if state.Data(ctx, "version") != version {
+				state.SetDataMap(ctx, map[string]string{
+					"version":         version,
+					"previousVersion": cv.Status.SuccessVersion,
+					"started":         time.Now().UTC().Format(time.RFC3339),
+				})
+			}
+			s.trackDeployment(version, toUpdate)
+		}
+
 		var states []state.State
 		for _, wl := range toUpdate {
-			st := s.verify(version,
-				s.updateRolloutStatus(version, k8s.StatusProgressing,
-					s.deploy(version, wl,
-						s.successfulDeploymentStats(wl,
-							s.syncVersionConfig(version,
-								s.addHistory(version, wl,
-									s.updateRolloutStatus(version, k8s.StatusSuccess, nil)))))))
-
-			states = append(states, state.WithFailure(st, s.handleFailure(wl, version)))
+			success := s.updateRolloutStatus(version, k8s.StatusSuccess, nil)
+			addHistory := s.step(wl, "addHistory", s.addHistory(version, wl, success), success)
+			writeBack := s.step(wl, "writeBack", s.writeBack(version, addHistory), addHistory)
+			syncVersionConfig := s.step(wl, "syncVersionConfig", s.syncVersionConfig(version, writeBack), writeBack)
+			deployed := s.updateRolloutStatus(version, k8s.StatusProgressing,
+				s.deploy(version, wl,
+					s.successfulDeploymentStats(version, wl, syncVersionConfig)))
+			st := s.step(wl, "verify", s.verify(version, wl, deployed), deployed)
+			started := s.step(wl, "notifyStarted", s.notifyStarted(version, wl, st), st)
+
+			states = append(states, state.WithFailure(started, s.handleFailure(wl, version)))
 		}
 
 		return state.Many(states...)
 	}
 }
 
+// step returns a state for the named step of the sync of the given workload.
+func (s *Syncer) step(workload k8s.Workload, name string, st, next state.State) state.State {
+	return state.NewStepState(fmt.Sprintf("%s.%s", workload.Name(), name), st, next)
+}
+
 // handleFailure is a state invoked when a sync permanently fails. It is responsible for updating
-// the rollout status and generating relevant stats and events.
+// the rollout status and generating relevant stats, events and notifications.
 func (s *Syncer) handleFailure(workload k8s.Workload, version string) state.OnFailureFunc {
 	return func(ctx context.Context, err error) {
 		glog.V(1).Infof("Failed to process container version: version=%v, target=%v, error=%v",
 			version, workload.Name(), err)
 
-		s.options.Stats.Event(fmt.Sprintf("%s.sync.failure", workload.Name()),
+		s.options.Stats.Event("rollout_failure",
 			fmt.Sprintf("Failed to validate image with %s", version), "", "error",
-			time.Now().UTC())
-		s.options.Recorder.Event(events.Warning, "CRSyncFailed", "Failed to deploy the target")
+			time.Now().UTC(), s.statsTags(workload, "version:"+version)...)
 
 		_, uErr := s.k8sProvider.UpdateRolloutStatus(s.cv.Name, version, k8s.StatusFailed, time.Now().UTC())
 		if uErr != nil {
 			glog.Errorf("Failed to update cv %s status as failed rollout for version %s: %v", s.cv.Name, version, uErr)
 			// TODO: something else?
 		}
+
+		record := s.failureRecord(ctx, version, workload, err)
+		s.rolloutStats(workload, record)
+		s.addRecord(ctx, workload, record)
+		s.recorder(ctx, workload).Eventf(events.Warning, failureReason(record.Status), "Failed to roll out %s %s to version %s: %s",
+			workload.Type(), workload.Name(), version, record.Reason)
+
+		eventType := notify.EventFailed
+		if record.Status == history.StatusRolledBack {
+			eventType = notify.EventRolledBack
+		}
+		event := s.notifyEvent(ctx, eventType, version, workload)
+		event.PreviousVersion = record.PreviousVersion
+		event.Message = record.Reason
+		s.notify(ctx, event)
+		s.deploymentStatus(ctx, version, workload.Name(), scm.StatusFailure, fmt.Sprintf("Failed to roll out %s", workload.Name()))
+	}
+}
+
+// failureReason returns the reason of the event recorded for a failed rollout with the
+// given history status.
+func failureReason(status string) string {
+	switch status {
+	case history.StatusRolledBack:
+		return events.ReasonRolledBack
+	case history.StatusVerificationFailed:
+		return events.ReasonVerificationFailed
+	case history.StatusAborted:
+		return events.ReasonRolloutAborted
 	}
+	return events.ReasonRolloutFailed
 }
 
-func (s *Syncer) verify(version string, next state.State) state.StateFunc {
+func (s *Syncer) verify(version string, target deploy.RolloutTarget, next state.State) state.StateFunc {
 	return func(ctx context.Context) (state.States, error) {
 		if version == s.cv.Status.CurrVersion && s.cv.Status.CurrStatus == k8s.StatusProgressing {
 			// we've already run the verify step
 			return state.Single(next)
 		}
 
-		return state.Single(
-			verify.NewVerifiers(s.k8sProvider.Client(), s.registryProvider, s.k8sProvider.Namespace(),
-				version, s.cv.Spec.Container.Verify, next))
+		verified := next
+		if len(s.cv.Spec.Container.Verify) > 0 {
+			verified = s.notifyState(notify.EventVerified, version, target, next)
+		}
+
+		// the image of each repository that the version is rolled out from is verified
+		repos := k8s.ImageRepos(s.cv)
+		for i := len(repos) - 1; i >= 0; i-- {
+			verified = verify.NewVerifiers(s.k8sProvider.Client(), s.registryProvider, s.k8sProvider.Namespace(),
+				repos[i], version, s.cv.Spec.Container.Verify, verified)
+		}
+		return state.Single(verified)
+	}
+}
+
+// notifyStarted notifies the channels and scm deployment of the cv that the rollout of
+// the target to the given version has started, unless the rollout was already in progress.
+func (s *Syncer) notifyStarted(version string, target deploy.RolloutTarget, next state.State) state.StateFunc {
+	return func(ctx context.Context) (state.States, error) {
+		if version == s.cv.Status.CurrVersion && s.cv.Status.CurrStatus == k8s.StatusProgressing {
+			return state.Single(next)
+		}
+		s.recorder(ctx, target).Eventf(events.Normal, events.ReasonRolloutStarted, "Rolling out %s %s to version %s",
+			target.Type(), target.Name(), version)
+		s.deploymentStatus(ctx, version, target.Name(), scm.StatusPending, fmt.Sprintf("Verifying %s", target.Name()))
+		return s.notifyState(notify.EventStarted, version, target, next)(ctx)
+	}
+}
+
+// notifyState returns a state that notifies the channels of the cv of the given event
+// of the rollout of the target to the given version.
+func (s *Syncer) notifyState(eventType, version string, target deploy.RolloutTarget, next state.State) state.StateFunc {
+	return func(ctx context.Context) (state.States, error) {
+		s.notify(ctx, s.notifyEvent(ctx, eventType, version, target))
+		return state.Single(next)
+	}
+}
+
+// notifyEvent returns a notification event of the given type for the rollout of the
+// target to the given version.
+func (s *Syncer) notifyEvent(ctx context.Context, eventType, version string, target deploy.RolloutTarget) *notify.Event {
+	return &notify.Event{
+		Type:            eventType,
+		CV:              s.cv.Name,
+		Namespace:       s.k8sProvider.Namespace(),
+		Workload:        target.Name(),
+		Version:         version,
+		PreviousVersion: state.Data(ctx, "previousVersion"),
+		TraceID:         tracing.TraceID(ctx),
+		Time:            time.Now().UTC(),
+	}
+}
+
+// notify sends the given event to the notification channels of the cv. Failures to notify
+// do not affect the rollout.
+func (s *Syncer) notify(ctx context.Context, event *notify.Event) {
+	if len(s.cv.Spec.Notifications) == 0 {
+		return
+	}
+	if err := s.notifier.Notify(ctx, s.cv.Spec.Notifications, event); err != nil {
+		s.recorder(ctx).Eventf(events.Warning, events.ReasonNotificationFailed, "Failed to send %s notification: %v", event.Type, err)
 	}
 }
 
@@ -193,7 +384,7 @@ func (s *Syncer) updateRolloutStatus(version, status string, next state.State) s
 		cv, err := s.k8sProvider.UpdateRolloutStatus(s.cv.Name, version, status, time.Now().UTC())
 		if err != nil {
 			glog.Errorf("Failed to update Rollout Status status for cv=%s, version=%s, status=%s: %v", s.cv.Name, version, status, err)
-			events.FromContext(ctx).Event(events.Warning, "FailedUpdateRolloutStatus", "Failed to update version status")
+			events.FromContext(ctx).Event(events.Warning, events.ReasonUpdateRolloutStatusFailed, "Failed to update version status")
 			return state.Error(errors.Wrapf(err, "failed to update Rollout status for cv=%s, version=%s, status=%s",
 				s.cv.Name, version, status))
 		}
@@ -209,22 +400,61 @@ func (s *Syncer) deploy(version string, target deploy.RolloutTarget, next state.
 	return func(ctx context.Context) (state.States, error) {
 		glog.V(4).Info("creating new deployer state")
 
+		// the workloads are patched with the tag of the version, so it must still point
+		// to the images whose signatures were verified
+		for _, repo := range k8s.ImageRepos(s.cv) {
+			if err := verify.CheckVerifiedDigest(ctx, s.registryProvider, repo, version, s.cv.Spec.Container.Verify); err != nil {
+				return state.Error(errors.WithStack(err))
+			}
+		}
+
+		s.deploymentStatus(ctx, version, target.Name(), scm.StatusInProgress, fmt.Sprintf("Rolling out %s", target.Name()))
+
 		return state.Single(
 			deploy.NewDeployState(s.k8sProvider.Client(), s.registryProvider, s.k8sProvider.Namespace(), s.cv, version, target, next))
 	}
 }
 
-// successfulDeploymentStats generates stats for a successful rollout.
-func (s *Syncer) successfulDeploymentStats(workload k8s.Workload, next state.State) state.StateFunc {
+// successfulDeploymentStats generates stats, events and notifications for a successful rollout.
+func (s *Syncer) successfulDeploymentStats(version string, workload k8s.Workload, next state.State) state.StateFunc {
 	return func(ctx context.Context) (state.States, error) {
 		glog.V(4).Info("Updating stats for successful deployment")
 
-		s.options.Stats.IncCount(fmt.Sprintf("crsyn.%s.sync.success", workload.Name()))
-		s.options.Recorder.Eventf(events.Normal, "Success", "%s updated completed successfully", workload.Name())
+		s.recorder(ctx, workload).Eventf(events.Normal, events.ReasonRolloutSucceeded, "Rolled out %s %s to version %s", workload.Type(), workload.Name(), version)
+		s.notify(ctx, s.notifyEvent(ctx, notify.EventSucceeded, version, workload))
+		s.deploymentStatus(ctx, version, workload.Name(), scm.StatusSuccess, fmt.Sprintf("Rolled out %s", workload.Name()))
 		return state.Single(next)
 	}
 }
 
+// rolloutStats generates stats for the completed rollout of the target described by the
+// given history record.
+func (s *Syncer) rolloutStats(target deploy.RolloutTarget, record *history.Record) {
+	tags := s.statsTags(target, "status:"+record.Status)
+	s.options.Stats.IncCount("rollouts_total", tags...)
+	switch record.Status {
+	case history.StatusSuccess, history.StatusDeferred:
+	case history.StatusRolledBack:
+		s.options.Stats.IncCount("rollout_failures_total", tags...)
+		s.options.Stats.IncCount("rollbacks_total", s.statsTags(target)...)
+	default:
+		s.options.Stats.IncCount("rollout_failures_total", tags...)
+	}
+	if record.Duration > 0 {
+		s.options.Stats.Timing("rollout_duration", time.Duration(record.Duration*float64(time.Second)), tags...)
+	}
+}
+
+// statsTags returns the tags of stats for the cv and the given target, if not nil,
+// along with any additional tags.
+func (s *Syncer) statsTags(target deploy.RolloutTarget, tags ...string) []string {
+	result := []string{"cv:" + s.cv.Name, "namespace:" + s.k8sProvider.Namespace()}
+	if target != nil {
+		result = append(result, "workload:"+target.Name())
+	}
+	return append(result, tags...)
+}
+
 // syncVersionConfig syncs the config map referenced by CV resource - creates if absent and updates if required
 // The controller is not responsible for managing the config resource it reference but only for updating
 // and ensuring its present. If the reference to config was removed from CV resource its not the responsibility
@@ -247,7 +477,7 @@ func (s *Syncer) syncVersionConfig(version string, next state.State) state.State
 				_, err = client.CoreV1().ConfigMaps(namespace).Create(
 					newVersionConfig(namespace, cv.Spec.Config.Name, cv.Spec.Config.Key, version))
 				if err != nil {
-					events.FromContext(ctx).Event(events.Warning, "FailedCreateVersionConfigMap", "Failed to create version configmap")
+					events.FromContext(ctx).Event(events.Warning, events.ReasonCreateVersionConfigMapFailed, "Failed to create version configmap")
 					return state.Error(errors.Wrapf(err, "failed to create version configmap from %s/%s:%s",
 						namespace, cv.Spec.Config.Name, cv.Spec.Config.Key))
 				}
@@ -271,7 +501,7 @@ func (s *Syncer) syncVersionConfig(version string, next state.State) state.State
 		// }`, s.Config.ConfigMap.Key, version)))
 		_, err = client.CoreV1().ConfigMaps(namespace).Update(cm)
 		if err != nil {
-			events.FromContext(ctx).Event(events.Warning, "FailedUpdateVersionConfigMap", "Failed to update version configmap")
+			events.FromContext(ctx).Event(events.Warning, events.ReasonUpdateVersionConfigMapFailed, "Failed to update version configmap")
 			return state.Error(errors.Wrapf(err, "failed to update version configmap from %s/%s:%s",
 				namespace, cv.Spec.Config.Name, cv.Spec.Config.Key))
 		}
@@ -292,33 +522,174 @@ func newVersionConfig(namespace, name, key, version string) *corev1.ConfigMap {
 	}
 }
 
-// addHistory adds the successful rollout of the target to the given version to the
-// history provider.
-func (s *Syncer) addHistory(version string, target deploy.RolloutTarget, next state.State) state.StateFunc {
+// writeBack writes the version back to the gitops repository of the cv. The version is
+// written once for all workloads of the rollout. Failures to write the version are
+// reported but do not fail the rollout, which has already succeeded.
+func (s *Syncer) writeBack(version string, next state.State) state.StateFunc {
 	return func(ctx context.Context) (state.States, error) {
-		if !s.cv.Spec.History.Enabled {
-			glog.V(4).Infof("Not adding version history for cv=%s, version=%s", s.cv.Name, version)
+		spec := s.cv.Spec.GitOps
+		if spec == nil || state.Data(ctx, "gitopsVersion") == version {
 			return state.Single(next)
 		}
+		glog.V(4).Infof("writeBack: cv=%s, version=%s, repository=%s", s.cv.Name, version, spec.Repository)
 
-		name := s.cv.Spec.History.Name
-		if name == "" {
-			name = target.Name()
+		result, err := s.writeVersion(ctx, spec, version)
+		if err != nil {
+			glog.Errorf("Failed to write version %s of cv %s back to %s: %v", version, s.cv.Name, spec.Repository, err)
+			s.recorder(ctx).Eventf(events.Warning, events.ReasonGitOpsWriteBackFailed,
+				"Failed to write version %s back to %s: %v", version, spec.Repository, err)
+			return state.Single(next)
+		}
+		if result != "" {
+			s.recorder(ctx).Eventf(events.Normal, events.ReasonGitOpsWriteBack,
+				"Wrote version %s back to %s: %s", version, spec.Repository, result)
 		}
 
-		glog.V(4).Infof("Adding version history for cv=%s, name=%s, version=%s", s.cv.Name, name, version)
+		state.SetData(ctx, "gitopsVersion", version)
+		return state.Single(next)
+	}
+}
 
-		err := s.historyProvider.Add(s.k8sProvider.Namespace(), name, &history.Record{
-			Type:    target.Type(),
-			Name:    target.Name(),
-			Version: version,
-			Time:    time.Now().UTC(),
-		})
+// writeVersion writes the version to the repository of the given spec and returns the
+// commit or merge request, as described by gitops.Writer.
+func (s *Syncer) writeVersion(ctx context.Context, spec *cv1.GitOpsSpec, version string) (string, error) {
+	var requester gitops.MergeRequester
+	if spec.MergeRequest && s.cv.Spec.SCM != nil {
+		repo, err := scm.ForSpec(s.k8sProvider.Client(), s.k8sProvider.Namespace(), s.cv.Spec.SCM)
 		if err != nil {
-			s.options.Stats.IncCount(fmt.Sprintf("crsyn.%s.history.save.failure", target.Name()))
-			s.options.Recorder.Event(events.Warning, "SaveHistoryFailed", "Failed to record update history")
+			return "", errors.WithStack(err)
 		}
+		requester = repo
+	}
 
+	writer, err := gitops.ForSpec(s.k8sProvider.Client(), s.k8sProvider.Namespace(), spec, requester)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return writer.Write(ctx, &gitops.Change{
+		Name:            s.cv.Name,
+		Namespace:       s.k8sProvider.Namespace(),
+		Image:           s.cv.Spec.ImageRepo,
+		Version:         version,
+		PreviousVersion: state.Data(ctx, "previousVersion"),
+	})
+}
+
+// addHistory adds the successful rollout of the target to the given version to the
+// history provider.
+func (s *Syncer) addHistory(version string, target deploy.RolloutTarget, next state.State) state.StateFunc {
+	return func(ctx context.Context) (state.States, error) {
+		record := s.historyRecord(ctx, version, target, history.StatusSuccess)
+		for _, spec := range s.cv.Spec.Container.Verify {
+			record.Verifiers = append(record.Verifiers, history.VerifierResult{
+				Kind:   spec.Kind,
+				Image:  spec.Image,
+				Passed: true,
+			})
+		}
+
+		s.rolloutStats(target, record)
+		s.options.Stats.Gauge("version_info", 1, s.statsTags(target, "version:"+version)...)
+		s.addRecord(ctx, target, record)
 		return state.Single(next)
 	}
 }
+
+// addRecord adds the given record of a rollout of the target to the history provider,
+// if history is enabled for the cv.
+func (s *Syncer) addRecord(ctx context.Context, target deploy.RolloutTarget, record *history.Record) {
+	if !s.cv.Spec.History.Enabled {
+		glog.V(4).Infof("Not adding version history for cv=%s, version=%s", s.cv.Name, record.Version)
+		return
+	}
+
+	if digester, ok := s.registry.(registry.Digester); ok {
+		digest, err := digester.Digest(ctx, record.Version)
+		if err != nil {
+			glog.V(2).Infof("Failed to get digest of version %s for history of cv %s: %v", record.Version, s.cv.Name, err)
+		} else {
+			record.Digest = digest
+		}
+	}
+
+	name := s.cv.Spec.History.Name
+	if name == "" {
+		name = target.Name()
+	}
+
+	glog.V(4).Infof("Adding version history for cv=%s, name=%s, version=%s, status=%s",
+		s.cv.Name, name, record.Version, record.Status)
+
+	err := s.historyProvider.Add(s.k8sProvider.Namespace(), name, record)
+	if err != nil {
+		glog.Errorf("Failed to add version history for cv=%s, name=%s, version=%s: %v", s.cv.Name, name, record.Version, err)
+		s.options.Stats.IncCount("history_save_failures_total", s.statsTags(target)...)
+		s.recorder(ctx, target).Event(events.Warning, events.ReasonSaveHistoryFailed, "Failed to record update history")
+	}
+}
+
+// failureRecord returns a history record for the rollout of the target to the given version
+// that failed with the given error.
+func (s *Syncer) failureRecord(ctx context.Context, version string, target deploy.RolloutTarget, err error) *history.Record {
+	record := s.historyRecord(ctx, version, target, history.StatusFailed)
+	record.Reason = err.Error()
+
+	if erb, ok := deploy.RolledBack(err); ok {
+		record.Status = history.StatusRolledBack
+		record.PreviousVersion = erb.PreviousVersion
+	} else if state.HasCause(err, state.ErrAborted) {
+		record.Status = history.StatusAborted
+	} else if evf, ok := verify.FailedVerifier(err); ok {
+		record.Status = history.StatusVerificationFailed
+		record.Verifiers = verifierResults(s.cv.Spec.Container.Verify, evf)
+	}
+	return record
+}
+
+// verifierResults returns the results of the given verifiers, which run in order, where
+// the verification failed with the given error.
+func verifierResults(specs []cv1.VerifySpec, evf *verify.ErrorVerifierFailed) []history.VerifierResult {
+	var results []history.VerifierResult
+	for _, spec := range specs {
+		if reflect.DeepEqual(spec, evf.Spec) {
+			break
+		}
+		results = append(results, history.VerifierResult{
+			Kind:   spec.Kind,
+			Image:  spec.Image,
+			Passed: true,
+		})
+	}
+
+	// if the failed verifier is not in the given specs, such as a verifier defined by
+	// the rollout strategy, then all of the given verifiers passed.
+	return append(results, history.VerifierResult{
+		Kind:    evf.Spec.Kind,
+		Image:   evf.Spec.Image,
+		Passed:  false,
+		Message: evf.Error(),
+	})
+}
+
+// historyRecord returns a history record for the rollout of the target to the given version
+// with the given status, populated from the progress of the rollout operation.
+func (s *Syncer) historyRecord(ctx context.Context, version string, target deploy.RolloutTarget, status string) *history.Record {
+	now := time.Now().UTC()
+	record := &history.Record{
+		Type:            target.Type(),
+		Name:            target.Name(),
+		Version:         version,
+		PreviousVersion: state.Data(ctx, "previousVersion"),
+		Status:          status,
+		Time:            now,
+		Actor:           fmt.Sprintf("registry tag %s", s.cv.Spec.Tag),
+		TraceID:         tracing.TraceID(ctx),
+	}
+	if s.cv.Spec.Strategy != nil {
+		record.Strategy = s.cv.Spec.Strategy.Kind
+	}
+	if started, err := time.Parse(time.RFC3339, state.Data(ctx, "started")); err == nil {
+		record.Duration = now.Sub(started).Seconds()
+	}
+	return record
+}
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nearmap/cvmanager/config"
+	"github.com/nearmap/cvmanager/events"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	customfake "github.com/nearmap/cvmanager/gok8s/client/clientset/versioned/fake"
+	k8s "github.com/nearmap/cvmanager/gok8s/workload"
+	"github.com/nearmap/cvmanager/history"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/verify"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const namespace = "test-ns"
+
+// fakeRegistry is a registry whose tags all resolve to the given version, and whose
+// images have the given scan findings. The repositories it is asked for are recorded.
+type fakeRegistry struct {
+	version  string
+	findings []registry.Finding
+	repos    []string
+}
+
+func (fr *fakeRegistry) RegistryFor(imageRepo string) (registry.Registry, error) {
+	fr.repos = append(fr.repos, imageRepo)
+	return fr, nil
+}
+
+func (fr *fakeRegistry) Version(ctx context.Context, tag string) (string, error) {
+	return fr.version, nil
+}
+
+func (fr *fakeRegistry) Digest(ctx context.Context, version string) (string, error) {
+	return "sha256:0123456789abcdef", nil
+}
+
+func (fr *fakeRegistry) ScanFindings(ctx context.Context, digest string) ([]registry.Finding, error) {
+	return fr.findings, nil
+}
+
+// syncTest is a syncer of a cv and deployment held by fake clientsets.
+type syncTest struct {
+	cs       *fake.Clientset
+	cvcs     *customfake.Clientset
+	recorder *events.FakeRecorder
+	syncer   *Syncer
+	harness  *statetest.Harness
+}
+
+func newSyncTest(t *testing.T, cv *cv1.ContainerVersion, reg *fakeRegistry) *syncTest {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace, Labels: map[string]string{"app": "test"}},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "app", Image: "nearmap/app:v1"},
+						{Name: "sidecar", Image: "nearmap/sidecar:v1"},
+					},
+				},
+			},
+		},
+	}
+
+	st := &syncTest{
+		cs:       fake.NewSimpleClientset(),
+		cvcs:     customfake.NewSimpleClientset(cv),
+		recorder: events.NewFakeRecorder(100),
+	}
+
+	// the fake clientset does not implement patches, so they are applied to a tracker
+	// that replaces the one of the clientset
+	tracker := k8stesting.NewObjectTracker(scheme.Scheme, scheme.Codecs.UniversalDecoder())
+	if err := tracker.Add(deployment); err != nil {
+		t.Fatalf("Failed to add deployment: %v", err)
+	}
+	st.cs.PrependReactor("*", "*", k8stesting.ObjectReaction(tracker))
+	st.cs.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj, err := tracker.Get(appsv1.SchemeGroupVersion.WithResource("deployments"), namespace, patch.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		original, err := json.Marshal(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		patched, err := strategicpatch.StrategicMergePatch(original, patch.GetPatch(), &appsv1.Deployment{})
+		if err != nil {
+			return true, nil, err
+		}
+		result := &appsv1.Deployment{}
+		if err := json.Unmarshal(patched, result); err != nil {
+			return true, nil, err
+		}
+		return true, result, tracker.Update(appsv1.SchemeGroupVersion.WithResource("deployments"), result, namespace)
+	})
+
+	k8sProvider := k8s.NewProvider(st.cs, st.cvcs, namespace)
+	hp := history.NewCRDProvider(st.cvcs, stats.NewFake(), 0)
+	syncer, err := NewSyncer(k8sProvider, cv, reg, hp, config.WithRecorder(st.recorder))
+	if err != nil {
+		t.Fatalf("Failed to create syncer: %v", err)
+	}
+	st.syncer = syncer
+	st.harness = statetest.New(syncer.initialState(),
+		state.WithCheckpointer(&annotationCheckpointer{k8sProvider: k8sProvider, cvName: cv.Name}),
+		state.WithRecorder(st.recorder))
+	return st
+}
+
+func newCV() *cv1.ContainerVersion {
+	return &cv1.ContainerVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cv", Namespace: namespace},
+		Spec: cv1.ContainerVersionSpec{
+			ImageRepo:     "nearmap/app",
+			Tag:           "dev",
+			Container:     cv1.ContainerSpec{Name: "app"},
+			Selector:      map[string]string{"app": "test"},
+			WorkloadKinds: []string{k8s.TypeDeployment},
+		},
+		Status: cv1.ContainerVersionStatus{
+			CurrVersion:    "v1",
+			CurrStatus:     k8s.StatusSuccess,
+			SuccessVersion: "v1",
+		},
+	}
+}
+
+// image returns the image of the deployment's container.
+func (st *syncTest) image(t *testing.T) string {
+	deployment, err := st.cs.AppsV1().Deployments(namespace).Get("app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+// status returns the rollout status of the cv.
+func (st *syncTest) status(t *testing.T) cv1.ContainerVersionStatus {
+	cv, err := st.cvcs.CustomV1().ContainerVersions(namespace).Get("test-cv", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get cv: %v", err)
+	}
+	if cv.Annotations[CheckpointAnnotation] != "" {
+		t.Errorf("Expected checkpoint to be cleared, got %s", cv.Annotations[CheckpointAnnotation])
+	}
+	return cv.Status
+}
+
+// events returns the reasons of the events recorded so far.
+func (st *syncTest) events() []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-st.recorder.Events:
+			reasons = append(reasons, strings.Fields(event)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func TestSyncerRollout(t *testing.T) {
+	cv := newCV()
+	cv.Spec.History.Enabled = true
+	st := newSyncTest(t, cv, &fakeRegistry{version: "v2"})
+
+	if err := st.harness.RunOperation(50); err != nil {
+		t.Fatalf("Failed to run sync: %v", err)
+	}
+
+	if image := st.image(t); image != "nearmap/app:v2" {
+		t.Errorf("Expected deployment to be rolled out to v2, got %s", image)
+	}
+	if status := st.status(t); status.CurrVersion != "v2" || status.CurrStatus != k8s.StatusSuccess || status.SuccessVersion != "v2" {
+		t.Errorf("Expected successful rollout status of v2, got %+v", status)
+	}
+	reasons := strings.Join(st.events(), ",")
+	if !strings.Contains(reasons, events.ReasonRolloutStarted) || !strings.Contains(reasons, events.ReasonRolloutSucceeded) {
+		t.Errorf("Expected rollout started and succeeded events, got %s", reasons)
+	}
+
+	page, err := st.syncer.historyProvider.History(namespace, "app", history.Query{})
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	records := page.Records
+	if len(records) != 1 || records[0].Version != "v2" || records[0].PreviousVersion != "v1" ||
+		records[0].Status != history.StatusSuccess {
+		t.Errorf("Expected history record of successful rollout from v1 to v2, got %+v", records)
+	}
+
+	// a further sync of the same version does not roll out again
+	if err := st.harness.RunOperation(50); err != nil {
+		t.Fatalf("Failed to run sync: %v", err)
+	}
+	if reasons := st.events(); len(reasons) != 0 {
+		t.Errorf("Expected no events for an up to date deployment, got %v", reasons)
+	}
+}
+
+func TestSyncerVerificationFailed(t *testing.T) {
+	cv := newCV()
+	cv.Spec.Container.Verify = []cv1.VerifySpec{{Kind: verify.KindScan}}
+	st := newSyncTest(t, cv, &fakeRegistry{
+		version:  "v2",
+		findings: []registry.Finding{{ID: "CVE-2021-3711", Severity: "CRITICAL", Package: "openssl"}},
+	})
+
+	if err := st.harness.RunOperation(50); err != nil {
+		t.Fatalf("Failed to run sync: %v", err)
+	}
+
+	if image := st.image(t); image != "nearmap/app:v1" {
+		t.Errorf("Expected deployment not to be rolled out, got %s", image)
+	}
+	if status := st.status(t); status.CurrVersion != "v2" || status.CurrStatus != k8s.StatusFailed || status.SuccessVersion != "v1" {
+		t.Errorf("Expected failed rollout status of v2, got %+v", status)
+	}
+	if reasons := strings.Join(st.events(), ","); !strings.Contains(reasons, events.ReasonVerificationFailed) {
+		t.Errorf("Expected verification failed event, got %s", reasons)
+	}
+
+	// a failed version is not rolled out again
+	if err := st.harness.RunOperation(50); err != nil {
+		t.Fatalf("Failed to run sync: %v", err)
+	}
+	if image := st.image(t); image != "nearmap/app:v1" {
+		t.Errorf("Expected deployment not to be rolled out, got %s", image)
+	}
+}
+
+func TestSyncerVerifiesContainerRepos(t *testing.T) {
+	cv := newCV()
+	cv.Spec.Container.Verify = []cv1.VerifySpec{{Kind: verify.KindScan}}
+	cv.Spec.Containers = []cv1.ContainerRef{{Name: "sidecar", ImageRepo: "nearmap/sidecar"}, {Name: "app"}}
+	reg := &fakeRegistry{version: "v2"}
+	st := newSyncTest(t, cv, reg)
+
+	if err := st.harness.RunOperation(50); err != nil {
+		t.Fatalf("Failed to run sync: %v", err)
+	}
+
+	repos := strings.Join(reg.repos, ",")
+	if !strings.Contains(repos, "nearmap/app") || !strings.Contains(repos, "nearmap/sidecar") {
+		t.Errorf("Expected the images of both repositories to be verified, got %s", repos)
+	}
+
+	deployment, err := st.cs.AppsV1().Deployments(namespace).Get("app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+	var images []string
+	for _, c := range deployment.Spec.Template.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	if strings.Join(images, ",") != "nearmap/app:v2,nearmap/sidecar:v2" {
+		t.Errorf("Expected both containers to be rolled out to v2 once, got %v", images)
+	}
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/nearmap/cvmanager/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tracedRecorder is an events.Recorder that logs the trace ID of events.
+type tracedRecorder struct {
+	recorder events.Recorder
+	traceID  string
+}
+
+// Recorder returns a recorder that logs the ID of the trace of the given context with
+// each event recorded with the given recorder, so that the events can be correlated
+// with the trace. The messages of the events are unchanged, so that repeated events are
+// still aggregated. The recorder is returned as is if the context is not part of a trace.
+func Recorder(ctx context.Context, recorder events.Recorder) events.Recorder {
+	traceID := TraceID(ctx)
+	if traceID == "" || recorder == nil {
+		return recorder
+	}
+	if tr, ok := recorder.(*tracedRecorder); ok {
+		recorder = tr.recorder
+	}
+	return &tracedRecorder{
+		recorder: recorder,
+		traceID:  traceID,
+	}
+}
+
+// Event implements the events.Recorder interface.
+func (tr *tracedRecorder) Event(eventType, reason, message string) {
+	tr.log(eventType, reason, message)
+	tr.recorder.Event(eventType, reason, message)
+}
+
+// Eventf implements the events.Recorder interface.
+func (tr *tracedRecorder) Eventf(eventType, reason, messageFmt string, args ...interface{}) {
+	tr.Event(eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// PastEventf implements the events.Recorder interface.
+func (tr *tracedRecorder) PastEventf(timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	tr.log(eventType, reason, message)
+	tr.recorder.PastEventf(timestamp, eventType, reason, "%s", message)
+}
+
+func (tr *tracedRecorder) log(eventType, reason, message string) {
+	glog.V(1).Infof("Event of trace %s: type=%s, reason=%s, message=%s", tr.traceID, eventType, reason, message)
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileExporter is an Exporter that appends spans as JSON lines to a local file,
+// for use when no tracing backend is available.
+type FileExporter struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewFileExporter returns an exporter that appends spans to the file at the given path.
+func NewFileExporter(path string) *FileExporter {
+	return &FileExporter{
+		path: path,
+	}
+}
+
+// Export implements the Exporter interface.
+func (fe *FileExporter) Export(spans []*Span) error {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+
+	f, err := os.OpenFile(fe.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open trace file %s", fe.path)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "failed to write span %s to trace file %s", s.Name, fe.path)
+		}
+	}
+	return errors.WithStack(f.Close())
+}
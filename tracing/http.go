@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// transport is an http.RoundTripper that records requests as spans.
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport returns an http.RoundTripper that records each request made with the
+// given round tripper as a child span of the span in the request's context, and
+// propagates the span to the server with the W3C traceparent header. The default
+// transport is used if base is nil.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := Start(req.Context(), "http."+req.Method, "http.method", req.Method, "http.host", req.URL.Host)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	// round trippers must not modify the given request
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("traceparent", span.Traceparent())
+
+	resp, err := t.base.RoundTrip(r)
+	if err == nil {
+		span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			span.SetError(errors.Errorf("server error: %s", resp.Status))
+		}
+	}
+	span.Finish(err)
+	return resp, err
+}
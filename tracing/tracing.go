@@ -0,0 +1,256 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	batchSize     = 64
+	queueSize     = 1024
+	flushInterval = 5 * time.Second
+)
+
+// Exporter sends completed spans to a tracing backend.
+type Exporter interface {
+	// Export sends the given batch of completed spans.
+	Export(spans []*Span) error
+}
+
+// Tracer creates spans and exports them once they end. Spans are exported in
+// batches by a background goroutine until the tracer is closed.
+// A nil Tracer creates no spans.
+type Tracer struct {
+	service  string
+	exporter Exporter
+	attrs    []string
+
+	queue chan *Span
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New returns a Tracer that exports the spans of the given service with the given exporter.
+// The given attributes, as alternating keys and values, are added to the root span of
+// every trace.
+func New(service string, exporter Exporter, attrs ...string) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		attrs:    attrs,
+		queue:    make(chan *Span, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// StartTrace starts the root span of a new trace with the given name and attributes,
+// given as alternating keys and values. Returns a nil span if the tracer is nil.
+func (t *Tracer) StartTrace(name string, attrs ...string) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(newID(16), "", name, append(append([]string{}, t.attrs...), attrs...))
+}
+
+// Close exports all ended spans and stops the tracer.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	close(t.stop)
+	<-t.done
+	return nil
+}
+
+func (t *Tracer) newSpan(traceID, parentID, name string, attrs []string) *Span {
+	s := &Span{
+		TraceID:  traceID,
+		SpanID:   newID(8),
+		ParentID: parentID,
+		Name:     name,
+		Start:    time.Now().UTC(),
+		tracer:   t,
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.SetAttribute(attrs[i], attrs[i+1])
+	}
+	return s
+}
+
+// enqueue schedules the ended span for export, dropping it if the queue is full.
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		glog.V(2).Infof("Trace queue is full: dropping span %s of trace %s", s.Name, s.TraceID)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			// the end of a root span completes its trace
+			if len(batch) < batchSize && s.ParentID != "" {
+				continue
+			}
+		case <-ticker.C:
+		case <-t.stop:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+			}
+			t.export(batch)
+			return
+		}
+		t.export(batch)
+		batch = nil
+	}
+}
+
+func (t *Tracer) export(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := t.exporter.Export(batch); err != nil {
+		glog.Errorf("Failed to export %d spans: %v", len(batch), err)
+	}
+}
+
+// Span is a timed operation within a trace. The methods of a nil Span do nothing,
+// so that callers need not check whether tracing is enabled.
+type Span struct {
+	TraceID    string            `json:"traceId"`
+	SpanID     string            `json:"spanId"`
+	ParentID   string            `json:"parentSpanId,omitempty"`
+	Name       string            `json:"name"`
+	Service    string            `json:"service,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed with the given error, if not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish ends the span with the given error, if not nil, and schedules it for export.
+// Finishing a span more than once has no effect.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.SetError(err)
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now().UTC()
+	s.Service = s.tracer.service
+	s.mu.Unlock()
+
+	s.tracer.enqueue(s)
+}
+
+// Traceparent returns the W3C trace context header value that propagates the span
+// to other services.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+)
+
+// NewContext returns a context populated with the given span, which becomes the
+// parent of spans started from the context.
+func NewContext(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// FromContext returns the span stored in context, or nil if not exists.
+func FromContext(ctx context.Context) *Span {
+	if s, has := ctx.Value(spanKey).(*Span); has {
+		return s
+	}
+	return nil
+}
+
+// TraceID returns the ID of the trace of the span stored in context, or an empty
+// string if not exists.
+func TraceID(ctx context.Context) string {
+	if s := FromContext(ctx); s != nil {
+		return s.TraceID
+	}
+	return ""
+}
+
+// Start starts a span with the given name and attributes, given as alternating keys
+// and values, as a child of the span stored in context. Returns a context populated
+// with the new span. No span is started if the context is not part of a trace.
+func Start(ctx context.Context, name string, attrs ...string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := parent.tracer.newSpan(parent.TraceID, parent.SpanID, name, attrs)
+	return NewContext(ctx, s), s
+}
+
+// newID returns a random hex encoded identifier of the given number of bytes.
+func newID(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		glog.Errorf("Failed to generate trace identifier: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
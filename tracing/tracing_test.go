@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nearmap/cvmanager/events"
+	"github.com/pkg/errors"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (me *memoryExporter) Export(spans []*Span) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := New("test", exporter, "cv", "app")
+
+	root := tracer.StartTrace("operation")
+	ctx := NewContext(context.Background(), root)
+	if TraceID(ctx) != root.TraceID || len(root.TraceID) != 32 {
+		t.Errorf("Expected trace ID of root span in context, got %s", TraceID(ctx))
+	}
+
+	ctx, child := Start(ctx, "state", "name", "deploy")
+	_, grandchild := Start(ctx, "k8s.PatchPodSpec")
+	grandchild.Finish(errors.New("conflict"))
+	child.Finish(nil)
+	root.Finish(nil)
+	root.Finish(nil)
+
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("Unexpected error closing tracer: %v", err)
+	}
+
+	if len(exporter.spans) != 3 {
+		t.Fatalf("Expected 3 exported spans, got %d", len(exporter.spans))
+	}
+	for _, s := range exporter.spans {
+		if s.TraceID != root.TraceID {
+			t.Errorf("Expected span %s to be part of trace %s, got %s", s.Name, root.TraceID, s.TraceID)
+		}
+		if s.Service != "test" {
+			t.Errorf("Expected span %s to have service test, got %s", s.Name, s.Service)
+		}
+		if s.End.Before(s.Start) {
+			t.Errorf("Expected span %s to end after it started", s.Name)
+		}
+	}
+	if child.ParentID != root.SpanID || grandchild.ParentID != child.SpanID {
+		t.Errorf("Unexpected span hierarchy: %s -> %s -> %s", root.SpanID, child.ParentID, grandchild.ParentID)
+	}
+	if root.Attributes["cv"] != "app" || child.Attributes["name"] != "deploy" {
+		t.Errorf("Unexpected attributes: root=%v, child=%v", root.Attributes, child.Attributes)
+	}
+	if grandchild.Error != "conflict" || child.Error != "" {
+		t.Errorf("Unexpected errors: grandchild=%s, child=%s", grandchild.Error, child.Error)
+	}
+}
+
+func TestUntraced(t *testing.T) {
+	var tracer *Tracer
+	if span := tracer.StartTrace("operation"); span != nil {
+		t.Errorf("Expected nil tracer to start no spans")
+	}
+
+	ctx, span := Start(context.Background(), "state")
+	if span != nil || TraceID(ctx) != "" {
+		t.Errorf("Expected no span outside of a trace")
+	}
+	span.SetAttribute("key", "value")
+	span.Finish(errors.New("failed"))
+
+	rec := events.NewFakeRecorder(1)
+	if Recorder(ctx, rec) != rec {
+		t.Errorf("Expected recorder outside of a trace to be returned as is")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	tracer := New("test", &memoryExporter{})
+	defer tracer.Close()
+	ctx := NewContext(context.Background(), tracer.StartTrace("operation"))
+
+	rec := events.NewFakeRecorder(1)
+	Recorder(ctx, rec).Eventf(events.Normal, "Success", "%s updated", "app")
+
+	expected := "Normal Success app updated"
+	if e := <-rec.Events; e != expected {
+		t.Errorf("Expected event %q, got %q", expected, e)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traces.jsonl")
+
+	tracer := New("test", NewFileExporter(path))
+	tracer.StartTrace("first").Finish(nil)
+	tracer.StartTrace("second").Finish(nil)
+	tracer.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 spans in trace file, got %d", len(lines))
+	}
+	var span Span
+	if err := json.Unmarshal([]byte(lines[1]), &span); err != nil {
+		t.Fatalf("Failed to decode span: %v", err)
+	}
+	if span.Name != "second" || span.TraceID == "" {
+		t.Errorf("Unexpected span %s of trace %s", span.Name, span.TraceID)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var req otlpTraces
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tracer := New("test", exporter)
+	root := tracer.StartTrace("operation")
+	_, child := Start(NewContext(context.Background(), root), "state")
+	child.Finish(errors.New("failed"))
+	root.Finish(nil)
+	tracer.Close()
+
+	if path != otlpTracesPath {
+		t.Errorf("Expected spans to be sent to %s, got %s", otlpTracesPath, path)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("Unexpected request %+v", req)
+	}
+	if attrs := req.ResourceSpans[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Value.StringValue != "test" {
+		t.Errorf("Expected service name resource attribute, got %+v", attrs)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "state" || spans[0].ParentSpanID != root.SpanID || spans[0].Status == nil ||
+		spans[0].Status.Code != otlpStatusError {
+		t.Errorf("Unexpected child span %+v", spans[0])
+	}
+
+	if _, err := NewOTLPExporter("otel-collector:4318"); err == nil {
+		t.Errorf("Expected error for endpoint without scheme")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	exporter := &memoryExporter{}
+	tracer := New("test", exporter)
+	root := tracer.StartTrace("operation")
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req = req.WithContext(NewContext(context.Background(), root))
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	tracer.Close()
+
+	if len(exporter.spans) != 1 {
+		t.Fatalf("Expected 1 exported span, got %d", len(exporter.spans))
+	}
+	span := exporter.spans[0]
+	if traceparent != span.Traceparent() || span.ParentID != root.SpanID {
+		t.Errorf("Expected request span %s to be propagated, got %s", span.Traceparent(), traceparent)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Errorf("Expected request not to be modified")
+	}
+}
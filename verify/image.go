@@ -10,6 +10,8 @@ import (
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	"github.com/nearmap/cvmanager/registry"
 	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/nearmap/cvmanager/tracing"
 	"github.com/pkg/errors"
 	"github.com/twinj/uuid"
 	corev1 "k8s.io/api/core/v1"
@@ -60,6 +62,19 @@ func (iv *ImageVerifier) Do(ctx context.Context) (state.States, error) {
 	return state.After(15*time.Second, iv.waitForPodState(pod.Name))
 }
 
+// RetryPolicy implements the state.HasRetryPolicy interface. Creating a verification
+// pod is retried fewer times than other operations so that a broken verifier fails
+// the rollout quickly.
+func (iv *ImageVerifier) RetryPolicy() state.RetryPolicy {
+	return state.RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: 15 * time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+		Jitter:       0.1,
+	}
+}
+
 // createPod creates a pod with the spec's container image and waits
 // for it to complete. Returns a Failed error if the pod does completes
 // with a non-zero status.
@@ -99,7 +114,9 @@ func (iv *ImageVerifier) createPod(ctx context.Context) (*corev1.Pod, error) {
 		},
 	}
 
+	_, span := tracing.Start(ctx, "k8s.CreatePod", "pod", name, "image", image)
 	p, err := iv.client.Create(pod)
+	span.Finish(err)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create pod with name=%s, image=%s", name, image)
 	}
@@ -141,12 +158,24 @@ func (iv *ImageVerifier) waitForPodState(name string) state.StateFunc {
 		switch pod.Status.Phase {
 		case corev1.PodSucceeded:
 			glog.V(4).Infof("verification pod %s succeeded", name)
+			iv.durationStats(ctx, pod, "passed")
 			return state.Single(iv.next)
 		case corev1.PodFailed:
 			glog.V(4).Infof("verification pod %s failed", name)
-			return state.Error(ErrFailed)
+			iv.durationStats(ctx, pod, "failed")
+			return state.Error(NewVerifierFailed(iv.spec, "verification pod %s failed", name))
 		}
 
+		state.Report(ctx, "waiting for verification pod %s (%s)", name, pod.Status.Phase)
 		return state.After(15*time.Second, iv.waitForPodState(name))
 	}
 }
+
+// durationStats generates stats for the duration of the completed verification pod.
+func (iv *ImageVerifier) durationStats(ctx context.Context, pod *corev1.Pod, result string) {
+	st := stats.FromContext(ctx)
+	if st == nil || pod.CreationTimestamp.IsZero() {
+		return
+	}
+	st.Timing("verification_duration", time.Since(pod.CreationTimestamp.Time), "kind:"+KindImage, "result:"+result)
+}
@@ -0,0 +1,352 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KindScan represents the Scan Verifier kind.
+	KindScan = "Scan"
+
+	// DefaultSeverity is the lowest severity of the vulnerabilities that fail a scan
+	// verifier unless otherwise specified.
+	DefaultSeverity = "HIGH"
+
+	// scanPollInterval is the time between checks of an image scan that has not completed.
+	scanPollInterval = 30 * time.Second
+
+	// maxScanPolls is the number of times an image scan is checked before the verifier
+	// gives up waiting for it to complete.
+	maxScanPolls = 20
+
+	// maxSummaryFindings is the maximum number of findings listed in a failure message.
+	maxSummaryFindings = 10
+)
+
+// severities ranks the severities used by ECR, Trivy and Grype.
+var severities = map[string]int{
+	"UNKNOWN":       0,
+	"UNDEFINED":     0,
+	"NEGLIGIBLE":    1,
+	"INFORMATIONAL": 1,
+	"LOW":           2,
+	"MEDIUM":        3,
+	"HIGH":          4,
+	"CRITICAL":      5,
+}
+
+// ScanVerifier is a Verifier implementation that fails the rollout of an image that has
+// vulnerabilities of at least a given severity, unless they are allowed by the spec. The
+// vulnerabilities are obtained from ECR image scanning or from a Trivy or Grype report.
+type ScanVerifier struct {
+	cs               kubernetes.Interface
+	registryProvider registry.Provider
+	namespace        string
+	imageRepo        string
+	version          string
+	spec             cv1.VerifySpec
+	next             state.State
+
+	polls int
+}
+
+// NewScanVerifier returns a verifier that checks the vulnerabilities of the image of the
+// given repository and version.
+func NewScanVerifier(cs kubernetes.Interface, registryProvider registry.Provider, namespace, imageRepo, version string,
+	spec cv1.VerifySpec, next state.State) *ScanVerifier {
+
+	return &ScanVerifier{
+		cs:               cs,
+		registryProvider: registryProvider,
+		namespace:        namespace,
+		imageRepo:        imageRepo,
+		version:          version,
+		spec:             spec,
+		next:             next,
+	}
+}
+
+// Do implements the State interface.
+func (sv *ScanVerifier) Do(ctx context.Context) (state.States, error) {
+	start := time.Now()
+
+	severity := sv.spec.Severity
+	if severity == "" {
+		severity = DefaultSeverity
+	}
+	threshold, ok := severities[strings.ToUpper(severity)]
+	if !ok {
+		return state.Error(state.NewFailed("invalid severity for scan verifier: %s", severity))
+	}
+	allowed, err := Allowed(sv.spec.Allowlist, time.Now())
+	if err != nil {
+		return state.Error(state.NewFailed("invalid allowlist for scan verifier: %v", err))
+	}
+
+	findings, err := sv.findings(ctx)
+	if errors.Cause(err) == registry.ErrScanPending {
+		sv.polls++
+		if sv.polls >= maxScanPolls {
+			sv.durationStats(ctx, start, "failed")
+			return state.Error(NewVerifierFailed(sv.spec, "scan of image %s:%s did not complete", sv.imageRepo, sv.version))
+		}
+		glog.V(4).Infof("Waiting for scan of image %s:%s to complete", sv.imageRepo, sv.version)
+		return state.After(scanPollInterval, sv)
+	}
+	if err != nil {
+		if _, ok := FailedVerifier(err); ok {
+			sv.durationStats(ctx, start, "failed")
+		}
+		return state.Error(errors.WithStack(err))
+	}
+
+	blocked := BlockedFindings(findings, threshold, sv.spec.BlockUnknown, allowed)
+	if len(blocked) > 0 {
+		sv.durationStats(ctx, start, "failed")
+		return state.Error(NewVerifierFailed(sv.spec, "image %s:%s has %s",
+			sv.imageRepo, sv.version, SummarizeFindings(blocked)))
+	}
+
+	glog.V(2).Infof("Image %s:%s has no vulnerabilities of severity %s or above", sv.imageRepo, sv.version, severity)
+	sv.durationStats(ctx, start, "passed")
+	return state.Single(sv.next)
+}
+
+// findings returns the vulnerabilities of the image from the source selected by the spec.
+func (sv *ScanVerifier) findings(ctx context.Context) ([]registry.Finding, error) {
+	src := sv.spec.ReportFrom
+	if src != nil && src.ConfigMap != nil {
+		if src.Artifact {
+			return nil, state.NewFailed("scan verifier requires a report from either a config map or an artifact")
+		}
+		return sv.configMapFindings()
+	}
+
+	reg, err := sv.registryProvider.RegistryFor(sv.imageRepo)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get registry for %s", sv.imageRepo)
+	}
+	digester, ok := reg.(registry.Digester)
+	if !ok {
+		return nil, state.NewFailed("registry of %s does not support digests", sv.imageRepo)
+	}
+	digest, err := digester.Digest(ctx, sv.version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get digest of version %s", sv.version)
+	}
+
+	if src != nil && src.Artifact {
+		fetcher, ok := reg.(registry.ArtifactFetcher)
+		if !ok {
+			return nil, state.NewFailed("registry of %s does not support artifacts", sv.imageRepo)
+		}
+		tag := registry.ReportTag(digest)
+		layers, err := fetcher.Artifact(ctx, tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get vulnerability report of %s@%s", sv.imageRepo, digest)
+		}
+		if len(layers) == 0 {
+			return nil, NewVerifierFailed(sv.spec, "image %s:%s has no vulnerability report %s", sv.imageRepo, sv.version, tag)
+		}
+		findings, err := ParseReport(layers[0])
+		if err != nil {
+			return nil, state.NewFailed("invalid vulnerability report %s: %v", tag, err)
+		}
+		return findings, nil
+	}
+
+	scanner, ok := reg.(registry.Scanner)
+	if !ok {
+		return nil, state.NewFailed("registry of %s does not scan images, a vulnerability report is required", sv.imageRepo)
+	}
+	return scanner.ScanFindings(ctx, digest)
+}
+
+// configMapFindings returns the vulnerabilities of the report in the config map of the spec.
+func (sv *ScanVerifier) configMapFindings() ([]registry.Finding, error) {
+	ref := sv.spec.ReportFrom.ConfigMap
+	key := ref.Key
+	if key == "" {
+		key = sv.version
+	}
+
+	cm, err := sv.cs.CoreV1().ConfigMaps(sv.namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get config map %s", ref.Name)
+	}
+	report, ok := cm.Data[key]
+	if !ok {
+		return nil, NewVerifierFailed(sv.spec, "config map %s has no vulnerability report %s", ref.Name, key)
+	}
+	findings, err := ParseReport([]byte(report))
+	if err != nil {
+		return nil, state.NewFailed("invalid vulnerability report %s in config map %s: %v", key, ref.Name, err)
+	}
+	return findings, nil
+}
+
+// durationStats generates stats for the duration of the scan verification.
+func (sv *ScanVerifier) durationStats(ctx context.Context, start time.Time, result string) {
+	st := stats.FromContext(ctx)
+	if st == nil {
+		return
+	}
+	st.Timing("verification_duration", time.Since(start), "kind:"+KindScan, "result:"+result)
+}
+
+// Allowed returns the IDs of the vulnerabilities in the allowlist that have not expired at
+// the given time.
+func Allowed(allowlist []cv1.AllowedVulnerability, now time.Time) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	for _, av := range allowlist {
+		if av.ID == "" {
+			return nil, errors.New("allowed vulnerability has no id")
+		}
+		if av.Expires != "" {
+			expires, err := parseExpiry(av.Expires)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid expiry of allowed vulnerability %s", av.ID)
+			}
+			if !now.Before(expires) {
+				glog.V(4).Infof("Allowed vulnerability %s expired at %v", av.ID, expires)
+				continue
+			}
+		}
+		allowed[av.ID] = true
+	}
+	return allowed, nil
+}
+
+// parseExpiry returns the time at which an allowed vulnerability expires, where a date
+// expires at the end of that day (UTC).
+func parseExpiry(expires string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", expires); err == nil {
+		return t.Add(24 * time.Hour), nil
+	}
+	t, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		return time.Time{}, errors.Errorf("expected YYYY-MM-DD or RFC 3339 time, got %s", expires)
+	}
+	return t, nil
+}
+
+// BlockedFindings returns the findings of at least the given severity that are not allowed,
+// ordered by decreasing severity. Findings of unknown severity are only blocked if
+// blockUnknown is set, as if they had the given severity.
+func BlockedFindings(findings []registry.Finding, threshold int, blockUnknown bool, allowed map[string]bool) []registry.Finding {
+	rank := func(f registry.Finding) int {
+		if s := severities[strings.ToUpper(f.Severity)]; s > 0 || !blockUnknown {
+			return s
+		}
+		return threshold
+	}
+
+	var blocked []registry.Finding
+	for _, f := range findings {
+		if rank(f) >= threshold && !allowed[f.ID] {
+			blocked = append(blocked, f)
+		}
+	}
+	sort.SliceStable(blocked, func(i, j int) bool {
+		si, sj := rank(blocked[i]), rank(blocked[j])
+		if si != sj {
+			return si > sj
+		}
+		return blocked[i].ID < blocked[j].ID
+	})
+	return blocked
+}
+
+// SummarizeFindings returns a short description of the given findings, listing the most
+// severe vulnerabilities.
+func SummarizeFindings(findings []registry.Finding) string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if seen[f.ID] {
+			continue
+		}
+		seen[f.ID] = true
+		if len(ids) < maxSummaryFindings {
+			ids = append(ids, fmt.Sprintf("%s (%s)", f.ID, strings.ToUpper(f.Severity)))
+		}
+	}
+
+	summary := fmt.Sprintf("%d blocked vulnerabilities: %s", len(seen), strings.Join(ids, ", "))
+	if len(seen) > len(ids) {
+		summary += fmt.Sprintf(" and %d more", len(seen)-len(ids))
+	}
+	return summary
+}
+
+// ParseReport returns the vulnerabilities of a Trivy or Grype JSON report.
+func ParseReport(data []byte) ([]registry.Finding, error) {
+	type trivyResult struct {
+		Vulnerabilities []struct {
+			VulnerabilityID string `json:"VulnerabilityID"`
+			PkgName         string `json:"PkgName"`
+			Severity        string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	}
+	var report struct {
+		// Results is set by Trivy.
+		Results []trivyResult `json:"Results"`
+
+		// Matches is set by Grype.
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name string `json:"name"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) > 0 && data[0] == '[' {
+		// reports of older versions of Trivy are a list of results
+		if err := json.Unmarshal(data, &report.Results); err != nil {
+			return nil, errors.Wrap(err, "failed to parse Trivy report")
+		}
+	} else {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, errors.Wrap(err, "failed to parse report")
+		}
+		_, trivy := fields["Results"]
+		_, grype := fields["matches"]
+		if !trivy && !grype {
+			return nil, errors.New("report is neither a Trivy nor a Grype report")
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, errors.Wrap(err, "failed to parse report")
+		}
+	}
+
+	var findings []registry.Finding
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			findings = append(findings, registry.Finding{ID: v.VulnerabilityID, Severity: v.Severity, Package: v.PkgName})
+		}
+	}
+	for _, m := range report.Matches {
+		findings = append(findings, registry.Finding{ID: m.Vulnerability.ID, Severity: m.Vulnerability.Severity, Package: m.Artifact.Name})
+	}
+	return findings, nil
+}
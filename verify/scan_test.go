@@ -0,0 +1,277 @@
+package verify
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	trivyReport = `{"SchemaVersion":2,"ArtifactName":"nearmap/app:abc","Results":[
+		{"Target":"nearmap/app:abc (debian 10.9)","Vulnerabilities":[
+			{"VulnerabilityID":"CVE-2021-3711","PkgName":"openssl","Severity":"CRITICAL"},
+			{"VulnerabilityID":"CVE-2021-3712","PkgName":"openssl","Severity":"HIGH"}]},
+		{"Target":"app","Vulnerabilities":[
+			{"VulnerabilityID":"CVE-2020-28851","PkgName":"golang.org/x/text","Severity":"MEDIUM"}]}]}`
+
+	oldTrivyReport = `[{"Target":"nearmap/app:abc","Vulnerabilities":[
+		{"VulnerabilityID":"CVE-2021-3711","PkgName":"openssl","Severity":"CRITICAL"}]}]`
+
+	grypeReport = `{"matches":[
+		{"vulnerability":{"id":"CVE-2021-3711","severity":"Critical"},"artifact":{"name":"openssl"}},
+		{"vulnerability":{"id":"GHSA-xxxx","severity":"Low"},"artifact":{"name":"lodash"}}]}`
+)
+
+// scanningRegistry is a registry with the given scan findings and report artifact of the image.
+type scanningRegistry struct {
+	findings []registry.Finding
+	pending  bool
+	report   string
+}
+
+func (sr *scanningRegistry) RegistryFor(imageRepo string) (registry.Registry, error) {
+	return sr, nil
+}
+
+func (sr *scanningRegistry) Version(ctx context.Context, tag string) (string, error) {
+	return tag, nil
+}
+
+func (sr *scanningRegistry) Digest(ctx context.Context, version string) (string, error) {
+	return digest, nil
+}
+
+func (sr *scanningRegistry) ScanFindings(ctx context.Context, d string) ([]registry.Finding, error) {
+	if sr.pending {
+		return nil, registry.ErrScanPending
+	}
+	return sr.findings, nil
+}
+
+func (sr *scanningRegistry) Artifact(ctx context.Context, tag string) ([][]byte, error) {
+	if tag != registry.ReportTag(digest) || sr.report == "" {
+		return nil, nil
+	}
+	return [][]byte{[]byte(sr.report)}, nil
+}
+
+func TestParseReport(t *testing.T) {
+	var tests = []struct {
+		message  string
+		report   string
+		expected []registry.Finding
+	}{
+		{"trivy", trivyReport, []registry.Finding{
+			{ID: "CVE-2021-3711", Severity: "CRITICAL", Package: "openssl"},
+			{ID: "CVE-2021-3712", Severity: "HIGH", Package: "openssl"},
+			{ID: "CVE-2020-28851", Severity: "MEDIUM", Package: "golang.org/x/text"},
+		}},
+		{"old trivy", oldTrivyReport, []registry.Finding{
+			{ID: "CVE-2021-3711", Severity: "CRITICAL", Package: "openssl"},
+		}},
+		{"grype", grypeReport, []registry.Finding{
+			{ID: "CVE-2021-3711", Severity: "Critical", Package: "openssl"},
+			{ID: "GHSA-xxxx", Severity: "Low", Package: "lodash"},
+		}},
+		{"no vulnerabilities", `{"SchemaVersion":2,"Results":[{"Target":"app"}]}`, nil},
+	}
+
+	for _, test := range tests {
+		findings, err := ParseReport([]byte(test.report))
+		if err != nil {
+			t.Errorf("%s: failed to parse report: %v", test.message, err)
+			continue
+		}
+		if len(findings) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.message, test.expected, findings)
+			continue
+		}
+		for i := range findings {
+			if findings[i] != test.expected[i] {
+				t.Errorf("%s: expected %v, got %v", test.message, test.expected, findings)
+				break
+			}
+		}
+	}
+
+	for _, report := range []string{"", "not json", `{"vulnerabilities":[]}`} {
+		if _, err := ParseReport([]byte(report)); err == nil {
+			t.Errorf("Expected error parsing report %q", report)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	allowlist := []cv1.AllowedVulnerability{
+		{ID: "CVE-1"},
+		{ID: "CVE-2", Expires: "2021-09-01"},
+		{ID: "CVE-3", Expires: "2021-08-31"},
+		{ID: "CVE-4", Expires: "2021-09-01T13:00:00Z"},
+		{ID: "CVE-5", Expires: "2021-09-01T11:00:00Z"},
+	}
+
+	allowed, err := Allowed(allowlist, now)
+	if err != nil {
+		t.Fatalf("Failed to get allowed vulnerabilities: %v", err)
+	}
+	for id, expected := range map[string]bool{"CVE-1": true, "CVE-2": true, "CVE-3": false, "CVE-4": true, "CVE-5": false} {
+		if allowed[id] != expected {
+			t.Errorf("Expected %s allowed to be %v", id, expected)
+		}
+	}
+
+	if _, err := Allowed([]cv1.AllowedVulnerability{{ID: "CVE-1", Expires: "next week"}}, now); err == nil {
+		t.Errorf("Expected error for invalid expiry")
+	}
+}
+
+func TestBlockedFindings(t *testing.T) {
+	findings := []registry.Finding{
+		{ID: "CVE-1", Severity: "LOW"},
+		{ID: "CVE-2", Severity: "UNKNOWN"},
+		{ID: "CVE-3", Severity: "Critical"},
+		{ID: "CVE-4", Severity: "SEVERE"},
+		{ID: "CVE-5", Severity: ""},
+		{ID: "CVE-6", Severity: "HIGH"},
+	}
+
+	var tests = []struct {
+		message      string
+		blockUnknown bool
+		expected     string
+	}{
+		{"unknown ignored", false, "CVE-3"},
+		{"unknown blocked", true, "CVE-3,CVE-2,CVE-4,CVE-5"},
+	}
+
+	for _, test := range tests {
+		blocked := BlockedFindings(findings, severities["HIGH"], test.blockUnknown, map[string]bool{"CVE-6": true})
+		var ids []string
+		for _, f := range blocked {
+			ids = append(ids, f.ID)
+		}
+		if strings.Join(ids, ",") != test.expected {
+			t.Errorf("%s: expected findings %s to be blocked, got %v", test.message, test.expected, ids)
+		}
+	}
+}
+
+func TestSummarizeFindings(t *testing.T) {
+	var findings []registry.Finding
+	for _, id := range []string{"CVE-1", "CVE-1", "CVE-2", "CVE-3", "CVE-4", "CVE-5", "CVE-6", "CVE-7", "CVE-8", "CVE-9", "CVE-10", "CVE-11"} {
+		findings = append(findings, registry.Finding{ID: id, Severity: "High"})
+	}
+	summary := SummarizeFindings(findings)
+	if !strings.HasPrefix(summary, "11 blocked vulnerabilities: CVE-1 (HIGH), CVE-2 (HIGH)") || !strings.HasSuffix(summary, "and 1 more") {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+}
+
+func TestScanVerifier(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "reports", Namespace: "default"},
+		Data:       map[string]string{"abc": grypeReport},
+	}
+	findings := []registry.Finding{
+		{ID: "CVE-2021-3711", Severity: "CRITICAL", Package: "openssl"},
+		{ID: "CVE-2020-28851", Severity: "MEDIUM", Package: "golang.org/x/text"},
+	}
+	future := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+
+	var tests = []struct {
+		message  string
+		registry *scanningRegistry
+		spec     cv1.VerifySpec
+		failure  string
+	}{
+		{"no findings", &scanningRegistry{}, cv1.VerifySpec{}, ""},
+		{"blocked finding", &scanningRegistry{findings: findings}, cv1.VerifySpec{},
+			"1 blocked vulnerabilities: CVE-2021-3711 (CRITICAL)"},
+		{"lower severity", &scanningRegistry{findings: findings}, cv1.VerifySpec{Severity: "MEDIUM"},
+			"2 blocked vulnerabilities: CVE-2021-3711 (CRITICAL), CVE-2020-28851 (MEDIUM)"},
+		{"allowed", &scanningRegistry{findings: findings}, cv1.VerifySpec{
+			Allowlist: []cv1.AllowedVulnerability{{ID: "CVE-2021-3711", Expires: future}},
+		}, ""},
+		{"allowance expired", &scanningRegistry{findings: findings}, cv1.VerifySpec{
+			Allowlist: []cv1.AllowedVulnerability{{ID: "CVE-2021-3711", Expires: "2021-01-01"}},
+		}, "CVE-2021-3711"},
+		{"config map report", &scanningRegistry{}, cv1.VerifySpec{
+			ReportFrom: &cv1.ReportSource{ConfigMap: &cv1.ConfigMapKeyRef{Name: "reports"}},
+		}, "1 blocked vulnerabilities: CVE-2021-3711 (CRITICAL)"},
+		{"missing config map report", &scanningRegistry{}, cv1.VerifySpec{
+			ReportFrom: &cv1.ReportSource{ConfigMap: &cv1.ConfigMapKeyRef{Name: "reports", Key: "other"}},
+		}, "config map reports has no vulnerability report other"},
+		{"artifact report", &scanningRegistry{report: trivyReport}, cv1.VerifySpec{
+			ReportFrom: &cv1.ReportSource{Artifact: true},
+		}, "2 blocked vulnerabilities: CVE-2021-3711 (CRITICAL), CVE-2021-3712 (HIGH)"},
+		{"missing artifact report", &scanningRegistry{}, cv1.VerifySpec{
+			ReportFrom: &cv1.ReportSource{Artifact: true},
+		}, "has no vulnerability report sha256-0123456789abcdef.scan"},
+	}
+
+	for _, test := range tests {
+		test.spec.Kind = KindScan
+		next := state.StateFunc(func(ctx context.Context) (state.States, error) { return state.None() })
+		sv := NewScanVerifier(fake.NewSimpleClientset(cm), test.registry, "default", "nearmap/app", "abc", test.spec, next)
+
+		states, err := sv.Do(context.Background())
+		if test.failure == "" {
+			if err != nil || len(states.States) != 1 {
+				t.Errorf("%s: expected verification to pass, got %v", test.message, err)
+			}
+			continue
+		}
+		evf, ok := FailedVerifier(err)
+		if !ok || !state.IsPermanent(err) || !strings.Contains(evf.Error(), test.failure) {
+			t.Errorf("%s: expected permanent verification failure %q, got %v", test.message, test.failure, err)
+		}
+	}
+}
+
+func TestScanVerifierPending(t *testing.T) {
+	sv := NewScanVerifier(fake.NewSimpleClientset(), &scanningRegistry{pending: true}, "default", "nearmap/app", "abc",
+		cv1.VerifySpec{Kind: KindScan}, nil)
+
+	for i := 1; i < maxScanPolls; i++ {
+		states, err := sv.Do(context.Background())
+		if err != nil || len(states.States) != 1 {
+			t.Fatalf("Expected verifier to wait for scan, got %v", err)
+		}
+		if _, ok := states.States[0].(*state.AfterState); !ok {
+			t.Fatalf("Expected verifier to wait for scan, got %T", states.States[0])
+		}
+	}
+	if _, err := sv.Do(context.Background()); !strings.Contains(err.Error(), "did not complete") {
+		t.Errorf("Expected verification failure after waiting for scan, got %v", err)
+	}
+}
+
+func TestScanVerifierConfig(t *testing.T) {
+	var tests = []struct {
+		message string
+		spec    cv1.VerifySpec
+	}{
+		{"invalid severity", cv1.VerifySpec{Severity: "SEVERE"}},
+		{"invalid allowlist", cv1.VerifySpec{Allowlist: []cv1.AllowedVulnerability{{Expires: "2021-01-01"}}}},
+		{"config map and artifact", cv1.VerifySpec{
+			ReportFrom: &cv1.ReportSource{ConfigMap: &cv1.ConfigMapKeyRef{Name: "reports"}, Artifact: true},
+		}},
+	}
+
+	for _, test := range tests {
+		test.spec.Kind = KindScan
+		sv := NewScanVerifier(fake.NewSimpleClientset(), &scanningRegistry{}, "default", "nearmap/app", "abc", test.spec, nil)
+		if _, err := sv.Do(context.Background()); err == nil || !state.IsPermanent(err) {
+			t.Errorf("%s: expected permanent error, got %v", test.message, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package verify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/stats"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KindSignature represents the Signature Verifier kind.
+	KindSignature = "Signature"
+)
+
+// SignatureVerifier is a Verifier implementation that verifies the cosign signatures of
+// the image being rolled out. Signatures are verified offline against public keys, so
+// no transparency log is required.
+type SignatureVerifier struct {
+	cs               kubernetes.Interface
+	registryProvider registry.Provider
+	namespace        string
+	imageRepo        string
+	version          string
+	spec             cv1.VerifySpec
+	next             state.State
+}
+
+// NewSignatureVerifier returns a verifier that checks that the image of the given repository
+// and version has a signature of one of the public keys of the spec, stored as a cosign
+// signature artifact in the repository.
+func NewSignatureVerifier(cs kubernetes.Interface, registryProvider registry.Provider, namespace, imageRepo, version string,
+	spec cv1.VerifySpec, next state.State) *SignatureVerifier {
+
+	return &SignatureVerifier{
+		cs:               cs,
+		registryProvider: registryProvider,
+		namespace:        namespace,
+		imageRepo:        imageRepo,
+		version:          version,
+		spec:             spec,
+		next:             next,
+	}
+}
+
+// Do implements the State interface.
+func (sv *SignatureVerifier) Do(ctx context.Context) (state.States, error) {
+	start := time.Now()
+
+	keys, err := sv.keys()
+	if err != nil {
+		return state.Error(errors.WithStack(err))
+	}
+
+	reg, err := sv.registryProvider.RegistryFor(sv.imageRepo)
+	if err != nil {
+		return state.Error(errors.Wrapf(err, "failed to get registry for %s", sv.imageRepo))
+	}
+	digester, ok := reg.(registry.Digester)
+	if !ok {
+		return state.Error(state.NewFailed("registry of %s does not support digests", sv.imageRepo))
+	}
+	fetcher, ok := reg.(registry.SignatureFetcher)
+	if !ok {
+		return state.Error(state.NewFailed("registry of %s does not support signatures", sv.imageRepo))
+	}
+
+	digest, err := digester.Digest(ctx, sv.version)
+	if err != nil {
+		return state.Error(errors.Wrapf(err, "failed to get digest of version %s", sv.version))
+	}
+	signatures, err := fetcher.Signatures(ctx, digest)
+	if err != nil {
+		return state.Error(errors.Wrapf(err, "failed to get signatures of %s@%s", sv.imageRepo, digest))
+	}
+
+	if err := VerifySignatures(signatures, digest, keys); err != nil {
+		sv.durationStats(ctx, start, "failed")
+		return state.Error(NewVerifierFailed(sv.spec, "image %s:%s (%s) failed signature verification: %v",
+			sv.imageRepo, sv.version, digest, err))
+	}
+
+	glog.V(2).Infof("Verified signature of image %s:%s (%s)", sv.imageRepo, sv.version, digest)
+	state.SetData(ctx, verifiedDigestKey(sv.imageRepo), digest)
+	sv.durationStats(ctx, start, "passed")
+	return state.Single(sv.next)
+}
+
+// verifiedDigestKey returns the key of the checkpoint data holding the digest of the
+// image of the given repository whose signature was verified.
+func verifiedDigestKey(imageRepo string) string {
+	return "verifiedDigest:" + imageRepo
+}
+
+// CheckVerifiedDigest returns a permanent verifier failure if the given version of the
+// image repository no longer resolves to the digest whose signature was verified by the
+// operation of the context, such as when the tag was pushed again after verification.
+// Nothing is checked if no signature was verified.
+func CheckVerifiedDigest(ctx context.Context, registryProvider registry.Provider, imageRepo, version string,
+	cvvs []cv1.VerifySpec) error {
+
+	verified := state.Data(ctx, verifiedDigestKey(imageRepo))
+	if verified == "" {
+		return nil
+	}
+
+	reg, err := registryProvider.RegistryFor(imageRepo)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get registry for %s", imageRepo)
+	}
+	digester, ok := reg.(registry.Digester)
+	if !ok {
+		return state.NewFailed("registry of %s does not support digests", imageRepo)
+	}
+	digest, err := digester.Digest(ctx, version)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get digest of version %s", version)
+	}
+	if digest == verified {
+		return nil
+	}
+
+	spec := cv1.VerifySpec{Kind: KindSignature}
+	for _, cvv := range cvvs {
+		if cvv.Kind == KindSignature {
+			spec = cvv
+			break
+		}
+	}
+	return NewVerifierFailed(spec, "image %s:%s changed from the verified %s to %s", imageRepo, version, verified, digest)
+}
+
+// keys returns the public keys of the spec.
+func (sv *SignatureVerifier) keys() ([]crypto.PublicKey, error) {
+	src := sv.spec.KeysFrom
+	if src == nil || (src.Secret == nil) == (src.ConfigMap == nil) {
+		return nil, state.NewFailed("signature verifier requires keys from either a secret or a config map")
+	}
+
+	var data []byte
+	if ref := src.Secret; ref != nil {
+		secret, err := sv.cs.CoreV1().Secrets(sv.namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get secret %s", ref.Name)
+		}
+		var ok bool
+		if data, ok = secret.Data[ref.Key]; !ok {
+			return nil, state.NewFailed("secret %s has no key %s", ref.Name, ref.Key)
+		}
+	} else {
+		ref := src.ConfigMap
+		cm, err := sv.cs.CoreV1().ConfigMaps(sv.namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get config map %s", ref.Name)
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok {
+			return nil, state.NewFailed("config map %s has no key %s", ref.Name, ref.Key)
+		}
+		data = []byte(value)
+	}
+
+	keys, err := ParsePublicKeys(data)
+	if err != nil {
+		return nil, state.NewFailed("invalid public keys for signature verifier: %v", err)
+	}
+	return keys, nil
+}
+
+// durationStats generates stats for the duration of the signature verification.
+func (sv *SignatureVerifier) durationStats(ctx context.Context, start time.Time, result string) {
+	st := stats.FromContext(ctx)
+	if st == nil {
+		return
+	}
+	st.Timing("verification_duration", time.Since(start), "kind:"+KindSignature, "result:"+result)
+}
+
+// ParsePublicKeys returns the ECDSA and RSA public keys of the given PEM encoded data.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key")
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, errors.Errorf("unsupported public key type %T", key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+// VerifySignatures returns nil if one of the given signatures is a valid signature of one
+// of the keys for a payload that identifies the image with the given digest.
+func VerifySignatures(signatures []registry.Signature, digest string, keys []crypto.PublicKey) error {
+	if len(signatures) == 0 {
+		return errors.New("image is not signed")
+	}
+
+	var err error
+	for _, sig := range signatures {
+		if err = verifySignature(sig, digest, keys); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifySignature verifies the given signature and its payload.
+func verifySignature(sig registry.Signature, digest string, keys []crypto.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return errors.Wrap(err, "signature is not base64 encoded")
+	}
+
+	hash := sha256.Sum256(sig.Payload)
+	verified := false
+	for _, key := range keys {
+		if verifyHash(key, hash[:], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return errors.New("no signature matches a trusted key")
+	}
+
+	var payload struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(sig.Payload, &payload); err != nil {
+		return errors.Wrap(err, "failed to parse signed payload")
+	}
+	if payload.Critical.Image.Digest != digest {
+		return errors.Errorf("signature is for image %s", payload.Critical.Image.Digest)
+	}
+	return nil
+}
+
+// verifyHash returns true if the signature is a valid signature of the hash by the key.
+func verifyHash(key crypto.PublicKey, hash, signature []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var rs struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &rs); err != nil || len(rest) > 0 {
+			return false
+		}
+		return ecdsa.Verify(k, hash, rs.R, rs.S)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
+	"github.com/nearmap/cvmanager/registry"
+	"github.com/nearmap/cvmanager/state"
+	"github.com/nearmap/cvmanager/state/statetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const digest = "sha256:0123456789abcdef"
+
+// signingRegistry is a registry with the given signatures of the image of each version.
+// Once repushed, versions resolve to an unsigned image.
+type signingRegistry struct {
+	signatures []registry.Signature
+	repushed   bool
+}
+
+func (sr *signingRegistry) RegistryFor(imageRepo string) (registry.Registry, error) {
+	return sr, nil
+}
+
+func (sr *signingRegistry) Version(ctx context.Context, tag string) (string, error) {
+	return tag, nil
+}
+
+func (sr *signingRegistry) Digest(ctx context.Context, version string) (string, error) {
+	if sr.repushed {
+		return "sha256:repushed", nil
+	}
+	return digest, nil
+}
+
+func (sr *signingRegistry) Signatures(ctx context.Context, d string) ([]registry.Signature, error) {
+	if d != digest {
+		return nil, nil
+	}
+	return sr.signatures, nil
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, d string) registry.Signature {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"nearmap/app"},`+
+		`"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, d))
+	hash := sha256.Sum256(payload)
+	sig, err := key.Sign(rand.Reader, hash[:], nil)
+	if err != nil {
+		t.Fatalf("Failed to sign payload: %v", err)
+	}
+	return registry.Signature{Payload: payload, Signature: base64.StdEncoding.EncodeToString(sig)}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	key, public := newKey(t)
+	other, otherPublic := newKey(t)
+	untrusted, _ := newKey(t)
+
+	spec := cv1.VerifySpec{
+		Kind:     KindSignature,
+		KeysFrom: &cv1.KeysSource{Secret: &cv1.SecretKeyRef{Name: "cosign", Key: "cosign.pub"}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cosign", Namespace: "default"},
+		Data:       map[string][]byte{"cosign.pub": append(otherPublic, public...)},
+	}
+
+	tampered := sign(t, key, digest)
+	tampered.Payload = []byte(strings.Replace(string(tampered.Payload), "nearmap/app", "nearmap/other", 1))
+
+	var tests = []struct {
+		message    string
+		signatures []registry.Signature
+		failure    string
+	}{
+		{"signed", []registry.Signature{sign(t, key, digest)}, ""},
+		{"signed by one of several keys", []registry.Signature{sign(t, other, digest)}, ""},
+		{"one valid signature", []registry.Signature{sign(t, key, "sha256:other"), sign(t, key, digest)}, ""},
+		{"unsigned", nil, "image is not signed"},
+		{"other image", []registry.Signature{sign(t, key, "sha256:other")}, "signature is for image sha256:other"},
+		{"tampered payload", []registry.Signature{tampered}, "no signature matches a trusted key"},
+		{"untrusted key", []registry.Signature{sign(t, untrusted, digest)}, "no signature matches a trusted key"},
+	}
+
+	for _, test := range tests {
+		next := state.StateFunc(func(ctx context.Context) (state.States, error) { return state.None() })
+		sv := NewSignatureVerifier(fake.NewSimpleClientset(secret), &signingRegistry{signatures: test.signatures},
+			"default", "nearmap/app", "abc", spec, next)
+
+		states, err := sv.Do(context.Background())
+		if test.failure == "" {
+			if err != nil || len(states.States) != 1 {
+				t.Errorf("%s: expected verification to pass, got %v", test.message, err)
+			}
+			continue
+		}
+		evf, ok := FailedVerifier(err)
+		if !ok || !state.IsPermanent(err) || !strings.Contains(evf.Error(), test.failure) {
+			t.Errorf("%s: expected permanent verification failure %q, got %v", test.message, test.failure, err)
+		}
+	}
+}
+
+func TestCheckVerifiedDigest(t *testing.T) {
+	key, public := newKey(t)
+	spec := cv1.VerifySpec{
+		Kind:     KindSignature,
+		KeysFrom: &cv1.KeysSource{Secret: &cv1.SecretKeyRef{Name: "cosign", Key: "cosign.pub"}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cosign", Namespace: "default"},
+		Data:       map[string][]byte{"cosign.pub": public},
+	}
+
+	for _, repushed := range []bool{false, true} {
+		reg := &signingRegistry{signatures: []registry.Signature{sign(t, key, digest)}}
+
+		var checkErr error
+		checked := state.StateFunc(func(ctx context.Context) (state.States, error) {
+			checkErr = CheckVerifiedDigest(ctx, reg, "nearmap/app", "abc", []cv1.VerifySpec{spec})
+			return state.None()
+		})
+		push := state.StateFunc(func(ctx context.Context) (state.States, error) {
+			reg.repushed = repushed
+			return state.Single(checked)
+		})
+		sv := NewSignatureVerifier(fake.NewSimpleClientset(secret), reg, "default", "nearmap/app", "abc", spec, push)
+
+		if err := statetest.New(sv).RunOperation(10); err != nil {
+			t.Fatalf("Failed to run verification: %v", err)
+		}
+		if !repushed {
+			if checkErr != nil {
+				t.Errorf("Expected the verified image to pass the digest check, got %v", checkErr)
+			}
+			continue
+		}
+		evf, ok := FailedVerifier(checkErr)
+		if !ok || !state.IsPermanent(checkErr) || !strings.Contains(evf.Error(), "changed from the verified "+digest) {
+			t.Errorf("Expected permanent verification failure of a repushed image, got %v", checkErr)
+		}
+	}
+}
+
+func TestSignatureVerifierKeys(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "keys", Namespace: "default"},
+		Data:       map[string]string{"cosign.pub": "not a key"},
+	}
+	var tests = []struct {
+		message string
+		keys    *cv1.KeysSource
+	}{
+		{"no keys", nil},
+		{"secret and config map", &cv1.KeysSource{
+			Secret:    &cv1.SecretKeyRef{Name: "keys", Key: "cosign.pub"},
+			ConfigMap: &cv1.ConfigMapKeyRef{Name: "keys", Key: "cosign.pub"},
+		}},
+		{"missing key", &cv1.KeysSource{ConfigMap: &cv1.ConfigMapKeyRef{Name: "keys", Key: "missing"}}},
+		{"invalid keys", &cv1.KeysSource{ConfigMap: &cv1.ConfigMapKeyRef{Name: "keys", Key: "cosign.pub"}}},
+	}
+
+	for _, test := range tests {
+		spec := cv1.VerifySpec{Kind: KindSignature, KeysFrom: test.keys}
+		sv := NewSignatureVerifier(fake.NewSimpleClientset(cm), &signingRegistry{}, "default", "nearmap/app", "abc", spec, nil)
+		if _, err := sv.Do(context.Background()); err == nil || !state.IsPermanent(err) {
+			t.Errorf("%s: expected permanent error, got %v", test.message, err)
+		}
+	}
+}
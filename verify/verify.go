@@ -2,6 +2,7 @@ package verify
 
 import (
 	"context"
+	"fmt"
 
 	cv1 "github.com/nearmap/cvmanager/gok8s/apis/custom/v1"
 	"github.com/nearmap/cvmanager/registry"
@@ -14,14 +15,53 @@ var (
 	ErrFailed = state.NewFailed("Verification failed")
 )
 
-// NewVerifier returns a state instance that implements a verifier, as defined in the verify spec.
-func NewVerifier(cs kubernetes.Interface, registryProvider registry.Provider, namespace, version string,
+// ErrorVerifierFailed is a permanent error indicating that the verifier with the given spec failed.
+type ErrorVerifierFailed struct {
+	Spec cv1.VerifySpec
+
+	message string
+}
+
+// NewVerifierFailed returns an ErrorVerifierFailed for the verifier with the given spec.
+func NewVerifierFailed(spec cv1.VerifySpec, message string, args ...interface{}) *ErrorVerifierFailed {
+	return &ErrorVerifierFailed{
+		Spec:    spec,
+		message: fmt.Sprintf(message, args...),
+	}
+}
+
+// Error implements the error interface.
+func (evf *ErrorVerifierFailed) Error() string {
+	return fmt.Sprintf("%s: %s", ErrFailed.Error(), evf.message)
+}
+
+// Cause implements the errors.Cause interface.
+func (evf *ErrorVerifierFailed) Cause() error {
+	return ErrFailed
+}
+
+// FailedVerifier returns the ErrorVerifierFailed in the cause chain of the given error, if any.
+func FailedVerifier(err error) (*ErrorVerifierFailed, bool) {
+	evf, ok := state.FindCause(err, func(err error) bool {
+		_, ok := err.(*ErrorVerifierFailed)
+		return ok
+	}).(*ErrorVerifierFailed)
+	return evf, ok
+}
+
+// NewVerifier returns a state instance that implements a verifier, as defined in the verify spec,
+// for the rollout of the given version of the image repository.
+func NewVerifier(cs kubernetes.Interface, registryProvider registry.Provider, namespace, imageRepo, version string,
 	spec cv1.VerifySpec, next state.State) (state.States, error) {
 
 	var verifier state.State
 	switch spec.Kind {
 	case KindImage:
 		verifier = NewImageVerifier(cs, registryProvider, namespace, spec, next)
+	case KindSignature:
+		verifier = NewSignatureVerifier(cs, registryProvider, namespace, imageRepo, version, spec, next)
+	case KindScan:
+		verifier = NewScanVerifier(cs, registryProvider, namespace, imageRepo, version, spec, next)
 	default:
 		return state.Error(state.NewFailed("unknown verify type: %v", spec.Kind))
 	}
@@ -30,13 +70,13 @@ func NewVerifier(cs kubernetes.Interface, registryProvider registry.Provider, na
 }
 
 // NewVerifiers returns a state function that invokes verify operations for the given verify specs.
-func NewVerifiers(cs kubernetes.Interface, registryProvider registry.Provider, namespace, version string,
+func NewVerifiers(cs kubernetes.Interface, registryProvider registry.Provider, namespace, imageRepo, version string,
 	cvvs []cv1.VerifySpec, next state.State) state.StateFunc {
 
-	return newVerifiers(cs, registryProvider, namespace, version, cvvs, next, 0)
+	return newVerifiers(cs, registryProvider, namespace, imageRepo, version, cvvs, next, 0)
 }
 
-func newVerifiers(cs kubernetes.Interface, registryProvider registry.Provider, namespace, version string,
+func newVerifiers(cs kubernetes.Interface, registryProvider registry.Provider, namespace, imageRepo, version string,
 	cvvs []cv1.VerifySpec, next state.State, idx int) state.StateFunc {
 
 	return func(ctx context.Context) (state.States, error) {
@@ -44,7 +84,7 @@ func newVerifiers(cs kubernetes.Interface, registryProvider registry.Provider, n
 			return state.Single(next)
 		}
 
-		return NewVerifier(cs, registryProvider, namespace, version, cvvs[idx],
-			newVerifiers(cs, registryProvider, namespace, version, cvvs, next, idx+1))
+		return NewVerifier(cs, registryProvider, namespace, imageRepo, version, cvvs[idx],
+			newVerifiers(cs, registryProvider, namespace, imageRepo, version, cvvs, next, idx+1))
 	}
 }